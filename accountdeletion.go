@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/drewheasman/chirpy/internal/audit"
+	"github.com/drewheasman/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	accountDeletionInterval = time.Hour
+	accountDeletionWorker   = "account_deletion"
+
+	errorCodeAccountPendingDeletion = "account_pending_deletion"
+)
+
+// deleteMeHandler schedules the caller's account for deletion once the grace
+// period is over. Every session ends now, and logging in again before the
+// deadline cancels the deletion.
+func (cfg *apiConfig) deleteMeHandler(w http.ResponseWriter, req *http.Request) {
+	type deleteMeRequest struct {
+		Password string `json:"password"`
+	}
+
+	userId := requestPrincipal(req).UserID
+
+	decoder := json.NewDecoder(req.Body)
+	var decoded deleteMeRequest
+	if err := decoder.Decode(&decoded); err != nil || decoded.Password == "" {
+		respondWithError(w, http.StatusBadRequest, "error unmarshalling request body")
+		return
+	}
+
+	userRecord, err := cfg.store.GetUser(req.Context(), userId)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "user not found")
+		return
+	}
+	if err := checkPasswordHash(req.Context(), decoded.Password, userRecord.HashedPassword); err != nil {
+		respondWithError(w, http.StatusUnauthorized, "incorrect password")
+		return
+	}
+
+	deleteAt, err := cfg.store.ScheduleUserDeletion(req.Context(), database.ScheduleUserDeletionParams{
+		ID:                  userId,
+		DeletionScheduledAt: sql.NullTime{Time: time.Now().Add(cfg.accountDeletionGrace), Valid: true},
+	})
+	if err != nil {
+		slog.ErrorContext(req.Context(), "error scheduling deletion", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "error scheduling deletion")
+		return
+	}
+	if err := cfg.store.RevokeAllSessionsForUser(req.Context(), userId); err != nil {
+		slog.ErrorContext(req.Context(), "error revoking sessions", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "error revoking sessions")
+		return
+	}
+
+	cfg.recordAudit(req.Context(), audit.Entry{
+		Action:       audit.ActionUserDeletionScheduled,
+		ActorID:      uuid.NullUUID{UUID: userId, Valid: true},
+		TargetUserID: uuid.NullUUID{UUID: userId, Valid: true},
+		Diff:         audit.Changed("deletion_scheduled_at", nil, deleteAt.Time),
+	})
+	slog.InfoContext(req.Context(), "account deletion scheduled")
+
+	type deleteMeResponse struct {
+		DeletionScheduledAt time.Time `json:"deletion_scheduled_at"`
+	}
+
+	respondWithJson(w, http.StatusAccepted, deleteMeResponse{DeletionScheduledAt: deleteAt.Time})
+}
+
+// respondAccountPendingDeletion rejects tokens that are still around for an
+// account that is about to be deleted. Logging in again cancels the deletion.
+func respondAccountPendingDeletion(w http.ResponseWriter, deleteAt time.Time) {
+	respondWithJson(w, http.StatusForbidden, accountErrorResponse{
+		Error: "account is scheduled for deletion at " + deleteAt.Format(time.RFC3339) + ", log in to cancel",
+		Code:  errorCodeAccountPendingDeletion,
+	})
+}
+
+// cancelAccountDeletion is called once a login has fully succeeded. Logging
+// in during the grace period means the user changed their mind.
+func (cfg *apiConfig) cancelAccountDeletion(ctx context.Context, userRecord database.User) {
+	if !userRecord.DeletionScheduledAt.Valid {
+		return
+	}
+
+	cancelled, err := cfg.store.CancelUserDeletion(ctx, userRecord.ID)
+	if err != nil {
+		slog.ErrorContext(ctx, "error cancelling account deletion", "error", err)
+		return
+	}
+	if cancelled == 1 {
+		cfg.recordAudit(ctx, audit.Entry{
+			Action:       audit.ActionUserDeletionCancelled,
+			ActorID:      uuid.NullUUID{UUID: userRecord.ID, Valid: true},
+			TargetUserID: uuid.NullUUID{UUID: userRecord.ID, Valid: true},
+			Diff:         audit.Changed("deletion_scheduled_at", userRecord.DeletionScheduledAt.Time, nil),
+		})
+		slog.InfoContext(ctx, "account deletion cancelled")
+	}
+}
+
+// deleteDueAccounts hard-deletes every account whose grace period is over.
+// Chirps, sessions and everything else the user owns go with it through ON
+// DELETE CASCADE. Only the user ID is kept, in the audit log.
+func (cfg *apiConfig) deleteDueAccounts(ctx context.Context) error {
+	now := sql.NullTime{Time: time.Now(), Valid: true}
+
+	// Data exports live partly outside the database, so they can't just cascade.
+	exportKeys, err := cfg.store.DeleteDataExportsForDueUsers(ctx, now)
+	if err != nil {
+		return err
+	}
+	cfg.deleteDataExportBlobs(ctx, exportKeys)
+
+	deleted, err := cfg.store.DeleteDueUsers(ctx, now)
+	if err != nil {
+		return err
+	}
+
+	for _, u := range deleted {
+		// Login throttling is keyed by email, so clear that out too.
+		if err := cfg.accountLimiter.Unlock(ctx, accountThrottleKey(u.Email)); err != nil {
+			slog.ErrorContext(ctx, "error clearing login throttle", "user_id", u.ID, "error", err)
+		}
+		cfg.recordAudit(ctx, audit.Entry{
+			Action:       audit.ActionUserDeleted,
+			TargetUserID: uuid.NullUUID{UUID: u.ID, Valid: true},
+		})
+	}
+	if len(deleted) > 0 {
+		slog.InfoContext(ctx, "deleted accounts", "count", len(deleted))
+	}
+
+	return nil
+}
+
+// RunAccountDeletion deletes due accounts every accountDeletionInterval until
+// ctx is cancelled. Deleting with DELETE ... RETURNING means several servers
+// can run it at once without deleting anyone twice.
+func (cfg *apiConfig) RunAccountDeletion(ctx context.Context) error {
+	ticker := time.NewTicker(accountDeletionInterval)
+	defer ticker.Stop()
+	cfg.workers.register(accountDeletionWorker, accountDeletionInterval)
+
+	for {
+		err := cfg.deleteDueAccounts(ctx)
+		if err != nil {
+			slog.ErrorContext(ctx, "error deleting accounts", "error", err)
+		}
+		cfg.workers.record(accountDeletionWorker, err)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
@@ -1,6 +1,13 @@
 package main
 
-import "net/http"
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/drewheasman/chirpy/internal/audit"
+	"github.com/google/uuid"
+)
 
 func getHealthzHandler(w http.ResponseWriter, _ *http.Request) {
 	w.Header().Add("Content-Type", "text/plain; charset=utf-8")
@@ -9,12 +16,56 @@ func getHealthzHandler(w http.ResponseWriter, _ *http.Request) {
 }
 
 func (cfg *apiConfig) resetHandler(w http.ResponseWriter, req *http.Request) {
-	cfg.fileserverHits.Store(0)
+	if err := cfg.metrics.ResetFileserverHits(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "failed to reset metrics")
+		return
+	}
 
-	err := cfg.dbQueries.DeleteAllUsers(req.Context())
+	err := cfg.store.DeleteAllUsers(req.Context())
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "failed to delete all users")
 	}
 
 	_, _ = w.Write([]byte("OK"))
 }
+
+// unlockHandler lifts a login lockout for an account and, optionally, an IP.
+func (cfg *apiConfig) unlockHandler(w http.ResponseWriter, req *http.Request) {
+	type unlockRequest struct {
+		Email string `json:"email"`
+		IP    string `json:"ip"`
+	}
+
+	decoder := json.NewDecoder(req.Body)
+	var decoded unlockRequest
+	if err := decoder.Decode(&decoded); err != nil || (decoded.Email == "" && decoded.IP == "") {
+		respondWithError(w, http.StatusBadRequest, "email or ip is required")
+		return
+	}
+
+	if decoded.Email != "" {
+		if err := cfg.accountLimiter.Unlock(req.Context(), accountThrottleKey(decoded.Email)); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "failed to unlock account")
+			return
+		}
+	}
+	if decoded.IP != "" {
+		if err := cfg.ipLimiter.Unlock(req.Context(), ipThrottleKey(decoded.IP)); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "failed to unlock ip")
+			return
+		}
+	}
+
+	details := map[string]any{"ip": decoded.IP}
+	if decoded.Email != "" {
+		details["email_hash"] = cfg.auditLog.HashEmail(decoded.Email)
+	}
+	cfg.recordAudit(req.Context(), audit.Entry{
+		Action:  audit.ActionUserLoginUnlocked,
+		ActorID: uuid.NullUUID{UUID: requestPrincipal(req).UserID, Valid: true},
+		Details: details,
+	})
+	slog.InfoContext(req.Context(), "login lockout cleared")
+
+	respondNoContent(w, http.StatusNoContent)
+}
@@ -0,0 +1,425 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/drewheasman/chirpy/internal/audit"
+	"github.com/drewheasman/chirpy/internal/auth"
+	"github.com/drewheasman/chirpy/internal/database"
+	"github.com/drewheasman/chirpy/internal/store"
+	"github.com/google/uuid"
+)
+
+// These commands are for operators, so they act as nobody in particular and
+// their audit entries have no actor.
+
+const (
+	userUsage = `usage: chirpy user create [-role role] email < password
+       chirpy user promote [-role role] user
+       chirpy user suspend -reason text user
+
+A user is an email address or a user ID.`
+	tokenUsage  = "usage: chirpy token revoke-user user"
+	chirpsUsage = "usage: chirpy chirps purge -before date"
+)
+
+func runUserCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, userUsage)
+		return 2
+	}
+	switch args[0] {
+	case "create":
+		return runUserCreateCommand(args[1:], os.Stdin)
+	case "promote":
+		return runUserPromoteCommand(args[1:])
+	case "suspend":
+		return runUserSuspendCommand(args[1:])
+	}
+	fmt.Fprintln(os.Stderr, "unknown user command:", args[0])
+	fmt.Fprintln(os.Stderr, userUsage)
+	return 2
+}
+
+// parseCommandFlags parses args, which must leave exactly one argument.
+func parseCommandFlags(flags *flag.FlagSet, args []string, usage string) (string, bool) {
+	flags.SetOutput(io.Discard)
+	if err := flags.Parse(args); err != nil || flags.NArg() != 1 {
+		if err != nil && !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		fmt.Fprintln(os.Stderr, usage)
+		return "", false
+	}
+	return flags.Arg(0), true
+}
+
+// lookupUser finds a user by ID or email, whichever the operator has to hand.
+func (cfg *apiConfig) lookupUser(ctx context.Context, idOrEmail string) (database.User, error) {
+	var userRecord database.User
+	var err error
+	if id, parseErr := uuid.Parse(idOrEmail); parseErr == nil {
+		userRecord, err = cfg.store.GetUser(ctx, id)
+	} else {
+		userRecord, err = cfg.store.GetUserByEmail(ctx, idOrEmail)
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.User{}, fmt.Errorf("user %s not found", idOrEmail)
+	}
+	return userRecord, err
+}
+
+// runUserCreateCommand creates an account. The password is read from the
+// first line of stdin so that it stays out of the shell history.
+func runUserCreateCommand(args []string, stdin io.Reader) int {
+	flags := flag.NewFlagSet("user create", flag.ContinueOnError)
+	role := flags.String("role", auth.RoleUser, "user, moderator or admin")
+	email, ok := parseCommandFlags(flags, args, userUsage)
+	if !ok {
+		return 2
+	}
+	if !auth.ValidRole(*role) {
+		fmt.Fprintln(os.Stderr, "role must be one of user, moderator or admin")
+		return 2
+	}
+
+	password, err := bufio.NewReader(stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		fmt.Fprintln(os.Stderr, "error reading password:", err)
+		return 1
+	}
+	password = strings.TrimRight(password, "\r\n")
+	if password == "" {
+		fmt.Fprintln(os.Stderr, "a password is required on stdin")
+		return 2
+	}
+
+	cfg, err := newCommandConfig()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer cfg.db.Close()
+
+	userRecord, err := cfg.createUser(context.Background(), email, password, *role)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Printf("created %s %s with role %s\n", userRecord.Email, userRecord.ID, *role)
+	return 0
+}
+
+func (cfg *apiConfig) createUser(ctx context.Context, email, password, role string) (database.CreateUserRow, error) {
+	hashedPassword, err := hashPassword(ctx, password)
+	if err != nil {
+		return database.CreateUserRow{}, err
+	}
+	userRecord, err := cfg.store.CreateUser(ctx, database.CreateUserParams{
+		Email:          email,
+		HashedPassword: hashedPassword,
+	})
+	if errors.Is(err, store.ErrEmailTaken) {
+		return database.CreateUserRow{}, fmt.Errorf("a user with email %s already exists", email)
+	}
+	if err != nil {
+		return database.CreateUserRow{}, fmt.Errorf("error creating user: %w", err)
+	}
+	if role != auth.RoleUser {
+		if _, err := cfg.store.SetUserRole(ctx, database.SetUserRoleParams{ID: userRecord.ID, Role: role}); err != nil {
+			return database.CreateUserRow{}, fmt.Errorf("error setting role: %w", err)
+		}
+	}
+
+	cfg.recordAudit(ctx, audit.Entry{
+		Action:       audit.ActionUserCreated,
+		TargetUserID: uuid.NullUUID{UUID: userRecord.ID, Valid: true},
+		Details:      map[string]any{"role": role},
+	})
+	return userRecord, nil
+}
+
+func runUserPromoteCommand(args []string) int {
+	flags := flag.NewFlagSet("user promote", flag.ContinueOnError)
+	role := flags.String("role", auth.RoleAdmin, "role to give the user: user, moderator or admin")
+	idOrEmail, ok := parseCommandFlags(flags, args, userUsage)
+	if !ok {
+		return 2
+	}
+	if !auth.ValidRole(*role) {
+		fmt.Fprintln(os.Stderr, "role must be one of user, moderator or admin")
+		return 2
+	}
+
+	cfg, err := newCommandConfig()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer cfg.db.Close()
+
+	ctx := context.Background()
+	userRecord, err := cfg.lookupUser(ctx, idOrEmail)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if _, err := cfg.store.SetUserRole(ctx, database.SetUserRoleParams{ID: userRecord.ID, Role: *role}); err != nil {
+		fmt.Fprintln(os.Stderr, "error updating role:", err)
+		return 1
+	}
+
+	cfg.recordAudit(ctx, audit.Entry{
+		Action:       audit.ActionUserRoleChanged,
+		TargetUserID: uuid.NullUUID{UUID: userRecord.ID, Valid: true},
+		Diff:         audit.Changed("role", userRecord.Role, *role),
+	})
+	fmt.Printf("%s is now %s, was %s\n", userRecord.Email, *role, userRecord.Role)
+	return 0
+}
+
+func runUserSuspendCommand(args []string) int {
+	flags := flag.NewFlagSet("user suspend", flag.ContinueOnError)
+	reason := flags.String("reason", "", "why the user is suspended, required")
+	idOrEmail, ok := parseCommandFlags(flags, args, userUsage)
+	if !ok {
+		return 2
+	}
+	if *reason == "" {
+		fmt.Fprintln(os.Stderr, "a reason is required")
+		return 2
+	}
+
+	cfg, err := newCommandConfig()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer cfg.db.Close()
+
+	ctx := context.Background()
+	userRecord, err := cfg.lookupUser(ctx, idOrEmail)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	_, err = cfg.store.SuspendUser(ctx, database.SuspendUserParams{
+		ID:               userRecord.ID,
+		SuspensionReason: sql.NullString{String: *reason, Valid: true},
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error suspending user:", err)
+		return 1
+	}
+	if err := cfg.store.RevokeAllSessionsForUser(ctx, userRecord.ID); err != nil {
+		fmt.Fprintln(os.Stderr, "error revoking sessions:", err)
+		return 1
+	}
+
+	cfg.recordAudit(ctx, audit.Entry{
+		Action:       audit.ActionUserSuspended,
+		TargetUserID: uuid.NullUUID{UUID: userRecord.ID, Valid: true},
+		Diff:         audit.Changed("suspended", userRecord.SuspendedAt.Valid, true),
+		Details:      map[string]any{"reason": *reason},
+	})
+	fmt.Printf("suspended %s and revoked their sessions\n", userRecord.Email)
+	return 0
+}
+
+// runTokenCommand revokes everything a user could authenticate with other
+// than their password: sessions, OAuth grants and personal access tokens.
+func runTokenCommand(args []string) int {
+	if len(args) == 0 || args[0] != "revoke-user" {
+		fmt.Fprintln(os.Stderr, tokenUsage)
+		return 2
+	}
+	idOrEmail, ok := parseCommandFlags(flag.NewFlagSet("token revoke-user", flag.ContinueOnError), args[1:], tokenUsage)
+	if !ok {
+		return 2
+	}
+
+	cfg, err := newCommandConfig()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer cfg.db.Close()
+
+	ctx := context.Background()
+	userRecord, err := cfg.lookupUser(ctx, idOrEmail)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := cfg.store.RevokeAllSessionsForUser(ctx, userRecord.ID); err != nil {
+		fmt.Fprintln(os.Stderr, "error revoking sessions:", err)
+		return 1
+	}
+	deleted, err := cfg.store.DeletePersonalAccessTokensForUser(ctx, userRecord.ID)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error deleting personal access tokens:", err)
+		return 1
+	}
+
+	cfg.recordAudit(ctx, audit.Entry{
+		Action:       audit.ActionUserSessionsRevoked,
+		TargetUserID: uuid.NullUUID{UUID: userRecord.ID, Valid: true},
+		Details:      map[string]any{"personal_access_tokens_deleted": deleted},
+	})
+	fmt.Printf("revoked every session of %s and deleted %d personal access tokens\n", userRecord.Email, deleted)
+	return 0
+}
+
+func runChirpsCommand(args []string) int {
+	if len(args) == 0 || args[0] != "purge" {
+		fmt.Fprintln(os.Stderr, chirpsUsage)
+		return 2
+	}
+
+	flags := flag.NewFlagSet("chirps purge", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	beforeValue := flags.String("before", "", "delete chirps created before this date or RFC 3339 time, required")
+	if err := flags.Parse(args[1:]); err != nil || flags.NArg() != 0 {
+		fmt.Fprintln(os.Stderr, chirpsUsage)
+		return 2
+	}
+	before, err := parsePurgeBefore(*beforeValue)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	cfg, err := newCommandConfig()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer cfg.db.Close()
+
+	ctx := context.Background()
+	deleted, err := cfg.store.DeleteChirpsBefore(ctx, before)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error purging chirps:", err)
+		return 1
+	}
+
+	cfg.recordAudit(ctx, audit.Entry{
+		Action:  audit.ActionChirpsPurged,
+		Details: map[string]any{"before": before, "deleted": deleted},
+	})
+	fmt.Printf("deleted %d chirps created before %s\n", deleted, before.Format(time.RFC3339))
+	return 0
+}
+
+// parsePurgeBefore accepts a date, meaning midnight UTC, or an RFC 3339
+// time.
+func parsePurgeBefore(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, errors.New("-before is required")
+	}
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("-before is %q, want a date such as 2024-01-31 or an RFC 3339 time", value)
+	}
+	return t, nil
+}
+
+var seedWords = strings.Fields(`the a my our this that chirp bird song morning evening coffee code
+	garden river cloud rain sun city train book friend weekend music idea dream walk
+	is was feels looks sounds seems really quite very always never today tomorrow`)
+
+// runSeedCommand fills a dev database with users and chirps to try things
+// out with. Every seeded user has the same password, since hashing one per
+// user would take most of the time.
+func runSeedCommand(args []string) int {
+	flags := flag.NewFlagSet("seed", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	users := flags.Int("users", 10, "number of users to create")
+	chirps := flags.Int("chirps", 100, "number of chirps to create, spread across the users")
+	password := flags.String("password", "password", "password of every seeded user")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 0 || *users < 1 || *chirps < 0 {
+		fmt.Fprintln(os.Stderr, "usage: chirpy seed [-users N] [-chirps M] [-password password]")
+		return 2
+	}
+
+	cfg, err := newCommandConfig()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer cfg.db.Close()
+
+	if cfg.platform != platformDev {
+		fmt.Fprintln(os.Stderr, "seed only runs when the platform is dev")
+		return 1
+	}
+
+	emails, err := cfg.seed(context.Background(), *users, *chirps, *password)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "seed failed, nothing was created:", err)
+		return 1
+	}
+	fmt.Printf("created %d users with password %q and %d chirps, for example %s\n", len(emails), *password, *chirps, emails[0])
+	return 0
+}
+
+func (cfg *apiConfig) seed(ctx context.Context, users, chirps int, password string) ([]string, error) {
+	hashedPassword, err := hashPassword(ctx, password)
+	if err != nil {
+		return nil, err
+	}
+
+	// A random part keeps the emails unique if seed runs more than once.
+	run := uuid.NewString()[:8]
+	emails := make([]string, 0, users)
+	err = cfg.store.InTx(ctx, func(tx store.Store) error {
+		userIDs := make([]uuid.UUID, 0, users)
+		for i := range users {
+			userRecord, err := tx.CreateUser(ctx, database.CreateUserParams{
+				Email:          fmt.Sprintf("seed-%s-%d@example.com", run, i+1),
+				HashedPassword: hashedPassword,
+			})
+			if err != nil {
+				return err
+			}
+			emails = append(emails, userRecord.Email)
+			userIDs = append(userIDs, userRecord.ID)
+		}
+
+		for range chirps {
+			_, err := tx.CreateChirp(ctx, database.CreateChirpParams{
+				Body:   seedChirpBody(),
+				UserID: userIDs[rand.IntN(len(userIDs))],
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return emails, nil
+}
+
+func seedChirpBody() string {
+	words := make([]string, 3+rand.IntN(10))
+	for i := range words {
+		words[i] = seedWords[rand.IntN(len(seedWords))]
+	}
+	return strings.Join(words, " ")
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/drewheasman/chirpy/internal/auth"
+	"github.com/google/uuid"
+)
+
+func TestParsePurgeBefore(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Time
+		wantErr bool
+	}{
+		{value: "2024-01-31", want: time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC)},
+		{value: "2024-01-31T12:30:00+02:00", want: time.Date(2024, 1, 31, 10, 30, 0, 0, time.UTC)},
+		{value: "", wantErr: true},
+		{value: "last week", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parsePurgeBefore(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parsePurgeBefore() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("parsePurgeBefore() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCommandsRejectBadArguments(t *testing.T) {
+	tests := []struct {
+		name string
+		run  func() int
+	}{
+		{"unknown user command", func() int { return runUserCommand([]string{"delete", "a@example.com"}) }},
+		{"create without a password", func() int {
+			return runUserCreateCommand([]string{"a@example.com"}, strings.NewReader(""))
+		}},
+		{"create with an unknown role", func() int {
+			return runUserCreateCommand([]string{"-role", "owner", "a@example.com"}, strings.NewReader("hunter2\n"))
+		}},
+		{"suspend without a reason", func() int { return runUserCommand([]string{"suspend", "a@example.com"}) }},
+		{"revoke without a user", func() int { return runTokenCommand([]string{"revoke-user"}) }},
+		{"purge without a date", func() int { return runChirpsCommand([]string{"purge"}) }},
+		{"seed with no users", func() int { return runSeedCommand([]string{"-users", "0"}) }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := tt.run(); code != 2 {
+				t.Errorf("exit code = %d, want 2", code)
+			}
+		})
+	}
+}
+
+func TestMigrateStatusWithoutServeSettings(t *testing.T) {
+	t.Setenv("DB_DRIVER", "sqlite")
+	t.Setenv("DB_URL", filepath.Join(t.TempDir(), "chirpy.db"))
+	t.Setenv("SERVER_SECRET", "test")
+	t.Setenv("POLKA_KEY", "")
+
+	if code := runMigrateCommand([]string{"status"}); code != 0 {
+		t.Fatalf("migrate status without POLKA_KEY: exit code = %d, want 0", code)
+	}
+}
+
+func TestCreateUserCommand(t *testing.T) {
+	dbURL := os.Getenv("CHIRPY_TEST_DB_URL")
+	if dbURL == "" {
+		t.Skip("CHIRPY_TEST_DB_URL is not set")
+	}
+	t.Setenv("DB_URL", dbURL)
+	t.Setenv("SERVER_SECRET", "test")
+
+	cfg, err := newCommandConfig()
+	if err != nil {
+		t.Fatalf("newCommandConfig() resulted in error: %v", err)
+	}
+	defer cfg.db.Close()
+
+	ctx := context.Background()
+	email := "cli-" + uuid.NewString() + "@example.com"
+	created, err := cfg.createUser(ctx, email, "hunter2", auth.RoleModerator)
+	if err != nil {
+		t.Fatalf("createUser() resulted in error: %v", err)
+	}
+	if _, err := cfg.createUser(ctx, email, "hunter2", auth.RoleUser); err == nil {
+		t.Error("createUser() with a taken email resulted in no error")
+	}
+
+	for _, idOrEmail := range []string{email, created.ID.String()} {
+		userRecord, err := cfg.lookupUser(ctx, idOrEmail)
+		if err != nil {
+			t.Fatalf("lookupUser(%s) resulted in error: %v", idOrEmail, err)
+		}
+		if userRecord.ID != created.ID || userRecord.Role != auth.RoleModerator {
+			t.Errorf("lookupUser(%s) = %s %s, want %s moderator", idOrEmail, userRecord.ID, userRecord.Role, created.ID)
+		}
+	}
+	if _, err := cfg.lookupUser(ctx, "nobody-"+email); err == nil {
+		t.Error("lookupUser() of a missing user resulted in no error")
+	}
+}
@@ -0,0 +1,376 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/drewheasman/chirpy/internal/audit"
+	"github.com/drewheasman/chirpy/internal/auth"
+	"github.com/drewheasman/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	adminUsersDefaultLimit = 50
+	adminUsersMaxLimit     = 200
+)
+
+type AdminUser struct {
+	ID                    uuid.UUID  `json:"id"`
+	CreatedAt             time.Time  `json:"created_at"`
+	UpdatedAt             time.Time  `json:"updated_at"`
+	Email                 string     `json:"email"`
+	IsChirpyRed           bool       `json:"is_chirpy_red"`
+	Role                  string     `json:"role"`
+	SuspendedAt           *time.Time `json:"suspended_at"`
+	SuspensionReason      string     `json:"suspension_reason,omitempty"`
+	TotpEnabled           bool       `json:"totp_enabled"`
+	PasswordResetRequired bool       `json:"password_reset_required"`
+	ShadowBanned          bool       `json:"shadow_banned"`
+	DeletionScheduledAt   *time.Time `json:"deletion_scheduled_at,omitempty"`
+	ChirpCount            int64      `json:"chirp_count"`
+	SessionCount          int64      `json:"session_count"`
+}
+
+type adminUserList struct {
+	Users  []AdminUser `json:"users"`
+	Total  int64       `json:"total"`
+	Limit  int         `json:"limit"`
+	Offset int         `json:"offset"`
+}
+
+// parseDateParam accepts a full RFC 3339 timestamp or a plain date.
+func parseDateParam(value string) (sql.NullTime, error) {
+	if value == "" {
+		return sql.NullTime{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return sql.NullTime{Time: t.UTC(), Valid: true}, nil
+	}
+	t, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return sql.NullTime{}, err
+	}
+	return sql.NullTime{Time: t, Valid: true}, nil
+}
+
+// listUsersHandler searches users by email substring, plan ("red" or
+// "free") and creation date, newest first.
+func (cfg *apiConfig) listUsersHandler(w http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+
+	limit := adminUsersDefaultLimit
+	if value := query.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > adminUsersMaxLimit {
+			respondWithError(w, http.StatusBadRequest, "limit must be between 1 and "+strconv.Itoa(adminUsersMaxLimit))
+			return
+		}
+		limit = parsed
+	}
+	offset := 0
+	if value := query.Get("offset"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			respondWithError(w, http.StatusBadRequest, "offset must not be negative")
+			return
+		}
+		offset = parsed
+	}
+
+	var isChirpyRed sql.NullBool
+	switch query.Get("plan") {
+	case "":
+	case "red":
+		isChirpyRed = sql.NullBool{Bool: true, Valid: true}
+	case "free":
+		isChirpyRed = sql.NullBool{Bool: false, Valid: true}
+	default:
+		respondWithError(w, http.StatusBadRequest, "plan must be red or free")
+		return
+	}
+
+	createdAfter, err := parseDateParam(query.Get("created_after"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "created_after must be a date or RFC 3339 timestamp")
+		return
+	}
+	createdBefore, err := parseDateParam(query.Get("created_before"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "created_before must be a date or RFC 3339 timestamp")
+		return
+	}
+
+	email := sql.NullString{String: query.Get("email"), Valid: query.Get("email") != ""}
+
+	userRecords, err := cfg.store.ListUsers(req.Context(), database.ListUsersParams{
+		Email:         email,
+		IsChirpyRed:   isChirpyRed,
+		CreatedAfter:  createdAfter,
+		CreatedBefore: createdBefore,
+		MaxResults:    int32(limit),
+		SkipResults:   int32(offset),
+	})
+	if err != nil {
+		slog.ErrorContext(req.Context(), "error listing users", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "error listing users")
+		return
+	}
+	total, err := cfg.store.CountUsers(req.Context(), database.CountUsersParams{
+		Email:         email,
+		IsChirpyRed:   isChirpyRed,
+		CreatedAfter:  createdAfter,
+		CreatedBefore: createdBefore,
+	})
+	if err != nil {
+		slog.ErrorContext(req.Context(), "error counting users", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "error counting users")
+		return
+	}
+
+	usersResponse := adminUserList{
+		Users:  []AdminUser{},
+		Total:  total,
+		Limit:  limit,
+		Offset: offset,
+	}
+	for _, u := range userRecords {
+		usersResponse.Users = append(usersResponse.Users, AdminUser{
+			ID:          u.ID,
+			CreatedAt:   u.CreatedAt,
+			UpdatedAt:   u.UpdatedAt,
+			Email:       u.Email,
+			IsChirpyRed: u.IsChirpyRed,
+			Role:        u.Role,
+			SuspendedAt: nullTimePtr(u.SuspendedAt),
+		})
+	}
+
+	respondWithJson(w, http.StatusOK, usersResponse)
+}
+
+func (cfg *apiConfig) getAdminUserHandler(w http.ResponseWriter, req *http.Request) {
+	userId, err := uuid.Parse(req.PathValue("id"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "error parsing uuid from given id path param")
+		return
+	}
+
+	userRecord, err := cfg.store.GetUser(req.Context(), userId)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "user not found")
+		return
+	}
+	counts, err := cfg.store.GetUserActivityCounts(req.Context(), userId)
+	if err != nil {
+		slog.ErrorContext(req.Context(), "error counting user activity", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "error counting user activity")
+		return
+	}
+
+	respondWithJson(w, http.StatusOK, AdminUser{
+		ID:                    userRecord.ID,
+		CreatedAt:             userRecord.CreatedAt,
+		UpdatedAt:             userRecord.UpdatedAt,
+		Email:                 userRecord.Email,
+		IsChirpyRed:           userRecord.IsChirpyRed,
+		Role:                  userRecord.Role,
+		SuspendedAt:           nullTimePtr(userRecord.SuspendedAt),
+		SuspensionReason:      userRecord.SuspensionReason.String,
+		TotpEnabled:           userRecord.TotpEnabled,
+		PasswordResetRequired: userRecord.PasswordResetRequired,
+		ShadowBanned:          userRecord.ShadowBanned,
+		DeletionScheduledAt:   nullTimePtr(userRecord.DeletionScheduledAt),
+		ChirpCount:            counts.ChirpCount,
+		SessionCount:          counts.SessionCount,
+	})
+}
+
+// manageableUser loads the target of a staff action, responding with an
+// error if there isn't one. Staff can't act on themselves, and only admins
+// can act on other staff.
+func (cfg *apiConfig) manageableUser(w http.ResponseWriter, req *http.Request) (database.User, bool) {
+	userId, err := uuid.Parse(req.PathValue("id"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "error parsing uuid from given id path param")
+		return database.User{}, false
+	}
+
+	actorID := requestPrincipal(req).UserID
+	if userId == actorID {
+		respondWithError(w, http.StatusConflict, "staff can't manage their own account here")
+		return database.User{}, false
+	}
+
+	target, err := cfg.store.GetUser(req.Context(), userId)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "user not found")
+		return database.User{}, false
+	}
+	if target.Role != auth.RoleUser {
+		actor, err := cfg.store.GetUser(req.Context(), actorID)
+		if err != nil || actor.Role != auth.RoleAdmin {
+			respondWithError(w, http.StatusForbidden, "only admins can manage staff accounts")
+			return database.User{}, false
+		}
+	}
+
+	return target, true
+}
+
+func (cfg *apiConfig) suspendUserHandler(w http.ResponseWriter, req *http.Request) {
+	type suspendRequest struct {
+		Reason string `json:"reason"`
+	}
+
+	decoder := json.NewDecoder(req.Body)
+	var decoded suspendRequest
+	if err := decoder.Decode(&decoded); err != nil || decoded.Reason == "" {
+		respondWithError(w, http.StatusBadRequest, "a reason is required")
+		return
+	}
+
+	target, ok := cfg.manageableUser(w, req)
+	if !ok {
+		return
+	}
+
+	_, err := cfg.store.SuspendUser(req.Context(), database.SuspendUserParams{
+		ID:               target.ID,
+		SuspensionReason: sql.NullString{String: decoded.Reason, Valid: true},
+	})
+	if err != nil {
+		slog.ErrorContext(req.Context(), "error suspending user", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "error suspending user")
+		return
+	}
+	if err := cfg.store.RevokeAllSessionsForUser(req.Context(), target.ID); err != nil {
+		slog.ErrorContext(req.Context(), "error revoking sessions", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "error revoking sessions")
+		return
+	}
+
+	cfg.recordAdminAction(req, audit.ActionUserSuspended, target.ID, audit.Changed("suspended", false, true), map[string]any{
+		"reason": decoded.Reason,
+	})
+	slog.InfoContext(req.Context(), "user suspended")
+
+	respondNoContent(w, http.StatusNoContent)
+}
+
+func (cfg *apiConfig) unsuspendUserHandler(w http.ResponseWriter, req *http.Request) {
+	target, ok := cfg.manageableUser(w, req)
+	if !ok {
+		return
+	}
+
+	if _, err := cfg.store.UnsuspendUser(req.Context(), target.ID); err != nil {
+		slog.ErrorContext(req.Context(), "error unsuspending user", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "error unsuspending user")
+		return
+	}
+
+	cfg.recordAdminAction(req, audit.ActionUserUnsuspended, target.ID, audit.Changed("suspended", true, false), map[string]any{
+		"previous_reason": target.SuspensionReason.String,
+	})
+	slog.InfoContext(req.Context(), "user unsuspended")
+
+	respondNoContent(w, http.StatusNoContent)
+}
+
+// forcePasswordResetHandler logs the user out everywhere and makes them
+// choose a new password the next time they log in.
+func (cfg *apiConfig) forcePasswordResetHandler(w http.ResponseWriter, req *http.Request) {
+	target, ok := cfg.manageableUser(w, req)
+	if !ok {
+		return
+	}
+
+	if _, err := cfg.store.RequirePasswordReset(req.Context(), target.ID); err != nil {
+		slog.ErrorContext(req.Context(), "error requiring password reset", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "error requiring password reset")
+		return
+	}
+	if err := cfg.store.RevokeAllSessionsForUser(req.Context(), target.ID); err != nil {
+		slog.ErrorContext(req.Context(), "error revoking sessions", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "error revoking sessions")
+		return
+	}
+
+	cfg.recordAdminAction(req, audit.ActionUserPasswordReset, target.ID, audit.Changed("password_reset_required", target.PasswordResetRequired, true), nil)
+	slog.InfoContext(req.Context(), "password reset required")
+
+	respondNoContent(w, http.StatusNoContent)
+}
+
+func (cfg *apiConfig) revokeUserSessionsHandler(w http.ResponseWriter, req *http.Request) {
+	target, ok := cfg.manageableUser(w, req)
+	if !ok {
+		return
+	}
+
+	if err := cfg.store.RevokeAllSessionsForUser(req.Context(), target.ID); err != nil {
+		slog.ErrorContext(req.Context(), "error revoking sessions", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "error revoking sessions")
+		return
+	}
+
+	cfg.recordAdminAction(req, audit.ActionUserSessionsRevoked, target.ID, nil, nil)
+	slog.InfoContext(req.Context(), "user sessions revoked")
+
+	respondNoContent(w, http.StatusNoContent)
+}
+
+// setChirpyRedHandler grants or removes Chirpy Red by hand, for refunds and
+// payments Polka never told us about.
+func (cfg *apiConfig) setChirpyRedHandler(w http.ResponseWriter, req *http.Request) {
+	type chirpyRedRequest struct {
+		IsChirpyRed *bool `json:"is_chirpy_red"`
+	}
+
+	userId, err := uuid.Parse(req.PathValue("id"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "error parsing uuid from given id path param")
+		return
+	}
+
+	decoder := json.NewDecoder(req.Body)
+	var decoded chirpyRedRequest
+	if err := decoder.Decode(&decoded); err != nil || decoded.IsChirpyRed == nil {
+		respondWithError(w, http.StatusBadRequest, "is_chirpy_red is required")
+		return
+	}
+
+	userRecord, err := cfg.store.GetUser(req.Context(), userId)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "user not found")
+		return
+	}
+
+	updated, err := cfg.store.UpdateChirpyRed(req.Context(), database.UpdateChirpyRedParams{
+		ID:          userId,
+		IsChirpyRed: *decoded.IsChirpyRed,
+	})
+	if err != nil {
+		slog.ErrorContext(req.Context(), "error updating chirpy red", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "error updating chirpy red")
+		return
+	}
+	if updated == 0 {
+		respondWithError(w, http.StatusNotFound, "user not found")
+		return
+	}
+
+	action := audit.ActionUserChirpyRedRemoved
+	if *decoded.IsChirpyRed {
+		action = audit.ActionUserChirpyRedGranted
+	}
+	cfg.recordAdminAction(req, action, userId, audit.Changed("is_chirpy_red", userRecord.IsChirpyRed, *decoded.IsChirpyRed), nil)
+	slog.InfoContext(req.Context(), "chirpy red updated")
+
+	respondNoContent(w, http.StatusNoContent)
+}
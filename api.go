@@ -1,30 +1,55 @@
 package main
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"sort"
-	"strconv"
 	"strings"
 	"time"
 
+	"github.com/drewheasman/chirpy/internal/audit"
 	"github.com/drewheasman/chirpy/internal/auth"
 	"github.com/drewheasman/chirpy/internal/database"
+	"github.com/drewheasman/chirpy/internal/metrics"
+	"github.com/drewheasman/chirpy/internal/store"
 	"github.com/google/uuid"
 )
 
 const chirpMaxLength int = 140
 
-func (cfg *apiConfig) metricsHandler(w http.ResponseWriter, _ *http.Request) {
+func (cfg *apiConfig) metricsHandler(w http.ResponseWriter, req *http.Request) {
 	htmlString := `
 <html>
     <body>
         <h1>Welcome, Chirpy Admin</h1>
         <p>Chirpy has been visited %d times!</p>
+        <p>%d chirps created, %d logins and %d failed logins since the server started.</p>
     </body>
 </html>`
-	_, _ = w.Write([]byte(fmt.Sprintf(htmlString, cfg.fileserverHits.Load())))
+
+	visits, err := cfg.metrics.FileserverHitsSinceReset()
+	if err != nil {
+		slog.ErrorContext(req.Context(), "error reading metrics", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "error reading metrics")
+		return
+	}
+	counts := []int{int(visits)}
+	for _, name := range []string{metrics.ChirpsCreated, metrics.Logins, metrics.LoginsFailed} {
+		value, err := cfg.metrics.Value(name)
+		if err != nil {
+			slog.ErrorContext(req.Context(), "error reading metrics", "error", err)
+			respondWithError(w, http.StatusInternalServerError, "error reading metrics")
+			return
+		}
+		counts = append(counts, int(value))
+	}
+
+	_, _ = w.Write([]byte(fmt.Sprintf(htmlString, counts[0], counts[1], counts[2], counts[3])))
 }
 
 type Chirp struct {
@@ -65,12 +90,15 @@ func (cfg *apiConfig) getChirpsHandler(w http.ResponseWriter, req *http.Request)
 			respondWithError(w, http.StatusBadRequest, "failed to parse author_id")
 			return
 		}
-		chirps, err = cfg.dbQueries.GetChirpsByUser(req.Context(), authorUUID)
+		chirps, err = cfg.store.GetVisibleChirpsByUser(req.Context(), database.GetVisibleChirpsByUserParams{
+			UserID:   authorUUID,
+			ViewerID: viewerID(req),
+		})
 	} else {
-		chirps, err = cfg.dbQueries.GetChirps(req.Context())
+		chirps, err = cfg.store.GetVisibleChirps(req.Context(), viewerID(req))
 	}
 	if err != nil {
-		fmt.Println(err)
+		slog.WarnContext(req.Context(), "error getting chirps", "error", err)
 		respondWithError(w, http.StatusBadRequest, "error getting chirps")
 		return
 	}
@@ -97,10 +125,13 @@ func (cfg *apiConfig) getChirpHandler(w http.ResponseWriter, req *http.Request)
 		return
 	}
 
-	chirp, err := cfg.dbQueries.GetChirp(req.Context(), id)
-	fmt.Println("chirp", chirp)
+	chirp, err := cfg.store.GetVisibleChirp(req.Context(), database.GetVisibleChirpParams{
+		ID:       id,
+		ViewerID: viewerID(req),
+	})
 	if err != nil {
 		respondWithError(w, http.StatusNotFound, "error getting chirps")
+		return
 	}
 	respondWithJson(w, http.StatusOK, Chirp(chirp))
 }
@@ -110,19 +141,7 @@ func (cfg *apiConfig) createChirpHandler(w http.ResponseWriter, req *http.Reques
 		Body string `json:"body"`
 	}
 
-	token, err := auth.GetBearerToken(req.Header)
-	if err != nil {
-		fmt.Println(err)
-		respondWithError(w, http.StatusUnauthorized, "Not authorized")
-		return
-	}
-
-	id, err := auth.ValidateJWT(token, cfg.serverSecret)
-	if err != nil {
-		fmt.Println(err)
-		respondWithError(w, http.StatusUnauthorized, "Not authorized")
-		return
-	}
+	id := requestPrincipal(req).UserID
 
 	decoder := json.NewDecoder(req.Body)
 	var decoded expectedRequest
@@ -132,7 +151,6 @@ func (cfg *apiConfig) createChirpHandler(w http.ResponseWriter, req *http.Reques
 	}
 
 	if len(decoded.Body) > chirpMaxLength {
-		fmt.Println("request body too long (max "+strconv.Itoa(chirpMaxLength)+" characters):", decoded.Body)
 		respondWithError(w, http.StatusBadRequest, "Chirp is too long")
 		return
 	}
@@ -150,13 +168,13 @@ func (cfg *apiConfig) createChirpHandler(w http.ResponseWriter, req *http.Reques
 		cleanedWords = append(cleanedWords, word)
 	}
 
-	userRecord, err := cfg.dbQueries.GetUser(req.Context(), id)
+	userRecord, err := cfg.store.GetUser(req.Context(), id)
 	if err != nil {
 		respondWithError(w, http.StatusNotFound, "user_id not found")
 		return
 	}
 
-	chirpRecord, err := cfg.dbQueries.CreateChirp(req.Context(), database.CreateChirpParams{
+	chirpRecord, err := cfg.store.CreateChirp(req.Context(), database.CreateChirpParams{
 		Body:   strings.Join(cleanedWords, " "),
 		UserID: userRecord.ID,
 	})
@@ -165,6 +183,7 @@ func (cfg *apiConfig) createChirpHandler(w http.ResponseWriter, req *http.Reques
 		return
 	}
 
+	cfg.metrics.ChirpCreated()
 	respondWithJson(w, http.StatusCreated, Chirp(chirpRecord))
 }
 
@@ -174,6 +193,11 @@ type createUpdateUserRequest struct {
 }
 
 func (cfg *apiConfig) createUsersHandler(w http.ResponseWriter, req *http.Request) {
+	if !cfg.features.Signups {
+		respondWithError(w, http.StatusForbidden, "Signups are disabled")
+		return
+	}
+
 	decoder := json.NewDecoder(req.Body)
 	var decoded createUpdateUserRequest
 	if err := decoder.Decode(&decoded); err != nil || decoded.Email == "" || decoded.Password == "" {
@@ -181,23 +205,27 @@ func (cfg *apiConfig) createUsersHandler(w http.ResponseWriter, req *http.Reques
 		return
 	}
 
-	hashedPassword, err := auth.HashPassword(decoded.Password)
+	hashedPassword, err := hashPassword(req.Context(), decoded.Password)
 	if err != nil {
-		fmt.Print(err.Error())
+		slog.ErrorContext(req.Context(), "failed to hash password", "error", err)
 		respondWithError(w, http.StatusInternalServerError, "failed to hash password")
 		return
 	}
 
-	userRecord, err := cfg.dbQueries.CreateUser(req.Context(), database.CreateUserParams{
+	userRecord, err := cfg.store.CreateUser(req.Context(), database.CreateUserParams{
 		Email:          decoded.Email,
 		HashedPassword: hashedPassword,
 	})
+	if errors.Is(err, store.ErrEmailTaken) {
+		respondWithError(w, http.StatusConflict, "email is already in use")
+		return
+	}
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "error creating user")
 		return
 	}
 
-	fmt.Println("user created")
+	slog.InfoContext(req.Context(), "user created")
 
 	usersResponse := User{
 		Id:          userRecord.ID,
@@ -207,19 +235,11 @@ func (cfg *apiConfig) createUsersHandler(w http.ResponseWriter, req *http.Reques
 		IsChirpyRed: userRecord.IsChirpyRed,
 	}
 
-	fmt.Println("trying to respond with", http.StatusCreated)
 	respondWithJson(w, http.StatusCreated, usersResponse)
 }
 
 func (cfg *apiConfig) updateUserHandler(w http.ResponseWriter, req *http.Request) {
-	token, err := auth.GetBearerToken(req.Header)
-	if err != nil {
-		fmt.Println(err)
-		respondWithError(w, http.StatusUnauthorized, "Not authorized")
-		return
-	}
-
-	id, err := auth.ValidateJWT(token, cfg.serverSecret)
+	id := requestPrincipal(req).UserID
 
 	decoder := json.NewDecoder(req.Body)
 	var decoded createUpdateUserRequest
@@ -228,24 +248,48 @@ func (cfg *apiConfig) updateUserHandler(w http.ResponseWriter, req *http.Request
 		return
 	}
 
-	hashedPassword, err := auth.HashPassword(decoded.Password)
+	hashedPassword, err := hashPassword(req.Context(), decoded.Password)
 	if err != nil {
-		fmt.Print(err.Error())
+		slog.ErrorContext(req.Context(), "failed to hash password", "error", err)
 		respondWithError(w, http.StatusUnauthorized, "failed to hash password")
 		return
 	}
 
-	userRecord, err := cfg.dbQueries.UpdateUser(req.Context(), database.UpdateUserParams{
+	before, err := cfg.store.GetUser(req.Context(), id)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "error updating user")
+		return
+	}
+
+	userRecord, err := cfg.store.UpdateUser(req.Context(), database.UpdateUserParams{
 		ID:             id,
 		Email:          decoded.Email,
 		HashedPassword: hashedPassword,
 	})
+	if errors.Is(err, store.ErrEmailTaken) {
+		respondWithError(w, http.StatusConflict, "email is already in use")
+		return
+	}
 	if err != nil {
 		respondWithError(w, http.StatusUnauthorized, "error updating user")
 		return
 	}
 
-	fmt.Println("user updated")
+	// Passwords are never logged, only that one was set.
+	cfg.recordAudit(req.Context(), audit.Entry{
+		Action:       audit.ActionPasswordChanged,
+		ActorID:      uuid.NullUUID{UUID: id, Valid: true},
+		TargetUserID: uuid.NullUUID{UUID: id, Valid: true},
+	})
+	// Neither address is logged, as the log outlives the account.
+	if before.Email != userRecord.Email {
+		cfg.recordAudit(req.Context(), audit.Entry{
+			Action:       audit.ActionEmailChanged,
+			ActorID:      uuid.NullUUID{UUID: id, Valid: true},
+			TargetUserID: uuid.NullUUID{UUID: id, Valid: true},
+		})
+	}
+	slog.InfoContext(req.Context(), "user updated")
 
 	usersResponse := User{
 		Id:          userRecord.ID,
@@ -265,48 +309,43 @@ func (cfg *apiConfig) deleteChirpHandler(w http.ResponseWriter, req *http.Reques
 		return
 	}
 
-	token, err := auth.GetBearerToken(req.Header)
-	if err != nil {
-		fmt.Println(err)
-		respondWithError(w, http.StatusUnauthorized, "Not authorized")
-		return
-	}
-
-	userId, err := auth.ValidateJWT(token, cfg.serverSecret)
-	if err != nil {
-		fmt.Println(err)
-		respondWithError(w, http.StatusUnauthorized, "Not authorized")
-		return
-	}
+	userId := requestPrincipal(req).UserID
 
-	chirp, err := cfg.dbQueries.GetChirp(req.Context(), id)
+	chirp, err := cfg.store.GetChirp(req.Context(), id)
 	if err != nil {
-		fmt.Println(err)
+		slog.WarnContext(req.Context(), "chirp not found", "error", err)
 		respondWithError(w, http.StatusNotFound, "Chirp not found")
 		return
 	}
 	if chirp.UserID != userId {
-		fmt.Println(err)
 		respondWithError(w, http.StatusForbidden, "Can't delete chirp for a different user")
 		return
 	}
 
-	err = cfg.dbQueries.DeleteChirp(req.Context(), id)
+	err = cfg.store.DeleteChirp(req.Context(), id)
 	if err != nil {
-		fmt.Println(err)
+		slog.ErrorContext(req.Context(), "error deleting chirp", "error", err)
 		respondWithError(w, http.StatusInternalServerError, "Error deleting chirp")
 		return
 	}
 
-	fmt.Println("chirp deleted")
+	cfg.recordAudit(req.Context(), audit.Entry{
+		Action:       audit.ActionChirpDeleted,
+		ActorID:      uuid.NullUUID{UUID: userId, Valid: true},
+		TargetUserID: uuid.NullUUID{UUID: chirp.UserID, Valid: true},
+		TargetType:   audit.TargetChirp,
+		TargetID:     chirp.ID.String(),
+	})
+	slog.InfoContext(req.Context(), "chirp deleted")
 
 	respondNoContent(w, http.StatusNoContent)
 }
 
 func (cfg *apiConfig) loginHandler(w http.ResponseWriter, req *http.Request) {
 	type loginRequest struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
+		Email      string `json:"email"`
+		Password   string `json:"password"`
+		DeviceName string `json:"device_name"`
 	}
 
 	decoder := json.NewDecoder(req.Body)
@@ -316,12 +355,80 @@ func (cfg *apiConfig) loginHandler(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	userRecord, err := cfg.dbQueries.GetUserByEmail(req.Context(), decoded.Email)
+	attempt, wait, err := cfg.reserveLoginAttempt(req.Context(), decoded.Email, clientIP(req))
+	if err != nil {
+		slog.ErrorContext(req.Context(), "error checking login attempts", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "error checking login attempts")
+		return
+	}
+	if attempt == nil {
+		respondTooManyAttempts(w, wait)
+		return
+	}
+	defer attempt.release(context.WithoutCancel(req.Context()))
+
+	userRecord, err := cfg.store.GetUserByEmail(req.Context(), decoded.Email)
 	if err != nil {
+		attempt.fail(req.Context())
+		cfg.recordFailedLogin(req.Context(), decoded.Email, uuid.NullUUID{}, loginMethodPassword)
+		respondWithError(w, http.StatusUnauthorized, "incorrect email or password")
+		return
+	}
+
+	if err := checkPasswordHash(req.Context(), decoded.Password, userRecord.HashedPassword); err != nil {
+		attempt.fail(req.Context())
+		cfg.recordFailedLogin(req.Context(), decoded.Email, uuid.NullUUID{UUID: userRecord.ID, Valid: true}, loginMethodPassword)
 		respondWithError(w, http.StatusUnauthorized, "incorrect email or password")
 		return
 	}
 
+	// Only tell someone the account is suspended once they've proven they
+	// own it.
+	if userRecord.SuspendedAt.Valid {
+		respondAccountSuspended(w, userRecord.SuspensionReason.String)
+		return
+	}
+
+	if userRecord.TotpEnabled {
+		challengeToken, err := cfg.createTwoFactorChallenge(req.Context(), userRecord.ID)
+		if err != nil {
+			slog.ErrorContext(req.Context(), "failed to create two-factor challenge", "error", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to create two-factor challenge")
+			return
+		}
+
+		respondWithJson(w, http.StatusOK, twoFactorChallengeResponse{
+			TwoFactorRequired: true,
+			ChallengeToken:    challengeToken,
+		})
+		return
+	}
+
+	attempt.succeed(req.Context())
+	cfg.recordLogin(req.Context(), userRecord.ID, loginMethodPassword)
+
+	cfg.cancelAccountDeletion(req.Context(), userRecord)
+
+	if userRecord.PasswordResetRequired {
+		cfg.respondPasswordResetRequired(w, req.Context(), userRecord.ID)
+		return
+	}
+
+	usersResponse, err := cfg.issueLoginTokens(req.Context(), userRecord, sessionMetadataFromRequest(req, decoded.DeviceName))
+	if err != nil {
+		slog.ErrorContext(req.Context(), "failed to issue tokens", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to issue tokens")
+		return
+	}
+
+	slog.InfoContext(req.Context(), "user logged in")
+
+	respondWithJson(w, http.StatusOK, usersResponse)
+}
+
+// issueLoginTokens starts a new session and creates the access and refresh
+// tokens handed out at the end of a successful login.
+func (cfg *apiConfig) issueLoginTokens(ctx context.Context, userRecord database.User, metadata sessionMetadata) (User, error) {
 	usersResponse := User{
 		Id:          userRecord.ID,
 		CreatedAt:   userRecord.CreatedAt,
@@ -330,91 +437,176 @@ func (cfg *apiConfig) loginHandler(w http.ResponseWriter, req *http.Request) {
 		IsChirpyRed: userRecord.IsChirpyRed,
 	}
 
-	if err := auth.CheckPasswordHash(decoded.Password, userRecord.HashedPassword); err != nil {
-		respondWithError(w, http.StatusUnauthorized, "incorrect email or password")
-		return
+	sessionID := uuid.New()
+	jwt, err := auth.MakeSessionJWT(usersResponse.Id, sessionID, cfg.jwtKeys, cfg.accessTokenTTL)
+	if err != nil {
+		return User{}, err
 	}
+	usersResponse.Token = jwt
 
-	jwt, err := auth.MakeJWT(usersResponse.Id, cfg.serverSecret, time.Hour)
+	refreshToken, err := cfg.createRefreshToken(ctx, cfg.store, userRecord.ID, sessionID, metadata)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, err.Error())
-		return
+		return User{}, err
 	}
-	usersResponse.Token = jwt
+	usersResponse.RefreshToken = refreshToken
+
+	return usersResponse, nil
+}
 
+// createRefreshToken issues a refresh token in the given family, which is
+// also the session ID. Only its hash is stored, so the plaintext is returned
+// to the caller exactly once.
+func (cfg *apiConfig) createRefreshToken(ctx context.Context, s store.Store, userID, familyID uuid.UUID, metadata sessionMetadata) (string, error) {
 	refreshToken, err := auth.MakeRefreshToken()
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Failed to make refresh token")
-		return
-	}
-	err = cfg.dbQueries.CreateRefreshToken(req.Context(), database.CreateRefreshTokenParams{
-		Token:     refreshToken,
-		UserID:    userRecord.ID,
-		ExpiresAt: time.Now().Add(time.Hour * 24 * 60),
+		return "", err
+	}
+
+	err = s.CreateRefreshToken(ctx, database.CreateRefreshTokenParams{
+		TokenHash:  auth.HashToken(refreshToken),
+		UserID:     userID,
+		ExpiresAt:  time.Now().Add(cfg.refreshTokenTTL),
+		FamilyID:   familyID,
+		DeviceName: metadata.DeviceName,
+		UserAgent:  metadata.UserAgent,
+		Ip:         metadata.IP,
+		ClientID:   sql.NullString{String: metadata.ClientID, Valid: metadata.ClientID != ""},
+		Scopes:     metadata.Scopes,
 	})
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Failed to save refresh token")
-		return
+		return "", err
 	}
-	usersResponse.RefreshToken = refreshToken
 
-	fmt.Println("user logged in")
+	return refreshToken, nil
+}
 
-	respondWithJson(w, http.StatusOK, usersResponse)
+var errInvalidRefreshToken = errors.New("refresh token is invalid, expired or revoked")
+
+// rotateRefreshToken marks a refresh token as used and calls issue to store
+// its replacement in the same transaction. If issue fails the old token
+// stays usable, so retrying isn't mistaken for reuse. clientID is empty for
+// first-party tokens, so a token issued to an OAuth client can't be
+// exchanged for a full-scope session and vice versa.
+func (cfg *apiConfig) rotateRefreshToken(ctx context.Context, token, clientID string, issue func(tx store.Store, rotated database.RotateRefreshTokenRow) error) (database.RotateRefreshTokenRow, error) {
+	tokenHash := auth.HashToken(token)
+	client := sql.NullString{String: clientID, Valid: clientID != ""}
+	var rotated database.RotateRefreshTokenRow
+	err := cfg.store.InTx(ctx, func(tx store.Store) error {
+		var err error
+		rotated, err = tx.RotateRefreshToken(ctx, database.RotateRefreshTokenParams{
+			TokenHash: tokenHash,
+			ClientID:  client,
+		})
+		if err != nil {
+			return err
+		}
+		return issue(tx, rotated)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		// A token that was already rotated is being presented again, so
+		// either the client or an attacker holds a stolen copy. Revoke the
+		// whole family to log both out. A token presented by a different
+		// client is just rejected, so one client can't end another's grant.
+		existing, err := cfg.store.GetRefreshToken(ctx, tokenHash)
+		if err == nil && existing.RotatedAt.Valid && existing.ClientID == client {
+			if err := cfg.store.RevokeRefreshTokenFamily(ctx, existing.FamilyID); err != nil {
+				slog.ErrorContext(ctx, "error revoking refresh token family", "error", err)
+			}
+			slog.WarnContext(ctx, "refresh token reuse detected, token family revoked", "family_id", existing.FamilyID)
+		}
+		return database.RotateRefreshTokenRow{}, errInvalidRefreshToken
+	}
+	if err != nil {
+		return database.RotateRefreshTokenRow{}, err
+	}
+
+	return rotated, nil
 }
 
 func (cfg *apiConfig) refreshHandler(w http.ResponseWriter, req *http.Request) {
 	token, err := auth.GetBearerToken(req.Header)
 	if err != nil {
-		fmt.Println(err)
+		slog.WarnContext(req.Context(), "authentication failed", "error", err)
+		respondWithError(w, http.StatusUnauthorized, "Not authorized")
+		return
+	}
+
+	var refreshToken string
+	rotated, err := cfg.rotateRefreshToken(req.Context(), token, "", func(tx store.Store, rotated database.RotateRefreshTokenRow) error {
+		var err error
+		refreshToken, err = cfg.createRefreshToken(req.Context(), tx, rotated.UserID, rotated.FamilyID, sessionMetadataFromRequest(req, rotated.DeviceName))
+		return err
+	})
+	if errors.Is(err, errInvalidRefreshToken) {
+		slog.WarnContext(req.Context(), "authentication failed", "error", err)
 		respondWithError(w, http.StatusUnauthorized, "Not authorized")
 		return
 	}
+	if err != nil {
+		slog.ErrorContext(req.Context(), "failed to make refresh token", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to make refresh token")
+		return
+	}
 
-	userId, err := cfg.dbQueries.GetUserFromRefreshToken(req.Context(), token)
+	status, err := cfg.store.GetUserStatus(req.Context(), rotated.UserID)
 	if err != nil {
-		fmt.Println(err)
+		slog.WarnContext(req.Context(), "authentication failed", "error", err)
 		respondWithError(w, http.StatusUnauthorized, "Not authorized")
 		return
 	}
+	if status.SuspendedAt.Valid {
+		if err := cfg.store.RevokeRefreshTokenFamily(req.Context(), rotated.FamilyID); err != nil {
+			slog.ErrorContext(req.Context(), "error revoking refresh token family", "error", err)
+		}
+		respondAccountSuspended(w, status.SuspensionReason.String)
+		return
+	}
 
-	jwt, err := auth.MakeJWT(userId, cfg.serverSecret, time.Hour)
+	jwt, err := auth.MakeSessionJWT(rotated.UserID, rotated.FamilyID, cfg.jwtKeys, cfg.accessTokenTTL)
 	if err != nil {
-		fmt.Println(err)
+		slog.ErrorContext(req.Context(), "error making session JWT", "error", err)
 		respondWithError(w, http.StatusUnauthorized, err.Error())
 		return
 	}
 
 	type tokenResponse struct {
-		Token string `json:"token"`
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
 	}
 
-	respondWithJson(w, http.StatusOK, tokenResponse{Token: jwt})
+	respondWithJson(w, http.StatusOK, tokenResponse{Token: jwt, RefreshToken: refreshToken})
 }
 
 func (cfg *apiConfig) revokeHandler(w http.ResponseWriter, req *http.Request) {
 	token, err := auth.GetBearerToken(req.Header)
 	if err != nil {
-		fmt.Println(err)
+		slog.WarnContext(req.Context(), "authentication failed", "error", err)
 		respondWithError(w, http.StatusUnauthorized, "Not authorized")
 		return
 	}
 
-	_, err = cfg.dbQueries.GetUserFromRefreshToken(req.Context(), token)
+	refreshToken, err := cfg.store.GetRefreshToken(req.Context(), auth.HashToken(token))
 	if err != nil {
-		fmt.Println(err)
+		slog.WarnContext(req.Context(), "authentication failed", "error", err)
+		respondWithError(w, http.StatusUnauthorized, "Not authorized")
+		return
+	}
+	if refreshToken.RevokedAt.Valid || refreshToken.RotatedAt.Valid || refreshToken.ExpiresAt.Before(time.Now()) {
 		respondWithError(w, http.StatusUnauthorized, "Not authorized")
 		return
 	}
 
-	err = cfg.dbQueries.RevokeToken(req.Context(), token)
+	// Revoking the family ends the session, which also rejects any access
+	// tokens issued for it.
+	err = cfg.store.RevokeRefreshTokenFamily(req.Context(), refreshToken.FamilyID)
 	if err != nil {
-		fmt.Println(err)
+		slog.ErrorContext(req.Context(), "error revoking token", "error", err)
 		respondWithError(w, http.StatusInternalServerError, "Error revoking token")
 		return
 	}
 
-	fmt.Println("token revoked")
+	cfg.recordTokenRevoked(req.Context(), refreshToken.UserID, audit.TargetSession, refreshToken.FamilyID.String())
+	slog.InfoContext(req.Context(), "token revoked")
 
 	respondNoContent(w, http.StatusNoContent)
 }
@@ -427,9 +619,12 @@ func (cfg *apiConfig) polkaWebhooksHandler(w http.ResponseWriter, req *http.Requ
 		} `json:"data"`
 	}
 
+	cfg.metrics.WebhookReceived("polka")
+
+	// An empty key never matches, even if no key is configured.
 	apiKey, err := auth.GetAPIKey(req.Header)
-	if err != nil || apiKey != cfg.polkaKey {
-		fmt.Println("invalid ApiKey")
+	if err != nil || apiKey == "" || apiKey != cfg.polkaKey {
+		slog.WarnContext(req.Context(), "invalid polka api key")
 		respondNoContent(w, http.StatusUnauthorized)
 		return
 	}
@@ -437,31 +632,36 @@ func (cfg *apiConfig) polkaWebhooksHandler(w http.ResponseWriter, req *http.Requ
 	var decoded polkaWebhookRequest
 	decoder := json.NewDecoder(req.Body)
 	if err := decoder.Decode(&decoded); err != nil {
-		fmt.Println("error decoding request")
+		slog.WarnContext(req.Context(), "error decoding polka webhook", "error", err)
 		respondNoContent(w, http.StatusNoContent)
 		return
 	}
 
 	if decoded.Event != "user.upgraded" {
-		fmt.Println("unknown event")
+		slog.InfoContext(req.Context(), "ignoring polka event", "event", decoded.Event)
 		respondNoContent(w, http.StatusNoContent)
 		return
 	}
 
 	userId, err := uuid.Parse(decoded.Data.UserId)
 	if err != nil {
-		fmt.Println("error parsing user_id")
+		slog.WarnContext(req.Context(), "error parsing polka user_id", "error", err)
 		respondNoContent(w, http.StatusNoContent)
 		return
 	}
 
-	err = cfg.dbQueries.SetChirpyRed(req.Context(), userId)
+	err = cfg.store.SetChirpyRed(req.Context(), userId)
 	if err != nil {
-		fmt.Println("error setting chirpy red")
+		slog.WarnContext(req.Context(), "error setting chirpy red", "target_user_id", userId, "error", err)
 		respondNoContent(w, http.StatusNotFound)
 		return
 	}
 
-	fmt.Println("set chirpy red")
+	cfg.recordAudit(req.Context(), audit.Entry{
+		Action:       audit.ActionUserChirpyRedGranted,
+		TargetUserID: uuid.NullUUID{UUID: userId, Valid: true},
+		Details:      map[string]any{"source": "polka"},
+	})
+	slog.InfoContext(req.Context(), "set chirpy red", "target_user_id", userId)
 	respondNoContent(w, http.StatusNoContent)
 }
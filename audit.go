@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/drewheasman/chirpy/internal/audit"
+	"github.com/drewheasman/chirpy/internal/config"
+	"github.com/drewheasman/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	auditLogDefaultLimit = 50
+	auditLogMaxLimit     = 200
+
+	loginMethodPassword  = "password"
+	loginMethodTwoFactor = "two_factor"
+	loginMethodOAuth     = "oauth_authorize"
+)
+
+// middlewareAuditRequest stores where each request came from, so audit log
+// entries written while handling it record the IP address and user agent.
+func middlewareAuditRequest(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ctx := audit.NewContext(req.Context(), audit.Request{
+			IP:        clientIP(req),
+			UserAgent: req.UserAgent(),
+		})
+		next.ServeHTTP(w, req.WithContext(ctx))
+	})
+}
+
+// newAuditLog returns the audit log. Without a hash key a random key is
+// used, so failed logins can only be matched up by email within one run of
+// one server.
+func newAuditLog(store audit.Store, c config.Audit) (*audit.Log, error) {
+	key := []byte(c.HashKey)
+	if len(key) == 0 {
+		slog.Warn("audit.hash_key is not set, emails in the audit log will not match across restarts")
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+	}
+	return audit.New(store, key), nil
+}
+
+// recordAudit writes an audit log entry. A failure is logged rather than
+// undoing the action, which has already happened.
+func (cfg *apiConfig) recordAudit(ctx context.Context, entry audit.Entry) {
+	if err := cfg.auditLog.Record(ctx, entry); err != nil {
+		slog.ErrorContext(ctx, "error writing audit log", "action", entry.Action, "error", err)
+	}
+}
+
+// recordAdminAction records something the staff member making req did to a
+// user's account.
+func (cfg *apiConfig) recordAdminAction(req *http.Request, action string, targetID uuid.UUID, diff audit.Diff, details map[string]any) {
+	cfg.recordAudit(req.Context(), audit.Entry{
+		Action:       action,
+		ActorID:      uuid.NullUUID{UUID: requestPrincipal(req).UserID, Valid: true},
+		TargetUserID: uuid.NullUUID{UUID: targetID, Valid: true},
+		Diff:         diff,
+		Details:      details,
+	})
+}
+
+func (cfg *apiConfig) recordLogin(ctx context.Context, userID uuid.UUID, method string) {
+	cfg.metrics.Login(method)
+	cfg.recordAudit(ctx, audit.Entry{
+		Action:       audit.ActionLogin,
+		ActorID:      uuid.NullUUID{UUID: userID, Valid: true},
+		TargetUserID: uuid.NullUUID{UUID: userID, Valid: true},
+		Details:      map[string]any{"method": method},
+	})
+}
+
+// recordFailedLogin records a failed login. userID is null when no account
+// has the email, so the email's hash is kept so that guessing can be
+// spotted.
+func (cfg *apiConfig) recordFailedLogin(ctx context.Context, email string, userID uuid.NullUUID, method string) {
+	cfg.metrics.LoginFailed(method)
+	cfg.recordAudit(ctx, audit.Entry{
+		Action:       audit.ActionLoginFailed,
+		TargetUserID: userID,
+		Details:      map[string]any{"email_hash": cfg.auditLog.HashEmail(email), "method": method},
+	})
+}
+
+// recordTokenRevoked records a user revoking one of their own credentials.
+func (cfg *apiConfig) recordTokenRevoked(ctx context.Context, userID uuid.UUID, targetType, targetID string) {
+	cfg.recordAudit(ctx, audit.Entry{
+		Action:       audit.ActionTokenRevoked,
+		ActorID:      uuid.NullUUID{UUID: userID, Valid: true},
+		TargetUserID: uuid.NullUUID{UUID: userID, Valid: true},
+		TargetType:   targetType,
+		TargetID:     targetID,
+	})
+}
+
+type AuditLogEntry struct {
+	ID           uuid.UUID       `json:"id"`
+	CreatedAt    time.Time       `json:"created_at"`
+	Action       string          `json:"action"`
+	ActorID      *uuid.UUID      `json:"actor_id"`
+	TargetUserID *uuid.UUID      `json:"target_user_id"`
+	TargetType   string          `json:"target_type,omitempty"`
+	TargetID     string          `json:"target_id,omitempty"`
+	IP           string          `json:"ip"`
+	UserAgent    string          `json:"user_agent"`
+	Diff         json.RawMessage `json:"diff"`
+	Details      json.RawMessage `json:"details"`
+}
+
+type auditLogList struct {
+	Entries []AuditLogEntry `json:"entries"`
+	Total   int64           `json:"total"`
+	Limit   int             `json:"limit"`
+	Offset  int             `json:"offset"`
+}
+
+func nullUUIDPtr(id uuid.NullUUID) *uuid.UUID {
+	if !id.Valid {
+		return nil
+	}
+	return &id.UUID
+}
+
+func parseUUIDParam(value string) (uuid.NullUUID, error) {
+	if value == "" {
+		return uuid.NullUUID{}, nil
+	}
+	id, err := uuid.Parse(value)
+	if err != nil {
+		return uuid.NullUUID{}, err
+	}
+	return uuid.NullUUID{UUID: id, Valid: true}, nil
+}
+
+// listAuditLogHandler filters the audit log by actor, target user, action,
+// target type and time, newest first.
+func (cfg *apiConfig) listAuditLogHandler(w http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+
+	limit := auditLogDefaultLimit
+	if value := query.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > auditLogMaxLimit {
+			respondWithError(w, http.StatusBadRequest, "limit must be between 1 and "+strconv.Itoa(auditLogMaxLimit))
+			return
+		}
+		limit = parsed
+	}
+	offset := 0
+	if value := query.Get("offset"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			respondWithError(w, http.StatusBadRequest, "offset must not be negative")
+			return
+		}
+		offset = parsed
+	}
+
+	actorID, err := parseUUIDParam(query.Get("actor_id"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "actor_id must be a uuid")
+		return
+	}
+	targetUserID, err := parseUUIDParam(query.Get("target_user_id"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "target_user_id must be a uuid")
+		return
+	}
+	createdAfter, err := parseDateParam(query.Get("created_after"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "created_after must be a date or RFC 3339 timestamp")
+		return
+	}
+	createdBefore, err := parseDateParam(query.Get("created_before"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "created_before must be a date or RFC 3339 timestamp")
+		return
+	}
+
+	action := sql.NullString{String: query.Get("action"), Valid: query.Get("action") != ""}
+	targetType := sql.NullString{String: query.Get("target_type"), Valid: query.Get("target_type") != ""}
+
+	entries, err := cfg.store.ListAuditLog(req.Context(), database.ListAuditLogParams{
+		ActorID:       actorID,
+		TargetUserID:  targetUserID,
+		Action:        action,
+		TargetType:    targetType,
+		CreatedAfter:  createdAfter,
+		CreatedBefore: createdBefore,
+		MaxResults:    int32(limit),
+		SkipResults:   int32(offset),
+	})
+	if err != nil {
+		slog.ErrorContext(req.Context(), "error listing audit log", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "error listing audit log")
+		return
+	}
+	total, err := cfg.store.CountAuditLog(req.Context(), database.CountAuditLogParams{
+		ActorID:       actorID,
+		TargetUserID:  targetUserID,
+		Action:        action,
+		TargetType:    targetType,
+		CreatedAfter:  createdAfter,
+		CreatedBefore: createdBefore,
+	})
+	if err != nil {
+		slog.ErrorContext(req.Context(), "error counting audit log", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "error counting audit log")
+		return
+	}
+
+	response := auditLogList{
+		Entries: []AuditLogEntry{},
+		Total:   total,
+		Limit:   limit,
+		Offset:  offset,
+	}
+	for _, e := range entries {
+		response.Entries = append(response.Entries, AuditLogEntry{
+			ID:           e.ID,
+			CreatedAt:    e.CreatedAt,
+			Action:       e.Action,
+			ActorID:      nullUUIDPtr(e.ActorID),
+			TargetUserID: nullUUIDPtr(e.TargetUserID),
+			TargetType:   e.TargetType.String,
+			TargetID:     e.TargetID.String,
+			IP:           e.Ip,
+			UserAgent:    e.UserAgent,
+			Diff:         e.Diff,
+			Details:      e.Details,
+		})
+	}
+
+	respondWithJson(w, http.StatusOK, response)
+}
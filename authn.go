@@ -0,0 +1,197 @@
+package main
+
+import (
+	"crypto/subtle"
+	"log/slog"
+	"net/http"
+
+	"github.com/drewheasman/chirpy/internal/auth"
+	"github.com/google/uuid"
+)
+
+// authenticate accepts a session JWT, which carries every scope, an OAuth
+// access token limited to the scopes the user granted the client, or a
+// personal access token limited to the scopes it was created with.
+func (cfg *apiConfig) authenticate(req *http.Request) (auth.Principal, error) {
+	token, err := auth.GetBearerToken(req.Header)
+	if err != nil {
+		return auth.Principal{}, err
+	}
+
+	if auth.IsPersonalAccessToken(token) {
+		pat, err := cfg.store.UsePersonalAccessToken(req.Context(), auth.HashToken(token))
+		if err != nil {
+			return auth.Principal{}, err
+		}
+		return auth.Principal{
+			UserID: pat.UserID,
+			Scopes: pat.Scopes,
+			Method: auth.MethodPersonalAccessToken,
+		}, nil
+	}
+
+	claims, err := cfg.parseAccessToken(req.Context(), token)
+	if err != nil {
+		return auth.Principal{}, err
+	}
+	userId, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		return auth.Principal{}, err
+	}
+	sessionID, err := claims.SessionUUID()
+	if err != nil {
+		return auth.Principal{}, err
+	}
+
+	method := auth.MethodJWT
+	if claims.ClientID != "" {
+		method = auth.MethodOAuth
+	}
+
+	return auth.Principal{
+		UserID:    userId,
+		SessionID: sessionID,
+		Scopes:    claims.Scopes(),
+		Method:    method,
+	}, nil
+}
+
+// RequireAuth rejects requests without a valid token, whose token lacks any
+// of scopes, or whose user has been suspended, and otherwise stores the
+// principal in the request context.
+func (cfg *apiConfig) RequireAuth(next http.HandlerFunc, scopes ...string) http.Handler {
+	return cfg.requireAuth(next, false, scopes)
+}
+
+// RequireFirstParty is RequireAuth for endpoints that manage the account
+// itself. Only a session JWT is accepted, so a leaked personal access token
+// or a third-party OAuth client can't mint more credentials.
+func (cfg *apiConfig) RequireFirstParty(next http.HandlerFunc) http.Handler {
+	return cfg.requireAuth(next, true, nil)
+}
+
+func (cfg *apiConfig) requireAuth(next http.HandlerFunc, firstParty bool, scopes []string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		caller, err := cfg.authenticate(req)
+		if err != nil {
+			slog.WarnContext(req.Context(), "authentication failed", "error", err)
+			respondWithError(w, http.StatusUnauthorized, "Not authorized")
+			return
+		}
+		if firstParty && !caller.FirstParty() {
+			slog.WarnContext(req.Context(), "authentication failed", "error", errFirstPartyOnly)
+			respondWithError(w, http.StatusUnauthorized, "Not authorized")
+			return
+		}
+		for _, scope := range scopes {
+			if !caller.HasScope(scope) {
+				respondWithError(w, http.StatusForbidden, "token is missing the "+scope+" scope")
+				return
+			}
+		}
+		if !cfg.checkAccountActive(w, req, caller.UserID) {
+			return
+		}
+
+		setRequestUserID(req, caller.UserID)
+		next.ServeHTTP(w, req.WithContext(auth.NewContext(req.Context(), caller)))
+	})
+}
+
+// OptionalAuth lets anonymous requests through, but still rejects requests
+// that send a token that isn't valid or that lacks any of scopes. A token
+// only ever narrows what the caller may do, so presenting one without the
+// scope isn't the same as presenting none.
+func (cfg *apiConfig) OptionalAuth(next http.HandlerFunc, scopes ...string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Authorization") == "" {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		caller, err := cfg.authenticate(req)
+		if err != nil {
+			slog.WarnContext(req.Context(), "authentication failed", "error", err)
+			respondWithError(w, http.StatusUnauthorized, "Not authorized")
+			return
+		}
+		for _, scope := range scopes {
+			if !caller.HasScope(scope) {
+				respondWithError(w, http.StatusForbidden, "token is missing the "+scope+" scope")
+				return
+			}
+		}
+		if !cfg.checkAccountActive(w, req, caller.UserID) {
+			return
+		}
+
+		setRequestUserID(req, caller.UserID)
+		next.ServeHTTP(w, req.WithContext(auth.NewContext(req.Context(), caller)))
+	})
+}
+
+// checkAccountActive responds with an error and returns false if the user no
+// longer exists, has been suspended or is about to be deleted. It runs on every authenticated
+// request, so a suspension also stops tokens that were issued before it.
+func (cfg *apiConfig) checkAccountActive(w http.ResponseWriter, req *http.Request, userID uuid.UUID) bool {
+	status, err := cfg.store.GetUserStatus(req.Context(), userID)
+	if err != nil {
+		slog.WarnContext(req.Context(), "authentication failed", "error", err)
+		respondWithError(w, http.StatusUnauthorized, "Not authorized")
+		return false
+	}
+	if status.SuspendedAt.Valid {
+		respondAccountSuspended(w, status.SuspensionReason.String)
+		return false
+	}
+	if status.DeletionScheduledAt.Valid {
+		respondAccountPendingDeletion(w, status.DeletionScheduledAt.Time)
+		return false
+	}
+
+	return true
+}
+
+// requestPrincipal returns the principal stored by RequireAuth. Handlers
+// behind OptionalAuth should use auth.FromContext instead.
+func requestPrincipal(req *http.Request) auth.Principal {
+	caller, _ := auth.FromContext(req.Context())
+	return caller
+}
+
+// RequireRole is RequireFirstParty for staff endpoints. The role is read
+// from the database on every request, so a demotion takes effect at once
+// rather than when the access token expires.
+// requireMetricsToken lets through requests carrying the configured metrics
+// token, which unlike a session doesn't expire, so it suits a scraper.
+func (cfg *apiConfig) requireMetricsToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		token, err := auth.GetBearerToken(req.Header)
+		// Comparing hashes keeps the comparison constant time whatever
+		// length of token is sent.
+		if err != nil || subtle.ConstantTimeCompare([]byte(auth.HashToken(token)), []byte(auth.HashToken(cfg.metricsToken))) != 1 {
+			slog.WarnContext(req.Context(), "metrics scrape without the metrics token")
+			respondWithError(w, http.StatusUnauthorized, "Not authorized")
+			return
+		}
+
+		next.ServeHTTP(w, req)
+	})
+}
+
+func (cfg *apiConfig) RequireRole(role string, next http.HandlerFunc) http.Handler {
+	return cfg.RequireFirstParty(func(w http.ResponseWriter, req *http.Request) {
+		userRecord, err := cfg.store.GetUser(req.Context(), requestPrincipal(req).UserID)
+		if err != nil {
+			slog.WarnContext(req.Context(), "authentication failed", "error", err)
+			respondWithError(w, http.StatusUnauthorized, "Not authorized")
+			return
+		}
+		if !auth.RoleAtLeast(userRecord.Role, role) {
+			respondWithError(w, http.StatusForbidden, "requires the "+role+" role")
+			return
+		}
+
+		next.ServeHTTP(w, req)
+	})
+}
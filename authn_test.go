@@ -0,0 +1,192 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/drewheasman/chirpy/internal/auth"
+	"github.com/drewheasman/chirpy/internal/config"
+	"github.com/drewheasman/chirpy/internal/metrics"
+	"github.com/google/uuid"
+)
+
+// protectedRoutes are every route behind RequireAuth or RequireFirstParty.
+var protectedRoutes = []struct {
+	method     string
+	path       string
+	firstParty bool
+}{
+	{"POST", "/api/chirps", false},
+	{"DELETE", "/api/chirps/" + uuid.NewString(), false},
+	{"PUT", "/api/users", false},
+	{"DELETE", "/api/users/me", true},
+	{"POST", "/api/users/me/export", true},
+	{"GET", "/api/users/me/export/" + uuid.NewString(), true},
+	{"POST", "/api/users/me/2fa/setup", true},
+	{"POST", "/api/users/me/2fa/verify", true},
+	{"POST", "/api/users/me/2fa/disable", true},
+	{"POST", "/api/tokens", true},
+	{"GET", "/api/tokens", true},
+	{"DELETE", "/api/tokens/" + uuid.NewString(), true},
+	{"GET", "/api/sessions", true},
+	{"DELETE", "/api/sessions/" + uuid.NewString(), true},
+	{"POST", "/api/sessions/revoke-all", true},
+	{"POST", "/oauth/clients", true},
+	{"GET", "/admin/metrics", true},
+	{"POST", "/admin/unlock", true},
+	{"GET", "/admin/users", true},
+	{"GET", "/admin/users/" + uuid.NewString(), true},
+	{"POST", "/admin/users/" + uuid.NewString() + "/suspend", true},
+	{"POST", "/admin/users/" + uuid.NewString() + "/unsuspend", true},
+	{"PUT", "/admin/users/" + uuid.NewString() + "/shadow-ban", true},
+	{"POST", "/admin/users/" + uuid.NewString() + "/revoke-sessions", true},
+	{"POST", "/admin/users/" + uuid.NewString() + "/password-reset", true},
+	{"PUT", "/admin/users/" + uuid.NewString() + "/chirpy-red", true},
+	{"PUT", "/admin/users/" + uuid.NewString() + "/role", true},
+	{"POST", "/admin/import", true},
+	{"GET", "/admin/export", true},
+	{"GET", "/admin/audit", true},
+	{"GET", "/admin/logging", true},
+	{"PUT", "/admin/logging", true},
+}
+
+func newTestKeyring(t *testing.T, cfg auth.KeyringConfig) *auth.Keyring {
+	t.Helper()
+
+	keys, err := auth.NewKeyring(cfg)
+	if err != nil {
+		t.Fatalf("NewKeyring() resulted in error: %v", err)
+	}
+	return keys
+}
+
+func TestProtectedRoutesRejectBadTokens(t *testing.T) {
+	keys := newTestKeyring(t, auth.KeyringConfig{Algorithm: auth.AlgorithmEdDSA, Audience: defaultJWTAudience})
+	otherKeys := newTestKeyring(t, auth.KeyringConfig{Algorithm: auth.AlgorithmEdDSA, Audience: defaultJWTAudience})
+	otherAudience := newTestKeyring(t, auth.KeyringConfig{Algorithm: auth.AlgorithmEdDSA, Audience: "someone-else"})
+	legacy := newTestKeyring(t, auth.KeyringConfig{Algorithm: auth.AlgorithmHS256, HS256Secret: "secret", Audience: defaultJWTAudience})
+
+	// No database: every token below has to be turned away before the
+	// handler or the session lookup would touch it.
+	cfg := &apiConfig{jwtKeys: keys, metrics: metrics.New(), features: config.Default().Features}
+	handler := cfg.routes()
+
+	userID := uuid.New()
+	mustJWT := func(token string, err error) string {
+		t.Helper()
+		if err != nil {
+			t.Fatalf("making test token resulted in error: %v", err)
+		}
+		return token
+	}
+	expired := mustJWT(auth.MakeJWT(userID, keys, -time.Minute))
+	wrongKey := mustJWT(auth.MakeJWT(userID, otherKeys, time.Hour))
+	wrongAudience := mustJWT(auth.MakeJWT(userID, otherAudience, time.Hour))
+	hs256 := mustJWT(auth.MakeJWT(userID, legacy, time.Hour))
+	tampered := mustJWT(auth.MakeJWT(userID, keys, time.Hour))
+	tampered = tampered[:len(tampered)-4] + "AAAA"
+
+	badHeaders := []struct {
+		name   string
+		header string
+	}{
+		{"missing header", ""},
+		{"not bearer", "Basic dXNlcjpwYXNz"},
+		{"empty bearer", "Bearer "},
+		{"garbage", "Bearer not-a-jwt"},
+		{"expired", "Bearer " + expired},
+		{"signed by unknown key", "Bearer " + wrongKey},
+		{"wrong audience", "Bearer " + wrongAudience},
+		{"HS256 no longer accepted", "Bearer " + hs256},
+		{"tampered signature", "Bearer " + tampered},
+	}
+
+	for _, route := range protectedRoutes {
+		for _, bad := range badHeaders {
+			t.Run(route.method+" "+route.path+" "+bad.name, func(t *testing.T) {
+				req := httptest.NewRequest(route.method, route.path, strings.NewReader(`{}`))
+				if bad.header != "" {
+					req.Header.Set("Authorization", bad.header)
+				}
+				rec := httptest.NewRecorder()
+				handler.ServeHTTP(rec, req)
+
+				if rec.Code != http.StatusUnauthorized {
+					t.Fatalf("expected 401 got %d: %s", rec.Code, rec.Body.String())
+				}
+			})
+		}
+	}
+
+	t.Run("GET /api/chirps rejects an invalid token", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/api/chirps", nil)
+		req.Header.Set("Authorization", "Bearer "+expired)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusUnauthorized {
+			t.Fatalf("expected 401 got %d", rec.Code)
+		}
+	})
+}
+
+func TestProtectedRoutesEnforceScopes(t *testing.T) {
+	keys := newTestKeyring(t, auth.KeyringConfig{Algorithm: auth.AlgorithmEdDSA, Audience: defaultJWTAudience})
+	cfg := &apiConfig{jwtKeys: keys, metrics: metrics.New(), features: config.Default().Features}
+	handler := cfg.routes()
+
+	// An OAuth token without a session skips the session lookup, so this
+	// also runs without a database.
+	readOnly, err := auth.MakeClientJWT(uuid.New(), uuid.Nil, "chirpy_client_test", []string{auth.ScopeChirpsRead}, keys, time.Hour)
+	if err != nil {
+		t.Fatalf("MakeClientJWT() resulted in error: %v", err)
+	}
+
+	for _, route := range protectedRoutes {
+		expected := http.StatusForbidden
+		if route.firstParty {
+			expected = http.StatusUnauthorized
+		}
+
+		t.Run(route.method+" "+route.path, func(t *testing.T) {
+			req := httptest.NewRequest(route.method, route.path, strings.NewReader(`{}`))
+			req.Header.Set("Authorization", "Bearer "+readOnly)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != expected {
+				t.Fatalf("expected %d got %d: %s", expected, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestResetRequiresDevPlatform(t *testing.T) {
+	keys := newTestKeyring(t, auth.KeyringConfig{Algorithm: auth.AlgorithmEdDSA, Audience: defaultJWTAudience})
+
+	tests := []struct {
+		name     string
+		platform string
+		expected int
+	}{
+		{"production refuses before authenticating", "", http.StatusForbidden},
+		{"staging refuses before authenticating", "staging", http.StatusForbidden},
+		{"dev still requires an admin", platformDev, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &apiConfig{jwtKeys: keys, platform: tt.platform, metrics: metrics.New()}
+			req := httptest.NewRequest("POST", "/admin/reset", nil)
+			rec := httptest.NewRecorder()
+			cfg.routes().ServeHTTP(rec, req)
+
+			if rec.Code != tt.expected {
+				t.Fatalf("expected %d got %d: %s", tt.expected, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
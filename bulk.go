@@ -0,0 +1,530 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/drewheasman/chirpy/internal/audit"
+	"github.com/drewheasman/chirpy/internal/database"
+	"github.com/drewheasman/chirpy/internal/store"
+	"github.com/google/uuid"
+)
+
+const (
+	bulkBatchSize     = 500
+	bulkMaxLineLength = 1 << 20
+	bulkMaxImportSize = 1 << 30
+
+	bulkRecordUser  = "user"
+	bulkRecordChirp = "chirp"
+
+	defaultImportSource = "import"
+
+	// unsetPassword is the column default for users without a password. No
+	// bcrypt hash matches it, so they can't log in with one.
+	unsetPassword = "unset"
+)
+
+// errImportDryRun rolls back a dry run's transaction once it is done.
+var errImportDryRun = errors.New("dry run")
+
+// bulkRecord is one line of a JSON Lines import or export. Users must come
+// before the chirps that refer to them. An export uses Chirpy IDs as the
+// external IDs, so it can be imported into another server as is. Both users'
+// and chirps' external IDs are kept, so importing a file twice skips
+// everything the first run brought in.
+type bulkRecord struct {
+	Type           string    `json:"type"`
+	ExternalID     string    `json:"external_id,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+	Email          string    `json:"email,omitempty"`
+	HashedPassword string    `json:"hashed_password,omitempty"`
+	IsChirpyRed    bool      `json:"is_chirpy_red,omitempty"`
+	AuthorID       string    `json:"author_id,omitempty"`
+	Body           string    `json:"body,omitempty"`
+}
+
+// parseBulkRecord decodes and validates one line of an import.
+func parseBulkRecord(line []byte) (bulkRecord, error) {
+	decoder := json.NewDecoder(bytes.NewReader(line))
+	decoder.DisallowUnknownFields()
+
+	var record bulkRecord
+	if err := decoder.Decode(&record); err != nil {
+		return record, fmt.Errorf("invalid JSON: %w", err)
+	}
+	if record.CreatedAt.IsZero() {
+		record.CreatedAt = time.Now()
+	}
+
+	switch record.Type {
+	case bulkRecordUser:
+		if record.ExternalID == "" {
+			return record, errors.New("external_id is required")
+		}
+		if !strings.Contains(record.Email, "@") {
+			return record, errors.New("email is missing or invalid")
+		}
+		if record.HashedPassword == "" {
+			record.HashedPassword = unsetPassword
+		} else if !strings.HasPrefix(record.HashedPassword, "$2") {
+			return record, errors.New("hashed_password must be a bcrypt hash")
+		}
+	case bulkRecordChirp:
+		if record.ExternalID == "" {
+			return record, errors.New("external_id is required")
+		}
+		if record.AuthorID == "" {
+			return record, errors.New("author_id is required")
+		}
+		if record.Body == "" {
+			return record, errors.New("body is required")
+		}
+		if len(record.Body) > chirpMaxLength {
+			return record, errors.New("body is longer than " + strconv.Itoa(chirpMaxLength) + " characters")
+		}
+	default:
+		return record, fmt.Errorf("unknown type %q", record.Type)
+	}
+
+	return record, nil
+}
+
+type importLineError struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+type importReport struct {
+	DryRun         bool              `json:"dry_run"`
+	UsersImported  int               `json:"users_imported"`
+	UsersSkipped   int               `json:"users_skipped"`
+	ChirpsImported int               `json:"chirps_imported"`
+	ChirpsSkipped  int               `json:"chirps_skipped"`
+	Errors         []importLineError `json:"errors"`
+}
+
+func (r importReport) auditDetails() map[string]any {
+	return map[string]any{
+		"users_imported":  r.UsersImported,
+		"users_skipped":   r.UsersSkipped,
+		"chirps_imported": r.ChirpsImported,
+		"chirps_skipped":  r.ChirpsSkipped,
+		"errors":          len(r.Errors),
+	}
+}
+
+type importOptions struct {
+	Source string
+	DryRun bool
+}
+
+type importLine struct {
+	number int
+	record bulkRecord
+}
+
+// importer buffers lines and writes them a batch at a time, one multi-row
+// insert per table.
+type importer struct {
+	store  store.Store
+	source string
+	report *importReport
+
+	users  []importLine
+	chirps []importLine
+}
+
+func (im *importer) fail(line int, err error) {
+	im.report.Errors = append(im.report.Errors, importLineError{Line: line, Error: err.Error()})
+}
+
+func (im *importer) flush(ctx context.Context) error {
+	if err := im.flushUsers(ctx); err != nil {
+		return err
+	}
+	return im.flushChirps(ctx)
+}
+
+// emailKey is how emails are compared when looking for duplicates, so that
+// addresses differing only in case count as the same.
+func emailKey(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+func (im *importer) flushUsers(ctx context.Context) error {
+	if len(im.users) == 0 {
+		return nil
+	}
+	lines := im.users
+	im.users = nil
+
+	externalIds := []string{}
+	emails := []string{}
+	for _, l := range lines {
+		externalIds = append(externalIds, l.record.ExternalID)
+		emails = append(emails, emailKey(l.record.Email))
+	}
+
+	mapped, err := im.store.GetExternalUserIDs(ctx, database.GetExternalUserIDsParams{
+		Source:      im.source,
+		ExternalIds: externalIds,
+	})
+	if err != nil {
+		return err
+	}
+	seenIds := map[string]bool{}
+	for _, m := range mapped {
+		seenIds[m.ExternalID] = true
+	}
+
+	taken, err := im.store.GetUsersByEmails(ctx, emails)
+	if err != nil {
+		return err
+	}
+	seenEmails := map[string]bool{}
+	for _, email := range taken {
+		seenEmails[emailKey(email)] = true
+	}
+
+	params := database.ImportUsersParams{}
+	importedIds := []string{}
+	inBatch := map[string]bool{}
+	for _, l := range lines {
+		// Users imported by an earlier run are skipped, as flushChirps
+		// skips chirps, so a failed import can be fixed and run again.
+		if seenIds[l.record.ExternalID] {
+			im.report.UsersSkipped++
+			continue
+		}
+		if inBatch[l.record.ExternalID] {
+			im.fail(l.number, errors.New("duplicate external_id"))
+			continue
+		}
+		if seenEmails[emailKey(l.record.Email)] {
+			im.fail(l.number, errors.New("email is already in use"))
+			continue
+		}
+		inBatch[l.record.ExternalID] = true
+		seenEmails[emailKey(l.record.Email)] = true
+
+		importedIds = append(importedIds, l.record.ExternalID)
+		params.Ids = append(params.Ids, uuid.New())
+		params.CreatedAt = append(params.CreatedAt, l.record.CreatedAt)
+		params.Emails = append(params.Emails, l.record.Email)
+		params.HashedPasswords = append(params.HashedPasswords, l.record.HashedPassword)
+		params.IsChirpyRed = append(params.IsChirpyRed, l.record.IsChirpyRed)
+	}
+	if len(params.Ids) == 0 {
+		return nil
+	}
+
+	if err := im.store.ImportUsers(ctx, params); err != nil {
+		return err
+	}
+	err = im.store.CreateExternalUserIDs(ctx, database.CreateExternalUserIDsParams{
+		Source:      im.source,
+		ExternalIds: importedIds,
+		UserIds:     params.Ids,
+	})
+	if err != nil {
+		return err
+	}
+
+	im.report.UsersImported += len(params.Ids)
+	return nil
+}
+
+func (im *importer) flushChirps(ctx context.Context) error {
+	if len(im.chirps) == 0 {
+		return nil
+	}
+	lines := im.chirps
+	im.chirps = nil
+
+	externalIds := []string{}
+	authorIds := []string{}
+	for _, l := range lines {
+		externalIds = append(externalIds, l.record.ExternalID)
+		authorIds = append(authorIds, l.record.AuthorID)
+	}
+
+	seen, err := im.store.GetExternalChirpIDs(ctx, database.GetExternalChirpIDsParams{
+		Source:      im.source,
+		ExternalIds: externalIds,
+	})
+	if err != nil {
+		return err
+	}
+	seenIds := map[string]bool{}
+	for _, id := range seen {
+		seenIds[id] = true
+	}
+
+	mapped, err := im.store.GetExternalUserIDs(ctx, database.GetExternalUserIDsParams{
+		Source:      im.source,
+		ExternalIds: authorIds,
+	})
+	if err != nil {
+		return err
+	}
+	userIds := map[string]uuid.UUID{}
+	for _, m := range mapped {
+		userIds[m.ExternalID] = m.UserID
+	}
+
+	params := database.ImportChirpsParams{}
+	importedIds := []string{}
+	inBatch := map[string]bool{}
+	for _, l := range lines {
+		if seenIds[l.record.ExternalID] {
+			im.report.ChirpsSkipped++
+			continue
+		}
+		if inBatch[l.record.ExternalID] {
+			im.fail(l.number, errors.New("duplicate external_id"))
+			continue
+		}
+		userId, ok := userIds[l.record.AuthorID]
+		if !ok {
+			im.fail(l.number, fmt.Errorf("unknown author_id %q", l.record.AuthorID))
+			continue
+		}
+		inBatch[l.record.ExternalID] = true
+
+		importedIds = append(importedIds, l.record.ExternalID)
+		params.Ids = append(params.Ids, uuid.New())
+		params.CreatedAt = append(params.CreatedAt, l.record.CreatedAt)
+		params.Bodies = append(params.Bodies, l.record.Body)
+		params.UserIds = append(params.UserIds, userId)
+	}
+	if len(params.Ids) == 0 {
+		return nil
+	}
+
+	imported, err := im.store.ImportChirps(ctx, params)
+	if err != nil {
+		return err
+	}
+	err = im.store.CreateExternalChirpIDs(ctx, database.CreateExternalChirpIDsParams{
+		Source:      im.source,
+		ExternalIds: importedIds,
+		ChirpIds:    params.Ids,
+	})
+	if err != nil {
+		return err
+	}
+
+	im.report.ChirpsImported += int(imported)
+	return nil
+}
+
+// importJSONL imports users and chirps from r in a single transaction. Lines
+// that can't be imported are reported and skipped; any other error rolls
+// back the whole import. A dry run does all the same work and then rolls
+// back.
+func (cfg *apiConfig) importJSONL(ctx context.Context, r io.Reader, opts importOptions) (importReport, error) {
+	report := importReport{DryRun: opts.DryRun, Errors: []importLineError{}}
+	if opts.Source == "" {
+		opts.Source = defaultImportSource
+	}
+
+	err := cfg.store.InTx(ctx, func(tx store.Store) error {
+		im := &importer{
+			store:  tx,
+			source: opts.Source,
+			report: &report,
+		}
+		if err := im.importLines(ctx, r); err != nil {
+			return err
+		}
+		if opts.DryRun {
+			return errImportDryRun
+		}
+		return nil
+	})
+	if errors.Is(err, errImportDryRun) {
+		return report, nil
+	}
+	return report, err
+}
+
+// importLines reads r a line at a time, writing a batch whenever enough
+// lines are buffered.
+func (im *importer) importLines(ctx context.Context, r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), bulkMaxLineLength)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		record, err := parseBulkRecord(line)
+		if err != nil {
+			im.fail(lineNumber, err)
+			continue
+		}
+
+		// A chirp may refer to a user earlier in the same batch, so users
+		// are written first.
+		if record.Type == bulkRecordUser {
+			im.users = append(im.users, importLine{lineNumber, record})
+		} else {
+			im.chirps = append(im.chirps, importLine{lineNumber, record})
+		}
+		if len(im.users)+len(im.chirps) >= bulkBatchSize {
+			if err := im.flush(ctx); err != nil {
+				return err
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("line %d: %w", lineNumber+1, err)
+	}
+	return im.flush(ctx)
+}
+
+// exportJSONL writes every user and then every chirp to w, one JSON object
+// per line. Password hashes are left out.
+func (cfg *apiConfig) exportJSONL(ctx context.Context, w io.Writer) error {
+	encoder := json.NewEncoder(w)
+
+	afterId := uuid.Nil
+	for {
+		users, err := cfg.store.ListUsersForExport(ctx, database.ListUsersForExportParams{
+			AfterID:    afterId,
+			MaxResults: bulkBatchSize,
+		})
+		if err != nil {
+			return err
+		}
+		for _, u := range users {
+			err := encoder.Encode(bulkRecord{
+				Type:        bulkRecordUser,
+				ExternalID:  u.ID.String(),
+				CreatedAt:   u.CreatedAt,
+				Email:       u.Email,
+				IsChirpyRed: u.IsChirpyRed,
+			})
+			if err != nil {
+				return err
+			}
+			afterId = u.ID
+		}
+		if len(users) < bulkBatchSize {
+			break
+		}
+	}
+
+	afterId = uuid.Nil
+	for {
+		chirps, err := cfg.store.ListChirpsForExport(ctx, database.ListChirpsForExportParams{
+			AfterID:    afterId,
+			MaxResults: bulkBatchSize,
+		})
+		if err != nil {
+			return err
+		}
+		for _, c := range chirps {
+			err := encoder.Encode(bulkRecord{
+				Type:       bulkRecordChirp,
+				ExternalID: c.ID.String(),
+				CreatedAt:  c.CreatedAt,
+				AuthorID:   c.UserID.String(),
+				Body:       c.Body,
+			})
+			if err != nil {
+				return err
+			}
+			afterId = c.ID
+		}
+		if len(chirps) < bulkBatchSize {
+			break
+		}
+	}
+
+	return nil
+}
+
+// importHandler imports the request body. A large import takes longer than
+// the server's read and write timeouts allow, so they are lifted and the
+// body's size is capped instead.
+func (cfg *apiConfig) importHandler(w http.ResponseWriter, req *http.Request) {
+	dryRun, _ := strconv.ParseBool(req.URL.Query().Get("dry_run"))
+
+	rc := http.NewResponseController(w)
+	_ = rc.SetReadDeadline(time.Time{})
+	_ = rc.SetWriteDeadline(time.Time{})
+	body := http.MaxBytesReader(w, req.Body, bulkMaxImportSize)
+
+	report, err := cfg.importJSONL(req.Context(), body, importOptions{
+		Source: req.URL.Query().Get("source"),
+		DryRun: dryRun,
+	})
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		respondWithError(w, http.StatusRequestEntityTooLarge, "import is larger than "+strconv.FormatInt(tooLarge.Limit, 10)+" bytes, nothing was imported")
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(req.Context(), "import failed, nothing was imported", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "import failed, nothing was imported")
+		return
+	}
+
+	if !report.DryRun {
+		cfg.recordAudit(req.Context(), audit.Entry{
+			Action:  audit.ActionDataImported,
+			ActorID: uuid.NullUUID{UUID: requestPrincipal(req).UserID, Valid: true},
+			Details: report.auditDetails(),
+		})
+	}
+	slog.InfoContext(req.Context(), "import finished",
+		"dry_run", report.DryRun,
+		"users_imported", report.UsersImported,
+		"users_skipped", report.UsersSkipped,
+		"chirps_imported", report.ChirpsImported,
+		"chirps_skipped", report.ChirpsSkipped,
+		"errors", len(report.Errors),
+	)
+
+	respondWithJson(w, http.StatusOK, report)
+}
+
+// exportHandler streams the export, so once it has started an error can
+// only be reported by closing the connection before the body is finished,
+// which clients see as a broken download rather than a complete file.
+func (cfg *apiConfig) exportHandler(w http.ResponseWriter, req *http.Request) {
+	cfg.recordAudit(req.Context(), audit.Entry{
+		Action:  audit.ActionDataExported,
+		ActorID: uuid.NullUUID{UUID: requestPrincipal(req).UserID, Valid: true},
+	})
+
+	// A large export takes longer than the server's write timeout.
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", `attachment; filename="chirpy-`+time.Now().Format(time.DateOnly)+`.jsonl"`)
+	w.WriteHeader(http.StatusOK)
+
+	if err := cfg.exportJSONL(req.Context(), w); err != nil {
+		slog.ErrorContext(req.Context(), "error exporting", "error", err)
+		noteResponseError(w, "export failed")
+		if conn, _, err := http.NewResponseController(w).Hijack(); err == nil {
+			conn.Close()
+		}
+	}
+}
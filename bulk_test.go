@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/drewheasman/chirpy/internal/auth"
+	"github.com/drewheasman/chirpy/internal/database"
+	"github.com/drewheasman/chirpy/internal/store"
+)
+
+func TestParseBulkRecord(t *testing.T) {
+	tests := []struct {
+		name        string
+		line        string
+		expectedErr string
+	}{
+		{"user", `{"type":"user","external_id":"42","email":"a@example.com","created_at":"2020-01-02T03:04:05Z"}`, ""},
+		{"user with bcrypt hash", `{"type":"user","external_id":"42","email":"a@example.com","hashed_password":"$2a$10$abc"}`, ""},
+		{"chirp", `{"type":"chirp","external_id":"7","author_id":"42","body":"hello","created_at":"2020-01-02T03:04:05Z"}`, ""},
+		{"not json", `{"type":`, "invalid JSON"},
+		{"unknown field", `{"type":"user","external_id":"42","email":"a@example.com","password":"hunter2"}`, "invalid JSON"},
+		{"unknown type", `{"type":"like"}`, "unknown type"},
+		{"user without external id", `{"type":"user","email":"a@example.com"}`, "external_id is required"},
+		{"user with bad email", `{"type":"user","external_id":"42","email":"nope"}`, "email"},
+		{"user with plain password", `{"type":"user","external_id":"42","email":"a@example.com","hashed_password":"hunter2"}`, "bcrypt"},
+		{"chirp without external id", `{"type":"chirp","author_id":"42","body":"hello"}`, "external_id is required"},
+		{"chirp without author", `{"type":"chirp","external_id":"7","body":"hello"}`, "author_id is required"},
+		{"chirp without body", `{"type":"chirp","external_id":"7","author_id":"42"}`, "body is required"},
+		{"chirp too long", `{"type":"chirp","external_id":"7","author_id":"42","body":"` + strings.Repeat("a", chirpMaxLength+1) + `"}`, "longer than"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			record, err := parseBulkRecord([]byte(tt.line))
+			if tt.expectedErr == "" {
+				if err != nil {
+					t.Fatalf("parseBulkRecord() resulted in error: %v", err)
+				}
+				if record.CreatedAt.IsZero() {
+					t.Fatalf("expected created_at to be set")
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.expectedErr) {
+				t.Fatalf("expected error containing %q got %v", tt.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestParseBulkRecordKeepsCreatedAt(t *testing.T) {
+	record, err := parseBulkRecord([]byte(`{"type":"chirp","external_id":"7","author_id":"42","body":"hi","created_at":"2011-03-04T05:06:07Z"}`))
+	if err != nil {
+		t.Fatalf("parseBulkRecord() resulted in error: %v", err)
+	}
+	if got := record.CreatedAt.Format(time.RFC3339); got != "2011-03-04T05:06:07Z" {
+		t.Fatalf("expected original created_at got %s", got)
+	}
+}
+
+func TestParseBulkRecordDefaultsPassword(t *testing.T) {
+	record, err := parseBulkRecord([]byte(`{"type":"user","external_id":"42","email":"a@example.com"}`))
+	if err != nil {
+		t.Fatalf("parseBulkRecord() resulted in error: %v", err)
+	}
+	if record.HashedPassword != unsetPassword {
+		t.Fatalf("expected %q got %q", unsetPassword, record.HashedPassword)
+	}
+}
+
+func TestImportJSONLIgnoresEmailCase(t *testing.T) {
+	server, cfg := newMemoryTestServer(t)
+	existing := signUp(t, server.URL, cfg, auth.RoleUser)
+
+	lines := strings.Join([]string{
+		`{"type":"user","external_id":"1","email":"` + strings.ToUpper(existing.Email) + `"}`,
+		`{"type":"user","external_id":"2","email":"new@example.com"}`,
+		`{"type":"user","external_id":"3","email":" New@Example.com"}`,
+	}, "\n")
+	report, err := cfg.importJSONL(context.Background(), strings.NewReader(lines), importOptions{})
+	if err != nil {
+		t.Fatalf("importJSONL() resulted in error: %v", err)
+	}
+	if report.UsersImported != 1 || len(report.Errors) != 2 {
+		t.Fatalf("expected 1 user imported and 2 errors got %+v", report)
+	}
+	for i, line := range []int{1, 3} {
+		if report.Errors[i].Line != line || report.Errors[i].Error != "email is already in use" {
+			t.Errorf("expected line %d to be a duplicate email got %+v", line, report.Errors[i])
+		}
+	}
+}
+
+func TestImportJSONLTwiceSkipsImportedRows(t *testing.T) {
+	_, cfg := newMemoryTestServer(t)
+
+	lines := strings.Join([]string{
+		`{"type":"user","external_id":"u1","email":"reimported@example.com"}`,
+		`{"type":"chirp","external_id":"c1","author_id":"u1","body":"first"}`,
+		`{"type":"chirp","external_id":"c2","author_id":"u1","body":"second"}`,
+		`{"type":"chirp","external_id":"c2","author_id":"u1","body":"second again"}`,
+	}, "\n")
+	report, err := cfg.importJSONL(context.Background(), strings.NewReader(lines), importOptions{})
+	if err != nil {
+		t.Fatalf("importJSONL() resulted in error: %v", err)
+	}
+	if report.UsersImported != 1 || report.ChirpsImported != 2 || len(report.Errors) != 1 {
+		t.Fatalf("expected 1 user, 2 chirps and a duplicate external_id got %+v", report)
+	}
+
+	report, err = cfg.importJSONL(context.Background(), strings.NewReader(lines), importOptions{})
+	if err != nil {
+		t.Fatalf("importJSONL() resulted in error: %v", err)
+	}
+	if report.UsersImported != 0 || report.UsersSkipped != 1 || report.ChirpsImported != 0 || report.ChirpsSkipped != 3 {
+		t.Fatalf("expected the second run to skip everything got %+v", report)
+	}
+	chirps, err := cfg.store.GetChirps(context.Background())
+	if err != nil {
+		t.Fatalf("GetChirps() resulted in error: %v", err)
+	}
+	if len(chirps) != 2 {
+		t.Fatalf("expected 2 chirps after importing twice got %d", len(chirps))
+	}
+}
+
+// failingExportStore fails partway through an export, once the users have
+// been written.
+type failingExportStore struct {
+	store.Store
+}
+
+func (failingExportStore) ListChirpsForExport(ctx context.Context, arg database.ListChirpsForExportParams) ([]database.ListChirpsForExportRow, error) {
+	return nil, errors.New("connection reset")
+}
+
+func TestExportFailureEndsTheDownload(t *testing.T) {
+	server, cfg := newMemoryTestServer(t)
+	admin := signUp(t, server.URL, cfg, auth.RoleAdmin)
+	cfg.store = failingExportStore{Store: cfg.store}
+
+	req, err := http.NewRequest("GET", server.URL+"/admin/export", nil)
+	if err != nil {
+		t.Fatalf("http.NewRequest() resulted in error: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+admin.Token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET /admin/export resulted in error: %v", err)
+	}
+	defer resp.Body.Close()
+	if _, err := io.ReadAll(resp.Body); err == nil {
+		t.Fatal("expected the download to be cut off")
+	}
+
+	// The request is still logged, with the error, once the handler returns.
+	var buf bytes.Buffer
+	defaultLogger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, nil)))
+	t.Cleanup(func() { slog.SetDefault(defaultLogger) })
+
+	req = httptest.NewRequest(http.MethodGet, "/admin/export", nil)
+	cfg.middlewareObserveRequest(http.HandlerFunc(cfg.exportHandler)).ServeHTTP(httptest.NewRecorder(), req)
+	if !strings.Contains(buf.String(), `"msg":"request"`) || !strings.Contains(buf.String(), `"error":"export failed"`) {
+		t.Fatalf("expected the request to be logged with its error, got %s", buf.String())
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/drewheasman/chirpy/internal/audit"
+	"github.com/drewheasman/chirpy/internal/config"
+	"github.com/drewheasman/chirpy/internal/metrics"
+)
+
+const commandUsage = `usage: chirpy [serve] [flags]
+       chirpy command [arguments]
+
+With no command, chirpy runs the server. Flags override settings from the
+config file and the environment; see chirpy -help for the list. Other
+commands read the config file and the environment only.
+
+commands:
+  serve [flags]                             run the server
+  migrate up|down|status|to VERSION         apply or roll back database migrations
+  user create [-role role] email            create a user, reading the password from stdin
+  user promote [-role role] user            change a user's role, to admin by default
+  user suspend -reason text user            suspend a user and revoke their sessions
+  token revoke-user user                    revoke every session and token of a user
+  chirps purge -before date                 delete chirps created before date
+  seed [-users N] [-chirps M]               fill a dev database with sample data
+  import [-dry-run] [-source name] [file]   import users and chirps from JSON Lines
+  export [-o file]                          export users and chirps as JSON Lines
+  config print [flags]                      print the effective config, secrets redacted
+
+A user is an email address or a user ID.`
+
+// runCommand runs a command line subcommand and returns its exit code.
+func runCommand(name string, args []string) int {
+	switch name {
+	case "serve":
+		return runServeCommand(args)
+	case "user":
+		return runUserCommand(args)
+	case "token":
+		return runTokenCommand(args)
+	case "chirps":
+		return runChirpsCommand(args)
+	case "seed":
+		return runSeedCommand(args)
+	case "import":
+		return runImportCommand(args)
+	case "export":
+		return runExportCommand(args)
+	case "migrate":
+		return runMigrateCommand(args)
+	case "config":
+		return runConfigCommand(args)
+	case "help", "-h", "-help", "--help":
+		fmt.Println(commandUsage)
+		return 0
+	}
+
+	fmt.Fprintln(os.Stderr, "unknown command:", name)
+	fmt.Fprintln(os.Stderr, commandUsage)
+	return 2
+}
+
+// newCommandConfig connects to the database for commands that only need
+// the database. The config comes from the config file and the environment,
+// as commands have flags of their own.
+func newCommandConfig() (*apiConfig, error) {
+	conf, err := config.Load(nil, os.Getenv)
+	if err != nil {
+		return nil, configError(err)
+	}
+	if _, err := newLogger(conf.Log); err != nil {
+		return nil, err
+	}
+
+	db, err := openDB(conf.Database)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		return nil, fmt.Errorf("error connecting to database: %w", err)
+	}
+
+	dataStore := newStore(conf.Database.Driver, db)
+	return &apiConfig{
+		platform: conf.Platform,
+		db:       db,
+		dbDriver: conf.Database.Driver,
+		store:    dataStore,
+		auditLog: audit.New(dataStore, []byte(conf.Audit.HashKey)),
+		metrics:  metrics.New(),
+	}, nil
+}
+
+func runImportCommand(args []string) int {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "check the file and report errors without importing anything")
+	source := flags.String("source", defaultImportSource, "name of the system the file came from, which external IDs belong to")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	var r io.Reader = os.Stdin
+	if path := flags.Arg(0); path != "" && path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer f.Close()
+		r = f
+	}
+
+	cfg, err := newCommandConfig()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer cfg.db.Close()
+
+	report, err := cfg.importJSONL(context.Background(), r, importOptions{Source: *source, DryRun: *dryRun})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "import failed, nothing was imported:", err)
+		return 1
+	}
+
+	if !report.DryRun {
+		cfg.recordAudit(context.Background(), audit.Entry{
+			Action:  audit.ActionDataImported,
+			Details: report.auditDetails(),
+		})
+	}
+
+	for _, lineErr := range report.Errors {
+		fmt.Fprintf(os.Stderr, "line %d: %s\n", lineErr.Line, lineErr.Error)
+	}
+	verb := "imported"
+	if report.DryRun {
+		verb = "would import"
+	}
+	fmt.Printf("%s %d users and %d chirps, skipped %d users and %d chirps already imported, %d errors\n",
+		verb, report.UsersImported, report.ChirpsImported, report.UsersSkipped, report.ChirpsSkipped, len(report.Errors))
+
+	if len(report.Errors) > 0 {
+		return 1
+	}
+	return 0
+}
+
+func runExportCommand(args []string) int {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	output := flags.String("o", "-", "file to write to, or - for stdout")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	cfg, err := newCommandConfig()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer cfg.db.Close()
+
+	var w io.Writer = os.Stdout
+	if *output != "-" {
+		f, err := os.Create(*output)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer f.Close()
+		w = f
+	}
+
+	cfg.recordAudit(context.Background(), audit.Entry{Action: audit.ActionDataExported})
+
+	buffered := bufio.NewWriter(w)
+	if err := cfg.exportJSONL(context.Background(), buffered); err != nil {
+		fmt.Fprintln(os.Stderr, "export failed:", err)
+		return 1
+	}
+	if err := buffered.Flush(); err != nil {
+		fmt.Fprintln(os.Stderr, "export failed:", err)
+		return 1
+	}
+	return 0
+}
+
+// runConfigCommand prints the config the server would run with. It prints
+// an invalid config too, followed by what is wrong with it, since that is
+// usually why someone is looking.
+func runConfigCommand(args []string) int {
+	if len(args) == 0 || args[0] != "print" {
+		fmt.Fprintln(os.Stderr, "usage: chirpy config print [flags]")
+		return 2
+	}
+
+	conf, err := config.Load(args[1:], os.Getenv)
+	var fieldErr *config.FieldError
+	if err != nil && !errors.As(err, &fieldErr) {
+		fmt.Fprintln(os.Stderr, configError(err))
+		return 2
+	}
+	// The printed config is the one serve would run with.
+	err = errors.Join(err, conf.ValidateServe())
+
+	if err := config.Print(os.Stdout, conf); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, configError(err))
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,435 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/drewheasman/chirpy/internal/audit"
+	"github.com/drewheasman/chirpy/internal/blob"
+	"github.com/drewheasman/chirpy/internal/config"
+	"github.com/drewheasman/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	dataExportInterval   = time.Minute
+	dataExportLinkTTL    = time.Hour
+	dataExportRetention  = 7 * 24 * time.Hour
+	dataExportStaleAfter = 30 * time.Minute
+
+	dataExportComplete = "complete"
+
+	dataExportWorker = "data_exports"
+)
+
+// newExportStorage opens the blob store exports are written to and the
+// signer for their download links. Without a signing key a random key is
+// used, so links stop working on restart and only work on the server that
+// made them.
+func newExportStorage(c config.Exports) (blob.Store, *blob.Signer, error) {
+	store, err := blob.NewFSStore(c.BlobDir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error opening exports.blob_dir: %w", err)
+	}
+
+	secret := []byte(c.SigningKey)
+	if len(secret) == 0 {
+		slog.Warn("exports.signing_key is not set, export links will not survive a restart")
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return store, blob.NewSigner(secret), nil
+}
+
+type DataExport struct {
+	ID          uuid.UUID  `json:"id"`
+	Status      string     `json:"status"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+	Error       string     `json:"error,omitempty"`
+	DownloadURL string     `json:"download_url,omitempty"`
+}
+
+func (cfg *apiConfig) dataExportResponse(export database.DataExport) DataExport {
+	response := DataExport{
+		ID:          export.ID,
+		Status:      export.Status,
+		CreatedAt:   export.CreatedAt,
+		CompletedAt: nullTimePtr(export.CompletedAt),
+		ExpiresAt:   nullTimePtr(export.ExpiresAt),
+		Error:       export.Error.String,
+	}
+	if export.Status == dataExportComplete {
+		response.DownloadURL = cfg.dataExportDownloadURL(export)
+	}
+
+	return response
+}
+
+// dataExportDownloadURL signs a link that works without logging in, so it
+// can be opened in a browser. It never outlives the export itself.
+func (cfg *apiConfig) dataExportDownloadURL(export database.DataExport) string {
+	ttl := dataExportLinkTTL
+	if remaining := time.Until(export.ExpiresAt.Time); remaining < ttl {
+		ttl = remaining
+	}
+	expires, signature := cfg.exportSigner.Sign(export.ID.String(), ttl)
+
+	query := url.Values{}
+	query.Set("expires", strconv.FormatInt(expires, 10))
+	query.Set("signature", signature)
+	return "/api/exports/" + export.ID.String() + "/download?" + query.Encode()
+}
+
+// createDataExportHandler queues an export of everything stored about the
+// caller. The archive is built in the background by RunDataExports.
+func (cfg *apiConfig) createDataExportHandler(w http.ResponseWriter, req *http.Request) {
+	userId := requestPrincipal(req).UserID
+
+	active, err := cfg.store.CountActiveDataExportsForUser(req.Context(), userId)
+	if err != nil {
+		slog.ErrorContext(req.Context(), "error creating export", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "error creating export")
+		return
+	}
+	if active > 0 {
+		respondWithError(w, http.StatusConflict, "an export is already in progress")
+		return
+	}
+
+	export, err := cfg.store.CreateDataExport(req.Context(), userId)
+	if err != nil {
+		slog.ErrorContext(req.Context(), "error creating export", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "error creating export")
+		return
+	}
+
+	select {
+	case cfg.dataExportQueued <- struct{}{}:
+	default:
+	}
+
+	slog.InfoContext(req.Context(), "data export queued")
+
+	respondWithJson(w, http.StatusAccepted, cfg.dataExportResponse(export))
+}
+
+func (cfg *apiConfig) getDataExportHandler(w http.ResponseWriter, req *http.Request) {
+	exportId, err := uuid.Parse(req.PathValue("id"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "error parsing uuid from given id path param")
+		return
+	}
+
+	export, err := cfg.store.GetDataExportForUser(req.Context(), database.GetDataExportForUserParams{
+		ID:     exportId,
+		UserID: requestPrincipal(req).UserID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "export not found")
+		return
+	}
+
+	respondWithJson(w, http.StatusOK, cfg.dataExportResponse(export))
+}
+
+// downloadDataExportHandler serves the archive to anyone holding a link from
+// dataExportDownloadURL. The signature is the credential.
+func (cfg *apiConfig) downloadDataExportHandler(w http.ResponseWriter, req *http.Request) {
+	expires, err := strconv.ParseInt(req.URL.Query().Get("expires"), 10, 64)
+	if err != nil || !cfg.exportSigner.Verify(req.PathValue("id"), expires, req.URL.Query().Get("signature")) {
+		respondWithError(w, http.StatusForbidden, "invalid or expired download link")
+		return
+	}
+
+	exportId, err := uuid.Parse(req.PathValue("id"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "error parsing uuid from given id path param")
+		return
+	}
+
+	export, err := cfg.store.GetDataExport(req.Context(), exportId)
+	if err != nil || export.Status != dataExportComplete || !export.ExpiresAt.Time.After(time.Now()) {
+		respondWithError(w, http.StatusNotFound, "export not found")
+		return
+	}
+
+	r, err := cfg.blobStore.Open(req.Context(), export.BlobKey.String)
+	if err != nil {
+		slog.WarnContext(req.Context(), "export not found", "error", err)
+		respondWithError(w, http.StatusNotFound, "export not found")
+		return
+	}
+	defer r.Close()
+
+	// A large archive takes longer than the server's write timeout.
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="chirpy-export-`+export.CreatedAt.Format(time.DateOnly)+`.zip"`)
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(w, r); err != nil {
+		slog.ErrorContext(req.Context(), "error sending data export", "export_id", export.ID, "error", err)
+	}
+}
+
+// dataExportContents is everything an export contains. Each part is written
+// to the archive as both JSON and CSV.
+type dataExportContents struct {
+	Profile      database.User
+	Chirps       []database.Chirp
+	Sessions     []database.GetSessionHistoryForUserRow
+	Subscription []database.GetAuditLogForTargetRow
+}
+
+func (cfg *apiConfig) gatherDataExport(ctx context.Context, userID uuid.UUID) (dataExportContents, error) {
+	var contents dataExportContents
+	var err error
+
+	contents.Profile, err = cfg.store.GetUser(ctx, userID)
+	if err != nil {
+		return contents, err
+	}
+	contents.Chirps, err = cfg.store.GetChirpsByUser(ctx, userID)
+	if err != nil {
+		return contents, err
+	}
+	contents.Sessions, err = cfg.store.GetSessionHistoryForUser(ctx, userID)
+	if err != nil {
+		return contents, err
+	}
+	contents.Subscription, err = cfg.store.GetAuditLogForTarget(ctx, database.GetAuditLogForTargetParams{
+		TargetUserID: uuid.NullUUID{UUID: userID, Valid: true},
+		Actions:      []string{audit.ActionUserChirpyRedGranted, audit.ActionUserChirpyRedRemoved},
+	})
+	if err != nil {
+		return contents, err
+	}
+
+	return contents, nil
+}
+
+func formatNullTime(t sql.NullTime) string {
+	if !t.Valid {
+		return ""
+	}
+	return t.Time.Format(time.RFC3339)
+}
+
+// writeDataExportArchive writes contents as a zip. Password hashes, TOTP
+// secrets and token hashes are left out; they aren't the user's data so much
+// as the means to get at it.
+func writeDataExportArchive(w io.Writer, contents dataExportContents) error {
+	type profileExport struct {
+		ID          uuid.UUID `json:"id"`
+		CreatedAt   time.Time `json:"created_at"`
+		UpdatedAt   time.Time `json:"updated_at"`
+		Email       string    `json:"email"`
+		IsChirpyRed bool      `json:"is_chirpy_red"`
+		Role        string    `json:"role"`
+		TotpEnabled bool      `json:"totp_enabled"`
+	}
+	type chirpExport struct {
+		ID        uuid.UUID `json:"id"`
+		CreatedAt time.Time `json:"created_at"`
+		UpdatedAt time.Time `json:"updated_at"`
+		Body      string    `json:"body"`
+	}
+	type sessionExport struct {
+		SessionID  uuid.UUID  `json:"session_id"`
+		CreatedAt  time.Time  `json:"created_at"`
+		LastUsedAt time.Time  `json:"last_used_at"`
+		ExpiresAt  time.Time  `json:"expires_at"`
+		RevokedAt  *time.Time `json:"revoked_at"`
+		DeviceName string     `json:"device_name"`
+		UserAgent  string     `json:"user_agent"`
+		IP         string     `json:"ip"`
+		ClientID   string     `json:"client_id,omitempty"`
+	}
+	type subscriptionExport struct {
+		CreatedAt time.Time       `json:"created_at"`
+		Event     string          `json:"event"`
+		Details   json.RawMessage `json:"details"`
+	}
+
+	p := contents.Profile
+	profile := profileExport{p.ID, p.CreatedAt, p.UpdatedAt, p.Email, p.IsChirpyRed, p.Role, p.TotpEnabled}
+	profileRows := [][]string{
+		{"id", "created_at", "updated_at", "email", "is_chirpy_red", "role", "totp_enabled"},
+		{p.ID.String(), p.CreatedAt.Format(time.RFC3339), p.UpdatedAt.Format(time.RFC3339), p.Email, strconv.FormatBool(p.IsChirpyRed), p.Role, strconv.FormatBool(p.TotpEnabled)},
+	}
+
+	chirps := []chirpExport{}
+	chirpRows := [][]string{{"id", "created_at", "updated_at", "body"}}
+	for _, c := range contents.Chirps {
+		chirps = append(chirps, chirpExport{c.ID, c.CreatedAt, c.UpdatedAt, c.Body})
+		chirpRows = append(chirpRows, []string{c.ID.String(), c.CreatedAt.Format(time.RFC3339), c.UpdatedAt.Format(time.RFC3339), c.Body})
+	}
+
+	sessions := []sessionExport{}
+	sessionRows := [][]string{{"session_id", "created_at", "last_used_at", "expires_at", "revoked_at", "device_name", "user_agent", "ip", "client_id"}}
+	for _, s := range contents.Sessions {
+		sessions = append(sessions, sessionExport{s.FamilyID, s.CreatedAt, s.LastUsedAt, s.ExpiresAt, nullTimePtr(s.RevokedAt), s.DeviceName, s.UserAgent, s.Ip, s.ClientID.String})
+		sessionRows = append(sessionRows, []string{s.FamilyID.String(), s.CreatedAt.Format(time.RFC3339), s.LastUsedAt.Format(time.RFC3339), s.ExpiresAt.Format(time.RFC3339), formatNullTime(s.RevokedAt), s.DeviceName, s.UserAgent, s.Ip, s.ClientID.String})
+	}
+
+	subscription := []subscriptionExport{}
+	subscriptionRows := [][]string{{"created_at", "event", "details"}}
+	for _, e := range contents.Subscription {
+		subscription = append(subscription, subscriptionExport{e.CreatedAt, e.Action, e.Details})
+		subscriptionRows = append(subscriptionRows, []string{e.CreatedAt.Format(time.RFC3339), e.Action, string(e.Details)})
+	}
+
+	files := []struct {
+		name string
+		json any
+		csv  [][]string
+	}{
+		{"profile", profile, profileRows},
+		{"chirps", chirps, chirpRows},
+		{"sessions", sessions, sessionRows},
+		{"subscription", subscription, subscriptionRows},
+	}
+
+	zw := zip.NewWriter(w)
+	for _, file := range files {
+		jw, err := zw.Create(file.name + ".json")
+		if err != nil {
+			return err
+		}
+		encoder := json.NewEncoder(jw)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(file.json); err != nil {
+			return err
+		}
+
+		cw, err := zw.Create(file.name + ".csv")
+		if err != nil {
+			return err
+		}
+		if err := csv.NewWriter(cw).WriteAll(file.csv); err != nil {
+			return err
+		}
+	}
+
+	return zw.Close()
+}
+
+// runDataExport builds one export and streams it into the blob store.
+func (cfg *apiConfig) runDataExport(ctx context.Context, export database.DataExport) error {
+	contents, err := cfg.gatherDataExport(ctx, export.UserID)
+	if err != nil {
+		return err
+	}
+
+	key := "exports/" + export.UserID.String() + "/" + export.ID.String() + ".zip"
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(writeDataExportArchive(pw, contents))
+	}()
+	if err := cfg.blobStore.Put(ctx, key, pr); err != nil {
+		pr.CloseWithError(err)
+		return err
+	}
+
+	return cfg.store.CompleteDataExport(ctx, database.CompleteDataExportParams{
+		ID:        export.ID,
+		BlobKey:   sql.NullString{String: key, Valid: true},
+		ExpiresAt: sql.NullTime{Time: time.Now().Add(dataExportRetention), Valid: true},
+	})
+}
+
+// processDataExports runs queued exports until there are none left.
+func (cfg *apiConfig) processDataExports(ctx context.Context) error {
+	for {
+		export, err := cfg.store.ClaimDataExport(ctx, time.Now().Add(-dataExportStaleAfter))
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := cfg.runDataExport(ctx, export); err != nil {
+			slog.ErrorContext(ctx, "error running data export", "export_id", export.ID, "error", err)
+			err = cfg.store.FailDataExport(ctx, database.FailDataExportParams{
+				ID:        export.ID,
+				Error:     sql.NullString{String: "export failed, please try again", Valid: true},
+				ExpiresAt: sql.NullTime{Time: time.Now().Add(dataExportRetention), Valid: true},
+			})
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		slog.InfoContext(ctx, "data export complete", "export_id", export.ID)
+	}
+}
+
+// deleteExpiredDataExports removes exports past their retention, along with
+// their archives.
+func (cfg *apiConfig) deleteExpiredDataExports(ctx context.Context) error {
+	keys, err := cfg.store.DeleteExpiredDataExports(ctx, sql.NullTime{Time: time.Now(), Valid: true})
+	if err != nil {
+		return err
+	}
+	cfg.deleteDataExportBlobs(ctx, keys)
+
+	return nil
+}
+
+func (cfg *apiConfig) deleteDataExportBlobs(ctx context.Context, keys []sql.NullString) {
+	for _, key := range keys {
+		if !key.Valid {
+			continue
+		}
+		if err := cfg.blobStore.Delete(ctx, key.String); err != nil {
+			slog.ErrorContext(ctx, "error deleting data export archive", "key", key.String, "error", err)
+		}
+	}
+}
+
+// RunDataExports processes queued exports every dataExportInterval, or as
+// soon as one is queued on this server, until ctx is cancelled. Exports are
+// claimed with FOR UPDATE SKIP LOCKED, so several servers can run it at once.
+func (cfg *apiConfig) RunDataExports(ctx context.Context) error {
+	ticker := time.NewTicker(dataExportInterval)
+	defer ticker.Stop()
+	cfg.workers.register(dataExportWorker, dataExportInterval)
+
+	for {
+		err := cfg.deleteExpiredDataExports(ctx)
+		if err != nil {
+			slog.ErrorContext(ctx, "error deleting expired exports", "error", err)
+		}
+		if processErr := cfg.processDataExports(ctx); processErr != nil {
+			slog.ErrorContext(ctx, "error processing exports", "error", processErr)
+			err = processErr
+		}
+		cfg.workers.record(dataExportWorker, err)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		case <-cfg.dataExportQueued:
+		}
+	}
+}
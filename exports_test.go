@@ -0,0 +1,121 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/drewheasman/chirpy/internal/audit"
+	"github.com/drewheasman/chirpy/internal/blob"
+	"github.com/drewheasman/chirpy/internal/config"
+	"github.com/drewheasman/chirpy/internal/database"
+	"github.com/drewheasman/chirpy/internal/metrics"
+	"github.com/google/uuid"
+)
+
+func TestWriteDataExportArchive(t *testing.T) {
+	userID := uuid.New()
+	now := time.Now()
+	contents := dataExportContents{
+		Profile: database.User{
+			ID:             userID,
+			CreatedAt:      now,
+			UpdatedAt:      now,
+			Email:          "walt@example.com",
+			HashedPassword: "hash-that-must-not-leak",
+			TotpSecret:     sql.NullString{String: "secret-that-must-not-leak", Valid: true},
+			Role:           "user",
+		},
+		Chirps: []database.Chirp{
+			{ID: uuid.New(), CreatedAt: now, UpdatedAt: now, Body: "hello, \"world\"", UserID: userID},
+		},
+		Sessions: []database.GetSessionHistoryForUserRow{
+			{FamilyID: uuid.New(), CreatedAt: now, LastUsedAt: now, ExpiresAt: now, DeviceName: "laptop"},
+		},
+		Subscription: []database.GetAuditLogForTargetRow{
+			{CreatedAt: now, Action: audit.ActionUserChirpyRedGranted, Details: json.RawMessage(`{"source":"polka"}`)},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := writeDataExportArchive(&buf, contents); err != nil {
+		t.Fatalf("writeDataExportArchive() resulted in error: %v", err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("zip.NewReader() resulted in error: %v", err)
+	}
+
+	files := map[string]string{}
+	for _, f := range zr.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatalf("opening %s resulted in error: %v", f.Name, err)
+		}
+		data, _ := io.ReadAll(r)
+		r.Close()
+		files[f.Name] = string(data)
+	}
+
+	expectedRows := map[string]int{"profile": 2, "chirps": 2, "sessions": 2, "subscription": 2}
+	for name, rows := range expectedRows {
+		if !json.Valid([]byte(files[name+".json"])) {
+			t.Fatalf("%s.json is not valid JSON: %s", name, files[name+".json"])
+		}
+		records, err := csv.NewReader(strings.NewReader(files[name+".csv"])).ReadAll()
+		if err != nil {
+			t.Fatalf("reading %s.csv resulted in error: %v", name, err)
+		}
+		if len(records) != rows {
+			t.Fatalf("expected %d rows in %s.csv got %d", rows, name, len(records))
+		}
+	}
+
+	for name, data := range files {
+		if strings.Contains(data, "must-not-leak") {
+			t.Fatalf("%s contains a credential", name)
+		}
+	}
+}
+
+func TestDownloadDataExportRejectsBadLinks(t *testing.T) {
+	signer := blob.NewSigner([]byte("test"))
+	cfg := &apiConfig{exportSigner: signer, metrics: metrics.New(), features: config.Default().Features}
+	handler := cfg.routes()
+
+	exportID := uuid.NewString()
+	expires, signature := signer.Sign(exportID, time.Hour)
+	expired, expiredSignature := signer.Sign(exportID, -time.Minute)
+
+	tests := []struct {
+		name  string
+		query string
+	}{
+		{"no signature", ""},
+		{"tampered signature", "?expires=" + strconv.FormatInt(expires, 10) + "&signature=" + signature + "x"},
+		{"extended expiry", "?expires=" + strconv.FormatInt(expires+60, 10) + "&signature=" + signature},
+		{"expired", "?expires=" + strconv.FormatInt(expired, 10) + "&signature=" + expiredSignature},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/api/exports/"+exportID+"/download"+tt.query, nil)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusForbidden {
+				t.Fatalf("expected 403 got %d: %s", rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
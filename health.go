@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	readinessTimeout = 2 * time.Second
+
+	// A worker is stale once it has missed this many intervals in a row.
+	workerStaleAfterIntervals = 3
+)
+
+const (
+	healthOK      = "ok"
+	healthError   = "error"
+	healthPending = "pending"
+	healthStale   = "stale"
+)
+
+type healthCheck struct {
+	Status  string     `json:"status"`
+	Error   string     `json:"error,omitempty"`
+	LastRun *time.Time `json:"last_run,omitempty"`
+}
+
+type healthResponse struct {
+	Status  string                 `json:"status"`
+	Checks  map[string]healthCheck `json:"checks,omitempty"`
+	Workers map[string]healthCheck `json:"workers,omitempty"`
+}
+
+// workerHealth keeps track of when each background worker last finished a
+// pass, for /readyz to report.
+type workerHealth struct {
+	mu      sync.Mutex
+	workers map[string]*workerState
+}
+
+type workerState struct {
+	interval time.Duration
+	lastRun  time.Time
+	lastErr  error
+}
+
+func newWorkerHealth() *workerHealth {
+	return &workerHealth{workers: map[string]*workerState{}}
+}
+
+// register adds a worker that runs every interval. It is pending until it
+// records its first pass.
+func (h *workerHealth) register(name string, interval time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.workers[name] = &workerState{interval: interval}
+}
+
+// record notes that a pass of the worker finished, with err if it failed.
+func (h *workerHealth) record(name string, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if state, ok := h.workers[name]; ok {
+		state.lastRun = time.Now()
+		state.lastErr = err
+	}
+}
+
+func (h *workerHealth) check(now time.Time) map[string]healthCheck {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	checks := map[string]healthCheck{}
+	for name, state := range h.workers {
+		if state.lastRun.IsZero() {
+			checks[name] = healthCheck{Status: healthPending}
+			continue
+		}
+
+		lastRun := state.lastRun
+		check := healthCheck{Status: healthOK, LastRun: &lastRun}
+		switch {
+		case state.lastErr != nil:
+			check.Status = healthError
+			check.Error = state.lastErr.Error()
+		case now.Sub(state.lastRun) > workerStaleAfterIntervals*state.interval:
+			check.Status = healthStale
+		}
+		checks[name] = check
+	}
+	return checks
+}
+
+func (cfg *apiConfig) checkDatabase(ctx context.Context) healthCheck {
+	if err := cfg.store.Ping(ctx); err != nil {
+		return healthCheck{Status: healthError, Error: err.Error()}
+	}
+	return healthCheck{Status: healthOK}
+}
+
+// checkMigrations fails if the database is behind this build. Being ahead is
+// fine, since during a rolling deploy the old servers see the new schema.
+func (cfg *apiConfig) checkMigrations(ctx context.Context) healthCheck {
+	migrator, err := newMigrator(cfg.db, cfg.dbDriver)
+	if err != nil {
+		return healthCheck{Status: healthError, Error: err.Error()}
+	}
+	if err := migrator.Check(ctx); err != nil {
+		return healthCheck{Status: healthError, Error: err.Error()}
+	}
+	return healthCheck{Status: healthOK}
+}
+
+// livezHandler reports that the process is up. It doesn't look at anything
+// else, so a database outage doesn't get every server restarted.
+func livezHandler(w http.ResponseWriter, _ *http.Request) {
+	respondWithJson(w, http.StatusOK, healthResponse{Status: healthOK})
+}
+
+// readyzHandler reports whether this server can take traffic: the database
+// answers in time and has been migrated. Background workers are reported
+// too, but a failing worker doesn't stop the server serving requests.
+func (cfg *apiConfig) readyzHandler(w http.ResponseWriter, req *http.Request) {
+	ctx, cancel := context.WithTimeout(req.Context(), readinessTimeout)
+	defer cancel()
+
+	response := healthResponse{
+		Status:  healthOK,
+		Checks:  map[string]healthCheck{"database": cfg.checkDatabase(ctx)},
+		Workers: cfg.workers.check(time.Now()),
+	}
+	// The memory store has no schema, so there is nothing to migrate.
+	if response.Checks["database"].Status == healthOK && cfg.db != nil {
+		response.Checks["migrations"] = cfg.checkMigrations(ctx)
+	}
+
+	statusCode := http.StatusOK
+	for _, check := range response.Checks {
+		if check.Status != healthOK {
+			response.Status = healthError
+			statusCode = http.StatusServiceUnavailable
+		}
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	respondWithJson(w, statusCode, response)
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/drewheasman/chirpy/internal/config"
+)
+
+func TestWorkerHealth(t *testing.T) {
+	now := time.Now()
+	health := newWorkerHealth()
+	health.register("pending", time.Minute)
+	health.register("ok", time.Minute)
+	health.register("failing", time.Minute)
+	health.register("stale", time.Minute)
+
+	health.record("ok", nil)
+	health.record("failing", errors.New("database is down"))
+	health.record("stale", nil)
+	health.workers["stale"].lastRun = now.Add(-time.Hour)
+	health.record("unregistered", nil)
+
+	checks := health.check(now)
+
+	tests := []struct {
+		name       string
+		wantStatus string
+	}{
+		{name: "pending", wantStatus: healthPending},
+		{name: "ok", wantStatus: healthOK},
+		{name: "failing", wantStatus: healthError},
+		{name: "stale", wantStatus: healthStale},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := checks[tt.name].Status; got != tt.wantStatus {
+				t.Errorf("status = %q, want %q", got, tt.wantStatus)
+			}
+		})
+	}
+	if _, ok := checks["unregistered"]; ok {
+		t.Error("record() added a worker that was never registered")
+	}
+	if checks["failing"].Error != "database is down" {
+		t.Errorf("error = %q, want the worker's error", checks["failing"].Error)
+	}
+}
+
+func TestCheckMigrations(t *testing.T) {
+	ctx := context.Background()
+	db, err := openDB(config.Database{Driver: "sqlite", URL: filepath.Join(t.TempDir(), "chirpy.db")})
+	if err != nil {
+		t.Fatalf("openDB() resulted in error: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	cfg := &apiConfig{db: db, dbDriver: "sqlite"}
+
+	migrator, err := newMigrator(db, "sqlite")
+	if err != nil {
+		t.Fatalf("newMigrator() resulted in error: %v", err)
+	}
+	if _, err := migrator.To(ctx, 1); err != nil {
+		t.Fatalf("To() resulted in error: %v", err)
+	}
+	if check := cfg.checkMigrations(ctx); check.Status != healthError || !strings.Contains(check.Error, "behind") {
+		t.Errorf("checkMigrations() with a migration pending = %+v, want an error saying it is behind", check)
+	}
+
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatalf("Up() resulted in error: %v", err)
+	}
+	if check := cfg.checkMigrations(ctx); check.Status != healthOK {
+		t.Errorf("checkMigrations() after migrating = %+v, want ok", check)
+	}
+}
+
+func TestLivez(t *testing.T) {
+	w := httptest.NewRecorder()
+	livezHandler(w, httptest.NewRequest(http.MethodGet, "/livez", nil))
+
+	if w.Code != http.StatusOK {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	var response healthResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("json.Unmarshal() resulted in error: %v", err)
+	}
+	if response.Status != healthOK {
+		t.Errorf("status = %q, want %q", response.Status, healthOK)
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	t.Run("postgres", func(t *testing.T) {
+		testReadyz(t, newTestServer(t))
+	})
+	t.Run("sqlite", func(t *testing.T) {
+		testReadyz(t, newSQLiteTestServer(t))
+	})
+}
+
+func testReadyz(t *testing.T, server *httptest.Server) {
+	t.Helper()
+
+	resp, err := http.Get(server.URL + "/readyz")
+	if err != nil {
+		t.Fatalf("http.Get() resulted in error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var response healthResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		t.Fatalf("Decode() resulted in error: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || response.Status != healthOK {
+		t.Errorf("readyz = %d %+v, want %d with every check ok", resp.StatusCode, response, http.StatusOK)
+	}
+	for _, name := range []string{"database", "migrations"} {
+		if response.Checks[name].Status != healthOK {
+			t.Errorf("%s check = %+v, want ok", name, response.Checks[name])
+		}
+	}
+}
@@ -0,0 +1,168 @@
+// Package audit keeps an append-only record of security relevant actions:
+// who did what to which account, from where, and what changed.
+package audit
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"reflect"
+	"strings"
+
+	"github.com/drewheasman/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	ActionLogin           = "auth.login"
+	ActionLoginFailed     = "auth.login_failed"
+	ActionPasswordChanged = "user.password_changed"
+	ActionEmailChanged    = "user.email_changed"
+	ActionTokenRevoked    = "token.revoked"
+	ActionChirpDeleted    = "chirp.deleted"
+	ActionChirpsPurged    = "chirps.purged"
+
+	ActionUserCreated          = "user.created"
+	ActionUserRoleChanged      = "user.role_changed"
+	ActionUserSuspended        = "user.suspended"
+	ActionUserUnsuspended      = "user.unsuspended"
+	ActionUserPasswordReset    = "user.password_reset_required"
+	ActionUserSessionsRevoked  = "user.sessions_revoked"
+	ActionUserChirpyRedGranted = "user.chirpy_red_granted"
+	ActionUserChirpyRedRemoved = "user.chirpy_red_removed"
+	ActionUserShadowBanned     = "user.shadow_banned"
+	ActionUserShadowBanLifted  = "user.shadow_ban_lifted"
+	ActionUserLoginUnlocked    = "user.login_unlocked"
+
+	ActionUserDeletionScheduled = "user.deletion_scheduled"
+	ActionUserDeletionCancelled = "user.deletion_cancelled"
+	ActionUserDeleted           = "user.deleted"
+
+	ActionDataImported = "data.imported"
+	ActionDataExported = "data.exported"
+)
+
+// Target types say what kind of thing an entry's target ID refers to.
+const (
+	TargetUser                = "user"
+	TargetChirp               = "chirp"
+	TargetSession             = "session"
+	TargetPersonalAccessToken = "personal_access_token"
+	TargetOAuthClient         = "oauth_client"
+)
+
+// Change is the value of one field before and after an action.
+type Change struct {
+	Old any `json:"old"`
+	New any `json:"new"`
+}
+
+// Diff maps field names to how they changed.
+type Diff map[string]Change
+
+// Changed is a Diff of a single field.
+func Changed(field string, old, new any) Diff {
+	return Diff{field: {Old: old, New: new}}
+}
+
+// Compare returns a Diff of the fields that differ between before and after.
+// A field missing from one side is compared as nil.
+func Compare(before, after map[string]any) Diff {
+	diff := Diff{}
+	for field, old := range before {
+		if new := after[field]; !reflect.DeepEqual(old, new) {
+			diff[field] = Change{Old: old, New: new}
+		}
+	}
+	for field, new := range after {
+		if _, ok := before[field]; !ok && new != nil {
+			diff[field] = Change{Old: nil, New: new}
+		}
+	}
+	return diff
+}
+
+// Entry is one action to record. The actor is null for actions the server
+// takes by itself, such as Polka webhooks and scheduled deletions.
+type Entry struct {
+	Action  string
+	ActorID uuid.NullUUID
+
+	// TargetUserID is the account the action concerns, such as the author
+	// of a deleted chirp, and is what the log is filtered by per user.
+	TargetUserID uuid.NullUUID
+	// TargetType and TargetID name the thing acted on. They default to the
+	// target user.
+	TargetType string
+	TargetID   string
+
+	Diff    Diff
+	Details map[string]any
+}
+
+// Store is where entries are written. *database.Queries satisfies it.
+type Store interface {
+	CreateAuditLogEntry(ctx context.Context, arg database.CreateAuditLogEntryParams) error
+}
+
+// Log writes entries. Entries outlive the accounts they mention, so they
+// must not hold personal data such as email addresses.
+type Log struct {
+	store Store
+	key   []byte
+}
+
+// New returns a Log that writes to store and hashes emails with key.
+func New(store Store, key []byte) *Log {
+	return &Log{store: store, key: key}
+}
+
+// HashEmail returns a keyed hash to record in place of email, so failed
+// logins for one address can be told apart and grouped without the log
+// keeping the address. Case and surrounding space are ignored.
+func (l *Log) HashEmail(email string) string {
+	mac := hmac.New(sha256.New, l.key)
+	mac.Write([]byte(strings.ToLower(strings.TrimSpace(email))))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Record writes e, along with the IP address and user agent of the request
+// in ctx, if there is one.
+func (l *Log) Record(ctx context.Context, e Entry) error {
+	if e.TargetType == "" && e.TargetUserID.Valid {
+		e.TargetType = TargetUser
+		e.TargetID = e.TargetUserID.UUID.String()
+	}
+	if e.Diff == nil {
+		e.Diff = Diff{}
+	}
+	if e.Details == nil {
+		e.Details = map[string]any{}
+	}
+
+	diffJson, err := json.Marshal(e.Diff)
+	if err != nil {
+		return err
+	}
+	detailsJson, err := json.Marshal(e.Details)
+	if err != nil {
+		return err
+	}
+
+	request, _ := FromContext(ctx)
+
+	return l.store.CreateAuditLogEntry(ctx, database.CreateAuditLogEntryParams{
+		ActorID:      e.ActorID,
+		Action:       e.Action,
+		TargetUserID: e.TargetUserID,
+		TargetType:   sql.NullString{String: e.TargetType, Valid: e.TargetType != ""},
+		TargetID:     sql.NullString{String: e.TargetID, Valid: e.TargetID != ""},
+		Ip:           request.IP,
+		UserAgent:    request.UserAgent,
+		Details:      detailsJson,
+		Diff:         diffJson,
+	})
+}
@@ -0,0 +1,127 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/drewheasman/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+type fakeStore struct {
+	entries []database.CreateAuditLogEntryParams
+}
+
+func (s *fakeStore) CreateAuditLogEntry(_ context.Context, arg database.CreateAuditLogEntryParams) error {
+	s.entries = append(s.entries, arg)
+	return nil
+}
+
+func TestRecord(t *testing.T) {
+	store := &fakeStore{}
+	log := New(store, []byte("key"))
+
+	actor := uuid.New()
+	target := uuid.New()
+	ctx := NewContext(context.Background(), Request{IP: "192.0.2.1", UserAgent: "curl/8.0"})
+
+	err := log.Record(ctx, Entry{
+		Action:       ActionUserRoleChanged,
+		ActorID:      uuid.NullUUID{UUID: actor, Valid: true},
+		TargetUserID: uuid.NullUUID{UUID: target, Valid: true},
+		Diff:         Changed("role", "user", "moderator"),
+	})
+	if err != nil {
+		t.Fatalf("Record() resulted in error: %v", err)
+	}
+
+	if len(store.entries) != 1 {
+		t.Fatalf("expected 1 entry got %d", len(store.entries))
+	}
+	entry := store.entries[0]
+	if entry.Ip != "192.0.2.1" || entry.UserAgent != "curl/8.0" {
+		t.Fatalf("expected request metadata, got ip %q user agent %q", entry.Ip, entry.UserAgent)
+	}
+	if entry.TargetType.String != TargetUser || entry.TargetID.String != target.String() {
+		t.Fatalf("expected target to default to the user, got %v %v", entry.TargetType, entry.TargetID)
+	}
+	if string(entry.Diff) != `{"role":{"old":"user","new":"moderator"}}` {
+		t.Fatalf("unexpected diff %s", entry.Diff)
+	}
+	if string(entry.Details) != `{}` {
+		t.Fatalf("expected empty details got %s", entry.Details)
+	}
+}
+
+func TestRecordWithoutRequest(t *testing.T) {
+	store := &fakeStore{}
+
+	err := New(store, []byte("key")).Record(context.Background(), Entry{Action: ActionDataImported})
+	if err != nil {
+		t.Fatalf("Record() resulted in error: %v", err)
+	}
+
+	entry := store.entries[0]
+	if entry.Ip != "" || entry.TargetType.Valid || entry.TargetID.Valid || entry.TargetUserID.Valid {
+		t.Fatalf("expected an entry with no request or target, got %+v", entry)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		name     string
+		before   map[string]any
+		after    map[string]any
+		expected Diff
+	}{
+		{
+			name:     "unchanged",
+			before:   map[string]any{"email": "a@example.com"},
+			after:    map[string]any{"email": "a@example.com"},
+			expected: Diff{},
+		},
+		{
+			name:     "changed",
+			before:   map[string]any{"email": "a@example.com", "is_chirpy_red": false},
+			after:    map[string]any{"email": "b@example.com", "is_chirpy_red": false},
+			expected: Diff{"email": {Old: "a@example.com", New: "b@example.com"}},
+		},
+		{
+			name:     "added and removed",
+			before:   map[string]any{"reason": "spam"},
+			after:    map[string]any{"role": "admin"},
+			expected: Diff{"reason": {Old: "spam", New: nil}, "role": {Old: nil, New: "admin"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Compare(tt.before, tt.after)
+			if !reflect.DeepEqual(got, tt.expected) {
+				gotJson, _ := json.Marshal(got)
+				t.Fatalf("unexpected diff %s", gotJson)
+			}
+		})
+	}
+}
+
+func TestHashEmail(t *testing.T) {
+	log := New(&fakeStore{}, []byte("key"))
+
+	hash := log.HashEmail("walt@example.com")
+	if hash == "" || strings.Contains(hash, "walt") {
+		t.Fatalf("HashEmail() = %q, want a hash that doesn't contain the email", hash)
+	}
+	if got := log.HashEmail(" Walt@Example.com"); got != hash {
+		t.Errorf("HashEmail() of the same email in another case = %q, want %q", got, hash)
+	}
+	if got := log.HashEmail("jesse@example.com"); got == hash {
+		t.Errorf("HashEmail() of another email = %q, want a different hash", got)
+	}
+	if got := New(&fakeStore{}, []byte("other key")).HashEmail("walt@example.com"); got == hash {
+		t.Errorf("HashEmail() with another key = %q, want a different hash", got)
+	}
+}
@@ -0,0 +1,21 @@
+package audit
+
+import "context"
+
+// Request is where an action came from.
+type Request struct {
+	IP        string
+	UserAgent string
+}
+
+type requestKey struct{}
+
+// NewContext returns a copy of ctx carrying r, for Record to pick up.
+func NewContext(ctx context.Context, r Request) context.Context {
+	return context.WithValue(ctx, requestKey{}, r)
+}
+
+func FromContext(ctx context.Context) (Request, bool) {
+	r, ok := ctx.Value(requestKey{}).(Request)
+	return r, ok
+}
@@ -10,32 +10,59 @@ import (
 	"github.com/google/uuid"
 )
 
-func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
-	newJwt := jwt.NewWithClaims(
-		jwt.SigningMethodHS256,
-		jwt.RegisteredClaims{
-			Issuer:    "chirpy",
+// Claims are the registered JWT claims plus the session (refresh token
+// family) the access token was issued for. Tokens issued to OAuth clients
+// also carry the client and the scopes the user granted it.
+type Claims struct {
+	jwt.RegisteredClaims
+	SessionID string `json:"sid,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Scope     string `json:"scope,omitempty"`
+}
+
+func MakeJWT(userID uuid.UUID, keys *Keyring, expiresIn time.Duration) (string, error) {
+	return MakeSessionJWT(userID, uuid.Nil, keys, expiresIn)
+}
+
+// MakeSessionJWT makes an access token tied to a session, so revoking the
+// session also rejects the token before it expires.
+func MakeSessionJWT(userID, sessionID uuid.UUID, keys *Keyring, expiresIn time.Duration) (string, error) {
+	return MakeClientJWT(userID, sessionID, "", nil, keys, expiresIn)
+}
+
+// MakeClientJWT makes an access token for a third-party OAuth client that is
+// limited to the given scopes.
+func MakeClientJWT(userID, sessionID uuid.UUID, clientID string, scopes []string, keys *Keyring, expiresIn time.Duration) (string, error) {
+	claims := &Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
 			IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
 			ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(expiresIn)),
 			Subject:   userID.String(),
 		},
-	)
+		ClientID: clientID,
+		Scope:    strings.Join(scopes, " "),
+	}
+	if sessionID != uuid.Nil {
+		claims.SessionID = sessionID.String()
+	}
 
-	return newJwt.SignedString([]byte(tokenSecret))
+	return keys.sign(claims)
 }
 
-func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
+// ParseJWT validates the token against the key named by its kid (or the
+// shared secret for HS256 tokens) and checks the issuer and audience.
+func ParseJWT(tokenString string, keys *Keyring) (*Claims, error) {
+	return keys.parse(tokenString)
+}
+
+func ValidateJWT(tokenString string, keys *Keyring) (uuid.UUID, error) {
 	var id uuid.UUID
 
-	token, err := jwt.ParseWithClaims(tokenString, &jwt.RegisteredClaims{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(tokenSecret), nil
-	})
+	claims, err := ParseJWT(tokenString, keys)
 	if err != nil {
 		return id, err
 	}
 
-	claims := token.Claims.(*jwt.RegisteredClaims)
-
 	id, err = uuid.Parse(claims.Subject)
 	if err != nil {
 		return id, err
@@ -43,6 +70,24 @@ func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
 	return id, nil
 }
 
+// Scopes returns the scopes granted to an OAuth client. First-party tokens
+// have no client and act with the user's full authority.
+func (c *Claims) Scopes() []string {
+	if c.ClientID == "" {
+		return AllScopes
+	}
+	return strings.Fields(c.Scope)
+}
+
+// SessionUUID returns the session the token was issued for, or uuid.Nil for
+// tokens that aren't tied to one.
+func (c *Claims) SessionUUID() (uuid.UUID, error) {
+	if c.SessionID == "" {
+		return uuid.Nil, nil
+	}
+	return uuid.Parse(c.SessionID)
+}
+
 var AuthHeaderMissing error = errors.New("No authorization header")
 var AuthHeaderIncorrectlyFormatted = errors.New("Authorization header incorrectly formatted")
 
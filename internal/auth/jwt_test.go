@@ -8,16 +8,26 @@ import (
 	"github.com/google/uuid"
 )
 
+func newHS256Keyring(t *testing.T, secretString string) *Keyring {
+	t.Helper()
+
+	keys, err := NewKeyring(KeyringConfig{HS256Secret: secretString, Audience: "chirpy-api"})
+	if err != nil {
+		t.Fatalf("NewKeyring() resulted in error: %v", err)
+	}
+	return keys
+}
+
 func TestMakeJWTValidateJWT(t *testing.T) {
-	secretString := "1234567890"
+	keys := newHS256Keyring(t, "1234567890")
 	id := uuid.New()
 
-	jwt, err := MakeJWT(id, secretString, time.Duration(time.Second))
+	jwt, err := MakeJWT(id, keys, time.Duration(time.Second))
 	if err != nil {
 		t.Fatalf("MakeJWT() resulted in error: %v", err)
 	}
 
-	actualId, err := ValidateJWT(jwt, secretString)
+	actualId, err := ValidateJWT(jwt, keys)
 	if err != nil {
 		t.Fatalf("ValidateJWT() resulted in error: %v", err)
 	}
@@ -79,3 +89,55 @@ func TestGetBearerToken(t *testing.T) {
 		})
 	}
 }
+
+func TestMakeSessionJWT(t *testing.T) {
+	keys := newHS256Keyring(t, "1234567890")
+	id := uuid.New()
+	sessionID := uuid.New()
+
+	jwt, err := MakeSessionJWT(id, sessionID, keys, time.Minute)
+	if err != nil {
+		t.Fatalf("MakeSessionJWT() resulted in error: %v", err)
+	}
+
+	claims, err := ParseJWT(jwt, keys)
+	if err != nil {
+		t.Fatalf("ParseJWT() resulted in error: %v", err)
+	}
+	actualSessionID, err := claims.SessionUUID()
+	if err != nil {
+		t.Fatalf("SessionUUID() resulted in error: %v", err)
+	}
+	if actualSessionID != sessionID {
+		t.Fatalf("SessionUUID() resulted in %v, was %v", actualSessionID, sessionID)
+	}
+
+	if _, err := ParseJWT(jwt, newHS256Keyring(t, "wrong secret")); err == nil {
+		t.Fatalf("ParseJWT() accepted a token signed with a different secret")
+	}
+}
+
+func TestMakeClientJWTScopes(t *testing.T) {
+	keys := newHS256Keyring(t, "1234567890")
+
+	firstParty, _ := MakeSessionJWT(uuid.New(), uuid.New(), keys, time.Minute)
+	claims, err := ParseJWT(firstParty, keys)
+	if err != nil {
+		t.Fatalf("ParseJWT() resulted in error: %v", err)
+	}
+	if len(claims.Scopes()) != len(AllScopes) {
+		t.Fatalf("first-party token should carry every scope, got %v", claims.Scopes())
+	}
+
+	client, _ := MakeClientJWT(uuid.New(), uuid.New(), "client-1", []string{ScopeChirpsRead}, keys, time.Minute)
+	claims, err = ParseJWT(client, keys)
+	if err != nil {
+		t.Fatalf("ParseJWT() resulted in error: %v", err)
+	}
+	if claims.ClientID != "client-1" {
+		t.Fatalf("Expected client-1 got %v", claims.ClientID)
+	}
+	if scopes := claims.Scopes(); len(scopes) != 1 || scopes[0] != ScopeChirpsRead {
+		t.Fatalf("Expected [%v] got %v", ScopeChirpsRead, scopes)
+	}
+}
@@ -0,0 +1,448 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	AlgorithmHS256 = "HS256"
+	AlgorithmEdDSA = "EdDSA"
+	AlgorithmRS256 = "RS256"
+
+	tokenIssuer = "chirpy"
+	rsaKeyBits  = 2048
+
+	// keyIDTimeFormat starts every kid, so a key's age survives being copied
+	// between hosts, which file modification times don't.
+	keyIDTimeFormat = "20060102T150405Z"
+)
+
+var ErrUnknownKeyID = errors.New("unknown key id")
+
+// SigningKey is one asymmetric key in a Keyring, identified by its kid.
+type SigningKey struct {
+	ID        string
+	Algorithm string
+	CreatedAt time.Time
+	private   crypto.Signer
+}
+
+func (k *SigningKey) method() jwt.SigningMethod {
+	if k.Algorithm == AlgorithmRS256 {
+		return jwt.SigningMethodRS256
+	}
+	return jwt.SigningMethodEdDSA
+}
+
+type KeyringConfig struct {
+	// Algorithm is used to sign new tokens. HS256 keeps signing with the
+	// shared secret; EdDSA and RS256 sign with the newest key in the ring.
+	Algorithm string
+	Audience  string
+	// HS256Secret is the shared secret that every token was signed with
+	// before keys were introduced.
+	HS256Secret string
+	// AcceptHS256 keeps validating HS256 tokens while clients migrate.
+	// Tokens issued before audiences were introduced carry no aud claim, so
+	// HS256 tokens without one are accepted too.
+	AcceptHS256 bool
+	// Dir holds one PEM encoded private key per file, named <kid>.pem. When
+	// it's empty, keys only live in memory and are lost on restart.
+	Dir string
+	// Retain is how long a key still validates tokens after a newer key
+	// replaced it. It must be longer than the access token lifetime.
+	Retain time.Duration
+}
+
+// Keyring signs and validates JWTs. It can hold several asymmetric keys at
+// once so that tokens signed before a rotation stay valid until they expire.
+type Keyring struct {
+	mu          sync.RWMutex
+	keys        []*SigningKey
+	algorithm   string
+	audience    string
+	hmacSecret  []byte
+	acceptHS256 bool
+	dir         string
+	retain      time.Duration
+	now         func() time.Time
+}
+
+func NewKeyring(cfg KeyringConfig) (*Keyring, error) {
+	algorithm := cfg.Algorithm
+	if algorithm == "" {
+		algorithm = AlgorithmHS256
+	}
+	if algorithm != AlgorithmHS256 && algorithm != AlgorithmEdDSA && algorithm != AlgorithmRS256 {
+		return nil, fmt.Errorf("unsupported signing algorithm %q", algorithm)
+	}
+	if algorithm == AlgorithmHS256 && cfg.HS256Secret == "" {
+		return nil, errors.New("HS256 signing requires a secret")
+	}
+
+	k := &Keyring{
+		algorithm:   algorithm,
+		audience:    cfg.Audience,
+		hmacSecret:  []byte(cfg.HS256Secret),
+		acceptHS256: cfg.AcceptHS256 || algorithm == AlgorithmHS256,
+		dir:         cfg.Dir,
+		retain:      cfg.Retain,
+		now:         time.Now,
+	}
+
+	if k.dir != "" {
+		if err := k.Reload(); err != nil {
+			return nil, err
+		}
+	}
+	if algorithm != AlgorithmHS256 && len(k.keys) == 0 {
+		if _, err := k.Rotate(); err != nil {
+			return nil, err
+		}
+	}
+
+	return k, nil
+}
+
+// Audience is the aud claim that tokens are issued for and must carry.
+func (k *Keyring) Audience() string {
+	return k.audience
+}
+
+// Rotate generates a new key that signs every token from now on, and drops
+// keys that were replaced more than Retain ago. An HS256 keyring signs with
+// the configured secret, so it has no keys to rotate.
+func (k *Keyring) Rotate() (*SigningKey, error) {
+	if k.algorithm == AlgorithmHS256 {
+		return nil, errors.New("HS256 keyrings have no keys to rotate")
+	}
+
+	var private crypto.Signer
+	var err error
+	switch k.algorithm {
+	case AlgorithmRS256:
+		private, err = rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	default:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	randData := make([]byte, 4)
+	if _, err := rand.Read(randData); err != nil {
+		return nil, err
+	}
+	createdAt := k.now().UTC().Truncate(time.Second)
+	key := &SigningKey{
+		ID:        createdAt.Format(keyIDTimeFormat) + "-" + hex.EncodeToString(randData),
+		Algorithm: k.algorithm,
+		CreatedAt: createdAt,
+		private:   private,
+	}
+
+	if k.dir != "" {
+		if err := writeKeyFile(k.dir, key); err != nil {
+			return nil, err
+		}
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.keys = append(k.keys, key)
+	k.prune()
+
+	return key, nil
+}
+
+// Reload reads every key in the keyring directory, picking up keys that
+// other instances rotated in.
+func (k *Keyring) Reload() error {
+	entries, err := os.ReadDir(k.dir)
+	if err != nil {
+		return err
+	}
+
+	keys := []*SigningKey{}
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".pem" {
+			continue
+		}
+		key, err := readKeyFile(filepath.Join(k.dir, entry.Name()))
+		if err != nil {
+			return fmt.Errorf("loading %s: %w", entry.Name(), err)
+		}
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+	})
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.keys = keys
+	k.prune()
+
+	return nil
+}
+
+// RunRotation rotates the signing key whenever the newest key is older than
+// every, until ctx is cancelled. With a shared directory it also reloads keys
+// rotated by other instances. Errors are logged and tried again on the next
+// tick, as a directory that is briefly unreadable shouldn't stop rotation for
+// the life of the process. An HS256 keyring has nothing to rotate, so it
+// returns straight away.
+func (k *Keyring) RunRotation(ctx context.Context, every time.Duration) error {
+	if k.algorithm == AlgorithmHS256 {
+		slog.WarnContext(ctx, "not rotating signing keys, HS256 signs with the server secret")
+		return nil
+	}
+
+	ticker := time.NewTicker(min(every, time.Minute))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		if k.dir != "" {
+			if err := k.Reload(); err != nil {
+				slog.ErrorContext(ctx, "error reloading signing keys", "error", err)
+				continue
+			}
+		}
+
+		current := k.signingKey()
+		if current == nil || k.now().Sub(current.CreatedAt) >= every {
+			if _, err := k.Rotate(); err != nil {
+				slog.ErrorContext(ctx, "error rotating signing key", "error", err)
+			}
+		}
+	}
+}
+
+func (k *Keyring) signingKey() *SigningKey {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	if len(k.keys) == 0 {
+		return nil
+	}
+	return k.keys[len(k.keys)-1]
+}
+
+func (k *Keyring) findKey(kid string) *SigningKey {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	for _, key := range k.keys {
+		if key.ID == kid {
+			return key
+		}
+	}
+	return nil
+}
+
+// prune drops keys that were replaced by a newer key more than retain ago.
+// Callers must hold the write lock.
+func (k *Keyring) prune() {
+	if k.retain <= 0 {
+		return
+	}
+
+	now := k.now()
+	kept := []*SigningKey{}
+	for i, key := range k.keys {
+		if i < len(k.keys)-1 && now.Sub(k.keys[i+1].CreatedAt) > k.retain {
+			if k.dir != "" {
+				os.Remove(filepath.Join(k.dir, key.ID+".pem"))
+			}
+			continue
+		}
+		kept = append(kept, key)
+	}
+	k.keys = kept
+}
+
+func (k *Keyring) sign(claims *Claims) (string, error) {
+	claims.Issuer = tokenIssuer
+	if k.audience != "" {
+		claims.Audience = jwt.ClaimStrings{k.audience}
+	}
+
+	if k.algorithm == AlgorithmHS256 {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(k.hmacSecret)
+	}
+
+	key := k.signingKey()
+	if key == nil {
+		return "", errors.New("keyring has no signing key")
+	}
+	token := jwt.NewWithClaims(key.method(), claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.private)
+}
+
+func (k *Keyring) parse(tokenString string) (*Claims, error) {
+	parser := jwt.NewParser(jwt.WithValidMethods([]string{AlgorithmEdDSA, AlgorithmRS256, AlgorithmHS256}))
+	token, err := parser.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
+		alg := token.Method.Alg()
+		if alg == AlgorithmHS256 {
+			if !k.acceptHS256 || len(k.hmacSecret) == 0 {
+				return nil, errors.New("HS256 tokens are no longer accepted")
+			}
+			return k.hmacSecret, nil
+		}
+
+		kid, _ := token.Header["kid"].(string)
+		key := k.findKey(kid)
+		if key == nil {
+			return nil, ErrUnknownKeyID
+		}
+		if key.Algorithm != alg {
+			return nil, fmt.Errorf("key %s does not sign %s tokens", kid, alg)
+		}
+		return key.private.Public(), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	claims := token.Claims.(*Claims)
+	if !claims.VerifyIssuer(tokenIssuer, true) {
+		return nil, errors.New("token has the wrong issuer")
+	}
+	// HS256 only gets this far while it is accepted, and tokens from before
+	// audiences may have no aud at all. One that has an aud must still match.
+	audienceRequired := token.Method.Alg() != AlgorithmHS256
+	if k.audience != "" && !claims.VerifyAudience(k.audience, audienceRequired) {
+		return nil, errors.New("token has the wrong audience")
+	}
+
+	return claims, nil
+}
+
+// JWK is the public half of a signing key, as published in a JWKS document.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public keys of every key that can still validate tokens.
+func (k *Keyring) JWKS() JWKS {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	jwks := JWKS{Keys: []JWK{}}
+	for _, key := range k.keys {
+		jwk := JWK{Kid: key.ID, Alg: key.Algorithm, Use: "sig"}
+		switch public := key.private.Public().(type) {
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		default:
+			continue
+		}
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+
+	return jwks
+}
+
+func writeKeyFile(dir string, key *SigningKey) error {
+	der, err := x509.MarshalPKCS8PrivateKey(key.private)
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(dir, key.ID+".pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	return os.WriteFile(path, data, 0o600)
+}
+
+func readKeyFile(path string) (*SigningKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	id := strings.TrimSuffix(filepath.Base(path), ".pem")
+	createdAt, err := keyCreatedAt(id)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	key := &SigningKey{
+		ID:        id,
+		CreatedAt: createdAt,
+	}
+	switch private := parsed.(type) {
+	case ed25519.PrivateKey:
+		key.Algorithm = AlgorithmEdDSA
+		key.private = private
+	case *rsa.PrivateKey:
+		key.Algorithm = AlgorithmRS256
+		key.private = private
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", parsed)
+	}
+
+	return key, nil
+}
+
+// keyCreatedAt reads the creation time from the start of a kid made by
+// Rotate.
+func keyCreatedAt(id string) (time.Time, error) {
+	prefix, _, _ := strings.Cut(id, "-")
+	createdAt, err := time.Parse(keyIDTimeFormat, prefix)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("key id %q doesn't start with its creation time", id)
+	}
+	return createdAt.UTC(), nil
+}
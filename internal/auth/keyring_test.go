@@ -0,0 +1,191 @@
+package auth
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+)
+
+func TestKeyringAlgorithms(t *testing.T) {
+	for _, algorithm := range []string{AlgorithmEdDSA, AlgorithmRS256} {
+		t.Run(algorithm, func(t *testing.T) {
+			keys, err := NewKeyring(KeyringConfig{Algorithm: algorithm, Audience: "chirpy-api"})
+			if err != nil {
+				t.Fatalf("NewKeyring() resulted in error: %v", err)
+			}
+
+			id := uuid.New()
+			token, err := MakeJWT(id, keys, time.Minute)
+			if err != nil {
+				t.Fatalf("MakeJWT() resulted in error: %v", err)
+			}
+
+			actualId, err := ValidateJWT(token, keys)
+			if err != nil {
+				t.Fatalf("ValidateJWT() resulted in error: %v", err)
+			}
+			if actualId != id {
+				t.Fatalf("ValidateJWT() resulted in %v, was %v", actualId, id)
+			}
+
+			jwks := keys.JWKS()
+			if len(jwks.Keys) != 1 || jwks.Keys[0].Alg != algorithm {
+				t.Fatalf("unexpected JWKS %+v", jwks)
+			}
+		})
+	}
+}
+
+func TestKeyringRotation(t *testing.T) {
+	keys, err := NewKeyring(KeyringConfig{Algorithm: AlgorithmEdDSA, Audience: "chirpy-api", Retain: time.Hour})
+	if err != nil {
+		t.Fatalf("NewKeyring() resulted in error: %v", err)
+	}
+	now := time.Now()
+	keys.now = func() time.Time { return now }
+
+	oldToken, _ := MakeJWT(uuid.New(), keys, time.Hour)
+
+	now = now.Add(time.Minute)
+	if _, err := keys.Rotate(); err != nil {
+		t.Fatalf("Rotate() resulted in error: %v", err)
+	}
+	newToken, _ := MakeJWT(uuid.New(), keys, time.Hour)
+
+	if len(keys.JWKS().Keys) != 2 {
+		t.Fatalf("expected both keys to be published after rotation")
+	}
+	for _, token := range []string{oldToken, newToken} {
+		if _, err := ValidateJWT(token, keys); err != nil {
+			t.Fatalf("ValidateJWT() resulted in error after rotation: %v", err)
+		}
+	}
+
+	now = now.Add(2 * time.Hour)
+	if _, err := keys.Rotate(); err != nil {
+		t.Fatalf("Rotate() resulted in error: %v", err)
+	}
+	if _, err := ValidateJWT(oldToken, keys); err == nil {
+		t.Fatalf("ValidateJWT() accepted a token signed with a retired key")
+	}
+}
+
+func TestKeyringHS256DoesNotRotate(t *testing.T) {
+	keys, err := NewKeyring(KeyringConfig{Algorithm: AlgorithmHS256, Audience: "chirpy-api", HS256Secret: "1234567890"})
+	if err != nil {
+		t.Fatalf("NewKeyring() resulted in error: %v", err)
+	}
+
+	if _, err := keys.Rotate(); err == nil {
+		t.Fatal("Rotate() made a key for an HS256 keyring")
+	}
+	// RunRotation returns straight away instead of waiting for ctx.
+	if err := keys.RunRotation(context.Background(), time.Nanosecond); err != nil {
+		t.Fatalf("RunRotation() resulted in error: %v", err)
+	}
+	if len(keys.JWKS().Keys) != 0 {
+		t.Fatalf("expected no published keys, got %d", len(keys.JWKS().Keys))
+	}
+}
+
+func TestKeyringRejects(t *testing.T) {
+	secretString := "1234567890"
+	keys, err := NewKeyring(KeyringConfig{Algorithm: AlgorithmEdDSA, Audience: "chirpy-api", HS256Secret: secretString})
+	if err != nil {
+		t.Fatalf("NewKeyring() resulted in error: %v", err)
+	}
+	other, _ := NewKeyring(KeyringConfig{Algorithm: AlgorithmEdDSA, Audience: "chirpy-api"})
+	otherAudience, _ := NewKeyring(KeyringConfig{Algorithm: AlgorithmEdDSA, Audience: "someone-else"})
+
+	legacy := func(issuer string, audience ...string) string {
+		token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+			Issuer:    issuer,
+			Audience:  audience,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+			Subject:   uuid.New().String(),
+		}).SignedString([]byte(secretString))
+		return token
+	}
+	unknownKid, _ := MakeJWT(uuid.New(), other, time.Minute)
+	wrongAudience, _ := MakeJWT(uuid.New(), otherAudience, time.Minute)
+
+	testTable := []struct {
+		name  string
+		token string
+	}{
+		{name: "HS256 while not accepted", token: legacy("chirpy", "chirpy-api")},
+		{name: "Unknown kid", token: unknownKid},
+		{name: "Wrong audience", token: wrongAudience},
+		{name: "Garbage", token: "not.a.jwt"},
+	}
+
+	for _, v := range testTable {
+		t.Run(v.name, func(t *testing.T) {
+			if _, err := ValidateJWT(v.token, keys); err == nil {
+				t.Fatalf("ValidateJWT() accepted the token")
+			}
+		})
+	}
+
+	migrating, _ := NewKeyring(KeyringConfig{Algorithm: AlgorithmEdDSA, Audience: "chirpy-api", HS256Secret: secretString, AcceptHS256: true})
+	if _, err := ValidateJWT(legacy("chirpy", "chirpy-api"), migrating); err != nil {
+		t.Fatalf("ValidateJWT() rejected an HS256 token during migration: %v", err)
+	}
+	if _, err := ValidateJWT(legacy("chirpy"), migrating); err != nil {
+		t.Fatalf("ValidateJWT() rejected an HS256 token from before audiences: %v", err)
+	}
+	if _, err := ValidateJWT(legacy("chirpy", "someone-else"), migrating); err == nil {
+		t.Fatalf("ValidateJWT() accepted an HS256 token with the wrong audience")
+	}
+	if _, err := ValidateJWT(legacy("someone-else", "chirpy-api"), migrating); err == nil {
+		t.Fatalf("ValidateJWT() accepted a token with the wrong issuer")
+	}
+}
+
+func TestKeyringDir(t *testing.T) {
+	dir := t.TempDir()
+
+	keys, err := NewKeyring(KeyringConfig{Algorithm: AlgorithmEdDSA, Audience: "chirpy-api", Dir: dir})
+	if err != nil {
+		t.Fatalf("NewKeyring() resulted in error: %v", err)
+	}
+	token, _ := MakeJWT(uuid.New(), keys, time.Minute)
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Fatalf("expected the generated key to be written to %v", dir)
+	}
+
+	reloaded, err := NewKeyring(KeyringConfig{Algorithm: AlgorithmEdDSA, Audience: "chirpy-api", Dir: dir})
+	if err != nil {
+		t.Fatalf("NewKeyring() resulted in error: %v", err)
+	}
+	if _, err := ValidateJWT(token, reloaded); err != nil {
+		t.Fatalf("ValidateJWT() rejected a token signed by a key loaded from disk: %v", err)
+	}
+
+	// The age of a key comes from its kid, not from when the file was last
+	// touched.
+	original := keys.signingKey()
+	path := filepath.Join(dir, original.ID+".pem")
+	if err := os.Chtimes(path, time.Now(), time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("Chtimes() resulted in error: %v", err)
+	}
+	if err := reloaded.Reload(); err != nil {
+		t.Fatalf("Reload() resulted in error: %v", err)
+	}
+	if got := reloaded.signingKey().CreatedAt; !got.Equal(original.CreatedAt) {
+		t.Fatalf("reloaded key was created at %v, expected %v from its kid", got, original.CreatedAt)
+	}
+
+	data, _ := os.ReadFile(path)
+	os.WriteFile(filepath.Join(dir, "renamed.pem"), data, 0o600)
+	if err := reloaded.Reload(); err == nil {
+		t.Fatalf("Reload() accepted a key whose kid has no creation time")
+	}
+}
@@ -0,0 +1,36 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestVerifyPKCE(t *testing.T) {
+	// Example from RFC 7636 appendix B.
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	challenge := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+
+	if actual := PKCEChallengeS256(verifier); actual != challenge {
+		t.Fatalf("PKCEChallengeS256() resulted in %v, expected %v", actual, challenge)
+	}
+
+	testTable := []struct {
+		name     string
+		verifier string
+		expected bool
+	}{
+		{name: "Matching verifier", verifier: verifier, expected: true},
+		{name: "Different verifier", verifier: strings.Repeat("a", 43), expected: false},
+		{name: "Too short", verifier: "abc", expected: false},
+		{name: "Too long", verifier: strings.Repeat("a", 129), expected: false},
+		{name: "Invalid characters", verifier: strings.Repeat("a", 42) + "/", expected: false},
+	}
+
+	for _, v := range testTable {
+		t.Run(v.name, func(t *testing.T) {
+			if actual := VerifyPKCE(v.verifier, challenge); actual != v.expected {
+				t.Fatalf("VerifyPKCE() resulted in %v, expected %v", actual, v.expected)
+			}
+		})
+	}
+}
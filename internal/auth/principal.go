@@ -0,0 +1,46 @@
+package auth
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+const (
+	MethodJWT                 = "jwt"
+	MethodPersonalAccessToken = "personal_access_token"
+	MethodOAuth               = "oauth"
+)
+
+// Principal is whoever a request is acting for, and what it may do.
+type Principal struct {
+	UserID uuid.UUID
+	// SessionID is the session (refresh token family) the access token was
+	// issued for, or uuid.Nil for personal access tokens.
+	SessionID uuid.UUID
+	Scopes    []string
+	Method    string
+}
+
+func (p Principal) HasScope(scope string) bool {
+	return HasScope(p.Scopes, scope)
+}
+
+// FirstParty reports whether the user is acting directly through a session
+// they logged in to, rather than through a token they handed to someone else.
+func (p Principal) FirstParty() bool {
+	return p.Method == MethodJWT
+}
+
+type principalKey struct{}
+
+func NewContext(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// FromContext returns the principal stored by NewContext, and false for
+// anonymous requests.
+func FromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(Principal)
+	return p, ok
+}
@@ -0,0 +1,33 @@
+package auth
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestPrincipalContext(t *testing.T) {
+	if _, ok := FromContext(context.Background()); ok {
+		t.Fatalf("expected no principal in an empty context")
+	}
+
+	p := Principal{
+		UserID: uuid.New(),
+		Scopes: []string{ScopeChirpsRead},
+		Method: MethodPersonalAccessToken,
+	}
+	got, ok := FromContext(NewContext(context.Background(), p))
+	if !ok {
+		t.Fatalf("expected principal in context")
+	}
+	if got.UserID != p.UserID || got.Method != p.Method {
+		t.Fatalf("expected %+v got %+v", p, got)
+	}
+	if !got.HasScope(ScopeChirpsRead) || got.HasScope(ScopeChirpsWrite) {
+		t.Fatalf("unexpected scopes %v", got.Scopes)
+	}
+	if got.FirstParty() {
+		t.Fatalf("personal access token should not be first party")
+	}
+}
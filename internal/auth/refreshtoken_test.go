@@ -0,0 +1,30 @@
+package auth
+
+import "testing"
+
+func TestMakeRefreshTokenHash(t *testing.T) {
+	token, err := MakeRefreshToken()
+	if err != nil {
+		t.Fatalf("MakeRefreshToken() resulted in error: %v", err)
+	}
+	other, _ := MakeRefreshToken()
+	if token == other {
+		t.Fatalf("MakeRefreshToken() returned the same token twice")
+	}
+
+	if HashToken(token) != HashToken(token) {
+		t.Fatalf("HashToken() is not deterministic")
+	}
+	if HashToken(token) == HashToken(other) {
+		t.Fatalf("HashToken() collided for different tokens")
+	}
+	if HashToken(token) == token {
+		t.Fatalf("HashToken() returned the plaintext token")
+	}
+
+	// Known SHA-256 of "abc" so the stored format can be reproduced in SQL.
+	expected := "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"
+	if actual := HashToken("abc"); actual != expected {
+		t.Fatalf("Expected %v got %v", expected, actual)
+	}
+}
@@ -0,0 +1,25 @@
+package auth
+
+import "slices"
+
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+// Roles are ordered from least to most privileged; each role can do
+// everything the roles before it can.
+var Roles = []string{RoleUser, RoleModerator, RoleAdmin}
+
+func ValidRole(role string) bool {
+	return slices.Contains(Roles, role)
+}
+
+// RoleAtLeast reports whether role grants at least the privileges of min.
+// Unknown roles grant nothing.
+func RoleAtLeast(role, min string) bool {
+	have := slices.Index(Roles, role)
+	need := slices.Index(Roles, min)
+	return have >= 0 && need >= 0 && have >= need
+}
@@ -0,0 +1,28 @@
+package auth
+
+import "testing"
+
+func TestRoleAtLeast(t *testing.T) {
+	tests := []struct {
+		name     string
+		role     string
+		min      string
+		expected bool
+	}{
+		{"admin is a moderator", RoleAdmin, RoleModerator, true},
+		{"admin is an admin", RoleAdmin, RoleAdmin, true},
+		{"moderator is a user", RoleModerator, RoleUser, true},
+		{"moderator is not an admin", RoleModerator, RoleAdmin, false},
+		{"user is not a moderator", RoleUser, RoleModerator, false},
+		{"unknown role grants nothing", "root", RoleUser, false},
+		{"unknown minimum is never met", RoleAdmin, "root", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RoleAtLeast(tt.role, tt.min); got != tt.expected {
+				t.Fatalf("RoleAtLeast(%q, %q) expected %v got %v", tt.role, tt.min, tt.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package auth
+
+import "testing"
+
+func TestMakePersonalAccessToken(t *testing.T) {
+	token, err := MakePersonalAccessToken()
+	if err != nil {
+		t.Fatalf("MakePersonalAccessToken() resulted in error: %v", err)
+	}
+	if !IsPersonalAccessToken(token) {
+		t.Fatalf("IsPersonalAccessToken(%v) resulted in false", token)
+	}
+	if IsPersonalAccessToken("eyJhbGciOiJIUzI1NiJ9.e30.sig") {
+		t.Fatalf("IsPersonalAccessToken() accepted a JWT")
+	}
+}
+
+func TestValidScope(t *testing.T) {
+	testTable := []struct {
+		scope    string
+		expected bool
+	}{
+		{scope: ScopeChirpsRead, expected: true},
+		{scope: ScopeChirpsWrite, expected: true},
+		{scope: ScopeProfileWrite, expected: true},
+		{scope: "admin", expected: false},
+		{scope: "", expected: false},
+	}
+
+	for _, v := range testTable {
+		t.Run(v.scope, func(t *testing.T) {
+			if actual := ValidScope(v.scope); actual != v.expected {
+				t.Fatalf("ValidScope(%v) resulted in %v, expected %v", v.scope, actual, v.expected)
+			}
+		})
+	}
+}
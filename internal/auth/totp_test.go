@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA1 test key from RFC 6238 appendix B.
+var rfc6238Secret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+func TestTOTPCode(t *testing.T) {
+	testTable := []struct {
+		name         string
+		time         time.Time
+		expectedCode string
+	}{
+		{name: "59", time: time.Unix(59, 0), expectedCode: "287082"},
+		{name: "1111111109", time: time.Unix(1111111109, 0), expectedCode: "081804"},
+		{name: "1234567890", time: time.Unix(1234567890, 0), expectedCode: "005924"},
+		{name: "2000000000", time: time.Unix(2000000000, 0), expectedCode: "279037"},
+	}
+
+	for _, v := range testTable {
+		t.Run(v.name, func(t *testing.T) {
+			code, err := TOTPCode(rfc6238Secret, v.time)
+			if err != nil {
+				t.Fatalf("TOTPCode() resulted in error: %v", err)
+			}
+			if code != v.expectedCode {
+				t.Fatalf("Expected %v got %v", v.expectedCode, code)
+			}
+		})
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	now := time.Unix(1111111109, 0)
+
+	testTable := []struct {
+		name     string
+		code     string
+		at       time.Time
+		expected bool
+	}{
+		{name: "Current period", code: "081804", at: now, expected: true},
+		{name: "Previous period", code: "081804", at: now.Add(30 * time.Second), expected: true},
+		{name: "Too old", code: "081804", at: now.Add(90 * time.Second), expected: false},
+		{name: "Wrong code", code: "123456", at: now, expected: false},
+		{name: "Wrong length", code: "81804", at: now, expected: false},
+	}
+
+	for _, v := range testTable {
+		t.Run(v.name, func(t *testing.T) {
+			if _, actual := ValidateTOTP(v.code, rfc6238Secret, v.at); actual != v.expected {
+				t.Fatalf("ValidateTOTP() resulted in %v, expected %v", actual, v.expected)
+			}
+		})
+	}
+}
+
+func TestGenerateTOTPSecretRoundTrip(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("GenerateTOTPSecret() resulted in error: %v", err)
+	}
+
+	now := time.Now()
+	code, err := TOTPCode(secret, now)
+	if err != nil {
+		t.Fatalf("TOTPCode() resulted in error: %v", err)
+	}
+	counter, ok := ValidateTOTP(code, secret, now)
+	if !ok {
+		t.Fatalf("ValidateTOTP() rejected its own code %v", code)
+	}
+	if want := now.Unix() / totpPeriod; counter != want {
+		t.Fatalf("ValidateTOTP() resulted in counter %d, expected %d", counter, want)
+	}
+
+	uri := TOTPURI(secret, "a@example.com", "Chirpy")
+	if !strings.HasPrefix(uri, "otpauth://totp/Chirpy:a@example.com?") || !strings.Contains(uri, "secret="+secret) {
+		t.Fatalf("unexpected otpauth uri %v", uri)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(10)
+	if err != nil {
+		t.Fatalf("GenerateRecoveryCodes() resulted in error: %v", err)
+	}
+	if len(codes) != 10 {
+		t.Fatalf("Expected 10 codes got %v", len(codes))
+	}
+
+	for _, code := range codes {
+		if NormalizeRecoveryCode(strings.ToUpper(strings.ReplaceAll(code, "-", ""))) != code {
+			t.Fatalf("NormalizeRecoveryCode() did not round trip %v", code)
+		}
+	}
+}
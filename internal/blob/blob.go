@@ -0,0 +1,18 @@
+// Package blob stores opaque files, such as data exports, outside of the
+// database and hands out signed links to them.
+package blob
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+var ErrNotFound = errors.New("blob not found")
+
+// Store is somewhere to keep blobs by key. Keys are slash separated paths.
+type Store interface {
+	Put(ctx context.Context, key string, r io.Reader) error
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
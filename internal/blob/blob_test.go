@@ -0,0 +1,95 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFSStore(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewFSStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFSStore() resulted in error: %v", err)
+	}
+
+	if err := store.Put(ctx, "exports/a.zip", strings.NewReader("hello")); err != nil {
+		t.Fatalf("Put() resulted in error: %v", err)
+	}
+
+	r, err := store.Open(ctx, "exports/a.zip")
+	if err != nil {
+		t.Fatalf("Open() resulted in error: %v", err)
+	}
+	data, _ := io.ReadAll(r)
+	r.Close()
+	if string(data) != "hello" {
+		t.Fatalf("expected hello got %q", data)
+	}
+
+	if err := store.Delete(ctx, "exports/a.zip"); err != nil {
+		t.Fatalf("Delete() resulted in error: %v", err)
+	}
+	if _, err := store.Open(ctx, "exports/a.zip"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound after delete, got %v", err)
+	}
+	if err := store.Delete(ctx, "exports/a.zip"); err != nil {
+		t.Fatalf("deleting a missing blob resulted in error: %v", err)
+	}
+}
+
+func TestFSStoreKeysStayInDir(t *testing.T) {
+	store, err := NewFSStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFSStore() resulted in error: %v", err)
+	}
+
+	for _, key := range []string{"", "/", "..\\secret"} {
+		if err := store.Put(context.Background(), key, strings.NewReader("x")); err == nil {
+			t.Fatalf("expected key %q to be rejected", key)
+		}
+	}
+
+	// Leading ".." is cleaned away rather than escaping the directory.
+	if err := store.Put(context.Background(), "../../escape", strings.NewReader("x")); err != nil {
+		t.Fatalf("Put() resulted in error: %v", err)
+	}
+	if _, err := store.Open(context.Background(), "escape"); err != nil {
+		t.Fatalf("expected ../../escape to be stored as escape, got %v", err)
+	}
+}
+
+func TestSigner(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	signer := NewSigner([]byte("secret"))
+	signer.Now = func() time.Time { return now }
+
+	expires, signature := signer.Sign("export-1", time.Hour)
+
+	tests := []struct {
+		name      string
+		id        string
+		expires   int64
+		signature string
+		at        time.Time
+		expected  bool
+	}{
+		{"valid", "export-1", expires, signature, now, true},
+		{"other blob", "export-2", expires, signature, now, false},
+		{"extended expiry", "export-1", expires + 3600, signature, now, false},
+		{"bad signature", "export-1", expires, "00" + signature[2:], now, false},
+		{"expired", "export-1", expires, signature, now.Add(time.Hour), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signer.Now = func() time.Time { return tt.at }
+			if got := signer.Verify(tt.id, tt.expires, tt.signature); got != tt.expected {
+				t.Fatalf("Verify() expected %v got %v", tt.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,266 @@
+// Package config loads the server's settings. Each setting has a default,
+// which an optional YAML or TOML file overrides, which the environment
+// overrides, which command line flags override. Everything is validated at
+// once, so a bad deploy reports every mistake rather than the first.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// Config is every setting the server reads. The env tag is the environment
+// variable for a setting, and its flag is the dotted path of its yaml tags,
+// such as -server.addr.
+type Config struct {
+	Platform string   `yaml:"platform" toml:"platform" env:"PLATFORM" help:"deployment platform, \"dev\" enables destructive admin endpoints"`
+	Server   Server   `yaml:"server" toml:"server"`
+	Database Database `yaml:"database" toml:"database"`
+	JWT      JWT      `yaml:"jwt" toml:"jwt"`
+	Accounts Accounts `yaml:"accounts" toml:"accounts"`
+	Polka    Polka    `yaml:"polka" toml:"polka"`
+	Exports  Exports  `yaml:"exports" toml:"exports"`
+	Audit    Audit    `yaml:"audit" toml:"audit"`
+	Log      Log      `yaml:"log" toml:"log"`
+	Tracing  Tracing  `yaml:"tracing" toml:"tracing"`
+	Metrics  Metrics  `yaml:"metrics" toml:"metrics"`
+	Features Features `yaml:"features" toml:"features"`
+}
+
+type Server struct {
+	Addr              string        `yaml:"addr" toml:"addr" env:"ADDR" help:"address to listen on"`
+	StaticDir         string        `yaml:"static_dir" toml:"static_dir" env:"STATIC_DIR" help:"directory served under /app/"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" toml:"read_header_timeout" env:"HTTP_READ_HEADER_TIMEOUT" help:"time allowed to read request headers"`
+	ReadTimeout       time.Duration `yaml:"read_timeout" toml:"read_timeout" env:"HTTP_READ_TIMEOUT" help:"time allowed to read a whole request, 0 for no limit"`
+	WriteTimeout      time.Duration `yaml:"write_timeout" toml:"write_timeout" env:"HTTP_WRITE_TIMEOUT" help:"time allowed to write a response, 0 for no limit"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout" toml:"idle_timeout" env:"HTTP_IDLE_TIMEOUT" help:"how long to keep idle connections open"`
+	MaxHeaderBytes    int           `yaml:"max_header_bytes" toml:"max_header_bytes" env:"HTTP_MAX_HEADER_BYTES" help:"largest request headers accepted"`
+	ShutdownTimeout   time.Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT" help:"time allowed to drain requests and stop workers"`
+}
+
+type Database struct {
+	Driver          string        `yaml:"driver" toml:"driver" env:"DB_DRIVER" help:"postgres or sqlite"`
+	URL             string        `yaml:"url" toml:"url" env:"DB_URL" secret:"true" help:"Postgres connection URL, or SQLite database file"`
+	MaxOpenConns    int           `yaml:"max_open_conns" toml:"max_open_conns" env:"DB_MAX_OPEN_CONNS" help:"most open connections, 0 for no limit"`
+	MaxIdleConns    int           `yaml:"max_idle_conns" toml:"max_idle_conns" env:"DB_MAX_IDLE_CONNS" help:"most idle connections kept"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime" toml:"conn_max_lifetime" env:"DB_CONN_MAX_LIFETIME" help:"longest a connection is reused, 0 for no limit"`
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time" toml:"conn_max_idle_time" env:"DB_CONN_MAX_IDLE_TIME" help:"longest a connection stays idle, 0 for no limit"`
+	AutoMigrate     bool          `yaml:"auto_migrate" toml:"auto_migrate" env:"DB_AUTO_MIGRATE" help:"apply pending migrations at startup instead of refusing to start"`
+}
+
+type JWT struct {
+	SigningAlg      string        `yaml:"signing_alg" toml:"signing_alg" env:"JWT_SIGNING_ALG" help:"HS256, EdDSA or RS256"`
+	Audience        string        `yaml:"audience" toml:"audience" env:"JWT_AUDIENCE" help:"audience of issued tokens"`
+	ServerSecret    string        `yaml:"server_secret" toml:"server_secret" env:"SERVER_SECRET" secret:"true" help:"HS256 signing secret"`
+	AcceptHS256     bool          `yaml:"accept_hs256" toml:"accept_hs256" env:"JWT_ACCEPT_HS256" help:"accept HS256 tokens after switching algorithm"`
+	KeysDir         string        `yaml:"keys_dir" toml:"keys_dir" env:"JWT_KEYS_DIR" help:"directory EdDSA and RS256 keys are kept in"`
+	KeyRetain       time.Duration `yaml:"key_retain" toml:"key_retain" env:"JWT_KEY_RETAIN" help:"how long a rotated out key still verifies"`
+	RotateEvery     time.Duration `yaml:"rotate_every" toml:"rotate_every" env:"JWT_ROTATE_EVERY" help:"how often to rotate signing keys, 0 to never"`
+	AccessTokenTTL  time.Duration `yaml:"access_token_ttl" toml:"access_token_ttl" env:"JWT_ACCESS_TOKEN_TTL" help:"lifetime of session access tokens"`
+	RefreshTokenTTL time.Duration `yaml:"refresh_token_ttl" toml:"refresh_token_ttl" env:"JWT_REFRESH_TOKEN_TTL" help:"lifetime of refresh tokens"`
+}
+
+type Accounts struct {
+	DeletionGrace      time.Duration `yaml:"deletion_grace" toml:"deletion_grace" env:"ACCOUNT_DELETION_GRACE" help:"time to change your mind after deleting an account"`
+	LoginThrottleStore string        `yaml:"login_throttle_store" toml:"login_throttle_store" env:"LOGIN_THROTTLE_STORE" help:"memory or postgres"`
+	AdminEmail         string        `yaml:"admin_email" toml:"admin_email" env:"ADMIN_EMAIL" help:"account to make an admin at startup"`
+	AdminPassword      string        `yaml:"admin_password" toml:"admin_password" env:"ADMIN_PASSWORD" secret:"true" help:"password for admin_email if the account doesn't exist"`
+}
+
+type Polka struct {
+	Key string `yaml:"key" toml:"key" env:"POLKA_KEY" secret:"true" help:"API key Polka webhooks are sent with"`
+}
+
+type Exports struct {
+	BlobDir    string `yaml:"blob_dir" toml:"blob_dir" env:"BLOB_DIR" help:"directory data export archives are kept in"`
+	SigningKey string `yaml:"signing_key" toml:"signing_key" env:"EXPORT_SIGNING_KEY" secret:"true" help:"key export download links are signed with"`
+}
+
+type Audit struct {
+	HashKey string `yaml:"hash_key" toml:"hash_key" env:"AUDIT_HASH_KEY" secret:"true" help:"key emails are hashed with in the audit log"`
+}
+
+type Log struct {
+	Level  string `yaml:"level" toml:"level" env:"LOG_LEVEL" help:"debug, info, warn or error"`
+	Format string `yaml:"format" toml:"format" env:"LOG_FORMAT" help:"json or text"`
+}
+
+type Tracing struct {
+	Exporter string `yaml:"exporter" toml:"exporter" env:"TRACE_EXPORTER" help:"none, stdout or otlp"`
+}
+
+type Metrics struct {
+	Token string `yaml:"token" toml:"token" env:"METRICS_TOKEN" secret:"true" help:"bearer token scrapers fetch /metrics with, unset to not serve it"`
+}
+
+// Features turn whole areas of the API on and off.
+type Features struct {
+	Signups       bool `yaml:"signups" toml:"signups" env:"FEATURE_SIGNUPS" help:"allow new accounts through POST /api/users"`
+	OAuth         bool `yaml:"oauth" toml:"oauth" env:"FEATURE_OAUTH" help:"serve the OAuth endpoints"`
+	DataExports   bool `yaml:"data_exports" toml:"data_exports" env:"FEATURE_DATA_EXPORTS" help:"let users export their data"`
+	PolkaWebhooks bool `yaml:"polka_webhooks" toml:"polka_webhooks" env:"FEATURE_POLKA_WEBHOOKS" help:"accept Polka webhooks"`
+}
+
+// Default returns the settings used when nothing overrides them.
+func Default() Config {
+	return Config{
+		Server: Server{
+			Addr:              ":8080",
+			StaticDir:         ".",
+			ReadHeaderTimeout: 5 * time.Second,
+			ReadTimeout:       15 * time.Second,
+			WriteTimeout:      30 * time.Second,
+			IdleTimeout:       2 * time.Minute,
+			MaxHeaderBytes:    1 << 20,
+			ShutdownTimeout:   30 * time.Second,
+		},
+		Database: Database{
+			Driver:          "postgres",
+			MaxOpenConns:    25,
+			MaxIdleConns:    25,
+			ConnMaxLifetime: 30 * time.Minute,
+			ConnMaxIdleTime: 5 * time.Minute,
+		},
+		JWT: JWT{
+			SigningAlg:      "HS256",
+			Audience:        "chirpy-api",
+			AcceptHS256:     true,
+			KeyRetain:       24 * time.Hour,
+			AccessTokenTTL:  time.Hour,
+			RefreshTokenTTL: 60 * 24 * time.Hour,
+		},
+		Accounts: Accounts{
+			DeletionGrace:      30 * 24 * time.Hour,
+			LoginThrottleStore: "memory",
+		},
+		Exports: Exports{
+			BlobDir: "blobs",
+		},
+		Log: Log{
+			Level:  "info",
+			Format: "json",
+		},
+		Tracing: Tracing{
+			Exporter: "none",
+		},
+		Features: Features{
+			Signups:       true,
+			OAuth:         true,
+			DataExports:   true,
+			PolkaWebhooks: true,
+		},
+	}
+}
+
+// Validate returns every problem with c, joined into one error.
+func (c *Config) Validate() error {
+	var errs []error
+	invalid := func(path, format string, args ...any) {
+		errs = append(errs, &FieldError{Path: path, Env: envName(path), Problem: fmt.Sprintf(format, args...)})
+	}
+	oneOf := func(path, value string, allowed ...string) {
+		for _, a := range allowed {
+			if value == a {
+				return
+			}
+		}
+		invalid(path, "is %q, want one of %q", value, allowed)
+	}
+	notNegative := func(path string, d time.Duration) {
+		if d < 0 {
+			invalid(path, "must not be negative")
+		}
+	}
+	positive := func(path string, d time.Duration) {
+		if d <= 0 {
+			invalid(path, "must be positive")
+		}
+	}
+
+	if c.Server.Addr == "" {
+		invalid("server.addr", "is required")
+	}
+	if c.Server.StaticDir == "" {
+		invalid("server.static_dir", "is required")
+	}
+	positive("server.read_header_timeout", c.Server.ReadHeaderTimeout)
+	notNegative("server.read_timeout", c.Server.ReadTimeout)
+	notNegative("server.write_timeout", c.Server.WriteTimeout)
+	notNegative("server.idle_timeout", c.Server.IdleTimeout)
+	if c.Server.MaxHeaderBytes <= 0 {
+		invalid("server.max_header_bytes", "must be positive")
+	}
+	positive("server.shutdown_timeout", c.Server.ShutdownTimeout)
+
+	oneOf("database.driver", c.Database.Driver, "postgres", "sqlite")
+	if c.Database.URL == "" {
+		invalid("database.url", "is required")
+	}
+	if c.Database.MaxOpenConns < 0 {
+		invalid("database.max_open_conns", "must not be negative")
+	}
+	if c.Database.MaxIdleConns < 0 {
+		invalid("database.max_idle_conns", "must not be negative")
+	}
+	notNegative("database.conn_max_lifetime", c.Database.ConnMaxLifetime)
+	notNegative("database.conn_max_idle_time", c.Database.ConnMaxIdleTime)
+
+	oneOf("jwt.signing_alg", c.JWT.SigningAlg, "HS256", "EdDSA", "RS256")
+	if c.JWT.SigningAlg == "HS256" && c.JWT.ServerSecret == "" {
+		invalid("jwt.server_secret", "is required when jwt.signing_alg is HS256")
+	}
+	if c.JWT.Audience == "" {
+		invalid("jwt.audience", "is required")
+	}
+	notNegative("jwt.key_retain", c.JWT.KeyRetain)
+	notNegative("jwt.rotate_every", c.JWT.RotateEvery)
+	if c.JWT.SigningAlg == "HS256" && c.JWT.RotateEvery > 0 {
+		invalid("jwt.rotate_every", "must be 0 when jwt.signing_alg is HS256, which has no keys to rotate")
+	}
+	positive("jwt.access_token_ttl", c.JWT.AccessTokenTTL)
+	if c.JWT.RefreshTokenTTL <= c.JWT.AccessTokenTTL {
+		invalid("jwt.refresh_token_ttl", "must be longer than jwt.access_token_ttl")
+	}
+
+	notNegative("accounts.deletion_grace", c.Accounts.DeletionGrace)
+	oneOf("accounts.login_throttle_store", c.Accounts.LoginThrottleStore, "memory", "postgres")
+
+	if c.Exports.BlobDir == "" {
+		invalid("exports.blob_dir", "is required")
+	}
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Log.Level)); err != nil {
+		invalid("log.level", "is %q, want debug, info, warn or error", c.Log.Level)
+	}
+	oneOf("log.format", c.Log.Format, "json", "text")
+	oneOf("tracing.exporter", c.Tracing.Exporter, "none", "stdout", "otlp")
+
+	return errors.Join(errs...)
+}
+
+// ValidateServe returns the problems that only matter when serving the API,
+// such as keys for routes the other commands never register. Load doesn't
+// call it.
+func (c *Config) ValidateServe() error {
+	if c.Features.PolkaWebhooks && c.Polka.Key == "" {
+		return &FieldError{Path: "polka.key", Env: envName("polka.key"), Problem: "is required when features.polka_webhooks is on"}
+	}
+	return nil
+}
+
+// FieldError is a problem with one setting.
+type FieldError struct {
+	Path    string
+	Env     string
+	Problem string
+}
+
+func (e *FieldError) Error() string {
+	if e.Env == "" {
+		return e.Path + " " + e.Problem
+	}
+	return e.Path + " (" + e.Env + ") " + e.Problem
+}
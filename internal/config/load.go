@@ -0,0 +1,199 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// FileEnv names the config file when there is no -config flag.
+const FileEnv = "CHIRPY_CONFIG"
+
+// Load builds the config from defaults, the config file, the environment
+// from getenv and the flags in args, in increasing order of precedence.
+// The config is returned even when it is invalid so that it can be shown.
+func Load(args []string, getenv func(string) string) (*Config, error) {
+	c := Default()
+
+	fs, flags := newFlagSet()
+	if err := fs.Parse(args); err != nil {
+		return &c, err
+	}
+	if fs.NArg() > 0 {
+		return &c, fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+
+	var errs []error
+	path, ok := flags["config"]
+	if !ok {
+		path = getenv(FileEnv)
+	}
+	if path != "" {
+		if err := readFile(&c, path); err != nil {
+			return &c, err
+		}
+	}
+
+	for _, f := range settings(&c) {
+		if value := getenv(f.env); value != "" {
+			if err := f.set(value); err != nil {
+				errs = append(errs, &FieldError{Path: f.path, Env: f.env, Problem: err.Error()})
+			}
+		}
+	}
+	for _, f := range settings(&c) {
+		if value, ok := flags[f.path]; ok {
+			if err := f.set(value); err != nil {
+				errs = append(errs, &FieldError{Path: "-" + f.path, Problem: err.Error()})
+			}
+		}
+	}
+
+	// A value that didn't parse leaves the setting as it was, so validating
+	// still reports every other problem alongside it.
+	return &c, errors.Join(append(errs, c.Validate())...)
+}
+
+// Usage writes the flags Load accepts to w.
+func Usage(w io.Writer) {
+	fs, _ := newFlagSet()
+	fs.SetOutput(w)
+	fs.PrintDefaults()
+}
+
+// newFlagSet returns a flag for the config file and one for every setting.
+// Flags are only collected, so that they can be applied after the file and
+// the environment whatever order they came in.
+func newFlagSet() (*flag.FlagSet, map[string]string) {
+	fs := flag.NewFlagSet("chirpy", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	flags := map[string]string{}
+	collect := func(name string) func(string) error {
+		return func(value string) error {
+			flags[name] = value
+			return nil
+		}
+	}
+
+	fs.Func("config", "YAML or TOML config file (env "+FileEnv+")", collect("config"))
+	defaults := Default()
+	for _, f := range settings(&defaults) {
+		usage := f.help + " (env " + f.env + ")"
+		if f.value.Kind() == reflect.Bool {
+			fs.BoolFunc(f.path, usage, collect(f.path))
+		} else {
+			fs.Func(f.path, usage, collect(f.path))
+		}
+	}
+	return fs, flags
+}
+
+func readFile(c *Config, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading config file: %w", err)
+	}
+
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(strings.NewReader(string(data)))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("parsing %s: %w", path, err)
+		}
+	case ".toml":
+		meta, err := toml.Decode(string(data), c)
+		if err != nil {
+			return fmt.Errorf("parsing %s: %w", path, err)
+		}
+		if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+			return fmt.Errorf("parsing %s: unknown setting %s", path, undecoded[0])
+		}
+	default:
+		return fmt.Errorf("config file %s must end in .yaml, .yml or .toml", path)
+	}
+	return nil
+}
+
+// setting is one leaf of the config, found through its struct tags.
+type setting struct {
+	path   string
+	env    string
+	help   string
+	secret bool
+	value  reflect.Value
+}
+
+func settings(c *Config) []setting {
+	var all []setting
+	var walk func(prefix string, v reflect.Value)
+	walk = func(prefix string, v reflect.Value) {
+		t := v.Type()
+		for i := range t.NumField() {
+			field := t.Field(i)
+			path := prefix + field.Tag.Get("yaml")
+			if field.Type.Kind() == reflect.Struct {
+				walk(path+".", v.Field(i))
+				continue
+			}
+			all = append(all, setting{
+				path:   path,
+				env:    field.Tag.Get("env"),
+				help:   field.Tag.Get("help"),
+				secret: field.Tag.Get("secret") == "true",
+				value:  v.Field(i),
+			})
+		}
+	}
+	walk("", reflect.ValueOf(c).Elem())
+	return all
+}
+
+func (s setting) set(value string) error {
+	switch s.value.Interface().(type) {
+	case time.Duration:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("is %q, want a duration such as 30s or 1h", value)
+		}
+		s.value.SetInt(int64(d))
+	case string:
+		s.value.SetString(value)
+	case bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("is %q, want true or false", value)
+		}
+		s.value.SetBool(b)
+	case int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("is %q, want a whole number", value)
+		}
+		s.value.SetInt(int64(n))
+	default:
+		return fmt.Errorf("has unsupported type %s", s.value.Type())
+	}
+	return nil
+}
+
+// envName is the environment variable for the setting at path.
+func envName(path string) string {
+	c := Default()
+	for _, s := range settings(&c) {
+		if s.path == path {
+			return s.env
+		}
+	}
+	return ""
+}
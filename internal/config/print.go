@@ -0,0 +1,28 @@
+package config
+
+import (
+	"io"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Redacted replaces the value of secrets that are set when printing.
+const Redacted = "[REDACTED]"
+
+// Print writes c to w in the YAML config file format, with every secret
+// that is set replaced by Redacted.
+func Print(w io.Writer, c *Config) error {
+	redacted := *c
+	for _, s := range settings(&redacted) {
+		if s.secret && s.value.String() != "" {
+			s.value.SetString(Redacted)
+		}
+	}
+
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&redacted); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
@@ -7,52 +7,303 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 const createRefreshToken = `-- name: CreateRefreshToken :exec
-INSERT INTO refresh_tokens (token, created_at, updated_at, user_id, expires_at)
-VALUES ($1, NOW(), NOW(), $2, $3)
+INSERT INTO refresh_tokens (token_hash, created_at, updated_at, user_id, expires_at, family_id, device_name, user_agent, ip, last_used_at, client_id, scopes)
+VALUES ($1, NOW(), NOW(), $2, $3, $4, $5, $6, $7, NOW(), $8, $9)
 `
 
 type CreateRefreshTokenParams struct {
-	Token     string
-	UserID    uuid.UUID
-	ExpiresAt time.Time
+	TokenHash  string
+	UserID     uuid.UUID
+	ExpiresAt  time.Time
+	FamilyID   uuid.UUID
+	DeviceName string
+	UserAgent  string
+	Ip         string
+	ClientID   sql.NullString
+	Scopes     []string
 }
 
 func (q *Queries) CreateRefreshToken(ctx context.Context, arg CreateRefreshTokenParams) error {
-	_, err := q.db.ExecContext(ctx, createRefreshToken, arg.Token, arg.UserID, arg.ExpiresAt)
+	_, err := q.db.ExecContext(ctx, createRefreshToken,
+		arg.TokenHash,
+		arg.UserID,
+		arg.ExpiresAt,
+		arg.FamilyID,
+		arg.DeviceName,
+		arg.UserAgent,
+		arg.Ip,
+		arg.ClientID,
+		pq.Array(arg.Scopes),
+	)
 	return err
 }
 
-const getUserFromRefreshToken = `-- name: GetUserFromRefreshToken :one
-SELECT user_id
+const getActiveSessionsForUser = `-- name: GetActiveSessionsForUser :many
+SELECT
+    family_id,
+    device_name,
+    user_agent,
+    ip,
+    (
+        SELECT MIN(f.created_at)
+        FROM refresh_tokens f
+        WHERE f.family_id = refresh_tokens.family_id
+    )::timestamp AS started_at,
+    last_used_at,
+    expires_at
 FROM refresh_tokens
 WHERE
-    token = $1 AND
+    user_id = $1 AND
     expires_at > NOW() AND
+    revoked_at IS NULL AND
+    rotated_at IS NULL
+ORDER BY last_used_at DESC
+`
+
+type GetActiveSessionsForUserRow struct {
+	FamilyID   uuid.UUID
+	DeviceName string
+	UserAgent  string
+	Ip         string
+	StartedAt  time.Time
+	LastUsedAt time.Time
+	ExpiresAt  time.Time
+}
+
+func (q *Queries) GetActiveSessionsForUser(ctx context.Context, userID uuid.UUID) ([]GetActiveSessionsForUserRow, error) {
+	rows, err := q.db.QueryContext(ctx, getActiveSessionsForUser, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetActiveSessionsForUserRow
+	for rows.Next() {
+		var i GetActiveSessionsForUserRow
+		if err := rows.Scan(
+			&i.FamilyID,
+			&i.DeviceName,
+			&i.UserAgent,
+			&i.Ip,
+			&i.StartedAt,
+			&i.LastUsedAt,
+			&i.ExpiresAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getRefreshToken = `-- name: GetRefreshToken :one
+SELECT token_hash, created_at, updated_at, user_id, expires_at, revoked_at, family_id, rotated_at, device_name, user_agent, ip, last_used_at, client_id, scopes
+FROM refresh_tokens
+WHERE token_hash = $1
+`
+
+func (q *Queries) GetRefreshToken(ctx context.Context, tokenHash string) (RefreshToken, error) {
+	row := q.db.QueryRowContext(ctx, getRefreshToken, tokenHash)
+	var i RefreshToken
+	err := row.Scan(
+		&i.TokenHash,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.ExpiresAt,
+		&i.RevokedAt,
+		&i.FamilyID,
+		&i.RotatedAt,
+		&i.DeviceName,
+		&i.UserAgent,
+		&i.Ip,
+		&i.LastUsedAt,
+		&i.ClientID,
+		pq.Array(&i.Scopes),
+	)
+	return i, err
+}
+
+const getSessionHistoryForUser = `-- name: GetSessionHistoryForUser :many
+SELECT
+    family_id,
+    created_at,
+    last_used_at,
+    expires_at,
+    revoked_at,
+    device_name,
+    user_agent,
+    ip,
+    client_id
+FROM refresh_tokens
+WHERE user_id = $1
+ORDER BY created_at
+`
+
+type GetSessionHistoryForUserRow struct {
+	FamilyID   uuid.UUID
+	CreatedAt  time.Time
+	LastUsedAt time.Time
+	ExpiresAt  time.Time
+	RevokedAt  sql.NullTime
+	DeviceName string
+	UserAgent  string
+	Ip         string
+	ClientID   sql.NullString
+}
+
+func (q *Queries) GetSessionHistoryForUser(ctx context.Context, userID uuid.UUID) ([]GetSessionHistoryForUserRow, error) {
+	rows, err := q.db.QueryContext(ctx, getSessionHistoryForUser, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetSessionHistoryForUserRow
+	for rows.Next() {
+		var i GetSessionHistoryForUserRow
+		if err := rows.Scan(
+			&i.FamilyID,
+			&i.CreatedAt,
+			&i.LastUsedAt,
+			&i.ExpiresAt,
+			&i.RevokedAt,
+			&i.DeviceName,
+			&i.UserAgent,
+			&i.Ip,
+			&i.ClientID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const isSessionActive = `-- name: IsSessionActive :one
+SELECT EXISTS (
+    SELECT 1
+    FROM refresh_tokens
+    WHERE
+        family_id = $1 AND
+        revoked_at IS NULL AND
+        expires_at > NOW()
+)
+`
+
+func (q *Queries) IsSessionActive(ctx context.Context, familyID uuid.UUID) (bool, error) {
+	row := q.db.QueryRowContext(ctx, isSessionActive, familyID)
+	var exists bool
+	err := row.Scan(&exists)
+	return exists, err
+}
+
+const revokeAllSessionsForUser = `-- name: RevokeAllSessionsForUser :exec
+UPDATE refresh_tokens
+SET
+    revoked_at = NOW(),
+    updated_at = NOW()
+WHERE
+    user_id = $1 AND
     revoked_at IS NULL
 `
 
-func (q *Queries) GetUserFromRefreshToken(ctx context.Context, token string) (uuid.UUID, error) {
-	row := q.db.QueryRowContext(ctx, getUserFromRefreshToken, token)
-	var user_id uuid.UUID
-	err := row.Scan(&user_id)
-	return user_id, err
+func (q *Queries) RevokeAllSessionsForUser(ctx context.Context, userID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, revokeAllSessionsForUser, userID)
+	return err
 }
 
-const revokeToken = `-- name: RevokeToken :exec
+const revokeRefreshTokenFamily = `-- name: RevokeRefreshTokenFamily :exec
 UPDATE refresh_tokens
 SET
     revoked_at = NOW(),
     updated_at = NOW()
-WHERE token = $1
+WHERE
+    family_id = $1 AND
+    revoked_at IS NULL
 `
 
-func (q *Queries) RevokeToken(ctx context.Context, token string) error {
-	_, err := q.db.ExecContext(ctx, revokeToken, token)
+func (q *Queries) RevokeRefreshTokenFamily(ctx context.Context, familyID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, revokeRefreshTokenFamily, familyID)
 	return err
 }
+
+const revokeSessionForUser = `-- name: RevokeSessionForUser :execrows
+UPDATE refresh_tokens
+SET
+    revoked_at = NOW(),
+    updated_at = NOW()
+WHERE
+    family_id = $1 AND
+    user_id = $2 AND
+    revoked_at IS NULL
+`
+
+type RevokeSessionForUserParams struct {
+	FamilyID uuid.UUID
+	UserID   uuid.UUID
+}
+
+func (q *Queries) RevokeSessionForUser(ctx context.Context, arg RevokeSessionForUserParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, revokeSessionForUser, arg.FamilyID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const rotateRefreshToken = `-- name: RotateRefreshToken :one
+UPDATE refresh_tokens
+SET
+    rotated_at = NOW(),
+    updated_at = NOW()
+WHERE
+    token_hash = $1 AND
+    expires_at > NOW() AND
+    revoked_at IS NULL AND
+    rotated_at IS NULL AND
+    client_id IS NOT DISTINCT FROM $2
+RETURNING user_id, family_id, device_name, scopes
+`
+
+type RotateRefreshTokenParams struct {
+	TokenHash string
+	ClientID  sql.NullString
+}
+
+type RotateRefreshTokenRow struct {
+	UserID     uuid.UUID
+	FamilyID   uuid.UUID
+	DeviceName string
+	Scopes     []string
+}
+
+func (q *Queries) RotateRefreshToken(ctx context.Context, arg RotateRefreshTokenParams) (RotateRefreshTokenRow, error) {
+	row := q.db.QueryRowContext(ctx, rotateRefreshToken, arg.TokenHash, arg.ClientID)
+	var i RotateRefreshTokenRow
+	err := row.Scan(
+		&i.UserID,
+		&i.FamilyID,
+		&i.DeviceName,
+		pq.Array(&i.Scopes),
+	)
+	return i, err
+}
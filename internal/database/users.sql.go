@@ -7,11 +7,74 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+const adminExists = `-- name: AdminExists :one
+SELECT EXISTS (
+    SELECT 1
+    FROM users
+    WHERE role = 'admin'
+)
+`
+
+func (q *Queries) AdminExists(ctx context.Context) (bool, error) {
+	row := q.db.QueryRowContext(ctx, adminExists)
+	var exists bool
+	err := row.Scan(&exists)
+	return exists, err
+}
+
+const cancelUserDeletion = `-- name: CancelUserDeletion :execrows
+UPDATE users
+SET
+    deletion_scheduled_at = NULL,
+    updated_at = NOW()
+WHERE
+    id = $1 AND
+    deletion_scheduled_at IS NOT NULL
+`
+
+func (q *Queries) CancelUserDeletion(ctx context.Context, id uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, cancelUserDeletion, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const countUsers = `-- name: CountUsers :one
+SELECT COUNT(*)
+FROM users
+WHERE
+    ($1::text IS NULL OR email ILIKE '%' || $1 || '%') AND
+    ($2::boolean IS NULL OR is_chirpy_red = $2) AND
+    ($3::timestamp IS NULL OR created_at >= $3) AND
+    ($4::timestamp IS NULL OR created_at < $4)
+`
+
+type CountUsersParams struct {
+	Email         sql.NullString
+	IsChirpyRed   sql.NullBool
+	CreatedAfter  sql.NullTime
+	CreatedBefore sql.NullTime
+}
+
+func (q *Queries) CountUsers(ctx context.Context, arg CountUsersParams) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countUsers,
+		arg.Email,
+		arg.IsChirpyRed,
+		arg.CreatedAfter,
+		arg.CreatedBefore,
+	)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const createUser = `-- name: CreateUser :one
 INSERT INTO users (id, created_at, updated_at, email, hashed_password)
 VALUES (gen_random_uuid(), NOW(), NOW(), $1, $2)
@@ -54,8 +117,70 @@ func (q *Queries) DeleteAllUsers(ctx context.Context) error {
 	return err
 }
 
+const deleteDueUsers = `-- name: DeleteDueUsers :many
+DELETE
+FROM users
+WHERE deletion_scheduled_at <= $1
+RETURNING id, email
+`
+
+type DeleteDueUsersRow struct {
+	ID    uuid.UUID
+	Email string
+}
+
+func (q *Queries) DeleteDueUsers(ctx context.Context, deletionScheduledAt sql.NullTime) ([]DeleteDueUsersRow, error) {
+	rows, err := q.db.QueryContext(ctx, deleteDueUsers, deletionScheduledAt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []DeleteDueUsersRow
+	for rows.Next() {
+		var i DeleteDueUsersRow
+		if err := rows.Scan(&i.ID, &i.Email); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const disableTOTP = `-- name: DisableTOTP :exec
+UPDATE users
+SET
+    totp_secret = NULL,
+    totp_enabled = FALSE,
+    updated_at = NOW()
+WHERE id = $1
+`
+
+func (q *Queries) DisableTOTP(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, disableTOTP, id)
+	return err
+}
+
+const enableTOTP = `-- name: EnableTOTP :exec
+UPDATE users
+SET
+    totp_enabled = TRUE,
+    updated_at = NOW()
+WHERE id = $1
+`
+
+func (q *Queries) EnableTOTP(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, enableTOTP, id)
+	return err
+}
+
 const getUser = `-- name: GetUser :one
-SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, totp_secret, totp_enabled, role, suspended_at, suspension_reason, password_reset_required, shadow_banned, deletion_scheduled_at, totp_last_counter
 FROM users
 WHERE id = $1
 `
@@ -70,12 +195,51 @@ func (q *Queries) GetUser(ctx context.Context, id uuid.UUID) (User, error) {
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.TotpSecret,
+		&i.TotpEnabled,
+		&i.Role,
+		&i.SuspendedAt,
+		&i.SuspensionReason,
+		&i.PasswordResetRequired,
+		&i.ShadowBanned,
+		&i.DeletionScheduledAt,
+		&i.TotpLastCounter,
 	)
 	return i, err
 }
 
+const getUserActivityCounts = `-- name: GetUserActivityCounts :one
+SELECT
+    (
+        SELECT COUNT(*)
+        FROM chirps
+        WHERE chirps.user_id = $1
+    ) AS chirp_count,
+    (
+        SELECT COUNT(DISTINCT family_id)
+        FROM refresh_tokens
+        WHERE
+            refresh_tokens.user_id = $1 AND
+            revoked_at IS NULL AND
+            rotated_at IS NULL AND
+            expires_at > NOW()
+    ) AS session_count
+`
+
+type GetUserActivityCountsRow struct {
+	ChirpCount   int64
+	SessionCount int64
+}
+
+func (q *Queries) GetUserActivityCounts(ctx context.Context, userID uuid.UUID) (GetUserActivityCountsRow, error) {
+	row := q.db.QueryRowContext(ctx, getUserActivityCounts, userID)
+	var i GetUserActivityCountsRow
+	err := row.Scan(&i.ChirpCount, &i.SessionCount)
+	return i, err
+}
+
 const getUserByEmail = `-- name: GetUserByEmail :one
-SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, totp_secret, totp_enabled, role, suspended_at, suspension_reason, password_reset_required, shadow_banned, deletion_scheduled_at, totp_last_counter
 FROM users
 WHERE email = $1
 `
@@ -90,10 +254,151 @@ func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.TotpSecret,
+		&i.TotpEnabled,
+		&i.Role,
+		&i.SuspendedAt,
+		&i.SuspensionReason,
+		&i.PasswordResetRequired,
+		&i.ShadowBanned,
+		&i.DeletionScheduledAt,
+		&i.TotpLastCounter,
 	)
 	return i, err
 }
 
+const getUserStatus = `-- name: GetUserStatus :one
+SELECT suspended_at, suspension_reason, shadow_banned, deletion_scheduled_at
+FROM users
+WHERE id = $1
+`
+
+type GetUserStatusRow struct {
+	SuspendedAt         sql.NullTime
+	SuspensionReason    sql.NullString
+	ShadowBanned        bool
+	DeletionScheduledAt sql.NullTime
+}
+
+func (q *Queries) GetUserStatus(ctx context.Context, id uuid.UUID) (GetUserStatusRow, error) {
+	row := q.db.QueryRowContext(ctx, getUserStatus, id)
+	var i GetUserStatusRow
+	err := row.Scan(
+		&i.SuspendedAt,
+		&i.SuspensionReason,
+		&i.ShadowBanned,
+		&i.DeletionScheduledAt,
+	)
+	return i, err
+}
+
+const listUsers = `-- name: ListUsers :many
+SELECT id, created_at, updated_at, email, is_chirpy_red, role, suspended_at
+FROM users
+WHERE
+    ($1::text IS NULL OR email ILIKE '%' || $1 || '%') AND
+    ($2::boolean IS NULL OR is_chirpy_red = $2) AND
+    ($3::timestamp IS NULL OR created_at >= $3) AND
+    ($4::timestamp IS NULL OR created_at < $4)
+ORDER BY created_at DESC, id DESC
+LIMIT $5
+OFFSET $6
+`
+
+type ListUsersParams struct {
+	Email         sql.NullString
+	IsChirpyRed   sql.NullBool
+	CreatedAfter  sql.NullTime
+	CreatedBefore sql.NullTime
+	MaxResults    int32
+	SkipResults   int32
+}
+
+type ListUsersRow struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Email       string
+	IsChirpyRed bool
+	Role        string
+	SuspendedAt sql.NullTime
+}
+
+func (q *Queries) ListUsers(ctx context.Context, arg ListUsersParams) ([]ListUsersRow, error) {
+	rows, err := q.db.QueryContext(ctx, listUsers,
+		arg.Email,
+		arg.IsChirpyRed,
+		arg.CreatedAfter,
+		arg.CreatedBefore,
+		arg.MaxResults,
+		arg.SkipResults,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListUsersRow
+	for rows.Next() {
+		var i ListUsersRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Email,
+			&i.IsChirpyRed,
+			&i.Role,
+			&i.SuspendedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const requirePasswordReset = `-- name: RequirePasswordReset :execrows
+UPDATE users
+SET
+    password_reset_required = TRUE,
+    updated_at = NOW()
+WHERE id = $1
+`
+
+func (q *Queries) RequirePasswordReset(ctx context.Context, id uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, requirePasswordReset, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const scheduleUserDeletion = `-- name: ScheduleUserDeletion :one
+UPDATE users
+SET
+    deletion_scheduled_at = $2,
+    updated_at = NOW()
+WHERE id = $1
+RETURNING deletion_scheduled_at
+`
+
+type ScheduleUserDeletionParams struct {
+	ID                  uuid.UUID
+	DeletionScheduledAt sql.NullTime
+}
+
+func (q *Queries) ScheduleUserDeletion(ctx context.Context, arg ScheduleUserDeletionParams) (sql.NullTime, error) {
+	row := q.db.QueryRowContext(ctx, scheduleUserDeletion, arg.ID, arg.DeletionScheduledAt)
+	var deletion_scheduled_at sql.NullTime
+	err := row.Scan(&deletion_scheduled_at)
+	return deletion_scheduled_at, err
+}
+
 const setChirpyRed = `-- name: SetChirpyRed :exec
 UPDATE users
 SET is_chirpy_red = TRUE
@@ -105,6 +410,127 @@ func (q *Queries) SetChirpyRed(ctx context.Context, id uuid.UUID) error {
 	return err
 }
 
+const setShadowBanned = `-- name: SetShadowBanned :execrows
+UPDATE users
+SET
+    shadow_banned = $2,
+    updated_at = NOW()
+WHERE id = $1
+`
+
+type SetShadowBannedParams struct {
+	ID           uuid.UUID
+	ShadowBanned bool
+}
+
+func (q *Queries) SetShadowBanned(ctx context.Context, arg SetShadowBannedParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, setShadowBanned, arg.ID, arg.ShadowBanned)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const setTOTPSecret = `-- name: SetTOTPSecret :exec
+UPDATE users
+SET
+    totp_secret = $2,
+    totp_enabled = FALSE,
+    updated_at = NOW()
+WHERE id = $1
+`
+
+type SetTOTPSecretParams struct {
+	ID         uuid.UUID
+	TotpSecret sql.NullString
+}
+
+func (q *Queries) SetTOTPSecret(ctx context.Context, arg SetTOTPSecretParams) error {
+	_, err := q.db.ExecContext(ctx, setTOTPSecret, arg.ID, arg.TotpSecret)
+	return err
+}
+
+const setUserRole = `-- name: SetUserRole :execrows
+UPDATE users
+SET
+    role = $2,
+    updated_at = NOW()
+WHERE id = $1
+`
+
+type SetUserRoleParams struct {
+	ID   uuid.UUID
+	Role string
+}
+
+func (q *Queries) SetUserRole(ctx context.Context, arg SetUserRoleParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, setUserRole, arg.ID, arg.Role)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const suspendUser = `-- name: SuspendUser :execrows
+UPDATE users
+SET
+    suspended_at = NOW(),
+    suspension_reason = $2,
+    updated_at = NOW()
+WHERE id = $1
+`
+
+type SuspendUserParams struct {
+	ID               uuid.UUID
+	SuspensionReason sql.NullString
+}
+
+func (q *Queries) SuspendUser(ctx context.Context, arg SuspendUserParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, suspendUser, arg.ID, arg.SuspensionReason)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const unsuspendUser = `-- name: UnsuspendUser :execrows
+UPDATE users
+SET
+    suspended_at = NULL,
+    suspension_reason = NULL,
+    updated_at = NOW()
+WHERE id = $1
+`
+
+func (q *Queries) UnsuspendUser(ctx context.Context, id uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, unsuspendUser, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const updateChirpyRed = `-- name: UpdateChirpyRed :execrows
+UPDATE users
+SET
+    is_chirpy_red = $2,
+    updated_at = NOW()
+WHERE id = $1
+`
+
+type UpdateChirpyRedParams struct {
+	ID          uuid.UUID
+	IsChirpyRed bool
+}
+
+func (q *Queries) UpdateChirpyRed(ctx context.Context, arg UpdateChirpyRedParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, updateChirpyRed, arg.ID, arg.IsChirpyRed)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const updateUser = `-- name: UpdateUser :one
 UPDATE users
 SET
@@ -141,3 +567,24 @@ func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (UpdateU
 	)
 	return i, err
 }
+
+const useTOTPCounter = `-- name: UseTOTPCounter :execrows
+UPDATE users
+SET totp_last_counter = $2
+WHERE
+    id = $1 AND
+    totp_last_counter < $2
+`
+
+type UseTOTPCounterParams struct {
+	ID              uuid.UUID
+	TotpLastCounter int64
+}
+
+func (q *Queries) UseTOTPCounter(ctx context.Context, arg UseTOTPCounterParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, useTOTPCounter, arg.ID, arg.TotpLastCounter)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,36 @@
+package logging
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// Request identifies the request a record was logged for. The user is
+// filled in once authentication has run, which is after the request was
+// put into the context.
+type Request struct {
+	ID     string
+	userID atomic.Value
+}
+
+func (r *Request) UserID() string {
+	userID, _ := r.userID.Load().(string)
+	return userID
+}
+
+func (r *Request) SetUserID(userID string) {
+	r.userID.Store(userID)
+}
+
+type requestKey struct{}
+
+// NewContext returns a copy of ctx carrying r.
+func NewContext(ctx context.Context, r *Request) context.Context {
+	return context.WithValue(ctx, requestKey{}, r)
+}
+
+// FromContext returns the request stored by NewContext, or nil.
+func FromContext(ctx context.Context) *Request {
+	r, _ := ctx.Value(requestKey{}).(*Request)
+	return r
+}
@@ -0,0 +1,170 @@
+// Package logging builds the server's structured logger. Its level and
+// format can be changed while the server runs, secrets are redacted, and
+// records logged with a request context carry that request's ID, user and
+// trace.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	FormatJSON = "json"
+	FormatText = "text"
+)
+
+const redacted = "[REDACTED]"
+
+// sensitiveKeys are attribute names, or name suffixes, whose values are never
+// written out.
+var sensitiveKeys = []string{
+	"password",
+	"secret",
+	"token",
+	"authorization",
+	"api_key",
+	"apikey",
+	"cookie",
+}
+
+// Settings is the level and format shared by every logger made by New.
+type Settings struct {
+	level slog.LevelVar
+	text  atomic.Bool
+}
+
+// NewSettings parses level ("debug", "info", "warn" or "error") and format
+// ("json" or "text"). Empty values mean info and JSON.
+func NewSettings(level, format string) (*Settings, error) {
+	s := &Settings{}
+	if level != "" {
+		if err := s.SetLevel(level); err != nil {
+			return nil, err
+		}
+	}
+	if format != "" {
+		if err := s.SetFormat(format); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (s *Settings) Level() string {
+	return strings.ToLower(s.level.Level().String())
+}
+
+func (s *Settings) SetLevel(level string) error {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return fmt.Errorf("unknown log level %q", level)
+	}
+	s.level.Set(l)
+	return nil
+}
+
+func (s *Settings) Format() string {
+	if s.text.Load() {
+		return FormatText
+	}
+	return FormatJSON
+}
+
+func (s *Settings) SetFormat(format string) error {
+	switch strings.ToLower(format) {
+	case FormatJSON:
+		s.text.Store(false)
+	case FormatText:
+		s.text.Store(true)
+	default:
+		return fmt.Errorf("unknown log format %q", format)
+	}
+	return nil
+}
+
+// New returns a logger writing to w with the level and format in s.
+func New(w io.Writer, s *Settings) *slog.Logger {
+	opts := &slog.HandlerOptions{
+		Level:       &s.level,
+		ReplaceAttr: redact,
+	}
+	return slog.New(&handler{
+		settings: s,
+		json:     slog.NewJSONHandler(w, opts),
+		text:     slog.NewTextHandler(w, opts),
+	})
+}
+
+// handler keeps a JSON and a text handler in step and writes each record
+// with whichever the settings currently ask for.
+type handler struct {
+	settings *Settings
+	json     slog.Handler
+	text     slog.Handler
+}
+
+func (h *handler) current() slog.Handler {
+	if h.settings.text.Load() {
+		return h.text
+	}
+	return h.json
+}
+
+func (h *handler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.current().Enabled(ctx, level)
+}
+
+func (h *handler) Handle(ctx context.Context, r slog.Record) error {
+	if info := FromContext(ctx); info != nil {
+		r.AddAttrs(slog.String("request_id", info.ID))
+		if userID := info.UserID(); userID != "" {
+			r.AddAttrs(slog.String("user_id", userID))
+		}
+	}
+	if span := trace.SpanContextFromContext(ctx); span.HasTraceID() {
+		r.AddAttrs(slog.String("trace_id", span.TraceID().String()))
+	}
+	return h.current().Handle(ctx, r)
+}
+
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &handler{
+		settings: h.settings,
+		json:     h.json.WithAttrs(attrs),
+		text:     h.text.WithAttrs(attrs),
+	}
+}
+
+func (h *handler) WithGroup(name string) slog.Handler {
+	return &handler{
+		settings: h.settings,
+		json:     h.json.WithGroup(name),
+		text:     h.text.WithGroup(name),
+	}
+}
+
+func redact(_ []string, a slog.Attr) slog.Attr {
+	if Sensitive(a.Key) {
+		return slog.String(a.Key, redacted)
+	}
+	return a
+}
+
+// Sensitive reports whether an attribute or header called key holds a
+// secret, such as "password", "refresh_token" or "Authorization".
+func Sensitive(key string) bool {
+	key = strings.ToLower(strings.ReplaceAll(key, "-", "_"))
+	for _, s := range sensitiveKeys {
+		if key == s || strings.HasSuffix(key, "_"+s) {
+			return true
+		}
+	}
+	return false
+}
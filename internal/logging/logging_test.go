@@ -0,0 +1,90 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestNewRedactsSecrets(t *testing.T) {
+	settings, err := NewSettings("", "")
+	if err != nil {
+		t.Fatalf("NewSettings() resulted in error: %v", err)
+	}
+	var buf bytes.Buffer
+	logger := New(&buf, settings)
+
+	logger.Info("login", "email", "a@example.com", "password", "hunter2", "refresh_token", "abc", "Authorization", "Bearer xyz")
+
+	var record map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("json.Unmarshal() resulted in error: %v", err)
+	}
+	if record["email"] != "a@example.com" {
+		t.Errorf("email = %v, want a@example.com", record["email"])
+	}
+	for _, key := range []string{"password", "refresh_token", "Authorization"} {
+		if record[key] != redacted {
+			t.Errorf("%s = %v, want %s", key, record[key], redacted)
+		}
+	}
+}
+
+func TestSettingsChangeAtRuntime(t *testing.T) {
+	settings, err := NewSettings("warn", "json")
+	if err != nil {
+		t.Fatalf("NewSettings() resulted in error: %v", err)
+	}
+	var buf bytes.Buffer
+	logger := New(&buf, settings).With("component", "test")
+
+	logger.Info("dropped")
+	if buf.Len() != 0 {
+		t.Fatalf("info record written at warn level: %s", buf.String())
+	}
+
+	if err := settings.SetLevel("debug"); err != nil {
+		t.Fatalf("SetLevel() resulted in error: %v", err)
+	}
+	if err := settings.SetFormat("text"); err != nil {
+		t.Fatalf("SetFormat() resulted in error: %v", err)
+	}
+	logger.Debug("kept")
+	if got := buf.String(); !strings.Contains(got, "msg=kept") || !strings.Contains(got, "component=test") {
+		t.Errorf("text record = %q, want msg=kept and component=test", got)
+	}
+	if settings.Level() != "debug" || settings.Format() != FormatText {
+		t.Errorf("settings = %s %s, want debug text", settings.Level(), settings.Format())
+	}
+
+	if err := settings.SetLevel("loud"); err == nil {
+		t.Error("SetLevel(loud) succeeded, want error")
+	}
+	if err := settings.SetFormat("xml"); err == nil {
+		t.Error("SetFormat(xml) succeeded, want error")
+	}
+}
+
+func TestHandleAddsRequest(t *testing.T) {
+	settings, err := NewSettings("", "")
+	if err != nil {
+		t.Fatalf("NewSettings() resulted in error: %v", err)
+	}
+	var buf bytes.Buffer
+	logger := New(&buf, settings)
+
+	r := &Request{ID: "req-1"}
+	ctx := NewContext(context.Background(), r)
+	r.SetUserID("user-1")
+	logger.InfoContext(ctx, "hello")
+
+	var record map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("json.Unmarshal() resulted in error: %v", err)
+	}
+	if record["request_id"] != "req-1" || record["user_id"] != "user-1" {
+		t.Errorf("record = %v, want request_id req-1 and user_id user-1", record)
+	}
+}
@@ -0,0 +1,193 @@
+// Package metrics keeps the server's Prometheus metrics. Everything, from
+// request latency to chirps created, lives in one registry, which both the
+// /metrics endpoint and the admin metrics page read from.
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "chirpy"
+
+// Names of the metrics the admin page shows.
+const (
+	FileserverHits = namespace + "_fileserver_hits_total"
+	ChirpsCreated  = namespace + "_chirps_created_total"
+	Logins         = namespace + "_logins_total"
+	LoginsFailed   = namespace + "_logins_failed_total"
+	Webhooks       = namespace + "_webhooks_received_total"
+)
+
+// routeUnmatched is the route label for requests that matched no pattern,
+// so that scanners can't create a series per path.
+const routeUnmatched = "unmatched"
+
+type Metrics struct {
+	registry *prometheus.Registry
+
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+
+	fileserverHits prometheus.Counter
+	chirpsCreated  prometheus.Counter
+	logins         *prometheus.CounterVec
+	loginsFailed   *prometheus.CounterVec
+	webhooks       *prometheus.CounterVec
+
+	// fileserverHitsReset is the hit count when the admin page was last
+	// reset. Prometheus counters only go up, so the page subtracts it.
+	mu                  sync.Mutex
+	fileserverHitsReset float64
+}
+
+// New returns metrics registered in a registry of their own, along with the
+// Go runtime and process collectors.
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests handled, by route pattern and status.",
+		}, []string{"route", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "HTTP request latency, by route pattern and status.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "status"}),
+		fileserverHits: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: FileserverHits,
+			Help: "Requests for the static app files.",
+		}),
+		chirpsCreated: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: ChirpsCreated,
+			Help: "Chirps created.",
+		}),
+		logins: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: Logins,
+			Help: "Successful logins, by method.",
+		}, []string{"method"}),
+		loginsFailed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: LoginsFailed,
+			Help: "Failed logins, by method.",
+		}, []string{"method"}),
+		webhooks: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: Webhooks,
+			Help: "Webhooks received, by source.",
+		}, []string{"source"}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requests,
+		m.requestDuration,
+		m.fileserverHits,
+		m.chirpsCreated,
+		m.logins,
+		m.loginsFailed,
+		m.webhooks,
+	)
+	return m
+}
+
+// RegisterDB adds connection pool stats from db.Stats().
+func (m *Metrics) RegisterDB(db *sql.DB) error {
+	return m.registry.Register(collectors.NewDBStatsCollector(db, namespace))
+}
+
+// Handler serves the registry in the Prometheus text format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
+
+// ObserveRequest counts a handled request. route is the ServeMux pattern it
+// matched, or empty if it matched none.
+func (m *Metrics) ObserveRequest(route string, status int, latency time.Duration) {
+	if route == "" {
+		route = routeUnmatched
+	}
+	labels := prometheus.Labels{"route": route, "status": strconv.Itoa(status)}
+	m.requests.With(labels).Inc()
+	m.requestDuration.With(labels).Observe(latency.Seconds())
+}
+
+func (m *Metrics) FileserverHit() {
+	m.fileserverHits.Inc()
+}
+
+func (m *Metrics) ChirpCreated() {
+	m.chirpsCreated.Inc()
+}
+
+func (m *Metrics) Login(method string) {
+	m.logins.WithLabelValues(method).Inc()
+}
+
+func (m *Metrics) LoginFailed(method string) {
+	m.loginsFailed.WithLabelValues(method).Inc()
+}
+
+func (m *Metrics) WebhookReceived(source string) {
+	m.webhooks.WithLabelValues(source).Inc()
+}
+
+// Value gathers the metric called name from the registry and sums it across
+// labels. It returns 0 for a metric that hasn't been observed yet.
+func (m *Metrics) Value(name string) (float64, error) {
+	families, err := m.registry.Gather()
+	if err != nil {
+		return 0, err
+	}
+
+	var total float64
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			switch {
+			case metric.GetCounter() != nil:
+				total += metric.GetCounter().GetValue()
+			case metric.GetGauge() != nil:
+				total += metric.GetGauge().GetValue()
+			}
+		}
+	}
+	return total, nil
+}
+
+// FileserverHitsSinceReset is what the admin page shows as visits.
+func (m *Metrics) FileserverHitsSinceReset() (float64, error) {
+	hits, err := m.Value(FileserverHits)
+	if err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return hits - m.fileserverHitsReset, nil
+}
+
+// ResetFileserverHits zeroes the admin page's visit count. The Prometheus
+// counter keeps counting.
+func (m *Metrics) ResetFileserverHits() error {
+	hits, err := m.Value(FileserverHits)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.fileserverHitsReset = hits
+	return nil
+}
@@ -0,0 +1,84 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestObserveRequest(t *testing.T) {
+	m := New()
+	m.ObserveRequest("GET /api/chirps/{id}", http.StatusOK, 20*time.Millisecond)
+	m.ObserveRequest("GET /api/chirps/{id}", http.StatusNotFound, time.Millisecond)
+	m.ObserveRequest("", http.StatusNotFound, time.Millisecond)
+
+	w := httptest.NewRecorder()
+	m.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body, _ := io.ReadAll(w.Body)
+
+	for _, want := range []string{
+		`chirpy_http_requests_total{route="GET /api/chirps/{id}",status="200"} 1`,
+		`chirpy_http_requests_total{route="GET /api/chirps/{id}",status="404"} 1`,
+		`chirpy_http_requests_total{route="unmatched",status="404"} 1`,
+		`chirpy_http_request_duration_seconds_count{route="GET /api/chirps/{id}",status="200"} 1`,
+		`go_goroutines`,
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("/metrics is missing %s", want)
+		}
+	}
+}
+
+func TestValue(t *testing.T) {
+	m := New()
+	m.Login("password")
+	m.Login("password")
+	m.Login("two_factor")
+	m.LoginFailed("password")
+
+	tests := []struct {
+		name string
+		want float64
+	}{
+		{name: Logins, want: 3},
+		{name: LoginsFailed, want: 1},
+		{name: ChirpsCreated, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := m.Value(tt.name)
+			if err != nil {
+				t.Fatalf("Value() resulted in error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Value() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResetFileserverHits(t *testing.T) {
+	m := New()
+	m.FileserverHit()
+	m.FileserverHit()
+
+	if err := m.ResetFileserverHits(); err != nil {
+		t.Fatalf("ResetFileserverHits() resulted in error: %v", err)
+	}
+	m.FileserverHit()
+
+	hits, err := m.FileserverHitsSinceReset()
+	if err != nil {
+		t.Fatalf("FileserverHitsSinceReset() resulted in error: %v", err)
+	}
+	if hits != 1 {
+		t.Errorf("FileserverHitsSinceReset() = %v, want 1", hits)
+	}
+	if total, _ := m.Value(FileserverHits); total != 3 {
+		t.Errorf("Value(%s) = %v, want 3", FileserverHits, total)
+	}
+}
@@ -0,0 +1,136 @@
+// Package migrate applies the goose migrations in sql/schema, or in
+// sql/sqlite/schema for SQLite, from inside the binary, so deploying doesn't
+// need the goose CLI.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+
+	"github.com/pressly/goose/v3"
+	"github.com/pressly/goose/v3/database"
+	"github.com/pressly/goose/v3/lock"
+)
+
+var (
+	// ErrBehind means the database hasn't had every migration applied.
+	ErrBehind = errors.New("database schema is behind the migrations")
+
+	// ErrNothingApplied is returned by Down when there is nothing to roll
+	// back.
+	ErrNothingApplied = goose.ErrNoNextVersion
+)
+
+// Result is one migration that was applied or rolled back.
+type Result = goose.MigrationResult
+
+// Status is whether one migration has been applied.
+type Status = goose.MigrationStatus
+
+// Migrator runs migrations against Postgres or SQLite. On Postgres changes
+// hold an advisory lock, so servers migrating at the same time take turns
+// rather than racing each other. A SQLite database belongs to one server,
+// which has nobody to take turns with.
+type Migrator struct {
+	provider *goose.Provider
+}
+
+// New returns a Migrator for the migrations in fsys, which are read from its
+// root.
+func New(db *sql.DB, fsys fs.FS) (*Migrator, error) {
+	return newMigrator(db, fsys, database.DialectPostgres, goose.DefaultTablename)
+}
+
+// NewSQLite returns a Migrator for the SQLite migrations in fsys, which are
+// read from its root.
+func NewSQLite(db *sql.DB, fsys fs.FS) (*Migrator, error) {
+	return newMigrator(db, fsys, database.DialectSQLite3, goose.DefaultTablename)
+}
+
+func newMigrator(db *sql.DB, fsys fs.FS, dialect database.Dialect, table string) (*Migrator, error) {
+	store, err := database.NewStore(dialect, table)
+	if err != nil {
+		return nil, err
+	}
+	opts := []goose.ProviderOption{
+		goose.WithStore(store),
+		goose.WithDisableGlobalRegistry(true),
+	}
+	if dialect == database.DialectPostgres {
+		locker, err := lock.NewPostgresSessionLocker()
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, goose.WithSessionLocker(locker))
+	}
+	provider, err := goose.NewProvider("", db, fsys, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{provider: provider}, nil
+}
+
+// Up applies every pending migration.
+func (m *Migrator) Up(ctx context.Context) ([]*Result, error) {
+	return m.provider.Up(ctx)
+}
+
+// Down rolls back the latest migration.
+func (m *Migrator) Down(ctx context.Context) (*Result, error) {
+	return m.provider.Down(ctx)
+}
+
+// To migrates up or down until version is the latest migration applied.
+// Version 0 rolls back every migration.
+func (m *Migrator) To(ctx context.Context, version int64) ([]*Result, error) {
+	if version != 0 && !m.hasVersion(version) {
+		return nil, fmt.Errorf("there is no migration %d", version)
+	}
+
+	current, err := m.provider.GetDBVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if version < current {
+		return m.provider.DownTo(ctx, version)
+	}
+	return m.provider.UpTo(ctx, version)
+}
+
+// Status reports every migration and whether it has been applied.
+func (m *Migrator) Status(ctx context.Context) ([]*Status, error) {
+	return m.provider.Status(ctx)
+}
+
+// Check returns an error wrapping ErrBehind if the latest migration hasn't
+// been applied, and an error too if an older one was skipped. It doesn't
+// take the lock, so it never waits for another server that is migrating.
+// A database ahead of the migrations passes, as it is during a rolling
+// deploy for servers still running the old build.
+func (m *Migrator) Check(ctx context.Context) error {
+	pending, err := m.provider.HasPending(ctx)
+	if err != nil {
+		return err
+	}
+	if !pending {
+		return nil
+	}
+
+	current, latest, err := m.provider.GetVersions(ctx)
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("%w: database is at version %d, the latest migration is %d", ErrBehind, current, latest)
+}
+
+func (m *Migrator) hasVersion(version int64) bool {
+	for _, source := range m.provider.ListSources() {
+		if source.Version == version {
+			return true
+		}
+	}
+	return false
+}
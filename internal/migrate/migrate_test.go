@@ -0,0 +1,161 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"github.com/pressly/goose/v3/database"
+
+	_ "github.com/lib/pq"
+	_ "modernc.org/sqlite"
+)
+
+const testVersionTable = "migrate_test_db_version"
+
+var testMigrations = fstest.MapFS{
+	"001_widgets.sql": {Data: []byte(`-- +goose Up
+CREATE TABLE migrate_test_widgets (id INTEGER PRIMARY KEY);
+
+-- +goose Down
+DROP TABLE migrate_test_widgets;
+`)},
+	"002_widget_names.sql": {Data: []byte(`-- +goose Up
+ALTER TABLE migrate_test_widgets ADD COLUMN name TEXT;
+
+-- +goose Down
+ALTER TABLE migrate_test_widgets DROP COLUMN name;
+`)},
+}
+
+// newTestDB connects to the database named by CHIRPY_TEST_DB_URL. The test
+// migrations have tables of their own, tracked in their own version table,
+// so the real schema is left alone.
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	dbURL := os.Getenv("CHIRPY_TEST_DB_URL")
+	if dbURL == "" {
+		t.Skip("CHIRPY_TEST_DB_URL is not set")
+	}
+	db, err := sql.Open("postgres", dbURL)
+	if err != nil {
+		t.Fatalf("sql.Open() resulted in error: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Exec("DROP TABLE IF EXISTS migrate_test_widgets")
+		db.Exec("DROP TABLE IF EXISTS " + testVersionTable)
+		db.Close()
+	})
+	return db
+}
+
+func TestMigrator(t *testing.T) {
+	m, err := newMigrator(newTestDB(t), testMigrations, database.DialectPostgres, testVersionTable)
+	if err != nil {
+		t.Fatalf("newMigrator() resulted in error: %v", err)
+	}
+	testMigrator(t, m)
+}
+
+func TestSQLiteMigrator(t *testing.T) {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "migrate.db"))
+	if err != nil {
+		t.Fatalf("sql.Open() resulted in error: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	m, err := NewSQLite(db, testMigrations)
+	if err != nil {
+		t.Fatalf("NewSQLite() resulted in error: %v", err)
+	}
+	testMigrator(t, m)
+}
+
+func testMigrator(t *testing.T, m *Migrator) {
+	t.Helper()
+	ctx := context.Background()
+
+	if err := m.Check(ctx); !errors.Is(err, ErrBehind) {
+		t.Fatalf("Check() on an empty database = %v, want ErrBehind", err)
+	}
+
+	results, err := m.To(ctx, 1)
+	if err != nil {
+		t.Fatalf("To(1) resulted in error: %v", err)
+	}
+	if len(results) != 1 || results[0].Source.Version != 1 {
+		t.Fatalf("To(1) applied %v, want migration 1", results)
+	}
+	if err := m.Check(ctx); !errors.Is(err, ErrBehind) {
+		t.Fatalf("Check() at version 1 = %v, want ErrBehind", err)
+	}
+
+	if _, err := m.Up(ctx); err != nil {
+		t.Fatalf("Up() resulted in error: %v", err)
+	}
+	if err := m.Check(ctx); err != nil {
+		t.Fatalf("Check() after Up() resulted in error: %v", err)
+	}
+
+	result, err := m.Down(ctx)
+	if err != nil {
+		t.Fatalf("Down() resulted in error: %v", err)
+	}
+	if result.Source.Version != 2 {
+		t.Errorf("Down() rolled back %d, want 2", result.Source.Version)
+	}
+
+	if _, err := m.To(ctx, 0); err != nil {
+		t.Fatalf("To(0) resulted in error: %v", err)
+	}
+	if _, err := m.Down(ctx); !errors.Is(err, ErrNothingApplied) {
+		t.Errorf("Down() with nothing applied = %v, want ErrNothingApplied", err)
+	}
+	if _, err := m.To(ctx, 3); err == nil {
+		t.Error("To(3) resulted in no error, want an unknown migration error")
+	}
+
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		t.Fatalf("Status() resulted in error: %v", err)
+	}
+	for _, status := range statuses {
+		if status.State != "pending" {
+			t.Errorf("migration %d is %s, want pending", status.Source.Version, status.State)
+		}
+	}
+}
+
+func TestMigratorUpConcurrently(t *testing.T) {
+	db := newTestDB(t)
+
+	var wg sync.WaitGroup
+	applied := make([]int, 2)
+	for i := range applied {
+		// Each server has a provider of its own.
+		m, err := newMigrator(db, testMigrations, database.DialectPostgres, testVersionTable)
+		if err != nil {
+			t.Fatalf("newMigrator() resulted in error: %v", err)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results, err := m.Up(context.Background())
+			if err != nil {
+				t.Errorf("Up() resulted in error: %v", err)
+			}
+			applied[i] = len(results)
+		}()
+	}
+	wg.Wait()
+
+	if total := applied[0] + applied[1]; total != len(testMigrations) {
+		t.Errorf("Up() applied %d migrations between both servers, want each applied once", total)
+	}
+}
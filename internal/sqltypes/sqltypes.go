@@ -0,0 +1,74 @@
+// Package sqltypes has column types for databases that lack the Postgres
+// types the schema uses.
+package sqltypes
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// StringArray is a TEXT[] kept in a TEXT column as a JSON array. Like
+// pq.Array, a nil slice is NULL and NULL scans to a nil slice.
+type StringArray []string
+
+func (a StringArray) Value() (driver.Value, error) {
+	if a == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal([]string(a))
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func (a *StringArray) Scan(src any) error {
+	var b []byte
+	switch src := src.(type) {
+	case nil:
+		*a = nil
+		return nil
+	case string:
+		b = []byte(src)
+	case []byte:
+		b = src
+	default:
+		return fmt.Errorf("cannot scan %T into StringArray", src)
+	}
+
+	var items []string
+	if err := json.Unmarshal(b, &items); err != nil {
+		return fmt.Errorf("cannot scan %q into StringArray: %w", b, err)
+	}
+	if items == nil {
+		items = []string{}
+	}
+	*a = items
+	return nil
+}
+
+// JSON is a JSONB value kept in a TEXT column. It is stored as text, so it
+// stays readable in the sqlite3 shell, and scans from text or a blob.
+type JSON json.RawMessage
+
+func (j JSON) Value() (driver.Value, error) {
+	if j == nil {
+		return nil, nil
+	}
+	return string(j), nil
+}
+
+func (j *JSON) Scan(src any) error {
+	switch src := src.(type) {
+	case nil:
+		*j = nil
+	case string:
+		*j = JSON(src)
+	case []byte:
+		*j = append(JSON(nil), src...)
+	default:
+		return fmt.Errorf("cannot scan %T into JSON", src)
+	}
+	return nil
+}
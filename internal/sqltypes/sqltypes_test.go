@@ -0,0 +1,67 @@
+package sqltypes
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestStringArray(t *testing.T) {
+	testTable := []struct {
+		name  string
+		array StringArray
+		value any
+	}{
+		{"nil", nil, nil},
+		{"empty", StringArray{}, "[]"},
+		{"items", StringArray{"chirps:read", "a \"quoted\" scope"}, `["chirps:read","a \"quoted\" scope"]`},
+	}
+
+	for _, tt := range testTable {
+		t.Run(tt.name, func(t *testing.T) {
+			value, err := tt.array.Value()
+			if err != nil {
+				t.Fatalf("Value() resulted in error: %v", err)
+			}
+			if value != tt.value {
+				t.Fatalf("Value() = %#v, want %#v", value, tt.value)
+			}
+
+			var scanned StringArray
+			if err := scanned.Scan(value); err != nil {
+				t.Fatalf("Scan() resulted in error: %v", err)
+			}
+			if !slices.Equal(scanned, tt.array) || (scanned == nil) != (tt.array == nil) {
+				t.Errorf("Scan(%#v) = %#v, want %#v", value, scanned, tt.array)
+			}
+		})
+	}
+
+	var scanned StringArray
+	if err := scanned.Scan([]byte(`["a"]`)); err != nil || !slices.Equal(scanned, StringArray{"a"}) {
+		t.Errorf("Scan() of a blob = %#v, %v, want [a]", scanned, err)
+	}
+	if err := scanned.Scan("not json"); err == nil {
+		t.Error("Scan() of text that isn't JSON resulted in no error")
+	}
+}
+
+func TestJSON(t *testing.T) {
+	value, err := JSON(`{"a":1}`).Value()
+	if err != nil || value != `{"a":1}` {
+		t.Errorf("Value() = %#v, %v, want the text of the JSON", value, err)
+	}
+	if value, err := JSON(nil).Value(); err != nil || value != nil {
+		t.Errorf("Value() of nil = %#v, %v, want nil", value, err)
+	}
+
+	for _, src := range []any{`{"a":1}`, []byte(`{"a":1}`)} {
+		var scanned JSON
+		if err := scanned.Scan(src); err != nil || string(scanned) != `{"a":1}` {
+			t.Errorf("Scan(%#v) = %s, %v, want {\"a\":1}", src, scanned, err)
+		}
+	}
+	var scanned JSON
+	if err := scanned.Scan(int64(1)); err == nil {
+		t.Error("Scan() of an integer resulted in no error")
+	}
+}
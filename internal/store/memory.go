@@ -0,0 +1,262 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/drewheasman/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// Memory keeps every table in memory, for tests and for trying the API
+// without a database. It enforces the same keys, foreign keys and cascades
+// as the schema, so code that works against it works against Postgres.
+//
+// A transaction holds the store to itself until it finishes, as if every
+// transaction were serializable.
+type Memory struct {
+	mu     *sync.Mutex
+	tables *memoryTables
+	inTx   bool
+}
+
+type memoryTables struct {
+	users                   []database.User
+	chirps                  []database.Chirp
+	refreshTokens           []database.RefreshToken
+	recoveryCodes           []database.RecoveryCode
+	twoFactorChallenges     []database.TwoFactorChallenge
+	passwordResetTokens     []database.PasswordResetToken
+	personalAccessTokens    []database.PersonalAccessToken
+	oauthClients            []database.OauthClient
+	oauthAuthorizationCodes []database.OauthAuthorizationCode
+	dataExports             []database.DataExport
+	externalUserIDs         []database.ExternalUserID
+	externalChirpIDs        []database.ExternalChirpID
+	auditLog                []database.AuditLog
+	loginAttempts           []database.LoginAttempt
+}
+
+func NewMemory() *Memory {
+	return &Memory{mu: &sync.Mutex{}, tables: &memoryTables{}}
+}
+
+// lock locks the store, unless it is a transaction that already holds it.
+// It returns the function that unlocks it again.
+func (m *Memory) lock() func() {
+	if m.inTx {
+		return func() {}
+	}
+	m.mu.Lock()
+	return m.mu.Unlock
+}
+
+func (m *Memory) Ping(ctx context.Context) error {
+	return nil
+}
+
+// InTx runs fn against a copy of the tables, which replaces them if fn
+// succeeds.
+func (m *Memory) InTx(ctx context.Context, fn func(Store) error) error {
+	if m.inTx {
+		return fn(m)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tx := &Memory{mu: m.mu, tables: m.tables.clone(), inTx: true}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	m.tables = tx.tables
+	return nil
+}
+
+// clone copies the tables. Rows are never changed in place, only replaced,
+// so the rows themselves can be shared.
+func (t *memoryTables) clone() *memoryTables {
+	return &memoryTables{
+		users:                   slices.Clone(t.users),
+		chirps:                  slices.Clone(t.chirps),
+		refreshTokens:           slices.Clone(t.refreshTokens),
+		recoveryCodes:           slices.Clone(t.recoveryCodes),
+		twoFactorChallenges:     slices.Clone(t.twoFactorChallenges),
+		passwordResetTokens:     slices.Clone(t.passwordResetTokens),
+		personalAccessTokens:    slices.Clone(t.personalAccessTokens),
+		oauthClients:            slices.Clone(t.oauthClients),
+		oauthAuthorizationCodes: slices.Clone(t.oauthAuthorizationCodes),
+		dataExports:             slices.Clone(t.dataExports),
+		externalUserIDs:         slices.Clone(t.externalUserIDs),
+		externalChirpIDs:        slices.Clone(t.externalChirpIDs),
+		auditLog:                slices.Clone(t.auditLog),
+		loginAttempts:           slices.Clone(t.loginAttempts),
+	}
+}
+
+// now is NOW() as a TIMESTAMP column stores it: UTC, to the microsecond.
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
+
+func errDuplicateKey(table string) error {
+	return fmt.Errorf("duplicate key value violates primary or unique key of %s", table)
+}
+
+func errForeignKey(table, column string) error {
+	return fmt.Errorf("insert or update on table %s violates foreign key on %s", table, column)
+}
+
+func (t *memoryTables) userIndex(id uuid.UUID) int {
+	return slices.IndexFunc(t.users, func(u database.User) bool { return u.ID == id })
+}
+
+func (t *memoryTables) hasUser(id uuid.UUID) bool {
+	return t.userIndex(id) >= 0
+}
+
+func (t *memoryTables) emailTaken(email string, except uuid.UUID) bool {
+	return slices.ContainsFunc(t.users, func(u database.User) bool { return u.Email == email && u.ID != except })
+}
+
+// updateUser applies update to the user with id, returning the number of
+// rows changed like an UPDATE would.
+func (t *memoryTables) updateUser(id uuid.UUID, update func(*database.User)) int64 {
+	i := t.userIndex(id)
+	if i < 0 {
+		return 0
+	}
+	userRecord := t.users[i]
+	update(&userRecord)
+	t.users[i] = userRecord
+	return 1
+}
+
+// deleteUsers deletes the users matching match along with every row that
+// references them, as ON DELETE CASCADE does.
+func (t *memoryTables) deleteUsers(match func(database.User) bool) []database.User {
+	var deleted []database.User
+	t.users = deleteRows(t.users, func(u database.User) bool {
+		if match(u) {
+			deleted = append(deleted, u)
+			return true
+		}
+		return false
+	})
+	if len(deleted) == 0 {
+		return nil
+	}
+
+	ids := map[uuid.UUID]bool{}
+	for _, u := range deleted {
+		ids[u.ID] = true
+	}
+	t.deleteChirps(func(c database.Chirp) bool { return ids[c.UserID] })
+	t.refreshTokens = deleteRows(t.refreshTokens, func(r database.RefreshToken) bool { return ids[r.UserID] })
+	t.recoveryCodes = deleteRows(t.recoveryCodes, func(r database.RecoveryCode) bool { return ids[r.UserID] })
+	t.twoFactorChallenges = deleteRows(t.twoFactorChallenges, func(c database.TwoFactorChallenge) bool { return ids[c.UserID] })
+	t.passwordResetTokens = deleteRows(t.passwordResetTokens, func(p database.PasswordResetToken) bool { return ids[p.UserID] })
+	t.personalAccessTokens = deleteRows(t.personalAccessTokens, func(p database.PersonalAccessToken) bool { return ids[p.UserID] })
+	t.oauthAuthorizationCodes = deleteRows(t.oauthAuthorizationCodes, func(c database.OauthAuthorizationCode) bool { return ids[c.UserID] })
+	t.dataExports = deleteRows(t.dataExports, func(d database.DataExport) bool { return ids[d.UserID] })
+	t.externalUserIDs = deleteRows(t.externalUserIDs, func(e database.ExternalUserID) bool { return ids[e.UserID] })
+
+	clientIDs := map[string]bool{}
+	t.oauthClients = deleteRows(t.oauthClients, func(c database.OauthClient) bool {
+		if ids[c.OwnerID] {
+			clientIDs[c.ID] = true
+			return true
+		}
+		return false
+	})
+	t.oauthAuthorizationCodes = deleteRows(t.oauthAuthorizationCodes, func(c database.OauthAuthorizationCode) bool { return clientIDs[c.ClientID] })
+	t.refreshTokens = deleteRows(t.refreshTokens, func(r database.RefreshToken) bool { return r.ClientID.Valid && clientIDs[r.ClientID.String] })
+
+	return deleted
+}
+
+// deleteChirps deletes the chirps matching match along with their external
+// IDs, as ON DELETE CASCADE does. It returns how many chirps it deleted.
+func (t *memoryTables) deleteChirps(match func(database.Chirp) bool) int {
+	ids := map[uuid.UUID]bool{}
+	t.chirps = deleteRows(t.chirps, func(c database.Chirp) bool {
+		if match(c) {
+			ids[c.ID] = true
+			return true
+		}
+		return false
+	})
+	t.externalChirpIDs = deleteRows(t.externalChirpIDs, func(e database.ExternalChirpID) bool { return ids[e.ChirpID] })
+	return len(ids)
+}
+
+// deleteRows returns rows without the ones matching match, in a new slice so
+// a transaction's copy of the table is left alone.
+func deleteRows[T any](rows []T, match func(T) bool) []T {
+	kept := make([]T, 0, len(rows))
+	for _, row := range rows {
+		if !match(row) {
+			kept = append(kept, row)
+		}
+	}
+	return kept
+}
+
+// page applies OFFSET and LIMIT.
+func page[T any](rows []T, limit, offset int32) []T {
+	if int(offset) >= len(rows) {
+		return nil
+	}
+	rows = rows[offset:]
+	if int(limit) < len(rows) {
+		rows = rows[:limit]
+	}
+	return rows
+}
+
+// compareUUIDs orders UUIDs the way Postgres does, byte by byte.
+func compareUUIDs(a, b uuid.UUID) int {
+	return bytes.Compare(a[:], b[:])
+}
+
+// ilikeContains reports whether '%' || pattern || '%' matches s with ILIKE,
+// where _ and % in pattern are wildcards and a backslash escapes them.
+func ilikeContains(s, pattern string) bool {
+	var expr strings.Builder
+	expr.WriteString("(?is)")
+	escaped := false
+	for _, r := range pattern {
+		switch {
+		case escaped:
+			expr.WriteString(regexp.QuoteMeta(string(r)))
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '%':
+			expr.WriteString(".*")
+		case r == '_':
+			expr.WriteString(".")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	return regexp.MustCompile(expr.String()).MatchString(s)
+}
+
+// inRange applies the optional created_after and created_before filters.
+func inRange(createdAt time.Time, after, before sql.NullTime) bool {
+	if after.Valid && createdAt.Before(after.Time) {
+		return false
+	}
+	if before.Valid && !createdAt.Before(before.Time) {
+		return false
+	}
+	return true
+}
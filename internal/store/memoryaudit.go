@@ -0,0 +1,105 @@
+package store
+
+import (
+	"context"
+	"slices"
+
+	"github.com/drewheasman/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+func (m *Memory) CountAuditLog(ctx context.Context, arg database.CountAuditLogParams) (int64, error) {
+	defer m.lock()()
+
+	var count int64
+	for _, e := range m.tables.auditLog {
+		if matchAuditLog(e, database.ListAuditLogParams{
+			ActorID:       arg.ActorID,
+			TargetUserID:  arg.TargetUserID,
+			Action:        arg.Action,
+			TargetType:    arg.TargetType,
+			CreatedAfter:  arg.CreatedAfter,
+			CreatedBefore: arg.CreatedBefore,
+		}) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// CreateAuditLogEntry appends an entry. Nothing changes or deletes entries
+// once they are written, which the audit_log table enforces with a trigger.
+func (m *Memory) CreateAuditLogEntry(ctx context.Context, arg database.CreateAuditLogEntryParams) error {
+	defer m.lock()()
+
+	m.tables.auditLog = append(m.tables.auditLog, database.AuditLog{
+		ID:           uuid.New(),
+		CreatedAt:    now(),
+		ActorID:      arg.ActorID,
+		Action:       arg.Action,
+		TargetUserID: arg.TargetUserID,
+		Details:      slices.Clone(arg.Details),
+		Ip:           arg.Ip,
+		UserAgent:    arg.UserAgent,
+		TargetType:   arg.TargetType,
+		TargetID:     arg.TargetID,
+		Diff:         slices.Clone(arg.Diff),
+	})
+	return nil
+}
+
+func (m *Memory) GetAuditLogForTarget(ctx context.Context, arg database.GetAuditLogForTargetParams) ([]database.GetAuditLogForTargetRow, error) {
+	defer m.lock()()
+
+	var items []database.GetAuditLogForTargetRow
+	for _, e := range m.tables.auditLog {
+		if !arg.TargetUserID.Valid || e.TargetUserID != arg.TargetUserID || !slices.Contains(arg.Actions, e.Action) {
+			continue
+		}
+		items = append(items, database.GetAuditLogForTargetRow{
+			CreatedAt: e.CreatedAt,
+			Action:    e.Action,
+			Details:   e.Details,
+		})
+	}
+	slices.SortStableFunc(items, func(a, b database.GetAuditLogForTargetRow) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+	return items, nil
+}
+
+func (m *Memory) ListAuditLog(ctx context.Context, arg database.ListAuditLogParams) ([]database.AuditLog, error) {
+	defer m.lock()()
+
+	var matched []database.AuditLog
+	for _, e := range m.tables.auditLog {
+		if matchAuditLog(e, arg) {
+			matched = append(matched, e)
+		}
+	}
+	slices.SortFunc(matched, func(a, b database.AuditLog) int {
+		if c := b.CreatedAt.Compare(a.CreatedAt); c != 0 {
+			return c
+		}
+		return compareUUIDs(b.ID, a.ID)
+	})
+	return page(matched, arg.MaxResults, arg.SkipResults), nil
+}
+
+// matchAuditLog applies the optional filters of ListAuditLog and
+// CountAuditLog, ignoring the paging.
+func matchAuditLog(e database.AuditLog, arg database.ListAuditLogParams) bool {
+	if arg.ActorID.Valid && e.ActorID != arg.ActorID {
+		return false
+	}
+	if arg.TargetUserID.Valid && e.TargetUserID != arg.TargetUserID {
+		return false
+	}
+	if arg.Action.Valid && e.Action != arg.Action.String {
+		return false
+	}
+	if arg.TargetType.Valid && e.TargetType != arg.TargetType {
+		return false
+	}
+	return inRange(e.CreatedAt, arg.CreatedAfter, arg.CreatedBefore)
+}
@@ -0,0 +1,370 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+
+	"github.com/drewheasman/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+func (m *Memory) CreateRecoveryCodes(ctx context.Context, arg database.CreateRecoveryCodesParams) error {
+	defer m.lock()()
+
+	if !m.tables.hasUser(arg.UserID) {
+		return errForeignKey("recovery_codes", "user_id")
+	}
+	createdAt := now()
+	for _, codeHash := range arg.CodeHashes {
+		m.tables.recoveryCodes = append(m.tables.recoveryCodes, database.RecoveryCode{
+			ID:        uuid.New(),
+			CreatedAt: createdAt,
+			UserID:    arg.UserID,
+			CodeHash:  codeHash,
+		})
+	}
+	return nil
+}
+
+func (m *Memory) CreateTwoFactorChallenge(ctx context.Context, arg database.CreateTwoFactorChallengeParams) error {
+	defer m.lock()()
+
+	if !m.tables.hasUser(arg.UserID) {
+		return errForeignKey("two_factor_challenges", "user_id")
+	}
+	if slices.ContainsFunc(m.tables.twoFactorChallenges, func(c database.TwoFactorChallenge) bool { return c.TokenHash == arg.TokenHash }) {
+		return errDuplicateKey("two_factor_challenges")
+	}
+	m.tables.twoFactorChallenges = append(m.tables.twoFactorChallenges, database.TwoFactorChallenge{
+		TokenHash: arg.TokenHash,
+		CreatedAt: now(),
+		UserID:    arg.UserID,
+		ExpiresAt: arg.ExpiresAt,
+	})
+	return nil
+}
+
+func (m *Memory) DeleteRecoveryCodes(ctx context.Context, userID uuid.UUID) error {
+	defer m.lock()()
+
+	m.tables.recoveryCodes = deleteRows(m.tables.recoveryCodes, func(r database.RecoveryCode) bool { return r.UserID == userID })
+	return nil
+}
+
+func (m *Memory) DeleteTwoFactorChallenge(ctx context.Context, tokenHash string) error {
+	defer m.lock()()
+
+	m.tables.twoFactorChallenges = deleteRows(m.tables.twoFactorChallenges, func(c database.TwoFactorChallenge) bool { return c.TokenHash == tokenHash })
+	return nil
+}
+
+func (m *Memory) GetUserFromTwoFactorChallenge(ctx context.Context, arg database.GetUserFromTwoFactorChallengeParams) (uuid.UUID, error) {
+	defer m.lock()()
+
+	i := slices.IndexFunc(m.tables.twoFactorChallenges, func(c database.TwoFactorChallenge) bool {
+		return c.TokenHash == arg.TokenHash && c.ExpiresAt.After(arg.ExpiresAt)
+	})
+	if i < 0 {
+		return uuid.UUID{}, sql.ErrNoRows
+	}
+	return m.tables.twoFactorChallenges[i].UserID, nil
+}
+
+func (m *Memory) UseRecoveryCode(ctx context.Context, arg database.UseRecoveryCodeParams) (int64, error) {
+	defer m.lock()()
+
+	usedAt := now()
+	var used int64
+	for i, r := range m.tables.recoveryCodes {
+		if r.UserID != arg.UserID || r.CodeHash != arg.CodeHash || r.UsedAt.Valid {
+			continue
+		}
+		r.UsedAt = sql.NullTime{Time: usedAt, Valid: true}
+		m.tables.recoveryCodes[i] = r
+		used++
+	}
+	return used, nil
+}
+
+// ConsumePasswordResetToken deletes the token if it is still valid at
+// arg.ExpiresAt, returning who it was for.
+func (m *Memory) ConsumePasswordResetToken(ctx context.Context, arg database.ConsumePasswordResetTokenParams) (uuid.UUID, error) {
+	defer m.lock()()
+
+	i := slices.IndexFunc(m.tables.passwordResetTokens, func(p database.PasswordResetToken) bool {
+		return p.TokenHash == arg.TokenHash && p.ExpiresAt.After(arg.ExpiresAt)
+	})
+	if i < 0 {
+		return uuid.UUID{}, sql.ErrNoRows
+	}
+	token := m.tables.passwordResetTokens[i]
+	m.tables.passwordResetTokens = deleteRows(m.tables.passwordResetTokens, func(p database.PasswordResetToken) bool { return p.TokenHash == token.TokenHash })
+	return token.UserID, nil
+}
+
+func (m *Memory) CreatePasswordResetToken(ctx context.Context, arg database.CreatePasswordResetTokenParams) error {
+	defer m.lock()()
+
+	if !m.tables.hasUser(arg.UserID) {
+		return errForeignKey("password_reset_tokens", "user_id")
+	}
+	if slices.ContainsFunc(m.tables.passwordResetTokens, func(p database.PasswordResetToken) bool { return p.TokenHash == arg.TokenHash }) {
+		return errDuplicateKey("password_reset_tokens")
+	}
+	m.tables.passwordResetTokens = append(m.tables.passwordResetTokens, database.PasswordResetToken{
+		TokenHash: arg.TokenHash,
+		CreatedAt: now(),
+		UserID:    arg.UserID,
+		ExpiresAt: arg.ExpiresAt,
+	})
+	return nil
+}
+
+func (m *Memory) ResetPassword(ctx context.Context, arg database.ResetPasswordParams) error {
+	defer m.lock()()
+
+	m.tables.updateUser(arg.ID, func(u *database.User) {
+		u.HashedPassword = arg.HashedPassword
+		u.PasswordResetRequired = false
+		u.UpdatedAt = now()
+	})
+	return nil
+}
+
+func (m *Memory) CreatePersonalAccessToken(ctx context.Context, arg database.CreatePersonalAccessTokenParams) (database.CreatePersonalAccessTokenRow, error) {
+	defer m.lock()()
+
+	if !m.tables.hasUser(arg.UserID) {
+		return database.CreatePersonalAccessTokenRow{}, errForeignKey("personal_access_tokens", "user_id")
+	}
+	if slices.ContainsFunc(m.tables.personalAccessTokens, func(p database.PersonalAccessToken) bool { return p.TokenHash == arg.TokenHash }) {
+		return database.CreatePersonalAccessTokenRow{}, errDuplicateKey("personal_access_tokens")
+	}
+	token := database.PersonalAccessToken{
+		ID:        uuid.New(),
+		CreatedAt: now(),
+		UserID:    arg.UserID,
+		Name:      arg.Name,
+		TokenHash: arg.TokenHash,
+		Scopes:    slices.Clone(arg.Scopes),
+		ExpiresAt: arg.ExpiresAt,
+	}
+	m.tables.personalAccessTokens = append(m.tables.personalAccessTokens, token)
+
+	return database.CreatePersonalAccessTokenRow{
+		ID:         token.ID,
+		CreatedAt:  token.CreatedAt,
+		Name:       token.Name,
+		Scopes:     token.Scopes,
+		ExpiresAt:  token.ExpiresAt,
+		LastUsedAt: token.LastUsedAt,
+	}, nil
+}
+
+func (m *Memory) DeletePersonalAccessToken(ctx context.Context, arg database.DeletePersonalAccessTokenParams) (int64, error) {
+	defer m.lock()()
+
+	before := len(m.tables.personalAccessTokens)
+	m.tables.personalAccessTokens = deleteRows(m.tables.personalAccessTokens, func(p database.PersonalAccessToken) bool {
+		return p.ID == arg.ID && p.UserID == arg.UserID
+	})
+	return int64(before - len(m.tables.personalAccessTokens)), nil
+}
+
+func (m *Memory) DeletePersonalAccessTokensForUser(ctx context.Context, userID uuid.UUID) (int64, error) {
+	defer m.lock()()
+
+	before := len(m.tables.personalAccessTokens)
+	m.tables.personalAccessTokens = deleteRows(m.tables.personalAccessTokens, func(p database.PersonalAccessToken) bool {
+		return p.UserID == userID
+	})
+	return int64(before - len(m.tables.personalAccessTokens)), nil
+}
+
+func (m *Memory) GetPersonalAccessTokensForUser(ctx context.Context, userID uuid.UUID) ([]database.GetPersonalAccessTokensForUserRow, error) {
+	defer m.lock()()
+
+	var items []database.GetPersonalAccessTokensForUserRow
+	for _, p := range m.tables.personalAccessTokens {
+		if p.UserID != userID {
+			continue
+		}
+		items = append(items, database.GetPersonalAccessTokensForUserRow{
+			ID:         p.ID,
+			CreatedAt:  p.CreatedAt,
+			Name:       p.Name,
+			Scopes:     p.Scopes,
+			ExpiresAt:  p.ExpiresAt,
+			LastUsedAt: p.LastUsedAt,
+		})
+	}
+	slices.SortStableFunc(items, func(a, b database.GetPersonalAccessTokensForUserRow) int {
+		return b.CreatedAt.Compare(a.CreatedAt)
+	})
+	return items, nil
+}
+
+// UsePersonalAccessToken records that an unexpired token was used.
+func (m *Memory) UsePersonalAccessToken(ctx context.Context, tokenHash string) (database.UsePersonalAccessTokenRow, error) {
+	defer m.lock()()
+
+	currentTime := now()
+	i := slices.IndexFunc(m.tables.personalAccessTokens, func(p database.PersonalAccessToken) bool {
+		return p.TokenHash == tokenHash && (!p.ExpiresAt.Valid || p.ExpiresAt.Time.After(currentTime))
+	})
+	if i < 0 {
+		return database.UsePersonalAccessTokenRow{}, sql.ErrNoRows
+	}
+
+	p := m.tables.personalAccessTokens[i]
+	p.LastUsedAt = sql.NullTime{Time: currentTime, Valid: true}
+	m.tables.personalAccessTokens[i] = p
+	return database.UsePersonalAccessTokenRow{ID: p.ID, UserID: p.UserID, Scopes: p.Scopes}, nil
+}
+
+// ConsumeOAuthAuthorizationCode deletes an unexpired code and returns it.
+// An expired code is left for nothing to find.
+func (m *Memory) ConsumeOAuthAuthorizationCode(ctx context.Context, codeHash string) (database.OauthAuthorizationCode, error) {
+	defer m.lock()()
+
+	currentTime := now()
+	i := slices.IndexFunc(m.tables.oauthAuthorizationCodes, func(c database.OauthAuthorizationCode) bool {
+		return c.CodeHash == codeHash && c.ExpiresAt.After(currentTime)
+	})
+	if i < 0 {
+		return database.OauthAuthorizationCode{}, sql.ErrNoRows
+	}
+	code := m.tables.oauthAuthorizationCodes[i]
+	m.tables.oauthAuthorizationCodes = deleteRows(m.tables.oauthAuthorizationCodes, func(c database.OauthAuthorizationCode) bool { return c.CodeHash == codeHash })
+	return code, nil
+}
+
+func (m *Memory) CreateOAuthAuthorizationCode(ctx context.Context, arg database.CreateOAuthAuthorizationCodeParams) error {
+	defer m.lock()()
+
+	if !m.tables.hasOAuthClient(arg.ClientID) {
+		return errForeignKey("oauth_authorization_codes", "client_id")
+	}
+	if !m.tables.hasUser(arg.UserID) {
+		return errForeignKey("oauth_authorization_codes", "user_id")
+	}
+	if slices.ContainsFunc(m.tables.oauthAuthorizationCodes, func(c database.OauthAuthorizationCode) bool { return c.CodeHash == arg.CodeHash }) {
+		return errDuplicateKey("oauth_authorization_codes")
+	}
+	m.tables.oauthAuthorizationCodes = append(m.tables.oauthAuthorizationCodes, database.OauthAuthorizationCode{
+		CodeHash:      arg.CodeHash,
+		CreatedAt:     now(),
+		ClientID:      arg.ClientID,
+		UserID:        arg.UserID,
+		RedirectUri:   arg.RedirectUri,
+		Scopes:        slices.Clone(arg.Scopes),
+		CodeChallenge: arg.CodeChallenge,
+		ExpiresAt:     arg.ExpiresAt,
+	})
+	return nil
+}
+
+func (m *Memory) CreateOAuthClient(ctx context.Context, arg database.CreateOAuthClientParams) (database.OauthClient, error) {
+	defer m.lock()()
+
+	if !m.tables.hasUser(arg.OwnerID) {
+		return database.OauthClient{}, errForeignKey("oauth_clients", "owner_id")
+	}
+	if m.tables.hasOAuthClient(arg.ID) {
+		return database.OauthClient{}, errDuplicateKey("oauth_clients")
+	}
+	client := database.OauthClient{
+		ID:           arg.ID,
+		CreatedAt:    now(),
+		OwnerID:      arg.OwnerID,
+		Name:         arg.Name,
+		SecretHash:   arg.SecretHash,
+		RedirectUris: slices.Clone(arg.RedirectUris),
+		Scopes:       slices.Clone(arg.Scopes),
+	}
+	m.tables.oauthClients = append(m.tables.oauthClients, client)
+	return client, nil
+}
+
+func (m *Memory) GetOAuthClient(ctx context.Context, id string) (database.OauthClient, error) {
+	defer m.lock()()
+
+	i := slices.IndexFunc(m.tables.oauthClients, func(c database.OauthClient) bool { return c.ID == id })
+	if i < 0 {
+		return database.OauthClient{}, sql.ErrNoRows
+	}
+	return m.tables.oauthClients[i], nil
+}
+
+func (m *Memory) GetLoginAttempt(ctx context.Context, key string) (database.LoginAttempt, error) {
+	defer m.lock()()
+
+	i := m.tables.loginAttemptIndex(key)
+	if i < 0 {
+		return database.LoginAttempt{}, sql.ErrNoRows
+	}
+	return m.tables.loginAttempts[i], nil
+}
+
+func (m *Memory) LockLoginAttempts(ctx context.Context, arg database.LockLoginAttemptsParams) error {
+	defer m.lock()()
+
+	if i := m.tables.loginAttemptIndex(arg.Key); i >= 0 {
+		m.tables.loginAttempts[i].LockedUntil = arg.LockedUntil
+	}
+	return nil
+}
+
+// RecordLoginFailure counts a failure, starting the count again if the last
+// one was before arg.WindowStart.
+func (m *Memory) RecordLoginFailure(ctx context.Context, arg database.RecordLoginFailureParams) (database.LoginAttempt, error) {
+	defer m.lock()()
+
+	i := m.tables.loginAttemptIndex(arg.Key)
+	if i < 0 {
+		attempt := database.LoginAttempt{Key: arg.Key, Failures: 1, LastFailureAt: arg.FailedAt}
+		m.tables.loginAttempts = append(m.tables.loginAttempts, attempt)
+		return attempt, nil
+	}
+
+	attempt := m.tables.loginAttempts[i]
+	if attempt.LastFailureAt.Before(arg.WindowStart) {
+		attempt.Failures = 1
+	} else {
+		attempt.Failures++
+	}
+	attempt.LastFailureAt = arg.FailedAt
+	m.tables.loginAttempts[i] = attempt
+	return attempt, nil
+}
+
+func (m *Memory) ReleaseLoginAttempt(ctx context.Context, arg database.ReleaseLoginAttemptParams) error {
+	defer m.lock()()
+
+	i := m.tables.loginAttemptIndex(arg.Key)
+	if i < 0 || m.tables.loginAttempts[i].Failures == 0 {
+		return nil
+	}
+	attempt := &m.tables.loginAttempts[i]
+	attempt.Failures--
+	if attempt.LastFailureAt.Equal(arg.ReservedAt) {
+		attempt.LastFailureAt = arg.PreviousFailureAt
+	}
+	return nil
+}
+
+func (m *Memory) ResetLoginAttempts(ctx context.Context, key string) error {
+	defer m.lock()()
+
+	m.tables.loginAttempts = deleteRows(m.tables.loginAttempts, func(a database.LoginAttempt) bool { return a.Key == key })
+	return nil
+}
+
+func (t *memoryTables) hasOAuthClient(id string) bool {
+	return slices.ContainsFunc(t.oauthClients, func(c database.OauthClient) bool { return c.ID == id })
+}
+
+func (t *memoryTables) loginAttemptIndex(key string) int {
+	return slices.IndexFunc(t.loginAttempts, func(a database.LoginAttempt) bool { return a.Key == key })
+}
@@ -0,0 +1,113 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+	"time"
+
+	"github.com/drewheasman/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+func (m *Memory) CreateChirp(ctx context.Context, arg database.CreateChirpParams) (database.Chirp, error) {
+	defer m.lock()()
+
+	if !m.tables.hasUser(arg.UserID) {
+		return database.Chirp{}, errForeignKey("chirps", "user_id")
+	}
+	createdAt := now()
+	chirp := database.Chirp{
+		ID:        uuid.New(),
+		CreatedAt: createdAt,
+		UpdatedAt: createdAt,
+		Body:      arg.Body,
+		UserID:    arg.UserID,
+	}
+	m.tables.chirps = append(m.tables.chirps, chirp)
+	return chirp, nil
+}
+
+func (m *Memory) DeleteChirp(ctx context.Context, id uuid.UUID) error {
+	defer m.lock()()
+
+	m.tables.deleteChirps(func(c database.Chirp) bool { return c.ID == id })
+	return nil
+}
+
+func (m *Memory) DeleteChirpsBefore(ctx context.Context, createdAt time.Time) (int64, error) {
+	defer m.lock()()
+
+	deleted := m.tables.deleteChirps(func(c database.Chirp) bool { return c.CreatedAt.Before(createdAt) })
+	return int64(deleted), nil
+}
+
+func (m *Memory) GetChirp(ctx context.Context, id uuid.UUID) (database.Chirp, error) {
+	defer m.lock()()
+
+	return m.tables.findChirp(func(c database.Chirp) bool { return c.ID == id })
+}
+
+func (m *Memory) GetChirps(ctx context.Context) ([]database.Chirp, error) {
+	defer m.lock()()
+
+	return m.tables.filterChirps(func(database.Chirp) bool { return true }), nil
+}
+
+func (m *Memory) GetChirpsByUser(ctx context.Context, userID uuid.UUID) ([]database.Chirp, error) {
+	defer m.lock()()
+
+	return m.tables.filterChirps(func(c database.Chirp) bool { return c.UserID == userID }), nil
+}
+
+func (m *Memory) GetVisibleChirp(ctx context.Context, arg database.GetVisibleChirpParams) (database.Chirp, error) {
+	defer m.lock()()
+
+	return m.tables.findChirp(func(c database.Chirp) bool {
+		return c.ID == arg.ID && m.tables.chirpVisible(c, arg.ViewerID)
+	})
+}
+
+func (m *Memory) GetVisibleChirps(ctx context.Context, viewerID uuid.NullUUID) ([]database.Chirp, error) {
+	defer m.lock()()
+
+	return m.tables.filterChirps(func(c database.Chirp) bool {
+		return m.tables.chirpVisible(c, viewerID)
+	}), nil
+}
+
+func (m *Memory) GetVisibleChirpsByUser(ctx context.Context, arg database.GetVisibleChirpsByUserParams) ([]database.Chirp, error) {
+	defer m.lock()()
+
+	return m.tables.filterChirps(func(c database.Chirp) bool {
+		return c.UserID == arg.UserID && m.tables.chirpVisible(c, arg.ViewerID)
+	}), nil
+}
+
+func (t *memoryTables) findChirp(match func(database.Chirp) bool) (database.Chirp, error) {
+	i := slices.IndexFunc(t.chirps, match)
+	if i < 0 {
+		return database.Chirp{}, sql.ErrNoRows
+	}
+	return t.chirps[i], nil
+}
+
+func (t *memoryTables) filterChirps(match func(database.Chirp) bool) []database.Chirp {
+	var items []database.Chirp
+	for _, c := range t.chirps {
+		if match(c) {
+			items = append(items, c)
+		}
+	}
+	return items
+}
+
+// chirpVisible hides chirps by shadow-banned users from everyone but their
+// author.
+func (t *memoryTables) chirpVisible(c database.Chirp, viewerID uuid.NullUUID) bool {
+	i := t.userIndex(c.UserID)
+	if i < 0 {
+		return false
+	}
+	return !t.users[i].ShadowBanned || (viewerID.Valid && viewerID.UUID == c.UserID)
+}
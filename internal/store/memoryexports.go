@@ -0,0 +1,348 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/drewheasman/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// errUnnestLengths is what the memory and SQLite stores return where Postgres would
+// fill the short arrays of an UNNEST with NULLs and then fail NOT NULL.
+var errUnnestLengths = errors.New("null value violates not-null constraint: arrays have different lengths")
+
+// ClaimDataExport picks the oldest pending export, or one left running
+// since before staleBefore, and marks it running.
+func (m *Memory) ClaimDataExport(ctx context.Context, staleBefore time.Time) (database.DataExport, error) {
+	defer m.lock()()
+
+	claim := -1
+	for i, d := range m.tables.dataExports {
+		if d.Status != "pending" && (d.Status != "running" || !d.UpdatedAt.Before(staleBefore)) {
+			continue
+		}
+		if claim < 0 || d.CreatedAt.Before(m.tables.dataExports[claim].CreatedAt) {
+			claim = i
+		}
+	}
+	if claim < 0 {
+		return database.DataExport{}, sql.ErrNoRows
+	}
+
+	return m.tables.updateDataExport(m.tables.dataExports[claim].ID, func(d *database.DataExport) {
+		d.Status = "running"
+		d.UpdatedAt = now()
+	}), nil
+}
+
+func (m *Memory) CompleteDataExport(ctx context.Context, arg database.CompleteDataExportParams) error {
+	defer m.lock()()
+
+	completedAt := now()
+	m.tables.updateDataExport(arg.ID, func(d *database.DataExport) {
+		d.Status = "complete"
+		d.BlobKey = arg.BlobKey
+		d.CompletedAt = sql.NullTime{Time: completedAt, Valid: true}
+		d.ExpiresAt = arg.ExpiresAt
+		d.UpdatedAt = completedAt
+	})
+	return nil
+}
+
+func (m *Memory) CountActiveDataExportsForUser(ctx context.Context, userID uuid.UUID) (int64, error) {
+	defer m.lock()()
+
+	var count int64
+	for _, d := range m.tables.dataExports {
+		if d.UserID == userID && (d.Status == "pending" || d.Status == "running") {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (m *Memory) CreateDataExport(ctx context.Context, userID uuid.UUID) (database.DataExport, error) {
+	defer m.lock()()
+
+	if !m.tables.hasUser(userID) {
+		return database.DataExport{}, errForeignKey("data_exports", "user_id")
+	}
+	createdAt := now()
+	export := database.DataExport{
+		ID:        uuid.New(),
+		CreatedAt: createdAt,
+		UpdatedAt: createdAt,
+		UserID:    userID,
+		Status:    "pending",
+	}
+	m.tables.dataExports = append(m.tables.dataExports, export)
+	return export, nil
+}
+
+func (m *Memory) DeleteDataExportsForDueUsers(ctx context.Context, deletionScheduledAt sql.NullTime) ([]sql.NullString, error) {
+	defer m.lock()()
+
+	due := map[uuid.UUID]bool{}
+	for _, u := range m.tables.users {
+		if deletionDue(u, deletionScheduledAt) {
+			due[u.ID] = true
+		}
+	}
+	return m.tables.deleteDataExports(func(d database.DataExport) bool { return due[d.UserID] }), nil
+}
+
+func (m *Memory) DeleteExpiredDataExports(ctx context.Context, expiresAt sql.NullTime) ([]sql.NullString, error) {
+	defer m.lock()()
+
+	return m.tables.deleteDataExports(func(d database.DataExport) bool {
+		return expiresAt.Valid && d.ExpiresAt.Valid && !d.ExpiresAt.Time.After(expiresAt.Time)
+	}), nil
+}
+
+func (m *Memory) FailDataExport(ctx context.Context, arg database.FailDataExportParams) error {
+	defer m.lock()()
+
+	completedAt := now()
+	m.tables.updateDataExport(arg.ID, func(d *database.DataExport) {
+		d.Status = "failed"
+		d.Error = arg.Error
+		d.CompletedAt = sql.NullTime{Time: completedAt, Valid: true}
+		d.ExpiresAt = arg.ExpiresAt
+		d.UpdatedAt = completedAt
+	})
+	return nil
+}
+
+func (m *Memory) GetDataExport(ctx context.Context, id uuid.UUID) (database.DataExport, error) {
+	defer m.lock()()
+
+	i := slices.IndexFunc(m.tables.dataExports, func(d database.DataExport) bool { return d.ID == id })
+	if i < 0 {
+		return database.DataExport{}, sql.ErrNoRows
+	}
+	return m.tables.dataExports[i], nil
+}
+
+func (m *Memory) GetDataExportForUser(ctx context.Context, arg database.GetDataExportForUserParams) (database.DataExport, error) {
+	defer m.lock()()
+
+	i := slices.IndexFunc(m.tables.dataExports, func(d database.DataExport) bool { return d.ID == arg.ID && d.UserID == arg.UserID })
+	if i < 0 {
+		return database.DataExport{}, sql.ErrNoRows
+	}
+	return m.tables.dataExports[i], nil
+}
+
+func (m *Memory) CreateExternalChirpIDs(ctx context.Context, arg database.CreateExternalChirpIDsParams) error {
+	defer m.lock()()
+
+	if len(arg.ExternalIds) != len(arg.ChirpIds) {
+		return errUnnestLengths
+	}
+	rows := make([]database.ExternalChirpID, len(arg.ExternalIds))
+	for i := range rows {
+		rows[i] = database.ExternalChirpID{Source: arg.Source, ExternalID: arg.ExternalIds[i], ChirpID: arg.ChirpIds[i]}
+		if !slices.ContainsFunc(m.tables.chirps, func(c database.Chirp) bool { return c.ID == rows[i].ChirpID }) {
+			return errForeignKey("external_chirp_ids", "chirp_id")
+		}
+		sameKey := func(e database.ExternalChirpID) bool {
+			return e.Source == rows[i].Source && e.ExternalID == rows[i].ExternalID
+		}
+		if slices.ContainsFunc(m.tables.externalChirpIDs, sameKey) || slices.ContainsFunc(rows[:i], sameKey) {
+			return errDuplicateKey("external_chirp_ids")
+		}
+	}
+	m.tables.externalChirpIDs = append(m.tables.externalChirpIDs, rows...)
+	return nil
+}
+
+func (m *Memory) CreateExternalUserIDs(ctx context.Context, arg database.CreateExternalUserIDsParams) error {
+	defer m.lock()()
+
+	if len(arg.ExternalIds) != len(arg.UserIds) {
+		return errUnnestLengths
+	}
+	rows := make([]database.ExternalUserID, len(arg.ExternalIds))
+	for i := range rows {
+		rows[i] = database.ExternalUserID{Source: arg.Source, ExternalID: arg.ExternalIds[i], UserID: arg.UserIds[i]}
+		if !m.tables.hasUser(rows[i].UserID) {
+			return errForeignKey("external_user_ids", "user_id")
+		}
+		sameKey := func(e database.ExternalUserID) bool {
+			return e.Source == rows[i].Source && e.ExternalID == rows[i].ExternalID
+		}
+		if slices.ContainsFunc(m.tables.externalUserIDs, sameKey) || slices.ContainsFunc(rows[:i], sameKey) {
+			return errDuplicateKey("external_user_ids")
+		}
+	}
+	m.tables.externalUserIDs = append(m.tables.externalUserIDs, rows...)
+	return nil
+}
+
+func (m *Memory) GetExternalChirpIDs(ctx context.Context, arg database.GetExternalChirpIDsParams) ([]string, error) {
+	defer m.lock()()
+
+	var items []string
+	for _, e := range m.tables.externalChirpIDs {
+		if e.Source == arg.Source && slices.Contains(arg.ExternalIds, e.ExternalID) {
+			items = append(items, e.ExternalID)
+		}
+	}
+	return items, nil
+}
+
+func (m *Memory) GetExternalUserIDs(ctx context.Context, arg database.GetExternalUserIDsParams) ([]database.GetExternalUserIDsRow, error) {
+	defer m.lock()()
+
+	var items []database.GetExternalUserIDsRow
+	for _, e := range m.tables.externalUserIDs {
+		if e.Source == arg.Source && slices.Contains(arg.ExternalIds, e.ExternalID) {
+			items = append(items, database.GetExternalUserIDsRow{ExternalID: e.ExternalID, UserID: e.UserID})
+		}
+	}
+	return items, nil
+}
+
+func (m *Memory) GetUsersByEmails(ctx context.Context, emails []string) ([]string, error) {
+	defer m.lock()()
+
+	var items []string
+	for _, u := range m.tables.users {
+		if slices.Contains(emails, strings.ToLower(u.Email)) {
+			items = append(items, u.Email)
+		}
+	}
+	return items, nil
+}
+
+func (m *Memory) ImportChirps(ctx context.Context, arg database.ImportChirpsParams) (int64, error) {
+	defer m.lock()()
+
+	n := len(arg.Ids)
+	if len(arg.CreatedAt) != n || len(arg.Bodies) != n || len(arg.UserIds) != n {
+		return 0, errUnnestLengths
+	}
+	rows := make([]database.Chirp, n)
+	for i := range rows {
+		if !m.tables.hasUser(arg.UserIds[i]) {
+			return 0, errForeignKey("chirps", "user_id")
+		}
+		rows[i] = database.Chirp{
+			ID:        arg.Ids[i],
+			CreatedAt: arg.CreatedAt[i],
+			UpdatedAt: arg.CreatedAt[i],
+			Body:      arg.Bodies[i],
+			UserID:    arg.UserIds[i],
+		}
+	}
+	m.tables.chirps = append(m.tables.chirps, rows...)
+	return int64(len(rows)), nil
+}
+
+func (m *Memory) ImportUsers(ctx context.Context, arg database.ImportUsersParams) error {
+	defer m.lock()()
+
+	n := len(arg.Ids)
+	if len(arg.CreatedAt) != n || len(arg.Emails) != n || len(arg.HashedPasswords) != n || len(arg.IsChirpyRed) != n {
+		return errUnnestLengths
+	}
+	rows := make([]database.User, n)
+	for i := range rows {
+		rows[i] = database.User{
+			ID:             arg.Ids[i],
+			CreatedAt:      arg.CreatedAt[i],
+			UpdatedAt:      arg.CreatedAt[i],
+			Email:          arg.Emails[i],
+			HashedPassword: arg.HashedPasswords[i],
+			IsChirpyRed:    arg.IsChirpyRed[i],
+			Role:           "user",
+		}
+		sameEmail := func(u database.User) bool { return u.Email == rows[i].Email }
+		if slices.ContainsFunc(m.tables.users, sameEmail) || slices.ContainsFunc(rows[:i], sameEmail) {
+			return ErrEmailTaken
+		}
+		sameID := func(u database.User) bool { return u.ID == rows[i].ID }
+		if slices.ContainsFunc(m.tables.users, sameID) || slices.ContainsFunc(rows[:i], sameID) {
+			return errDuplicateKey("users")
+		}
+	}
+	m.tables.users = append(m.tables.users, rows...)
+	return nil
+}
+
+func (m *Memory) ListChirpsForExport(ctx context.Context, arg database.ListChirpsForExportParams) ([]database.ListChirpsForExportRow, error) {
+	defer m.lock()()
+
+	var matched []database.Chirp
+	for _, c := range m.tables.chirps {
+		if compareUUIDs(c.ID, arg.AfterID) > 0 {
+			matched = append(matched, c)
+		}
+	}
+	slices.SortFunc(matched, func(a, b database.Chirp) int { return compareUUIDs(a.ID, b.ID) })
+
+	var items []database.ListChirpsForExportRow
+	for _, c := range page(matched, arg.MaxResults, 0) {
+		items = append(items, database.ListChirpsForExportRow{
+			ID:        c.ID,
+			CreatedAt: c.CreatedAt,
+			Body:      c.Body,
+			UserID:    c.UserID,
+		})
+	}
+	return items, nil
+}
+
+func (m *Memory) ListUsersForExport(ctx context.Context, arg database.ListUsersForExportParams) ([]database.ListUsersForExportRow, error) {
+	defer m.lock()()
+
+	var matched []database.User
+	for _, u := range m.tables.users {
+		if compareUUIDs(u.ID, arg.AfterID) > 0 {
+			matched = append(matched, u)
+		}
+	}
+	slices.SortFunc(matched, func(a, b database.User) int { return compareUUIDs(a.ID, b.ID) })
+
+	var items []database.ListUsersForExportRow
+	for _, u := range page(matched, arg.MaxResults, 0) {
+		items = append(items, database.ListUsersForExportRow{
+			ID:          u.ID,
+			CreatedAt:   u.CreatedAt,
+			Email:       u.Email,
+			IsChirpyRed: u.IsChirpyRed,
+		})
+	}
+	return items, nil
+}
+
+// updateDataExport applies update to the export with id and returns it.
+func (t *memoryTables) updateDataExport(id uuid.UUID, update func(*database.DataExport)) database.DataExport {
+	i := slices.IndexFunc(t.dataExports, func(d database.DataExport) bool { return d.ID == id })
+	if i < 0 {
+		return database.DataExport{}
+	}
+	export := t.dataExports[i]
+	update(&export)
+	t.dataExports[i] = export
+	return export
+}
+
+// deleteDataExports deletes the exports matching match and returns their
+// blob keys, as DELETE ... RETURNING blob_key does.
+func (t *memoryTables) deleteDataExports(match func(database.DataExport) bool) []sql.NullString {
+	var blobKeys []sql.NullString
+	t.dataExports = deleteRows(t.dataExports, func(d database.DataExport) bool {
+		if match(d) {
+			blobKeys = append(blobKeys, d.BlobKey)
+			return true
+		}
+		return false
+	})
+	return blobKeys
+}
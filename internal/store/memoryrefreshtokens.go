@@ -0,0 +1,197 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+	"time"
+
+	"github.com/drewheasman/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+func (m *Memory) CreateRefreshToken(ctx context.Context, arg database.CreateRefreshTokenParams) error {
+	defer m.lock()()
+
+	if !m.tables.hasUser(arg.UserID) {
+		return errForeignKey("refresh_tokens", "user_id")
+	}
+	if arg.ClientID.Valid && !m.tables.hasOAuthClient(arg.ClientID.String) {
+		return errForeignKey("refresh_tokens", "client_id")
+	}
+	if slices.ContainsFunc(m.tables.refreshTokens, func(r database.RefreshToken) bool { return r.TokenHash == arg.TokenHash }) {
+		return errDuplicateKey("refresh_tokens")
+	}
+
+	createdAt := now()
+	m.tables.refreshTokens = append(m.tables.refreshTokens, database.RefreshToken{
+		TokenHash:  arg.TokenHash,
+		CreatedAt:  createdAt,
+		UpdatedAt:  createdAt,
+		UserID:     arg.UserID,
+		ExpiresAt:  arg.ExpiresAt,
+		FamilyID:   arg.FamilyID,
+		DeviceName: arg.DeviceName,
+		UserAgent:  arg.UserAgent,
+		Ip:         arg.Ip,
+		LastUsedAt: createdAt,
+		ClientID:   arg.ClientID,
+		Scopes:     slices.Clone(arg.Scopes),
+	})
+	return nil
+}
+
+func (m *Memory) GetActiveSessionsForUser(ctx context.Context, userID uuid.UUID) ([]database.GetActiveSessionsForUserRow, error) {
+	defer m.lock()()
+
+	currentTime := now()
+	var items []database.GetActiveSessionsForUserRow
+	for _, r := range m.tables.refreshTokens {
+		if r.UserID != userID || !r.ExpiresAt.After(currentTime) || r.RevokedAt.Valid || r.RotatedAt.Valid {
+			continue
+		}
+		items = append(items, database.GetActiveSessionsForUserRow{
+			FamilyID:   r.FamilyID,
+			DeviceName: r.DeviceName,
+			UserAgent:  r.UserAgent,
+			Ip:         r.Ip,
+			StartedAt:  m.tables.familyStartedAt(r.FamilyID),
+			LastUsedAt: r.LastUsedAt,
+			ExpiresAt:  r.ExpiresAt,
+		})
+	}
+	slices.SortStableFunc(items, func(a, b database.GetActiveSessionsForUserRow) int {
+		return b.LastUsedAt.Compare(a.LastUsedAt)
+	})
+	return items, nil
+}
+
+func (m *Memory) GetRefreshToken(ctx context.Context, tokenHash string) (database.RefreshToken, error) {
+	defer m.lock()()
+
+	i := slices.IndexFunc(m.tables.refreshTokens, func(r database.RefreshToken) bool { return r.TokenHash == tokenHash })
+	if i < 0 {
+		return database.RefreshToken{}, sql.ErrNoRows
+	}
+	return m.tables.refreshTokens[i], nil
+}
+
+func (m *Memory) GetSessionHistoryForUser(ctx context.Context, userID uuid.UUID) ([]database.GetSessionHistoryForUserRow, error) {
+	defer m.lock()()
+
+	var items []database.GetSessionHistoryForUserRow
+	for _, r := range m.tables.refreshTokens {
+		if r.UserID != userID {
+			continue
+		}
+		items = append(items, database.GetSessionHistoryForUserRow{
+			FamilyID:   r.FamilyID,
+			CreatedAt:  r.CreatedAt,
+			LastUsedAt: r.LastUsedAt,
+			ExpiresAt:  r.ExpiresAt,
+			RevokedAt:  r.RevokedAt,
+			DeviceName: r.DeviceName,
+			UserAgent:  r.UserAgent,
+			Ip:         r.Ip,
+			ClientID:   r.ClientID,
+		})
+	}
+	slices.SortStableFunc(items, func(a, b database.GetSessionHistoryForUserRow) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+	return items, nil
+}
+
+func (m *Memory) IsSessionActive(ctx context.Context, familyID uuid.UUID) (bool, error) {
+	defer m.lock()()
+
+	currentTime := now()
+	return slices.ContainsFunc(m.tables.refreshTokens, func(r database.RefreshToken) bool {
+		return r.FamilyID == familyID && !r.RevokedAt.Valid && r.ExpiresAt.After(currentTime)
+	}), nil
+}
+
+func (m *Memory) RevokeAllSessionsForUser(ctx context.Context, userID uuid.UUID) error {
+	defer m.lock()()
+
+	m.tables.revokeRefreshTokens(func(r database.RefreshToken) bool { return r.UserID == userID })
+	return nil
+}
+
+func (m *Memory) RevokeRefreshTokenFamily(ctx context.Context, familyID uuid.UUID) error {
+	defer m.lock()()
+
+	m.tables.revokeRefreshTokens(func(r database.RefreshToken) bool { return r.FamilyID == familyID })
+	return nil
+}
+
+func (m *Memory) RevokeSessionForUser(ctx context.Context, arg database.RevokeSessionForUserParams) (int64, error) {
+	defer m.lock()()
+
+	return m.tables.revokeRefreshTokens(func(r database.RefreshToken) bool {
+		return r.FamilyID == arg.FamilyID && r.UserID == arg.UserID
+	}), nil
+}
+
+// RotateRefreshToken marks a token used, as long as it hasn't expired, been
+// revoked or been rotated already, and was issued to the same client.
+func (m *Memory) RotateRefreshToken(ctx context.Context, arg database.RotateRefreshTokenParams) (database.RotateRefreshTokenRow, error) {
+	defer m.lock()()
+
+	currentTime := now()
+	i := slices.IndexFunc(m.tables.refreshTokens, func(r database.RefreshToken) bool {
+		return r.TokenHash == arg.TokenHash &&
+			r.ExpiresAt.After(currentTime) &&
+			!r.RevokedAt.Valid &&
+			!r.RotatedAt.Valid &&
+			notDistinct(r.ClientID, arg.ClientID)
+	})
+	if i < 0 {
+		return database.RotateRefreshTokenRow{}, sql.ErrNoRows
+	}
+
+	r := m.tables.refreshTokens[i]
+	r.RotatedAt = sql.NullTime{Time: currentTime, Valid: true}
+	r.UpdatedAt = currentTime
+	m.tables.refreshTokens[i] = r
+
+	return database.RotateRefreshTokenRow{
+		UserID:     r.UserID,
+		FamilyID:   r.FamilyID,
+		DeviceName: r.DeviceName,
+		Scopes:     r.Scopes,
+	}, nil
+}
+
+// revokeRefreshTokens revokes the unrevoked tokens matching match and
+// returns how many it revoked.
+func (t *memoryTables) revokeRefreshTokens(match func(database.RefreshToken) bool) int64 {
+	currentTime := now()
+	var revoked int64
+	for i, r := range t.refreshTokens {
+		if r.RevokedAt.Valid || !match(r) {
+			continue
+		}
+		r.RevokedAt = sql.NullTime{Time: currentTime, Valid: true}
+		r.UpdatedAt = currentTime
+		t.refreshTokens[i] = r
+		revoked++
+	}
+	return revoked
+}
+
+// notDistinct is a IS NOT DISTINCT FROM b: both NULL, or both the same.
+func notDistinct(a, b sql.NullString) bool {
+	return a.Valid == b.Valid && (!a.Valid || a.String == b.String)
+}
+
+// familyStartedAt is when the first token of a session was issued.
+func (t *memoryTables) familyStartedAt(familyID uuid.UUID) time.Time {
+	var startedAt time.Time
+	for _, r := range t.refreshTokens {
+		if r.FamilyID == familyID && (startedAt.IsZero() || r.CreatedAt.Before(startedAt)) {
+			startedAt = r.CreatedAt
+		}
+	}
+	return startedAt
+}
@@ -0,0 +1,347 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+
+	"github.com/drewheasman/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// userRoles are the roles the users.role check constraint allows.
+var userRoles = []string{"user", "moderator", "admin"}
+
+func (m *Memory) AdminExists(ctx context.Context) (bool, error) {
+	defer m.lock()()
+
+	return slices.ContainsFunc(m.tables.users, func(u database.User) bool { return u.Role == "admin" }), nil
+}
+
+func (m *Memory) CancelUserDeletion(ctx context.Context, id uuid.UUID) (int64, error) {
+	defer m.lock()()
+
+	i := m.tables.userIndex(id)
+	if i < 0 || !m.tables.users[i].DeletionScheduledAt.Valid {
+		return 0, nil
+	}
+	return m.tables.updateUser(id, func(u *database.User) {
+		u.DeletionScheduledAt = sql.NullTime{}
+		u.UpdatedAt = now()
+	}), nil
+}
+
+func (m *Memory) CountUsers(ctx context.Context, arg database.CountUsersParams) (int64, error) {
+	defer m.lock()()
+
+	var count int64
+	for _, u := range m.tables.users {
+		if matchUser(u, arg.Email, arg.IsChirpyRed, arg.CreatedAfter, arg.CreatedBefore) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (m *Memory) CreateUser(ctx context.Context, arg database.CreateUserParams) (database.CreateUserRow, error) {
+	defer m.lock()()
+
+	if m.tables.emailTaken(arg.Email, uuid.Nil) {
+		return database.CreateUserRow{}, ErrEmailTaken
+	}
+	createdAt := now()
+	userRecord := database.User{
+		ID:             uuid.New(),
+		CreatedAt:      createdAt,
+		UpdatedAt:      createdAt,
+		Email:          arg.Email,
+		HashedPassword: arg.HashedPassword,
+		Role:           "user",
+	}
+	m.tables.users = append(m.tables.users, userRecord)
+
+	return database.CreateUserRow{
+		ID:          userRecord.ID,
+		CreatedAt:   userRecord.CreatedAt,
+		UpdatedAt:   userRecord.UpdatedAt,
+		Email:       userRecord.Email,
+		IsChirpyRed: userRecord.IsChirpyRed,
+	}, nil
+}
+
+func (m *Memory) DeleteAllUsers(ctx context.Context) error {
+	defer m.lock()()
+
+	m.tables.deleteUsers(func(database.User) bool { return true })
+	return nil
+}
+
+func (m *Memory) DeleteDueUsers(ctx context.Context, deletionScheduledAt sql.NullTime) ([]database.DeleteDueUsersRow, error) {
+	defer m.lock()()
+
+	deleted := m.tables.deleteUsers(func(u database.User) bool {
+		return deletionDue(u, deletionScheduledAt)
+	})
+	var items []database.DeleteDueUsersRow
+	for _, u := range deleted {
+		items = append(items, database.DeleteDueUsersRow{ID: u.ID, Email: u.Email})
+	}
+	return items, nil
+}
+
+func (m *Memory) DisableTOTP(ctx context.Context, id uuid.UUID) error {
+	defer m.lock()()
+
+	m.tables.updateUser(id, func(u *database.User) {
+		u.TotpSecret = sql.NullString{}
+		u.TotpEnabled = false
+		u.UpdatedAt = now()
+	})
+	return nil
+}
+
+func (m *Memory) EnableTOTP(ctx context.Context, id uuid.UUID) error {
+	defer m.lock()()
+
+	m.tables.updateUser(id, func(u *database.User) {
+		u.TotpEnabled = true
+		u.UpdatedAt = now()
+	})
+	return nil
+}
+
+func (m *Memory) GetUser(ctx context.Context, id uuid.UUID) (database.User, error) {
+	defer m.lock()()
+
+	i := m.tables.userIndex(id)
+	if i < 0 {
+		return database.User{}, sql.ErrNoRows
+	}
+	return m.tables.users[i], nil
+}
+
+func (m *Memory) GetUserActivityCounts(ctx context.Context, userID uuid.UUID) (database.GetUserActivityCountsRow, error) {
+	defer m.lock()()
+
+	var counts database.GetUserActivityCountsRow
+	for _, c := range m.tables.chirps {
+		if c.UserID == userID {
+			counts.ChirpCount++
+		}
+	}
+
+	currentTime := now()
+	families := map[uuid.UUID]bool{}
+	for _, r := range m.tables.refreshTokens {
+		if r.UserID == userID && !r.RevokedAt.Valid && !r.RotatedAt.Valid && r.ExpiresAt.After(currentTime) {
+			families[r.FamilyID] = true
+		}
+	}
+	counts.SessionCount = int64(len(families))
+	return counts, nil
+}
+
+func (m *Memory) GetUserByEmail(ctx context.Context, email string) (database.User, error) {
+	defer m.lock()()
+
+	i := slices.IndexFunc(m.tables.users, func(u database.User) bool { return u.Email == email })
+	if i < 0 {
+		return database.User{}, sql.ErrNoRows
+	}
+	return m.tables.users[i], nil
+}
+
+func (m *Memory) GetUserStatus(ctx context.Context, id uuid.UUID) (database.GetUserStatusRow, error) {
+	defer m.lock()()
+
+	i := m.tables.userIndex(id)
+	if i < 0 {
+		return database.GetUserStatusRow{}, sql.ErrNoRows
+	}
+	u := m.tables.users[i]
+	return database.GetUserStatusRow{
+		SuspendedAt:         u.SuspendedAt,
+		SuspensionReason:    u.SuspensionReason,
+		ShadowBanned:        u.ShadowBanned,
+		DeletionScheduledAt: u.DeletionScheduledAt,
+	}, nil
+}
+
+func (m *Memory) ListUsers(ctx context.Context, arg database.ListUsersParams) ([]database.ListUsersRow, error) {
+	defer m.lock()()
+
+	var matched []database.User
+	for _, u := range m.tables.users {
+		if matchUser(u, arg.Email, arg.IsChirpyRed, arg.CreatedAfter, arg.CreatedBefore) {
+			matched = append(matched, u)
+		}
+	}
+	slices.SortFunc(matched, func(a, b database.User) int {
+		if c := b.CreatedAt.Compare(a.CreatedAt); c != 0 {
+			return c
+		}
+		return compareUUIDs(b.ID, a.ID)
+	})
+
+	var items []database.ListUsersRow
+	for _, u := range page(matched, arg.MaxResults, arg.SkipResults) {
+		items = append(items, database.ListUsersRow{
+			ID:          u.ID,
+			CreatedAt:   u.CreatedAt,
+			UpdatedAt:   u.UpdatedAt,
+			Email:       u.Email,
+			IsChirpyRed: u.IsChirpyRed,
+			Role:        u.Role,
+			SuspendedAt: u.SuspendedAt,
+		})
+	}
+	return items, nil
+}
+
+func (m *Memory) RequirePasswordReset(ctx context.Context, id uuid.UUID) (int64, error) {
+	defer m.lock()()
+
+	return m.tables.updateUser(id, func(u *database.User) {
+		u.PasswordResetRequired = true
+		u.UpdatedAt = now()
+	}), nil
+}
+
+func (m *Memory) ScheduleUserDeletion(ctx context.Context, arg database.ScheduleUserDeletionParams) (sql.NullTime, error) {
+	defer m.lock()()
+
+	updated := m.tables.updateUser(arg.ID, func(u *database.User) {
+		u.DeletionScheduledAt = arg.DeletionScheduledAt
+		u.UpdatedAt = now()
+	})
+	if updated == 0 {
+		return sql.NullTime{}, sql.ErrNoRows
+	}
+	return arg.DeletionScheduledAt, nil
+}
+
+func (m *Memory) SetChirpyRed(ctx context.Context, id uuid.UUID) error {
+	defer m.lock()()
+
+	m.tables.updateUser(id, func(u *database.User) {
+		u.IsChirpyRed = true
+	})
+	return nil
+}
+
+func (m *Memory) SetShadowBanned(ctx context.Context, arg database.SetShadowBannedParams) (int64, error) {
+	defer m.lock()()
+
+	return m.tables.updateUser(arg.ID, func(u *database.User) {
+		u.ShadowBanned = arg.ShadowBanned
+		u.UpdatedAt = now()
+	}), nil
+}
+
+func (m *Memory) SetTOTPSecret(ctx context.Context, arg database.SetTOTPSecretParams) error {
+	defer m.lock()()
+
+	m.tables.updateUser(arg.ID, func(u *database.User) {
+		u.TotpSecret = arg.TotpSecret
+		u.TotpEnabled = false
+		u.UpdatedAt = now()
+	})
+	return nil
+}
+
+func (m *Memory) SetUserRole(ctx context.Context, arg database.SetUserRoleParams) (int64, error) {
+	defer m.lock()()
+
+	if !slices.Contains(userRoles, arg.Role) {
+		return 0, errors.New("new row for relation users violates check constraint users_role_check")
+	}
+	return m.tables.updateUser(arg.ID, func(u *database.User) {
+		u.Role = arg.Role
+		u.UpdatedAt = now()
+	}), nil
+}
+
+func (m *Memory) SuspendUser(ctx context.Context, arg database.SuspendUserParams) (int64, error) {
+	defer m.lock()()
+
+	suspendedAt := now()
+	return m.tables.updateUser(arg.ID, func(u *database.User) {
+		u.SuspendedAt = sql.NullTime{Time: suspendedAt, Valid: true}
+		u.SuspensionReason = arg.SuspensionReason
+		u.UpdatedAt = suspendedAt
+	}), nil
+}
+
+func (m *Memory) UnsuspendUser(ctx context.Context, id uuid.UUID) (int64, error) {
+	defer m.lock()()
+
+	return m.tables.updateUser(id, func(u *database.User) {
+		u.SuspendedAt = sql.NullTime{}
+		u.SuspensionReason = sql.NullString{}
+		u.UpdatedAt = now()
+	}), nil
+}
+
+func (m *Memory) UpdateChirpyRed(ctx context.Context, arg database.UpdateChirpyRedParams) (int64, error) {
+	defer m.lock()()
+
+	return m.tables.updateUser(arg.ID, func(u *database.User) {
+		u.IsChirpyRed = arg.IsChirpyRed
+		u.UpdatedAt = now()
+	}), nil
+}
+
+func (m *Memory) UpdateUser(ctx context.Context, arg database.UpdateUserParams) (database.UpdateUserRow, error) {
+	defer m.lock()()
+
+	i := m.tables.userIndex(arg.ID)
+	if i < 0 {
+		return database.UpdateUserRow{}, sql.ErrNoRows
+	}
+	if m.tables.emailTaken(arg.Email, arg.ID) {
+		return database.UpdateUserRow{}, ErrEmailTaken
+	}
+	m.tables.updateUser(arg.ID, func(u *database.User) {
+		u.Email = arg.Email
+		u.HashedPassword = arg.HashedPassword
+		u.UpdatedAt = now()
+	})
+
+	u := m.tables.users[i]
+	return database.UpdateUserRow{
+		ID:          u.ID,
+		CreatedAt:   u.CreatedAt,
+		UpdatedAt:   u.UpdatedAt,
+		Email:       u.Email,
+		IsChirpyRed: u.IsChirpyRed,
+	}, nil
+}
+
+func (m *Memory) UseTOTPCounter(ctx context.Context, arg database.UseTOTPCounterParams) (int64, error) {
+	defer m.lock()()
+
+	i := m.tables.userIndex(arg.ID)
+	if i < 0 || m.tables.users[i].TotpLastCounter >= arg.TotpLastCounter {
+		return 0, nil
+	}
+	m.tables.users[i].TotpLastCounter = arg.TotpLastCounter
+	return 1, nil
+}
+
+// matchUser applies the optional filters of ListUsers and CountUsers.
+func matchUser(u database.User, email sql.NullString, isChirpyRed sql.NullBool, createdAfter, createdBefore sql.NullTime) bool {
+	if email.Valid && !ilikeContains(u.Email, email.String) {
+		return false
+	}
+	if isChirpyRed.Valid && u.IsChirpyRed != isChirpyRed.Bool {
+		return false
+	}
+	return inRange(u.CreatedAt, createdAfter, createdBefore)
+}
+
+// deletionDue is deletion_scheduled_at <= before, which is never true when
+// either is NULL.
+func deletionDue(u database.User, before sql.NullTime) bool {
+	return before.Valid && u.DeletionScheduledAt.Valid && !u.DeletionScheduledAt.Time.After(before.Time)
+}
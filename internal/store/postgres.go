@@ -0,0 +1,67 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/drewheasman/chirpy/internal/database"
+	"github.com/drewheasman/chirpy/internal/tracing"
+	"github.com/lib/pq"
+)
+
+// Postgres is the sqlc code for a Postgres database, with queries traced.
+type Postgres struct {
+	*database.Queries
+	db *sql.DB
+	tx *sql.Tx
+}
+
+func NewPostgres(db *sql.DB) *Postgres {
+	return &Postgres{Queries: database.New(tracing.WrapDB(db, tracing.Postgres)), db: db}
+}
+
+func (s *Postgres) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+func (s *Postgres) InTx(ctx context.Context, fn func(Store) error) error {
+	if s.tx != nil {
+		return fn(s)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(&Postgres{Queries: database.New(tracing.WrapDB(tx, tracing.Postgres)), db: s.db, tx: tx}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *Postgres) CreateUser(ctx context.Context, arg database.CreateUserParams) (database.CreateUserRow, error) {
+	userRecord, err := s.Queries.CreateUser(ctx, arg)
+	return userRecord, translateError(err)
+}
+
+func (s *Postgres) UpdateUser(ctx context.Context, arg database.UpdateUserParams) (database.UpdateUserRow, error) {
+	userRecord, err := s.Queries.UpdateUser(ctx, arg)
+	return userRecord, translateError(err)
+}
+
+func (s *Postgres) ImportUsers(ctx context.Context, arg database.ImportUsersParams) error {
+	return translateError(s.Queries.ImportUsers(ctx, arg))
+}
+
+// translateError turns the unique violation on users.email into
+// ErrEmailTaken, and leaves any other error alone.
+func translateError(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == "users_email_key" {
+		return ErrEmailTaken
+	}
+	return err
+}
@@ -0,0 +1,143 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/drewheasman/chirpy/internal/database/sqlite"
+	"github.com/drewheasman/chirpy/internal/tracing"
+	"github.com/google/uuid"
+	sqlitedriver "modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// sqliteTimeFormat is how times are stored. Every time is UTC and in the
+// same format, so comparing them as text compares the instants, and the
+// driver reads TIMESTAMP columns in this format back as time.Time.
+const sqliteTimeFormat = "2006-01-02 15:04:05.999999999"
+
+// The queries in sql/sqlite/queries call NOW() and gen_random_uuid() as the
+// Postgres ones do, so SQLite gets them as functions.
+func init() {
+	sqlitedriver.MustRegisterScalarFunction("now", 0, func(*sqlitedriver.FunctionContext, []driver.Value) (driver.Value, error) {
+		return time.Now().UTC().Format(sqliteTimeFormat), nil
+	})
+	sqlitedriver.MustRegisterScalarFunction("gen_random_uuid", 0, func(*sqlitedriver.FunctionContext, []driver.Value) (driver.Value, error) {
+		return uuid.NewString(), nil
+	})
+}
+
+// OpenSQLite opens the SQLite database at path, which may be a file: URI,
+// with foreign keys enforced. Transactions take the write lock as they
+// begin and writers wait their turn, rather than failing with SQLITE_BUSY.
+func OpenSQLite(path string) (*sql.DB, error) {
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	return sql.Open("sqlite", path+sep+"_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_txlock=immediate")
+}
+
+// SQLite is the sqlc code for a SQLite database, with queries traced. Its
+// rows are converted to the types the Postgres code uses, and the batches
+// Postgres inserts with UNNEST are inserted a row at a time.
+type SQLite struct {
+	q  *sqlite.Queries
+	db *sql.DB
+	tx *sql.Tx
+}
+
+func NewSQLite(db *sql.DB) *SQLite {
+	return &SQLite{q: sqlite.New(sqliteDB{tracing.WrapDB(db, tracing.SQLite)}), db: db}
+}
+
+func (s *SQLite) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+func (s *SQLite) InTx(ctx context.Context, fn func(Store) error) error {
+	if s.tx != nil {
+		return fn(s)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(&SQLite{q: sqlite.New(sqliteDB{tracing.WrapDB(tx, tracing.SQLite)}), db: s.db, tx: tx}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// sqliteDB stores the time arguments of every query in sqliteTimeFormat, the
+// way the schema expects them.
+type sqliteDB struct {
+	sqlite.DBTX
+}
+
+func (db sqliteDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return db.DBTX.ExecContext(ctx, query, sqliteArgs(args)...)
+}
+
+func (db sqliteDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return db.DBTX.QueryContext(ctx, query, sqliteArgs(args)...)
+}
+
+func (db sqliteDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return db.DBTX.QueryRowContext(ctx, query, sqliteArgs(args)...)
+}
+
+func sqliteArgs(args []interface{}) []interface{} {
+	converted := make([]interface{}, len(args))
+	for i, arg := range args {
+		switch arg := arg.(type) {
+		case time.Time:
+			converted[i] = arg.UTC().Format(sqliteTimeFormat)
+		case sql.NullTime:
+			if arg.Valid {
+				converted[i] = arg.Time.UTC().Format(sqliteTimeFormat)
+			}
+		default:
+			converted[i] = arg
+		}
+	}
+	return converted
+}
+
+// convertRows converts each of rows, keeping a nil slice nil as sqlc
+// returns it when nothing matched.
+func convertRows[From, To any](rows []From, convert func(From) To) []To {
+	if rows == nil {
+		return nil
+	}
+	converted := make([]To, len(rows))
+	for i, row := range rows {
+		converted[i] = convert(row)
+	}
+	return converted
+}
+
+// translateSQLiteError turns the unique violation on users.email into
+// ErrEmailTaken, and leaves any other error alone.
+func translateSQLiteError(err error) error {
+	var sqliteErr *sqlitedriver.Error
+	if errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE && strings.Contains(sqliteErr.Error(), "users.email") {
+		return ErrEmailTaken
+	}
+	return err
+}
+
+// batch runs fn in a transaction, for the inserts Postgres makes in one
+// statement from arrays.
+func (s *SQLite) batch(ctx context.Context, fn func(q *sqlite.Queries) error) error {
+	return s.InTx(ctx, func(tx Store) error {
+		return fn(tx.(*SQLite).q)
+	})
+}
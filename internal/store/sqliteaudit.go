@@ -0,0 +1,63 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/drewheasman/chirpy/internal/database"
+	"github.com/drewheasman/chirpy/internal/database/sqlite"
+	"github.com/drewheasman/chirpy/internal/sqltypes"
+)
+
+func (s *SQLite) CountAuditLog(ctx context.Context, arg database.CountAuditLogParams) (int64, error) {
+	return s.q.CountAuditLog(ctx, sqlite.CountAuditLogParams(arg))
+}
+
+func (s *SQLite) CreateAuditLogEntry(ctx context.Context, arg database.CreateAuditLogEntryParams) error {
+	return s.q.CreateAuditLogEntry(ctx, sqlite.CreateAuditLogEntryParams{
+		ActorID:      arg.ActorID,
+		Action:       arg.Action,
+		TargetUserID: arg.TargetUserID,
+		TargetType:   arg.TargetType,
+		TargetID:     arg.TargetID,
+		Ip:           arg.Ip,
+		UserAgent:    arg.UserAgent,
+		Details:      sqltypes.JSON(arg.Details),
+		Diff:         sqltypes.JSON(arg.Diff),
+	})
+}
+
+func (s *SQLite) GetAuditLogForTarget(ctx context.Context, arg database.GetAuditLogForTargetParams) ([]database.GetAuditLogForTargetRow, error) {
+	rows, err := s.q.GetAuditLogForTarget(ctx, sqlite.GetAuditLogForTargetParams(arg))
+	return convertRows(rows, func(r sqlite.GetAuditLogForTargetRow) database.GetAuditLogForTargetRow {
+		return database.GetAuditLogForTargetRow{CreatedAt: r.CreatedAt, Action: r.Action, Details: json.RawMessage(r.Details)}
+	}), err
+}
+
+func (s *SQLite) ListAuditLog(ctx context.Context, arg database.ListAuditLogParams) ([]database.AuditLog, error) {
+	rows, err := s.q.ListAuditLog(ctx, sqlite.ListAuditLogParams{
+		ActorID:       arg.ActorID,
+		TargetUserID:  arg.TargetUserID,
+		Action:        arg.Action,
+		TargetType:    arg.TargetType,
+		CreatedAfter:  arg.CreatedAfter,
+		CreatedBefore: arg.CreatedBefore,
+		MaxResults:    int64(arg.MaxResults),
+		SkipResults:   int64(arg.SkipResults),
+	})
+	return convertRows(rows, func(r sqlite.AuditLog) database.AuditLog {
+		return database.AuditLog{
+			ID:           r.ID,
+			CreatedAt:    r.CreatedAt,
+			ActorID:      r.ActorID,
+			Action:       r.Action,
+			TargetUserID: r.TargetUserID,
+			Details:      json.RawMessage(r.Details),
+			Ip:           r.Ip,
+			UserAgent:    r.UserAgent,
+			TargetType:   r.TargetType,
+			TargetID:     r.TargetID,
+			Diff:         json.RawMessage(r.Diff),
+		}
+	}), err
+}
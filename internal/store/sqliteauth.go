@@ -0,0 +1,174 @@
+package store
+
+import (
+	"context"
+
+	"github.com/drewheasman/chirpy/internal/database"
+	"github.com/drewheasman/chirpy/internal/database/sqlite"
+	"github.com/google/uuid"
+)
+
+func (s *SQLite) CreateRecoveryCodes(ctx context.Context, arg database.CreateRecoveryCodesParams) error {
+	return s.batch(ctx, func(q *sqlite.Queries) error {
+		for _, codeHash := range arg.CodeHashes {
+			if err := q.CreateRecoveryCode(ctx, sqlite.CreateRecoveryCodeParams{UserID: arg.UserID, CodeHash: codeHash}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *SQLite) CreateTwoFactorChallenge(ctx context.Context, arg database.CreateTwoFactorChallengeParams) error {
+	return s.q.CreateTwoFactorChallenge(ctx, sqlite.CreateTwoFactorChallengeParams(arg))
+}
+
+func (s *SQLite) DeleteRecoveryCodes(ctx context.Context, userID uuid.UUID) error {
+	return s.q.DeleteRecoveryCodes(ctx, userID)
+}
+
+func (s *SQLite) DeleteTwoFactorChallenge(ctx context.Context, tokenHash string) error {
+	return s.q.DeleteTwoFactorChallenge(ctx, tokenHash)
+}
+
+func (s *SQLite) GetUserFromTwoFactorChallenge(ctx context.Context, arg database.GetUserFromTwoFactorChallengeParams) (uuid.UUID, error) {
+	return s.q.GetUserFromTwoFactorChallenge(ctx, sqlite.GetUserFromTwoFactorChallengeParams(arg))
+}
+
+func (s *SQLite) UseRecoveryCode(ctx context.Context, arg database.UseRecoveryCodeParams) (int64, error) {
+	return s.q.UseRecoveryCode(ctx, sqlite.UseRecoveryCodeParams(arg))
+}
+
+func (s *SQLite) ConsumePasswordResetToken(ctx context.Context, arg database.ConsumePasswordResetTokenParams) (uuid.UUID, error) {
+	return s.q.ConsumePasswordResetToken(ctx, sqlite.ConsumePasswordResetTokenParams(arg))
+}
+
+func (s *SQLite) CreatePasswordResetToken(ctx context.Context, arg database.CreatePasswordResetTokenParams) error {
+	return s.q.CreatePasswordResetToken(ctx, sqlite.CreatePasswordResetTokenParams(arg))
+}
+
+func (s *SQLite) ResetPassword(ctx context.Context, arg database.ResetPasswordParams) error {
+	return s.q.ResetPassword(ctx, sqlite.ResetPasswordParams(arg))
+}
+
+func (s *SQLite) CreatePersonalAccessToken(ctx context.Context, arg database.CreatePersonalAccessTokenParams) (database.CreatePersonalAccessTokenRow, error) {
+	row, err := s.q.CreatePersonalAccessToken(ctx, sqlite.CreatePersonalAccessTokenParams{
+		UserID:    arg.UserID,
+		Name:      arg.Name,
+		TokenHash: arg.TokenHash,
+		Scopes:    arg.Scopes,
+		ExpiresAt: arg.ExpiresAt,
+	})
+	return database.CreatePersonalAccessTokenRow{
+		ID:         row.ID,
+		CreatedAt:  row.CreatedAt,
+		Name:       row.Name,
+		Scopes:     row.Scopes,
+		ExpiresAt:  row.ExpiresAt,
+		LastUsedAt: row.LastUsedAt,
+	}, err
+}
+
+func (s *SQLite) DeletePersonalAccessToken(ctx context.Context, arg database.DeletePersonalAccessTokenParams) (int64, error) {
+	return s.q.DeletePersonalAccessToken(ctx, sqlite.DeletePersonalAccessTokenParams(arg))
+}
+
+func (s *SQLite) DeletePersonalAccessTokensForUser(ctx context.Context, userID uuid.UUID) (int64, error) {
+	return s.q.DeletePersonalAccessTokensForUser(ctx, userID)
+}
+
+func (s *SQLite) GetPersonalAccessTokensForUser(ctx context.Context, userID uuid.UUID) ([]database.GetPersonalAccessTokensForUserRow, error) {
+	rows, err := s.q.GetPersonalAccessTokensForUser(ctx, userID)
+	return convertRows(rows, func(r sqlite.GetPersonalAccessTokensForUserRow) database.GetPersonalAccessTokensForUserRow {
+		return database.GetPersonalAccessTokensForUserRow{
+			ID:         r.ID,
+			CreatedAt:  r.CreatedAt,
+			Name:       r.Name,
+			Scopes:     r.Scopes,
+			ExpiresAt:  r.ExpiresAt,
+			LastUsedAt: r.LastUsedAt,
+		}
+	}), err
+}
+
+func (s *SQLite) UsePersonalAccessToken(ctx context.Context, tokenHash string) (database.UsePersonalAccessTokenRow, error) {
+	row, err := s.q.UsePersonalAccessToken(ctx, tokenHash)
+	return database.UsePersonalAccessTokenRow{ID: row.ID, UserID: row.UserID, Scopes: row.Scopes}, err
+}
+
+func (s *SQLite) ConsumeOAuthAuthorizationCode(ctx context.Context, codeHash string) (database.OauthAuthorizationCode, error) {
+	row, err := s.q.ConsumeOAuthAuthorizationCode(ctx, codeHash)
+	return database.OauthAuthorizationCode{
+		CodeHash:      row.CodeHash,
+		CreatedAt:     row.CreatedAt,
+		ClientID:      row.ClientID,
+		UserID:        row.UserID,
+		RedirectUri:   row.RedirectUri,
+		Scopes:        row.Scopes,
+		CodeChallenge: row.CodeChallenge,
+		ExpiresAt:     row.ExpiresAt,
+	}, err
+}
+
+func (s *SQLite) CreateOAuthAuthorizationCode(ctx context.Context, arg database.CreateOAuthAuthorizationCodeParams) error {
+	return s.q.CreateOAuthAuthorizationCode(ctx, sqlite.CreateOAuthAuthorizationCodeParams{
+		CodeHash:      arg.CodeHash,
+		ClientID:      arg.ClientID,
+		UserID:        arg.UserID,
+		RedirectUri:   arg.RedirectUri,
+		Scopes:        arg.Scopes,
+		CodeChallenge: arg.CodeChallenge,
+		ExpiresAt:     arg.ExpiresAt,
+	})
+}
+
+func (s *SQLite) CreateOAuthClient(ctx context.Context, arg database.CreateOAuthClientParams) (database.OauthClient, error) {
+	row, err := s.q.CreateOAuthClient(ctx, sqlite.CreateOAuthClientParams{
+		ID:           arg.ID,
+		OwnerID:      arg.OwnerID,
+		Name:         arg.Name,
+		SecretHash:   arg.SecretHash,
+		RedirectUris: arg.RedirectUris,
+		Scopes:       arg.Scopes,
+	})
+	return oauthClientFromSQLite(row), err
+}
+
+func (s *SQLite) GetOAuthClient(ctx context.Context, id string) (database.OauthClient, error) {
+	row, err := s.q.GetOAuthClient(ctx, id)
+	return oauthClientFromSQLite(row), err
+}
+
+func (s *SQLite) GetLoginAttempt(ctx context.Context, key string) (database.LoginAttempt, error) {
+	row, err := s.q.GetLoginAttempt(ctx, key)
+	return database.LoginAttempt(row), err
+}
+
+func (s *SQLite) LockLoginAttempts(ctx context.Context, arg database.LockLoginAttemptsParams) error {
+	return s.q.LockLoginAttempts(ctx, sqlite.LockLoginAttemptsParams(arg))
+}
+
+func (s *SQLite) RecordLoginFailure(ctx context.Context, arg database.RecordLoginFailureParams) (database.LoginAttempt, error) {
+	row, err := s.q.RecordLoginFailure(ctx, sqlite.RecordLoginFailureParams(arg))
+	return database.LoginAttempt(row), err
+}
+
+func (s *SQLite) ReleaseLoginAttempt(ctx context.Context, arg database.ReleaseLoginAttemptParams) error {
+	return s.q.ReleaseLoginAttempt(ctx, sqlite.ReleaseLoginAttemptParams(arg))
+}
+
+func (s *SQLite) ResetLoginAttempts(ctx context.Context, key string) error {
+	return s.q.ResetLoginAttempts(ctx, key)
+}
+
+func oauthClientFromSQLite(c sqlite.OauthClient) database.OauthClient {
+	return database.OauthClient{
+		ID:           c.ID,
+		CreatedAt:    c.CreatedAt,
+		OwnerID:      c.OwnerID,
+		Name:         c.Name,
+		SecretHash:   c.SecretHash,
+		RedirectUris: c.RedirectUris,
+		Scopes:       c.Scopes,
+	}
+}
@@ -0,0 +1,53 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/drewheasman/chirpy/internal/database"
+	"github.com/drewheasman/chirpy/internal/database/sqlite"
+	"github.com/google/uuid"
+)
+
+func (s *SQLite) CreateChirp(ctx context.Context, arg database.CreateChirpParams) (database.Chirp, error) {
+	row, err := s.q.CreateChirp(ctx, sqlite.CreateChirpParams(arg))
+	return database.Chirp(row), err
+}
+
+func (s *SQLite) DeleteChirp(ctx context.Context, id uuid.UUID) error {
+	return s.q.DeleteChirp(ctx, id)
+}
+
+func (s *SQLite) DeleteChirpsBefore(ctx context.Context, createdAt time.Time) (int64, error) {
+	return s.q.DeleteChirpsBefore(ctx, createdAt)
+}
+
+func (s *SQLite) GetChirp(ctx context.Context, id uuid.UUID) (database.Chirp, error) {
+	row, err := s.q.GetChirp(ctx, id)
+	return database.Chirp(row), err
+}
+
+func (s *SQLite) GetChirps(ctx context.Context) ([]database.Chirp, error) {
+	rows, err := s.q.GetChirps(ctx)
+	return convertRows(rows, func(r sqlite.Chirp) database.Chirp { return database.Chirp(r) }), err
+}
+
+func (s *SQLite) GetChirpsByUser(ctx context.Context, userID uuid.UUID) ([]database.Chirp, error) {
+	rows, err := s.q.GetChirpsByUser(ctx, userID)
+	return convertRows(rows, func(r sqlite.Chirp) database.Chirp { return database.Chirp(r) }), err
+}
+
+func (s *SQLite) GetVisibleChirp(ctx context.Context, arg database.GetVisibleChirpParams) (database.Chirp, error) {
+	row, err := s.q.GetVisibleChirp(ctx, sqlite.GetVisibleChirpParams(arg))
+	return database.Chirp(row), err
+}
+
+func (s *SQLite) GetVisibleChirps(ctx context.Context, viewerID uuid.NullUUID) ([]database.Chirp, error) {
+	rows, err := s.q.GetVisibleChirps(ctx, viewerID)
+	return convertRows(rows, func(r sqlite.Chirp) database.Chirp { return database.Chirp(r) }), err
+}
+
+func (s *SQLite) GetVisibleChirpsByUser(ctx context.Context, arg database.GetVisibleChirpsByUserParams) ([]database.Chirp, error) {
+	rows, err := s.q.GetVisibleChirpsByUser(ctx, sqlite.GetVisibleChirpsByUserParams(arg))
+	return convertRows(rows, func(r sqlite.Chirp) database.Chirp { return database.Chirp(r) }), err
+}
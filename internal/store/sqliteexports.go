@@ -0,0 +1,166 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/drewheasman/chirpy/internal/database"
+	"github.com/drewheasman/chirpy/internal/database/sqlite"
+	"github.com/google/uuid"
+)
+
+func (s *SQLite) ClaimDataExport(ctx context.Context, staleBefore time.Time) (database.DataExport, error) {
+	row, err := s.q.ClaimDataExport(ctx, staleBefore)
+	return database.DataExport(row), err
+}
+
+func (s *SQLite) CompleteDataExport(ctx context.Context, arg database.CompleteDataExportParams) error {
+	return s.q.CompleteDataExport(ctx, sqlite.CompleteDataExportParams(arg))
+}
+
+func (s *SQLite) CountActiveDataExportsForUser(ctx context.Context, userID uuid.UUID) (int64, error) {
+	return s.q.CountActiveDataExportsForUser(ctx, userID)
+}
+
+func (s *SQLite) CreateDataExport(ctx context.Context, userID uuid.UUID) (database.DataExport, error) {
+	row, err := s.q.CreateDataExport(ctx, userID)
+	return database.DataExport(row), err
+}
+
+func (s *SQLite) DeleteDataExportsForDueUsers(ctx context.Context, deletionScheduledAt sql.NullTime) ([]sql.NullString, error) {
+	return s.q.DeleteDataExportsForDueUsers(ctx, deletionScheduledAt)
+}
+
+func (s *SQLite) DeleteExpiredDataExports(ctx context.Context, expiresAt sql.NullTime) ([]sql.NullString, error) {
+	return s.q.DeleteExpiredDataExports(ctx, expiresAt)
+}
+
+func (s *SQLite) FailDataExport(ctx context.Context, arg database.FailDataExportParams) error {
+	return s.q.FailDataExport(ctx, sqlite.FailDataExportParams(arg))
+}
+
+func (s *SQLite) GetDataExport(ctx context.Context, id uuid.UUID) (database.DataExport, error) {
+	row, err := s.q.GetDataExport(ctx, id)
+	return database.DataExport(row), err
+}
+
+func (s *SQLite) GetDataExportForUser(ctx context.Context, arg database.GetDataExportForUserParams) (database.DataExport, error) {
+	row, err := s.q.GetDataExportForUser(ctx, sqlite.GetDataExportForUserParams(arg))
+	return database.DataExport(row), err
+}
+
+func (s *SQLite) CreateExternalChirpIDs(ctx context.Context, arg database.CreateExternalChirpIDsParams) error {
+	if len(arg.ExternalIds) != len(arg.ChirpIds) {
+		return errUnnestLengths
+	}
+	return s.batch(ctx, func(q *sqlite.Queries) error {
+		for i, externalID := range arg.ExternalIds {
+			err := q.CreateExternalChirpID(ctx, sqlite.CreateExternalChirpIDParams{
+				Source:     arg.Source,
+				ExternalID: externalID,
+				ChirpID:    arg.ChirpIds[i],
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *SQLite) CreateExternalUserIDs(ctx context.Context, arg database.CreateExternalUserIDsParams) error {
+	if len(arg.ExternalIds) != len(arg.UserIds) {
+		return errUnnestLengths
+	}
+	return s.batch(ctx, func(q *sqlite.Queries) error {
+		for i, externalID := range arg.ExternalIds {
+			err := q.CreateExternalUserID(ctx, sqlite.CreateExternalUserIDParams{
+				Source:     arg.Source,
+				ExternalID: externalID,
+				UserID:     arg.UserIds[i],
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *SQLite) GetExternalChirpIDs(ctx context.Context, arg database.GetExternalChirpIDsParams) ([]string, error) {
+	return s.q.GetExternalChirpIDs(ctx, sqlite.GetExternalChirpIDsParams(arg))
+}
+
+func (s *SQLite) GetExternalUserIDs(ctx context.Context, arg database.GetExternalUserIDsParams) ([]database.GetExternalUserIDsRow, error) {
+	rows, err := s.q.GetExternalUserIDs(ctx, sqlite.GetExternalUserIDsParams(arg))
+	return convertRows(rows, func(r sqlite.GetExternalUserIDsRow) database.GetExternalUserIDsRow {
+		return database.GetExternalUserIDsRow(r)
+	}), err
+}
+
+func (s *SQLite) GetUsersByEmails(ctx context.Context, emails []string) ([]string, error) {
+	return s.q.GetUsersByEmails(ctx, emails)
+}
+
+func (s *SQLite) ImportChirps(ctx context.Context, arg database.ImportChirpsParams) (int64, error) {
+	n := len(arg.Ids)
+	if len(arg.CreatedAt) != n || len(arg.Bodies) != n || len(arg.UserIds) != n {
+		return 0, errUnnestLengths
+	}
+	err := s.batch(ctx, func(q *sqlite.Queries) error {
+		for i, body := range arg.Bodies {
+			err := q.ImportChirp(ctx, sqlite.ImportChirpParams{
+				ID:        arg.Ids[i],
+				CreatedAt: arg.CreatedAt[i],
+				Body:      body,
+				UserID:    arg.UserIds[i],
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(arg.Bodies)), nil
+}
+
+func (s *SQLite) ImportUsers(ctx context.Context, arg database.ImportUsersParams) error {
+	n := len(arg.Ids)
+	if len(arg.CreatedAt) != n || len(arg.Emails) != n || len(arg.HashedPasswords) != n || len(arg.IsChirpyRed) != n {
+		return errUnnestLengths
+	}
+	err := s.batch(ctx, func(q *sqlite.Queries) error {
+		for i, id := range arg.Ids {
+			err := q.ImportUser(ctx, sqlite.ImportUserParams{
+				ID:             id,
+				CreatedAt:      arg.CreatedAt[i],
+				Email:          arg.Emails[i],
+				HashedPassword: arg.HashedPasswords[i],
+				IsChirpyRed:    arg.IsChirpyRed[i],
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return translateSQLiteError(err)
+}
+
+func (s *SQLite) ListChirpsForExport(ctx context.Context, arg database.ListChirpsForExportParams) ([]database.ListChirpsForExportRow, error) {
+	rows, err := s.q.ListChirpsForExport(ctx, sqlite.ListChirpsForExportParams{AfterID: arg.AfterID, MaxResults: int64(arg.MaxResults)})
+	return convertRows(rows, func(r sqlite.ListChirpsForExportRow) database.ListChirpsForExportRow {
+		return database.ListChirpsForExportRow(r)
+	}), err
+}
+
+func (s *SQLite) ListUsersForExport(ctx context.Context, arg database.ListUsersForExportParams) ([]database.ListUsersForExportRow, error) {
+	rows, err := s.q.ListUsersForExport(ctx, sqlite.ListUsersForExportParams{AfterID: arg.AfterID, MaxResults: int64(arg.MaxResults)})
+	return convertRows(rows, func(r sqlite.ListUsersForExportRow) database.ListUsersForExportRow {
+		return database.ListUsersForExportRow(r)
+	}), err
+}
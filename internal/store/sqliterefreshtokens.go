@@ -0,0 +1,83 @@
+package store
+
+import (
+	"context"
+
+	"github.com/drewheasman/chirpy/internal/database"
+	"github.com/drewheasman/chirpy/internal/database/sqlite"
+	"github.com/google/uuid"
+)
+
+func (s *SQLite) CreateRefreshToken(ctx context.Context, arg database.CreateRefreshTokenParams) error {
+	return s.q.CreateRefreshToken(ctx, sqlite.CreateRefreshTokenParams{
+		TokenHash:  arg.TokenHash,
+		UserID:     arg.UserID,
+		ExpiresAt:  arg.ExpiresAt,
+		FamilyID:   arg.FamilyID,
+		DeviceName: arg.DeviceName,
+		UserAgent:  arg.UserAgent,
+		Ip:         arg.Ip,
+		ClientID:   arg.ClientID,
+		Scopes:     arg.Scopes,
+	})
+}
+
+func (s *SQLite) GetActiveSessionsForUser(ctx context.Context, userID uuid.UUID) ([]database.GetActiveSessionsForUserRow, error) {
+	rows, err := s.q.GetActiveSessionsForUser(ctx, userID)
+	return convertRows(rows, func(r sqlite.GetActiveSessionsForUserRow) database.GetActiveSessionsForUserRow {
+		return database.GetActiveSessionsForUserRow(r)
+	}), err
+}
+
+func (s *SQLite) GetRefreshToken(ctx context.Context, tokenHash string) (database.RefreshToken, error) {
+	row, err := s.q.GetRefreshToken(ctx, tokenHash)
+	return database.RefreshToken{
+		TokenHash:  row.TokenHash,
+		CreatedAt:  row.CreatedAt,
+		UpdatedAt:  row.UpdatedAt,
+		UserID:     row.UserID,
+		ExpiresAt:  row.ExpiresAt,
+		RevokedAt:  row.RevokedAt,
+		FamilyID:   row.FamilyID,
+		RotatedAt:  row.RotatedAt,
+		DeviceName: row.DeviceName,
+		UserAgent:  row.UserAgent,
+		Ip:         row.Ip,
+		LastUsedAt: row.LastUsedAt,
+		ClientID:   row.ClientID,
+		Scopes:     row.Scopes,
+	}, err
+}
+
+func (s *SQLite) GetSessionHistoryForUser(ctx context.Context, userID uuid.UUID) ([]database.GetSessionHistoryForUserRow, error) {
+	rows, err := s.q.GetSessionHistoryForUser(ctx, userID)
+	return convertRows(rows, func(r sqlite.GetSessionHistoryForUserRow) database.GetSessionHistoryForUserRow {
+		return database.GetSessionHistoryForUserRow(r)
+	}), err
+}
+
+func (s *SQLite) IsSessionActive(ctx context.Context, familyID uuid.UUID) (bool, error) {
+	return s.q.IsSessionActive(ctx, familyID)
+}
+
+func (s *SQLite) RevokeAllSessionsForUser(ctx context.Context, userID uuid.UUID) error {
+	return s.q.RevokeAllSessionsForUser(ctx, userID)
+}
+
+func (s *SQLite) RevokeRefreshTokenFamily(ctx context.Context, familyID uuid.UUID) error {
+	return s.q.RevokeRefreshTokenFamily(ctx, familyID)
+}
+
+func (s *SQLite) RevokeSessionForUser(ctx context.Context, arg database.RevokeSessionForUserParams) (int64, error) {
+	return s.q.RevokeSessionForUser(ctx, sqlite.RevokeSessionForUserParams(arg))
+}
+
+func (s *SQLite) RotateRefreshToken(ctx context.Context, arg database.RotateRefreshTokenParams) (database.RotateRefreshTokenRow, error) {
+	row, err := s.q.RotateRefreshToken(ctx, sqlite.RotateRefreshTokenParams(arg))
+	return database.RotateRefreshTokenRow{
+		UserID:     row.UserID,
+		FamilyID:   row.FamilyID,
+		DeviceName: row.DeviceName,
+		Scopes:     row.Scopes,
+	}, err
+}
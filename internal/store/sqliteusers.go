@@ -0,0 +1,121 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/drewheasman/chirpy/internal/database"
+	"github.com/drewheasman/chirpy/internal/database/sqlite"
+	"github.com/google/uuid"
+)
+
+func (s *SQLite) AdminExists(ctx context.Context) (bool, error) {
+	return s.q.AdminExists(ctx)
+}
+
+func (s *SQLite) CancelUserDeletion(ctx context.Context, id uuid.UUID) (int64, error) {
+	return s.q.CancelUserDeletion(ctx, id)
+}
+
+func (s *SQLite) CountUsers(ctx context.Context, arg database.CountUsersParams) (int64, error) {
+	return s.q.CountUsers(ctx, sqlite.CountUsersParams(arg))
+}
+
+func (s *SQLite) CreateUser(ctx context.Context, arg database.CreateUserParams) (database.CreateUserRow, error) {
+	row, err := s.q.CreateUser(ctx, sqlite.CreateUserParams(arg))
+	return database.CreateUserRow(row), translateSQLiteError(err)
+}
+
+func (s *SQLite) DeleteAllUsers(ctx context.Context) error {
+	return s.q.DeleteAllUsers(ctx)
+}
+
+func (s *SQLite) DeleteDueUsers(ctx context.Context, deletionScheduledAt sql.NullTime) ([]database.DeleteDueUsersRow, error) {
+	rows, err := s.q.DeleteDueUsers(ctx, deletionScheduledAt)
+	return convertRows(rows, func(r sqlite.DeleteDueUsersRow) database.DeleteDueUsersRow { return database.DeleteDueUsersRow(r) }), err
+}
+
+func (s *SQLite) DisableTOTP(ctx context.Context, id uuid.UUID) error {
+	return s.q.DisableTOTP(ctx, id)
+}
+
+func (s *SQLite) EnableTOTP(ctx context.Context, id uuid.UUID) error {
+	return s.q.EnableTOTP(ctx, id)
+}
+
+func (s *SQLite) GetUser(ctx context.Context, id uuid.UUID) (database.User, error) {
+	row, err := s.q.GetUser(ctx, id)
+	return database.User(row), err
+}
+
+func (s *SQLite) GetUserActivityCounts(ctx context.Context, userID uuid.UUID) (database.GetUserActivityCountsRow, error) {
+	row, err := s.q.GetUserActivityCounts(ctx, userID)
+	return database.GetUserActivityCountsRow(row), err
+}
+
+func (s *SQLite) GetUserByEmail(ctx context.Context, email string) (database.User, error) {
+	row, err := s.q.GetUserByEmail(ctx, email)
+	return database.User(row), err
+}
+
+func (s *SQLite) GetUserStatus(ctx context.Context, id uuid.UUID) (database.GetUserStatusRow, error) {
+	row, err := s.q.GetUserStatus(ctx, id)
+	return database.GetUserStatusRow(row), err
+}
+
+func (s *SQLite) ListUsers(ctx context.Context, arg database.ListUsersParams) ([]database.ListUsersRow, error) {
+	rows, err := s.q.ListUsers(ctx, sqlite.ListUsersParams{
+		Email:         arg.Email,
+		IsChirpyRed:   arg.IsChirpyRed,
+		CreatedAfter:  arg.CreatedAfter,
+		CreatedBefore: arg.CreatedBefore,
+		MaxResults:    int64(arg.MaxResults),
+		SkipResults:   int64(arg.SkipResults),
+	})
+	return convertRows(rows, func(r sqlite.ListUsersRow) database.ListUsersRow { return database.ListUsersRow(r) }), err
+}
+
+func (s *SQLite) RequirePasswordReset(ctx context.Context, id uuid.UUID) (int64, error) {
+	return s.q.RequirePasswordReset(ctx, id)
+}
+
+func (s *SQLite) ScheduleUserDeletion(ctx context.Context, arg database.ScheduleUserDeletionParams) (sql.NullTime, error) {
+	return s.q.ScheduleUserDeletion(ctx, sqlite.ScheduleUserDeletionParams(arg))
+}
+
+func (s *SQLite) SetChirpyRed(ctx context.Context, id uuid.UUID) error {
+	return s.q.SetChirpyRed(ctx, id)
+}
+
+func (s *SQLite) SetShadowBanned(ctx context.Context, arg database.SetShadowBannedParams) (int64, error) {
+	return s.q.SetShadowBanned(ctx, sqlite.SetShadowBannedParams(arg))
+}
+
+func (s *SQLite) SetTOTPSecret(ctx context.Context, arg database.SetTOTPSecretParams) error {
+	return s.q.SetTOTPSecret(ctx, sqlite.SetTOTPSecretParams(arg))
+}
+
+func (s *SQLite) SetUserRole(ctx context.Context, arg database.SetUserRoleParams) (int64, error) {
+	return s.q.SetUserRole(ctx, sqlite.SetUserRoleParams(arg))
+}
+
+func (s *SQLite) SuspendUser(ctx context.Context, arg database.SuspendUserParams) (int64, error) {
+	return s.q.SuspendUser(ctx, sqlite.SuspendUserParams(arg))
+}
+
+func (s *SQLite) UnsuspendUser(ctx context.Context, id uuid.UUID) (int64, error) {
+	return s.q.UnsuspendUser(ctx, id)
+}
+
+func (s *SQLite) UpdateChirpyRed(ctx context.Context, arg database.UpdateChirpyRedParams) (int64, error) {
+	return s.q.UpdateChirpyRed(ctx, sqlite.UpdateChirpyRedParams(arg))
+}
+
+func (s *SQLite) UpdateUser(ctx context.Context, arg database.UpdateUserParams) (database.UpdateUserRow, error) {
+	row, err := s.q.UpdateUser(ctx, sqlite.UpdateUserParams(arg))
+	return database.UpdateUserRow(row), translateSQLiteError(err)
+}
+
+func (s *SQLite) UseTOTPCounter(ctx context.Context, arg database.UseTOTPCounterParams) (int64, error) {
+	return s.q.UseTOTPCounter(ctx, sqlite.UseTOTPCounterParams(arg))
+}
@@ -0,0 +1,169 @@
+// Package store is the data layer the handlers talk to. The interfaces use
+// the sqlc types from internal/database, so the Postgres store is the
+// generated code with a few errors translated, the SQLite store converts the
+// rows of its own generated code in internal/database/sqlite, and the memory
+// store answers every query the way the SQL in sql/queries would.
+//
+// A row that isn't there is sql.ErrNoRows, as it is from sqlc.
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/drewheasman/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// ErrEmailTaken is returned when creating or updating a user would give two
+// users the same email.
+var ErrEmailTaken = errors.New("email is already taken")
+
+var (
+	_ Store = (*Postgres)(nil)
+	_ Store = (*Memory)(nil)
+	_ Store = (*SQLite)(nil)
+)
+
+// Store is every table the API uses.
+type Store interface {
+	Users
+	Chirps
+	RefreshTokens
+	TwoFactor
+	PasswordResets
+	PersonalAccessTokens
+	OAuth
+	DataExports
+	Imports
+	AuditLog
+	LoginAttempts
+
+	// Ping reports whether the store can be reached.
+	Ping(ctx context.Context) error
+	// InTx runs fn against a Store whose writes are kept only if fn
+	// returns nil. Inside fn, InTx just calls fn again.
+	InTx(ctx context.Context, fn func(Store) error) error
+}
+
+type Users interface {
+	AdminExists(ctx context.Context) (bool, error)
+	CancelUserDeletion(ctx context.Context, id uuid.UUID) (int64, error)
+	CountUsers(ctx context.Context, arg database.CountUsersParams) (int64, error)
+	CreateUser(ctx context.Context, arg database.CreateUserParams) (database.CreateUserRow, error)
+	DeleteAllUsers(ctx context.Context) error
+	DeleteDueUsers(ctx context.Context, deletionScheduledAt sql.NullTime) ([]database.DeleteDueUsersRow, error)
+	DisableTOTP(ctx context.Context, id uuid.UUID) error
+	EnableTOTP(ctx context.Context, id uuid.UUID) error
+	GetUser(ctx context.Context, id uuid.UUID) (database.User, error)
+	GetUserActivityCounts(ctx context.Context, userID uuid.UUID) (database.GetUserActivityCountsRow, error)
+	GetUserByEmail(ctx context.Context, email string) (database.User, error)
+	GetUserStatus(ctx context.Context, id uuid.UUID) (database.GetUserStatusRow, error)
+	ListUsers(ctx context.Context, arg database.ListUsersParams) ([]database.ListUsersRow, error)
+	RequirePasswordReset(ctx context.Context, id uuid.UUID) (int64, error)
+	ScheduleUserDeletion(ctx context.Context, arg database.ScheduleUserDeletionParams) (sql.NullTime, error)
+	SetChirpyRed(ctx context.Context, id uuid.UUID) error
+	SetShadowBanned(ctx context.Context, arg database.SetShadowBannedParams) (int64, error)
+	SetTOTPSecret(ctx context.Context, arg database.SetTOTPSecretParams) error
+	SetUserRole(ctx context.Context, arg database.SetUserRoleParams) (int64, error)
+	SuspendUser(ctx context.Context, arg database.SuspendUserParams) (int64, error)
+	UnsuspendUser(ctx context.Context, id uuid.UUID) (int64, error)
+	UpdateChirpyRed(ctx context.Context, arg database.UpdateChirpyRedParams) (int64, error)
+	UpdateUser(ctx context.Context, arg database.UpdateUserParams) (database.UpdateUserRow, error)
+	UseTOTPCounter(ctx context.Context, arg database.UseTOTPCounterParams) (int64, error)
+}
+
+type Chirps interface {
+	CreateChirp(ctx context.Context, arg database.CreateChirpParams) (database.Chirp, error)
+	DeleteChirp(ctx context.Context, id uuid.UUID) error
+	DeleteChirpsBefore(ctx context.Context, createdAt time.Time) (int64, error)
+	GetChirp(ctx context.Context, id uuid.UUID) (database.Chirp, error)
+	GetChirps(ctx context.Context) ([]database.Chirp, error)
+	GetChirpsByUser(ctx context.Context, userID uuid.UUID) ([]database.Chirp, error)
+	GetVisibleChirp(ctx context.Context, arg database.GetVisibleChirpParams) (database.Chirp, error)
+	GetVisibleChirps(ctx context.Context, viewerID uuid.NullUUID) ([]database.Chirp, error)
+	GetVisibleChirpsByUser(ctx context.Context, arg database.GetVisibleChirpsByUserParams) ([]database.Chirp, error)
+}
+
+type RefreshTokens interface {
+	CreateRefreshToken(ctx context.Context, arg database.CreateRefreshTokenParams) error
+	GetActiveSessionsForUser(ctx context.Context, userID uuid.UUID) ([]database.GetActiveSessionsForUserRow, error)
+	GetRefreshToken(ctx context.Context, tokenHash string) (database.RefreshToken, error)
+	GetSessionHistoryForUser(ctx context.Context, userID uuid.UUID) ([]database.GetSessionHistoryForUserRow, error)
+	IsSessionActive(ctx context.Context, familyID uuid.UUID) (bool, error)
+	RevokeAllSessionsForUser(ctx context.Context, userID uuid.UUID) error
+	RevokeRefreshTokenFamily(ctx context.Context, familyID uuid.UUID) error
+	RevokeSessionForUser(ctx context.Context, arg database.RevokeSessionForUserParams) (int64, error)
+	RotateRefreshToken(ctx context.Context, arg database.RotateRefreshTokenParams) (database.RotateRefreshTokenRow, error)
+}
+
+type TwoFactor interface {
+	CreateRecoveryCodes(ctx context.Context, arg database.CreateRecoveryCodesParams) error
+	CreateTwoFactorChallenge(ctx context.Context, arg database.CreateTwoFactorChallengeParams) error
+	DeleteRecoveryCodes(ctx context.Context, userID uuid.UUID) error
+	DeleteTwoFactorChallenge(ctx context.Context, tokenHash string) error
+	GetUserFromTwoFactorChallenge(ctx context.Context, arg database.GetUserFromTwoFactorChallengeParams) (uuid.UUID, error)
+	UseRecoveryCode(ctx context.Context, arg database.UseRecoveryCodeParams) (int64, error)
+}
+
+type PasswordResets interface {
+	ConsumePasswordResetToken(ctx context.Context, arg database.ConsumePasswordResetTokenParams) (uuid.UUID, error)
+	CreatePasswordResetToken(ctx context.Context, arg database.CreatePasswordResetTokenParams) error
+	ResetPassword(ctx context.Context, arg database.ResetPasswordParams) error
+}
+
+type PersonalAccessTokens interface {
+	CreatePersonalAccessToken(ctx context.Context, arg database.CreatePersonalAccessTokenParams) (database.CreatePersonalAccessTokenRow, error)
+	DeletePersonalAccessToken(ctx context.Context, arg database.DeletePersonalAccessTokenParams) (int64, error)
+	DeletePersonalAccessTokensForUser(ctx context.Context, userID uuid.UUID) (int64, error)
+	GetPersonalAccessTokensForUser(ctx context.Context, userID uuid.UUID) ([]database.GetPersonalAccessTokensForUserRow, error)
+	UsePersonalAccessToken(ctx context.Context, tokenHash string) (database.UsePersonalAccessTokenRow, error)
+}
+
+type OAuth interface {
+	ConsumeOAuthAuthorizationCode(ctx context.Context, codeHash string) (database.OauthAuthorizationCode, error)
+	CreateOAuthAuthorizationCode(ctx context.Context, arg database.CreateOAuthAuthorizationCodeParams) error
+	CreateOAuthClient(ctx context.Context, arg database.CreateOAuthClientParams) (database.OauthClient, error)
+	GetOAuthClient(ctx context.Context, id string) (database.OauthClient, error)
+}
+
+type DataExports interface {
+	ClaimDataExport(ctx context.Context, staleBefore time.Time) (database.DataExport, error)
+	CompleteDataExport(ctx context.Context, arg database.CompleteDataExportParams) error
+	CountActiveDataExportsForUser(ctx context.Context, userID uuid.UUID) (int64, error)
+	CreateDataExport(ctx context.Context, userID uuid.UUID) (database.DataExport, error)
+	DeleteDataExportsForDueUsers(ctx context.Context, deletionScheduledAt sql.NullTime) ([]sql.NullString, error)
+	DeleteExpiredDataExports(ctx context.Context, expiresAt sql.NullTime) ([]sql.NullString, error)
+	FailDataExport(ctx context.Context, arg database.FailDataExportParams) error
+	GetDataExport(ctx context.Context, id uuid.UUID) (database.DataExport, error)
+	GetDataExportForUser(ctx context.Context, arg database.GetDataExportForUserParams) (database.DataExport, error)
+}
+
+type Imports interface {
+	CreateExternalChirpIDs(ctx context.Context, arg database.CreateExternalChirpIDsParams) error
+	CreateExternalUserIDs(ctx context.Context, arg database.CreateExternalUserIDsParams) error
+	GetExternalChirpIDs(ctx context.Context, arg database.GetExternalChirpIDsParams) ([]string, error)
+	GetExternalUserIDs(ctx context.Context, arg database.GetExternalUserIDsParams) ([]database.GetExternalUserIDsRow, error)
+	GetUsersByEmails(ctx context.Context, emails []string) ([]string, error)
+	ImportChirps(ctx context.Context, arg database.ImportChirpsParams) (int64, error)
+	ImportUsers(ctx context.Context, arg database.ImportUsersParams) error
+	ListChirpsForExport(ctx context.Context, arg database.ListChirpsForExportParams) ([]database.ListChirpsForExportRow, error)
+	ListUsersForExport(ctx context.Context, arg database.ListUsersForExportParams) ([]database.ListUsersForExportRow, error)
+}
+
+type AuditLog interface {
+	CountAuditLog(ctx context.Context, arg database.CountAuditLogParams) (int64, error)
+	CreateAuditLogEntry(ctx context.Context, arg database.CreateAuditLogEntryParams) error
+	GetAuditLogForTarget(ctx context.Context, arg database.GetAuditLogForTargetParams) ([]database.GetAuditLogForTargetRow, error)
+	ListAuditLog(ctx context.Context, arg database.ListAuditLogParams) ([]database.AuditLog, error)
+}
+
+type LoginAttempts interface {
+	GetLoginAttempt(ctx context.Context, key string) (database.LoginAttempt, error)
+	LockLoginAttempts(ctx context.Context, arg database.LockLoginAttemptsParams) error
+	RecordLoginFailure(ctx context.Context, arg database.RecordLoginFailureParams) (database.LoginAttempt, error)
+	ReleaseLoginAttempt(ctx context.Context, arg database.ReleaseLoginAttemptParams) error
+	ResetLoginAttempts(ctx context.Context, key string) error
+}
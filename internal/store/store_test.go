@@ -0,0 +1,551 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/drewheasman/chirpy/internal/database"
+	"github.com/drewheasman/chirpy/internal/migrate"
+	"github.com/google/uuid"
+	_ "github.com/lib/pq"
+)
+
+// testStores are the stores every test below runs against, so neither the
+// SQLite store nor the memory store can drift from Postgres. The Postgres
+// store needs a migrated database named by CHIRPY_TEST_DB_URL, and shares it
+// with other tests, so the tests only look at rows they made. Each SQLite
+// store is a fresh database file.
+var testStores = []struct {
+	name     string
+	newStore func(t *testing.T) Store
+}{
+	{"postgres", newTestPostgres},
+	{"sqlite", newTestSQLite},
+	{"memory", func(*testing.T) Store { return NewMemory() }},
+}
+
+func newTestPostgres(t *testing.T) Store {
+	t.Helper()
+
+	dbURL := os.Getenv("CHIRPY_TEST_DB_URL")
+	if dbURL == "" {
+		t.Skip("CHIRPY_TEST_DB_URL is not set")
+	}
+	db, err := sql.Open("postgres", dbURL)
+	if err != nil {
+		t.Fatalf("sql.Open() resulted in error: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return NewPostgres(db)
+}
+
+func newTestSQLite(t *testing.T) Store {
+	t.Helper()
+
+	db, err := OpenSQLite(filepath.Join(t.TempDir(), "chirpy.db"))
+	if err != nil {
+		t.Fatalf("OpenSQLite() resulted in error: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	migrator, err := migrate.NewSQLite(db, os.DirFS("../../sql/sqlite/schema"))
+	if err != nil {
+		t.Fatalf("migrate.NewSQLite() resulted in error: %v", err)
+	}
+	if _, err := migrator.Up(context.Background()); err != nil {
+		t.Fatalf("Up() resulted in error: %v", err)
+	}
+	return NewSQLite(db)
+}
+
+// forEachStore runs test as a subtest against each of testStores.
+func forEachStore(t *testing.T, test func(t *testing.T, s Store)) {
+	for _, ts := range testStores {
+		t.Run(ts.name, func(t *testing.T) {
+			test(t, ts.newStore(t))
+		})
+	}
+}
+
+func createTestUser(t *testing.T, s Store) database.CreateUserRow {
+	t.Helper()
+
+	user, err := s.CreateUser(context.Background(), database.CreateUserParams{
+		Email:          "store-" + uuid.NewString() + "@example.com",
+		HashedPassword: "unset",
+	})
+	if err != nil {
+		t.Fatalf("CreateUser() resulted in error: %v", err)
+	}
+	return user
+}
+
+func TestUniqueEmail(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		user := createTestUser(t, s)
+		other := createTestUser(t, s)
+
+		_, err := s.CreateUser(ctx, database.CreateUserParams{Email: user.Email, HashedPassword: "unset"})
+		if !errors.Is(err, ErrEmailTaken) {
+			t.Errorf("CreateUser() with a taken email = %v, want ErrEmailTaken", err)
+		}
+
+		_, err = s.UpdateUser(ctx, database.UpdateUserParams{ID: other.ID, Email: user.Email, HashedPassword: "unset"})
+		if !errors.Is(err, ErrEmailTaken) {
+			t.Errorf("UpdateUser() to a taken email = %v, want ErrEmailTaken", err)
+		}
+		if _, err := s.UpdateUser(ctx, database.UpdateUserParams{ID: other.ID, Email: other.Email, HashedPassword: "unset"}); err != nil {
+			t.Errorf("UpdateUser() keeping its own email resulted in error: %v", err)
+		}
+		_, err = s.UpdateUser(ctx, database.UpdateUserParams{ID: uuid.New(), Email: "nobody-" + user.Email, HashedPassword: "unset"})
+		if !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("UpdateUser() of a missing user = %v, want sql.ErrNoRows", err)
+		}
+
+		err = s.ImportUsers(ctx, database.ImportUsersParams{
+			Ids:             []uuid.UUID{uuid.New()},
+			CreatedAt:       []time.Time{time.Now()},
+			Emails:          []string{user.Email},
+			HashedPasswords: []string{"unset"},
+			IsChirpyRed:     []bool{false},
+		})
+		if !errors.Is(err, ErrEmailTaken) {
+			t.Errorf("ImportUsers() with a taken email = %v, want ErrEmailTaken", err)
+		}
+	})
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		user := createTestUser(t, s)
+
+		create := func(expiresAt time.Time) (string, uuid.UUID) {
+			t.Helper()
+			tokenHash, familyID := uuid.NewString(), uuid.New()
+			err := s.CreateRefreshToken(ctx, database.CreateRefreshTokenParams{
+				TokenHash: tokenHash,
+				UserID:    user.ID,
+				ExpiresAt: expiresAt,
+				FamilyID:  familyID,
+				Scopes:    []string{},
+			})
+			if err != nil {
+				t.Fatalf("CreateRefreshToken() resulted in error: %v", err)
+			}
+			return tokenHash, familyID
+		}
+
+		expired, expiredFamily := create(time.Now().Add(-time.Minute))
+		if _, err := s.RotateRefreshToken(ctx, database.RotateRefreshTokenParams{TokenHash: expired}); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("RotateRefreshToken() of an expired token = %v, want sql.ErrNoRows", err)
+		}
+		if active, err := s.IsSessionActive(ctx, expiredFamily); err != nil || active {
+			t.Errorf("IsSessionActive() of an expired session = %v, %v, want false", active, err)
+		}
+
+		valid, validFamily := create(time.Now().Add(time.Hour))
+		wrongClient := database.RotateRefreshTokenParams{TokenHash: valid, ClientID: sql.NullString{String: "chirpy_client_test", Valid: true}}
+		if _, err := s.RotateRefreshToken(ctx, wrongClient); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("RotateRefreshToken() for another client = %v, want sql.ErrNoRows", err)
+		}
+
+		sessions, err := s.GetActiveSessionsForUser(ctx, user.ID)
+		if err != nil {
+			t.Fatalf("GetActiveSessionsForUser() resulted in error: %v", err)
+		}
+		if len(sessions) != 1 || sessions[0].FamilyID != validFamily {
+			t.Errorf("GetActiveSessionsForUser() = %+v, want only %s", sessions, validFamily)
+		}
+
+		rotated, err := s.RotateRefreshToken(ctx, database.RotateRefreshTokenParams{TokenHash: valid})
+		if err != nil {
+			t.Fatalf("RotateRefreshToken() resulted in error: %v", err)
+		}
+		if rotated.UserID != user.ID || rotated.FamilyID != validFamily {
+			t.Errorf("RotateRefreshToken() = %+v, want user %s family %s", rotated, user.ID, validFamily)
+		}
+		if _, err := s.RotateRefreshToken(ctx, database.RotateRefreshTokenParams{TokenHash: valid}); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("RotateRefreshToken() twice = %v, want sql.ErrNoRows", err)
+		}
+
+		// A rotated token no longer counts, but its family is still active
+		// until it is revoked.
+		if active, err := s.IsSessionActive(ctx, validFamily); err != nil || !active {
+			t.Errorf("IsSessionActive() after rotation = %v, %v, want true", active, err)
+		}
+		if err := s.RevokeRefreshTokenFamily(ctx, validFamily); err != nil {
+			t.Fatalf("RevokeRefreshTokenFamily() resulted in error: %v", err)
+		}
+		if active, err := s.IsSessionActive(ctx, validFamily); err != nil || active {
+			t.Errorf("IsSessionActive() after revocation = %v, %v, want false", active, err)
+		}
+	})
+}
+
+func TestInTx(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		errRollback := errors.New("roll back")
+		var rolledBack, committed database.CreateUserRow
+
+		err := s.InTx(ctx, func(tx Store) error {
+			rolledBack = createTestUser(t, tx)
+			return errRollback
+		})
+		if !errors.Is(err, errRollback) {
+			t.Fatalf("InTx() = %v, want the error from fn", err)
+		}
+		if _, err := s.GetUser(ctx, rolledBack.ID); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("GetUser() of a rolled back user = %v, want sql.ErrNoRows", err)
+		}
+
+		err = s.InTx(ctx, func(tx Store) error {
+			committed = createTestUser(t, tx)
+			return tx.InTx(ctx, func(Store) error { return nil })
+		})
+		if err != nil {
+			t.Fatalf("InTx() resulted in error: %v", err)
+		}
+		if _, err := s.GetUser(ctx, committed.ID); err != nil {
+			t.Errorf("GetUser() of a committed user resulted in error: %v", err)
+		}
+	})
+}
+
+func TestDeleteDueUsersCascades(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		user := createTestUser(t, s)
+
+		chirp, err := s.CreateChirp(ctx, database.CreateChirpParams{Body: "gone soon", UserID: user.ID})
+		if err != nil {
+			t.Fatalf("CreateChirp() resulted in error: %v", err)
+		}
+		tokenHash := uuid.NewString()
+		err = s.CreateRefreshToken(ctx, database.CreateRefreshTokenParams{
+			TokenHash: tokenHash,
+			UserID:    user.ID,
+			ExpiresAt: time.Now().Add(time.Hour),
+			FamilyID:  uuid.New(),
+			Scopes:    []string{},
+		})
+		if err != nil {
+			t.Fatalf("CreateRefreshToken() resulted in error: %v", err)
+		}
+
+		deleteAt := sql.NullTime{Time: time.Now().Add(-time.Minute), Valid: true}
+		if _, err := s.ScheduleUserDeletion(ctx, database.ScheduleUserDeletionParams{ID: user.ID, DeletionScheduledAt: deleteAt}); err != nil {
+			t.Fatalf("ScheduleUserDeletion() resulted in error: %v", err)
+		}
+		deleted, err := s.DeleteDueUsers(ctx, sql.NullTime{Time: time.Now(), Valid: true})
+		if err != nil {
+			t.Fatalf("DeleteDueUsers() resulted in error: %v", err)
+		}
+		found := false
+		for _, d := range deleted {
+			found = found || d.ID == user.ID
+		}
+		if !found {
+			t.Fatalf("DeleteDueUsers() = %+v, want it to include %s", deleted, user.ID)
+		}
+
+		if _, err := s.GetChirp(ctx, chirp.ID); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("GetChirp() of a deleted user's chirp = %v, want sql.ErrNoRows", err)
+		}
+		if _, err := s.GetRefreshToken(ctx, tokenHash); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("GetRefreshToken() of a deleted user's token = %v, want sql.ErrNoRows", err)
+		}
+		if _, err := s.CreateChirp(ctx, database.CreateChirpParams{Body: "orphan", UserID: user.ID}); err == nil {
+			t.Error("CreateChirp() for a deleted user resulted in no error")
+		}
+	})
+}
+
+func TestPersonalAccessTokenScopes(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		user := createTestUser(t, s)
+		scopes := []string{"chirps:read", "chirps:write"}
+
+		tokenHash := uuid.NewString()
+		created, err := s.CreatePersonalAccessToken(ctx, database.CreatePersonalAccessTokenParams{
+			UserID:    user.ID,
+			Name:      "laptop",
+			TokenHash: tokenHash,
+			Scopes:    scopes,
+		})
+		if err != nil {
+			t.Fatalf("CreatePersonalAccessToken() resulted in error: %v", err)
+		}
+		if !slices.Equal(created.Scopes, scopes) || created.ExpiresAt.Valid || created.LastUsedAt.Valid {
+			t.Errorf("CreatePersonalAccessToken() = %+v, want scopes %v and no expiry or last use", created, scopes)
+		}
+
+		used, err := s.UsePersonalAccessToken(ctx, tokenHash)
+		if err != nil {
+			t.Fatalf("UsePersonalAccessToken() resulted in error: %v", err)
+		}
+		if used.ID != created.ID || used.UserID != user.ID || !slices.Equal(used.Scopes, scopes) {
+			t.Errorf("UsePersonalAccessToken() = %+v, want token %s of user %s with scopes %v", used, created.ID, user.ID, scopes)
+		}
+
+		tokens, err := s.GetPersonalAccessTokensForUser(ctx, user.ID)
+		if err != nil {
+			t.Fatalf("GetPersonalAccessTokensForUser() resulted in error: %v", err)
+		}
+		if len(tokens) != 1 || !tokens[0].LastUsedAt.Valid || !slices.Equal(tokens[0].Scopes, scopes) {
+			t.Errorf("GetPersonalAccessTokensForUser() = %+v, want the one token, used", tokens)
+		}
+
+		expiredHash := uuid.NewString()
+		_, err = s.CreatePersonalAccessToken(ctx, database.CreatePersonalAccessTokenParams{
+			UserID:    user.ID,
+			Name:      "expired",
+			TokenHash: expiredHash,
+			Scopes:    []string{},
+			ExpiresAt: sql.NullTime{Time: time.Now().Add(-time.Minute), Valid: true},
+		})
+		if err != nil {
+			t.Fatalf("CreatePersonalAccessToken() resulted in error: %v", err)
+		}
+		if _, err := s.UsePersonalAccessToken(ctx, expiredHash); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("UsePersonalAccessToken() of an expired token = %v, want sql.ErrNoRows", err)
+		}
+	})
+}
+
+func TestAuditLogFilters(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		user := createTestUser(t, s)
+		target := uuid.NullUUID{UUID: user.ID, Valid: true}
+		before := time.Now().Add(-time.Second)
+
+		for _, action := range []string{"user.suspend", "user.unsuspend", "user.role"} {
+			err := s.CreateAuditLogEntry(ctx, database.CreateAuditLogEntryParams{
+				Action:       action,
+				TargetUserID: target,
+				Details:      json.RawMessage(`{"action":"` + action + `"}`),
+				Diff:         json.RawMessage(`{}`),
+			})
+			if err != nil {
+				t.Fatalf("CreateAuditLogEntry() resulted in error: %v", err)
+			}
+		}
+
+		entries, err := s.GetAuditLogForTarget(ctx, database.GetAuditLogForTargetParams{
+			TargetUserID: target,
+			Actions:      []string{"user.suspend", "user.unsuspend"},
+		})
+		if err != nil {
+			t.Fatalf("GetAuditLogForTarget() resulted in error: %v", err)
+		}
+		if len(entries) != 2 {
+			t.Fatalf("GetAuditLogForTarget() = %+v, want the suspend and unsuspend entries", entries)
+		}
+		for _, entry := range entries {
+			var details map[string]string
+			if err := json.Unmarshal(entry.Details, &details); err != nil || details["action"] != entry.Action {
+				t.Errorf("GetAuditLogForTarget() details = %s, want the details of %s", entry.Details, entry.Action)
+			}
+		}
+		if entries, err := s.GetAuditLogForTarget(ctx, database.GetAuditLogForTargetParams{TargetUserID: target}); err != nil || len(entries) != 0 {
+			t.Errorf("GetAuditLogForTarget() with no actions = %+v, %v, want nothing", entries, err)
+		}
+
+		page, err := s.ListAuditLog(ctx, database.ListAuditLogParams{
+			TargetUserID: target,
+			CreatedAfter: sql.NullTime{Time: before, Valid: true},
+			MaxResults:   2,
+			SkipResults:  1,
+		})
+		if err != nil {
+			t.Fatalf("ListAuditLog() resulted in error: %v", err)
+		}
+		if len(page) != 2 {
+			t.Errorf("ListAuditLog() of 3 entries skipping 1 = %d entries, want 2", len(page))
+		}
+		count, err := s.CountAuditLog(ctx, database.CountAuditLogParams{
+			TargetUserID:  target,
+			CreatedBefore: sql.NullTime{Time: before, Valid: true},
+		})
+		if err != nil || count != 0 {
+			t.Errorf("CountAuditLog() before the entries = %d, %v, want 0", count, err)
+		}
+	})
+}
+
+func TestImportChirps(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		user := createTestUser(t, s)
+		source, externalID := "import-"+uuid.NewString(), uuid.NewString()
+
+		err := s.CreateExternalUserIDs(ctx, database.CreateExternalUserIDsParams{
+			Source:      source,
+			ExternalIds: []string{externalID},
+			UserIds:     []uuid.UUID{user.ID},
+		})
+		if err != nil {
+			t.Fatalf("CreateExternalUserIDs() resulted in error: %v", err)
+		}
+		ids, err := s.GetExternalUserIDs(ctx, database.GetExternalUserIDsParams{Source: source, ExternalIds: []string{externalID, "missing"}})
+		if err != nil {
+			t.Fatalf("GetExternalUserIDs() resulted in error: %v", err)
+		}
+		if len(ids) != 1 || ids[0].UserID != user.ID {
+			t.Errorf("GetExternalUserIDs() = %+v, want %s for %s", ids, user.ID, externalID)
+		}
+
+		email := "Store-" + uuid.NewString() + "@Example.com"
+		_, err = s.CreateUser(ctx, database.CreateUserParams{Email: email, HashedPassword: "unset"})
+		if err != nil {
+			t.Fatalf("CreateUser() resulted in error: %v", err)
+		}
+		taken, err := s.GetUsersByEmails(ctx, []string{strings.ToLower(email), "missing@example.com"})
+		if err != nil {
+			t.Fatalf("GetUsersByEmails() resulted in error: %v", err)
+		}
+		if len(taken) != 1 || taken[0] != email {
+			t.Errorf("GetUsersByEmails() = %v, want [%s]", taken, email)
+		}
+
+		createdAt := time.Now().Add(-24 * time.Hour)
+		chirpIDs := []uuid.UUID{uuid.New(), uuid.New()}
+		n, err := s.ImportChirps(ctx, database.ImportChirpsParams{
+			Ids:       chirpIDs,
+			CreatedAt: []time.Time{createdAt, createdAt},
+			Bodies:    []string{"first", "second"},
+			UserIds:   []uuid.UUID{user.ID, user.ID},
+		})
+		if err != nil || n != 2 {
+			t.Fatalf("ImportChirps() = %d, %v, want 2", n, err)
+		}
+		chirps, err := s.GetChirpsByUser(ctx, user.ID)
+		if err != nil {
+			t.Fatalf("GetChirpsByUser() resulted in error: %v", err)
+		}
+		if len(chirps) != 2 {
+			t.Errorf("GetChirpsByUser() after importing 2 chirps = %d chirps", len(chirps))
+		}
+
+		err = s.CreateExternalChirpIDs(ctx, database.CreateExternalChirpIDsParams{
+			Source:      source,
+			ExternalIds: []string{"c1", "c2"},
+			ChirpIds:    chirpIDs,
+		})
+		if err != nil {
+			t.Fatalf("CreateExternalChirpIDs() resulted in error: %v", err)
+		}
+		if err := s.DeleteChirp(ctx, chirpIDs[1]); err != nil {
+			t.Fatalf("DeleteChirp() resulted in error: %v", err)
+		}
+		seen, err := s.GetExternalChirpIDs(ctx, database.GetExternalChirpIDsParams{Source: source, ExternalIds: []string{"c1", "c2", "missing"}})
+		if err != nil {
+			t.Fatalf("GetExternalChirpIDs() resulted in error: %v", err)
+		}
+		if len(seen) != 1 || seen[0] != "c1" {
+			t.Errorf("GetExternalChirpIDs() after deleting c2's chirp = %v, want [c1]", seen)
+		}
+
+		_, err = s.ImportChirps(ctx, database.ImportChirpsParams{
+			Ids:       []uuid.UUID{uuid.New(), uuid.New()},
+			CreatedAt: []time.Time{createdAt},
+			Bodies:    []string{"third", "fourth"},
+			UserIds:   []uuid.UUID{user.ID, user.ID},
+		})
+		if err == nil {
+			t.Error("ImportChirps() with arrays of different lengths resulted in no error")
+		}
+	})
+}
+
+func TestUseTOTPCounter(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		user := createTestUser(t, s)
+
+		use := func(counter int64) int64 {
+			t.Helper()
+			used, err := s.UseTOTPCounter(ctx, database.UseTOTPCounterParams{ID: user.ID, TotpLastCounter: counter})
+			if err != nil {
+				t.Fatalf("UseTOTPCounter() resulted in error: %v", err)
+			}
+			return used
+		}
+
+		if used := use(100); used != 1 {
+			t.Errorf("UseTOTPCounter(100) = %d, want 1", used)
+		}
+		if used := use(100); used != 0 {
+			t.Errorf("UseTOTPCounter(100) again = %d, want 0", used)
+		}
+		if used := use(99); used != 0 {
+			t.Errorf("UseTOTPCounter(99) after 100 = %d, want 0", used)
+		}
+		if used := use(101); used != 1 {
+			t.Errorf("UseTOTPCounter(101) = %d, want 1", used)
+		}
+
+		userRecord, err := s.GetUser(ctx, user.ID)
+		if err != nil {
+			t.Fatalf("GetUser() resulted in error: %v", err)
+		}
+		if userRecord.TotpLastCounter != 101 {
+			t.Errorf("GetUser().TotpLastCounter = %d, want 101", userRecord.TotpLastCounter)
+		}
+	})
+}
+
+func TestReleaseLoginAttempt(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		key := "email:" + uuid.NewString()
+		first := time.Now().UTC().Truncate(time.Second).Add(-time.Minute)
+		reserved := first.Add(time.Minute)
+
+		record := func(at time.Time) {
+			t.Helper()
+			_, err := s.RecordLoginFailure(ctx, database.RecordLoginFailureParams{Key: key, FailedAt: at, WindowStart: at.Add(-time.Hour)})
+			if err != nil {
+				t.Fatalf("RecordLoginFailure() resulted in error: %v", err)
+			}
+		}
+		release := func() database.LoginAttempt {
+			t.Helper()
+			err := s.ReleaseLoginAttempt(ctx, database.ReleaseLoginAttemptParams{Key: key, ReservedAt: reserved, PreviousFailureAt: first})
+			if err != nil {
+				t.Fatalf("ReleaseLoginAttempt() resulted in error: %v", err)
+			}
+			attempt, err := s.GetLoginAttempt(ctx, key)
+			if err != nil {
+				t.Fatalf("GetLoginAttempt() resulted in error: %v", err)
+			}
+			return attempt
+		}
+
+		record(first)
+		record(reserved)
+		if attempt := release(); attempt.Failures != 1 || !attempt.LastFailureAt.Equal(first) {
+			t.Errorf("after releasing = %d failures, last at %v, want 1 at %v", attempt.Failures, attempt.LastFailureAt, first)
+		}
+
+		// A failure counted since the reservation keeps its time.
+		later := reserved.Add(time.Second)
+		record(reserved)
+		record(later)
+		if attempt := release(); attempt.Failures != 2 || !attempt.LastFailureAt.Equal(later) {
+			t.Errorf("after releasing = %d failures, last at %v, want 2 at %v", attempt.Failures, attempt.LastFailureAt, later)
+		}
+	})
+}
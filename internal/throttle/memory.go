@@ -0,0 +1,95 @@
+package throttle
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps entries in process memory. It only limits attempts made
+// against this instance. Keys that only ever fail are never reset, so
+// entries that can no longer slow anyone down are swept out as failures are
+// recorded.
+type MemoryStore struct {
+	mu        sync.Mutex
+	entries   map[string]Entry
+	lastSweep time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: map[string]Entry{}}
+}
+
+func (s *MemoryStore) Get(_ context.Context, key string) (Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.entries[key], nil
+}
+
+func (s *MemoryStore) RecordFailure(_ context.Context, key string, at, windowStart time.Time) (Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweep(at, windowStart)
+
+	entry := s.entries[key]
+	if entry.LastFailure.Before(windowStart) {
+		entry.Failures = 0
+	}
+	entry.Failures++
+	entry.LastFailure = at
+	s.entries[key] = entry
+
+	return entry, nil
+}
+
+func (s *MemoryStore) Release(_ context.Context, key string, reservedAt, previous time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if entry, ok := s.entries[key]; ok && entry.Failures > 0 {
+		entry.Failures--
+		if entry.LastFailure.Equal(reservedAt) {
+			entry.LastFailure = previous
+		}
+		s.entries[key] = entry
+	}
+
+	return nil
+}
+
+func (s *MemoryStore) Lock(_ context.Context, key string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry := s.entries[key]
+	entry.LockedUntil = until
+	s.entries[key] = entry
+
+	return nil
+}
+
+func (s *MemoryStore) Reset(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.entries, key)
+
+	return nil
+}
+
+// sweep deletes the entries whose failures are all older than windowStart
+// and which aren't locked at now. It walks the map at most once a window.
+func (s *MemoryStore) sweep(now, windowStart time.Time) {
+	if now.Sub(s.lastSweep) < now.Sub(windowStart) {
+		return
+	}
+	s.lastSweep = now
+
+	for key, entry := range s.entries {
+		if entry.LastFailure.Before(windowStart) && !entry.LockedUntil.After(now) {
+			delete(s.entries, key)
+		}
+	}
+}
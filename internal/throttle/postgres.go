@@ -0,0 +1,76 @@
+package throttle
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/drewheasman/chirpy/internal/database"
+	"github.com/drewheasman/chirpy/internal/store"
+)
+
+// PostgresStore keeps entries in the login_attempts table so that every
+// instance behind a load balancer sees the same failures.
+type PostgresStore struct {
+	attempts store.LoginAttempts
+}
+
+func NewPostgresStore(attempts store.LoginAttempts) *PostgresStore {
+	return &PostgresStore{attempts: attempts}
+}
+
+func (s *PostgresStore) Get(ctx context.Context, key string) (Entry, error) {
+	record, err := s.attempts.GetLoginAttempt(ctx, key)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Entry{}, nil
+	}
+	if err != nil {
+		return Entry{}, err
+	}
+
+	return entryFromRecord(record), nil
+}
+
+func (s *PostgresStore) RecordFailure(ctx context.Context, key string, at, windowStart time.Time) (Entry, error) {
+	record, err := s.attempts.RecordLoginFailure(ctx, database.RecordLoginFailureParams{
+		Key:         key,
+		FailedAt:    at.UTC(),
+		WindowStart: windowStart.UTC(),
+	})
+	if err != nil {
+		return Entry{}, err
+	}
+
+	return entryFromRecord(record), nil
+}
+
+func (s *PostgresStore) Release(ctx context.Context, key string, reservedAt, previous time.Time) error {
+	return s.attempts.ReleaseLoginAttempt(ctx, database.ReleaseLoginAttemptParams{
+		Key:               key,
+		ReservedAt:        reservedAt.UTC(),
+		PreviousFailureAt: previous.UTC(),
+	})
+}
+
+func (s *PostgresStore) Lock(ctx context.Context, key string, until time.Time) error {
+	return s.attempts.LockLoginAttempts(ctx, database.LockLoginAttemptsParams{
+		Key:         key,
+		LockedUntil: sql.NullTime{Time: until.UTC(), Valid: true},
+	})
+}
+
+func (s *PostgresStore) Reset(ctx context.Context, key string) error {
+	return s.attempts.ResetLoginAttempts(ctx, key)
+}
+
+func entryFromRecord(record database.LoginAttempt) Entry {
+	entry := Entry{
+		Failures:    int(record.Failures),
+		LastFailure: record.LastFailureAt,
+	}
+	if record.LockedUntil.Valid {
+		entry.LockedUntil = record.LockedUntil.Time
+	}
+	return entry
+}
@@ -0,0 +1,193 @@
+// Package throttle tracks failed attempts per key (an account, an IP
+// address) and decides how long that key has to wait before trying again.
+package throttle
+
+import (
+	"context"
+	"time"
+)
+
+// Entry is the failure history stored for a single key.
+type Entry struct {
+	Failures    int
+	LastFailure time.Time
+	LockedUntil time.Time
+}
+
+// Store persists entries. MemoryStore suits a single node, PostgresStore
+// shares state between every instance using the same database.
+type Store interface {
+	Get(ctx context.Context, key string) (Entry, error)
+	// RecordFailure adds a failure for key at the given time. Failures older
+	// than windowStart are forgotten, so the count restarts at one.
+	RecordFailure(ctx context.Context, key string, at, windowStart time.Time) (Entry, error)
+	// Release takes back one failure recorded for key at reservedAt. If no
+	// failure has been recorded since, the last failure goes back to
+	// previous.
+	Release(ctx context.Context, key string, reservedAt, previous time.Time) error
+	Lock(ctx context.Context, key string, until time.Time) error
+	Reset(ctx context.Context, key string) error
+}
+
+// Policy describes how quickly a key is slowed down and when it is locked out.
+type Policy struct {
+	// MaxFailures is the number of failures that triggers a lockout.
+	MaxFailures int
+	// BaseDelay is the wait after the first failure, doubled for each
+	// further failure up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// Lockout is how long a key stays locked once MaxFailures is reached.
+	Lockout time.Duration
+	// Window is how long a failure is remembered.
+	Window time.Duration
+}
+
+type Limiter struct {
+	Store  Store
+	Policy Policy
+	Now    func() time.Time
+}
+
+func NewLimiter(store Store, policy Policy) *Limiter {
+	return &Limiter{
+		Store:  store,
+		Policy: policy,
+		Now:    time.Now,
+	}
+}
+
+// RetryAfter returns how long key has to wait before its next attempt. Zero
+// means the attempt is allowed.
+func (l *Limiter) RetryAfter(ctx context.Context, key string) (time.Duration, error) {
+	entry, err := l.Store.Get(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+
+	return l.wait(entry, l.Now()), nil
+}
+
+// Fail records a failed attempt for key and returns how long it now has to
+// wait, locking it out once the policy's failure limit is reached.
+func (l *Limiter) Fail(ctx context.Context, key string) (time.Duration, error) {
+	now := l.Now()
+	entry, err := l.Store.RecordFailure(ctx, key, now, now.Add(-l.Policy.Window))
+	if err != nil {
+		return 0, err
+	}
+
+	if l.Policy.MaxFailures > 0 && entry.Failures >= l.Policy.MaxFailures {
+		entry.LockedUntil = now.Add(l.Policy.Lockout)
+		if err := l.Store.Lock(ctx, key, entry.LockedUntil); err != nil {
+			return 0, err
+		}
+	}
+
+	return l.wait(entry, now), nil
+}
+
+// Reservation is an attempt that was counted as a failure before it was
+// made. It has to end in Fail, or in Release or the limiter's Succeed.
+type Reservation struct {
+	limiter  *Limiter
+	key      string
+	at       time.Time
+	previous time.Time
+}
+
+// Reserve counts an attempt for key as a failure before it is made, so that
+// attempts made at the same time can't all start before any of them has
+// failed. When key has to wait, nothing is counted and the reservation is
+// nil. The wait is at least a second, which is what Retry-After counts in.
+func (l *Limiter) Reserve(ctx context.Context, key string) (*Reservation, time.Duration, error) {
+	now := l.Now()
+	entry, err := l.Store.Get(ctx, key)
+	if err != nil {
+		return nil, 0, err
+	}
+	if wait := l.wait(entry, now); wait > 0 {
+		return nil, wait, nil
+	}
+	r := &Reservation{limiter: l, key: key, at: now, previous: entry.LastFailure}
+
+	// A lockout that has ended starts the count again, or the failures
+	// that caused it would refuse every attempt until they left the window.
+	windowStart := now.Add(-l.Policy.Window)
+	if entry.LockedUntil.After(windowStart) {
+		windowStart = entry.LockedUntil
+	}
+	entry, err = l.Store.RecordFailure(ctx, key, now, windowStart)
+	if err != nil {
+		return nil, 0, err
+	}
+	if l.Policy.MaxFailures > 0 && entry.Failures > l.Policy.MaxFailures {
+		// Other attempts in flight have taken every failure left.
+		if err := r.Release(ctx); err != nil {
+			return nil, 0, err
+		}
+		entry.Failures--
+		return nil, max(l.wait(entry, now), time.Second), nil
+	}
+
+	return r, 0, nil
+}
+
+// Fail keeps the failure counted for the reserved attempt and returns how
+// long its key now has to wait, locking it out once the policy's failure
+// limit is reached.
+func (r *Reservation) Fail(ctx context.Context) (time.Duration, error) {
+	l := r.limiter
+	now := l.Now()
+	entry, err := l.Store.Get(ctx, r.key)
+	if err != nil {
+		return 0, err
+	}
+
+	if l.Policy.MaxFailures > 0 && entry.Failures >= l.Policy.MaxFailures {
+		entry.LockedUntil = now.Add(l.Policy.Lockout)
+		if err := l.Store.Lock(ctx, r.key, entry.LockedUntil); err != nil {
+			return 0, err
+		}
+	}
+
+	return l.wait(entry, now), nil
+}
+
+// Release takes back the failure counted for the reserved attempt, for an
+// attempt that didn't fail.
+func (r *Reservation) Release(ctx context.Context) error {
+	return r.limiter.Store.Release(ctx, r.key, r.at, r.previous)
+}
+
+// Succeed clears the failure history for key after a successful attempt.
+func (l *Limiter) Succeed(ctx context.Context, key string) error {
+	return l.Store.Reset(ctx, key)
+}
+
+// Unlock lifts any lockout or backoff on key.
+func (l *Limiter) Unlock(ctx context.Context, key string) error {
+	return l.Store.Reset(ctx, key)
+}
+
+func (l *Limiter) wait(entry Entry, now time.Time) time.Duration {
+	if entry.LockedUntil.After(now) {
+		return entry.LockedUntil.Sub(now)
+	}
+	if entry.Failures == 0 || now.Sub(entry.LastFailure) >= l.Policy.Window {
+		return 0
+	}
+
+	delay := l.Policy.BaseDelay
+	for i := 1; i < entry.Failures && delay < l.Policy.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > l.Policy.MaxDelay {
+		delay = l.Policy.MaxDelay
+	}
+
+	if next := entry.LastFailure.Add(delay); next.After(now) {
+		return next.Sub(now)
+	}
+	return 0
+}
@@ -0,0 +1,202 @@
+package throttle
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+var testPolicy = Policy{
+	MaxFailures: 4,
+	BaseDelay:   time.Second,
+	MaxDelay:    4 * time.Second,
+	Lockout:     time.Minute,
+	Window:      10 * time.Minute,
+}
+
+func newTestLimiter() (*Limiter, *time.Time) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	limiter := NewLimiter(NewMemoryStore(), testPolicy)
+	limiter.Now = func() time.Time { return now }
+	return limiter, &now
+}
+
+func TestLimiterBackoff(t *testing.T) {
+	ctx := context.Background()
+	limiter, _ := newTestLimiter()
+
+	expectedWaits := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second}
+	for i, expected := range expectedWaits {
+		wait, err := limiter.Fail(ctx, "email:a@example.com")
+		if err != nil {
+			t.Fatalf("Fail() resulted in error: %v", err)
+		}
+		if wait != expected {
+			t.Fatalf("failure %d: expected wait %v got %v", i+1, expected, wait)
+		}
+	}
+
+	wait, err := limiter.RetryAfter(ctx, "email:b@example.com")
+	if err != nil {
+		t.Fatalf("RetryAfter() resulted in error: %v", err)
+	}
+	if wait != 0 {
+		t.Fatalf("unrelated key should not wait, got %v", wait)
+	}
+}
+
+func TestLimiterLockout(t *testing.T) {
+	ctx := context.Background()
+	limiter, now := newTestLimiter()
+	key := "email:a@example.com"
+
+	for i := 0; i < testPolicy.MaxFailures; i++ {
+		if _, err := limiter.Fail(ctx, key); err != nil {
+			t.Fatalf("Fail() resulted in error: %v", err)
+		}
+	}
+
+	wait, _ := limiter.RetryAfter(ctx, key)
+	if wait != testPolicy.Lockout {
+		t.Fatalf("expected lockout of %v got %v", testPolicy.Lockout, wait)
+	}
+
+	*now = now.Add(testPolicy.Lockout)
+	wait, _ = limiter.RetryAfter(ctx, key)
+	if wait != 0 {
+		t.Fatalf("expected lockout to expire, still waiting %v", wait)
+	}
+}
+
+func TestLimiterUnlock(t *testing.T) {
+	ctx := context.Background()
+	limiter, _ := newTestLimiter()
+	key := "email:a@example.com"
+
+	for i := 0; i < testPolicy.MaxFailures; i++ {
+		limiter.Fail(ctx, key)
+	}
+	if err := limiter.Unlock(ctx, key); err != nil {
+		t.Fatalf("Unlock() resulted in error: %v", err)
+	}
+
+	wait, _ := limiter.RetryAfter(ctx, key)
+	if wait != 0 {
+		t.Fatalf("expected no wait after unlock, got %v", wait)
+	}
+}
+
+func TestLimiterWindowForgetsOldFailures(t *testing.T) {
+	ctx := context.Background()
+	limiter, now := newTestLimiter()
+	key := "ip:192.0.2.1"
+
+	limiter.Fail(ctx, key)
+	limiter.Fail(ctx, key)
+
+	*now = now.Add(testPolicy.Window + time.Second)
+	wait, err := limiter.Fail(ctx, key)
+	if err != nil {
+		t.Fatalf("Fail() resulted in error: %v", err)
+	}
+	if wait != testPolicy.BaseDelay {
+		t.Fatalf("expected failure count to restart, got wait %v", wait)
+	}
+}
+
+func TestMemoryStoreSweepsStaleEntries(t *testing.T) {
+	ctx := context.Background()
+	limiter, now := newTestLimiter()
+	store := limiter.Store.(*MemoryStore)
+
+	limiter.Fail(ctx, "email:stale@example.com")
+	for range testPolicy.MaxFailures {
+		limiter.Fail(ctx, "email:locked@example.com")
+	}
+	store.Lock(ctx, "email:locked@example.com", now.Add(testPolicy.Window+time.Hour))
+
+	*now = now.Add(testPolicy.Window + time.Second)
+	limiter.Fail(ctx, "email:new@example.com")
+
+	if _, ok := store.entries["email:stale@example.com"]; ok {
+		t.Error("entry outside the window is still stored")
+	}
+	if _, ok := store.entries["email:locked@example.com"]; !ok {
+		t.Error("locked entry was swept")
+	}
+	if wait, _ := limiter.RetryAfter(ctx, "email:locked@example.com"); wait == 0 {
+		t.Error("locked key can retry after the sweep")
+	}
+}
+
+func TestLimiterReserveCountsParallelAttempts(t *testing.T) {
+	ctx := context.Background()
+	limiter, now := newTestLimiter()
+	// Without a backoff only the failure limit holds parallel attempts back.
+	limiter.Policy.BaseDelay = 0
+	key := "email:a@example.com"
+
+	var mu sync.Mutex
+	var reserved []*Reservation
+	var wg sync.WaitGroup
+	for range 3 * testPolicy.MaxFailures {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r, wait, err := limiter.Reserve(ctx, key)
+			if err != nil {
+				t.Errorf("Reserve() resulted in error: %v", err)
+				return
+			}
+			if r == nil && wait < time.Second {
+				t.Errorf("Reserve() refused an attempt with a wait of %v", wait)
+			}
+			if r != nil {
+				mu.Lock()
+				reserved = append(reserved, r)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(reserved) != testPolicy.MaxFailures {
+		t.Fatalf("expected %d attempts to be reserved got %d", testPolicy.MaxFailures, len(reserved))
+	}
+	for _, r := range reserved {
+		if _, err := r.Fail(ctx); err != nil {
+			t.Fatalf("Fail() resulted in error: %v", err)
+		}
+	}
+	if wait, _ := limiter.RetryAfter(ctx, key); wait != testPolicy.Lockout {
+		t.Fatalf("expected lockout of %v got %v", testPolicy.Lockout, wait)
+	}
+
+	*now = now.Add(testPolicy.Lockout)
+	if r, _, _ := limiter.Reserve(ctx, key); r == nil {
+		t.Fatal("expected an attempt to be reserved once the lockout expired")
+	}
+}
+
+func TestReservationRelease(t *testing.T) {
+	ctx := context.Background()
+	limiter, now := newTestLimiter()
+	store := limiter.Store.(*MemoryStore)
+	key := "ip:192.0.2.1"
+
+	limiter.Fail(ctx, key)
+	before := store.entries[key]
+
+	*now = now.Add(time.Minute)
+	r, _, err := limiter.Reserve(ctx, key)
+	if err != nil || r == nil {
+		t.Fatalf("Reserve() = %v, %v, want a reservation", r, err)
+	}
+	if err := r.Release(ctx); err != nil {
+		t.Fatalf("Release() resulted in error: %v", err)
+	}
+	if after := store.entries[key]; after != before {
+		t.Fatalf("expected releasing to restore %+v got %+v", before, after)
+	}
+}
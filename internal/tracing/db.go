@@ -0,0 +1,97 @@
+package tracing
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/drewheasman/chirpy/internal/database"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// The database systems WrapDB can label query spans with.
+var (
+	Postgres = semconv.DBSystemPostgreSQL
+	SQLite   = semconv.DBSystemSqlite
+)
+
+// DB is a database.DBTX that starts a span for every query, named after
+// the sqlc query that ran it.
+type DB struct {
+	db     database.DBTX
+	system attribute.KeyValue
+}
+
+// WrapDB traces the queries run on db, which can be a *sql.DB or a *sql.Tx,
+// labelling them with system, such as Postgres or SQLite.
+func WrapDB(db database.DBTX, system attribute.KeyValue) *DB {
+	return &DB{db: db, system: system}
+}
+
+func (d *DB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	ctx, span := d.startQuery(ctx, query)
+	result, err := d.db.ExecContext(ctx, query, args...)
+	endQuery(span, err)
+	return result, err
+}
+
+func (d *DB) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	ctx, span := d.startQuery(ctx, query)
+	stmt, err := d.db.PrepareContext(ctx, query)
+	endQuery(span, err)
+	return stmt, err
+}
+
+// QueryContext's span covers running the query but not reading the rows.
+func (d *DB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	ctx, span := d.startQuery(ctx, query)
+	rows, err := d.db.QueryContext(ctx, query, args...)
+	endQuery(span, err)
+	return rows, err
+}
+
+func (d *DB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	ctx, span := d.startQuery(ctx, query)
+	row := d.db.QueryRowContext(ctx, query, args...)
+	endQuery(span, row.Err())
+	return row
+}
+
+func (d *DB) startQuery(ctx context.Context, query string) (context.Context, trace.Span) {
+	name := queryName(query)
+	return Tracer().Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			d.system,
+			semconv.DBOperationName(name),
+			semconv.DBQueryText(query),
+		),
+	)
+}
+
+// endQuery records err on span, unless it is sql.ErrNoRows, which callers
+// expect often enough that it isn't a failure.
+func endQuery(span trace.Span, err error) {
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// queryName reads the name from the "-- name: GetUser :one" comment sqlc
+// puts at the start of each query.
+func queryName(query string) string {
+	rest, ok := strings.CutPrefix(query, "-- name: ")
+	if !ok {
+		return "query"
+	}
+	if name, _, ok := strings.Cut(rest, " "); ok {
+		return name
+	}
+	return "query"
+}
@@ -0,0 +1,147 @@
+package tracing
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func useRecorder(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	return recorder
+}
+
+func TestRequestContinuesTrace(t *testing.T) {
+	recorder := useRecorder(t)
+	if _, err := Setup(context.Background(), ExporterNone, "chirpy"); err != nil {
+		t.Fatalf("Setup() resulted in error: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/chirps/1", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	_, span := StartRequest(req)
+	EndRequest(span, "GET /api/chirps/{id}", http.StatusInternalServerError)
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("got %d spans, want 1", len(spans))
+	}
+	got := spans[0]
+	if got.Name() != "GET /api/chirps/{id}" {
+		t.Errorf("Name() = %q, want the route pattern", got.Name())
+	}
+	if got.SpanContext().TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("TraceID() = %s, want the one from traceparent", got.SpanContext().TraceID())
+	}
+	if got.Parent().SpanID().String() != "00f067aa0ba902b7" {
+		t.Errorf("Parent().SpanID() = %s, want the one from traceparent", got.Parent().SpanID())
+	}
+	if got.Status().Code != codes.Error {
+		t.Errorf("Status().Code = %v, want Error for a 500", got.Status().Code)
+	}
+}
+
+func TestSetupRejectsUnknownExporter(t *testing.T) {
+	if _, err := Setup(context.Background(), "zipkin", "chirpy"); err == nil {
+		t.Error("Setup(zipkin) succeeded, want error")
+	}
+}
+
+// fakeDB fails queries with err.
+type fakeDB struct {
+	err error
+}
+
+func (f fakeDB) ExecContext(context.Context, string, ...interface{}) (sql.Result, error) {
+	return nil, f.err
+}
+
+func (f fakeDB) PrepareContext(context.Context, string) (*sql.Stmt, error) {
+	return nil, f.err
+}
+
+func (f fakeDB) QueryContext(context.Context, string, ...interface{}) (*sql.Rows, error) {
+	return nil, f.err
+}
+
+func (f fakeDB) QueryRowContext(context.Context, string, ...interface{}) *sql.Row {
+	return nil
+}
+
+func TestWrapDB(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      string
+		err        error
+		wantName   string
+		wantStatus codes.Code
+	}{
+		{
+			name:     "named query",
+			query:    "-- name: DeleteChirp :exec\nDELETE FROM chirps WHERE id = $1",
+			wantName: "DeleteChirp",
+		},
+		{
+			name:       "failed query",
+			query:      "-- name: CreateUser :one\nINSERT INTO users",
+			err:        errors.New("connection refused"),
+			wantName:   "CreateUser",
+			wantStatus: codes.Error,
+		},
+		{
+			name:     "no rows is not a failure",
+			query:    "-- name: GetUser :one\nSELECT 1",
+			err:      sql.ErrNoRows,
+			wantName: "GetUser",
+		},
+		{
+			name:     "unnamed query",
+			query:    "SELECT 1",
+			wantName: "query",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := useRecorder(t)
+			db := WrapDB(fakeDB{err: tt.err}, SQLite)
+
+			ctx, parent := Tracer().Start(context.Background(), "request")
+			db.ExecContext(ctx, tt.query)
+			parent.End()
+
+			spans := recorder.Ended()
+			if len(spans) != 2 {
+				t.Fatalf("got %d spans, want 2", len(spans))
+			}
+			query := spans[0]
+			if query.Name() != tt.wantName {
+				t.Errorf("Name() = %q, want %q", query.Name(), tt.wantName)
+			}
+			if query.Parent().SpanID() != parent.SpanContext().SpanID() {
+				t.Error("query span is not a child of the request span")
+			}
+			if query.Status().Code != tt.wantStatus {
+				t.Errorf("Status().Code = %v, want %v", query.Status().Code, tt.wantStatus)
+			}
+			if !slices.Contains(query.Attributes(), SQLite) {
+				t.Errorf("Attributes() = %v, want them to include %v", query.Attributes(), SQLite)
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/drewheasman/chirpy/internal/auth"
+	"github.com/drewheasman/chirpy/internal/config"
+)
+
+const defaultJWTAudience = "chirpy-api"
+
+// newKeyring builds the JWT keyring. The signing algorithm defaults to
+// HS256 with the server secret; switching it to EdDSA or RS256 starts
+// signing with keys from the keys directory while HS256 tokens are still
+// accepted unless accept_hs256 is turned off.
+func newKeyring(c config.JWT) (*auth.Keyring, error) {
+	if c.SigningAlg != auth.AlgorithmHS256 && c.KeysDir == "" {
+		slog.Warn("jwt.keys_dir is not set, signing keys will not survive a restart")
+	}
+
+	return auth.NewKeyring(auth.KeyringConfig{
+		Algorithm:   c.SigningAlg,
+		Audience:    c.Audience,
+		HS256Secret: c.ServerSecret,
+		AcceptHS256: c.AcceptHS256,
+		Dir:         c.KeysDir,
+		Retain:      c.KeyRetain,
+	})
+}
+
+func (cfg *apiConfig) jwksHandler(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	respondWithJson(w, http.StatusOK, cfg.jwtKeys.JWKS())
+}
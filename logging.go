@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/drewheasman/chirpy/internal/config"
+	"github.com/drewheasman/chirpy/internal/logging"
+	"github.com/drewheasman/chirpy/internal/tracing"
+	"github.com/google/uuid"
+)
+
+const (
+	requestIDHeader    = "X-Request-ID"
+	requestIDMaxLength = 128
+)
+
+// newLogger installs the process logger. The config sets where it starts,
+// and PUT /admin/logging changes it later.
+func newLogger(c config.Log) (*logging.Settings, error) {
+	settings, err := logging.NewSettings(c.Level, c.Format)
+	if err != nil {
+		return nil, err
+	}
+	slog.SetDefault(logging.New(os.Stderr, settings))
+	return settings, nil
+}
+
+// responseRecorder remembers the status a handler responded with, and the
+// message respondWithError sent, for the request log.
+type responseRecorder struct {
+	http.ResponseWriter
+	status       int
+	errorMessage string
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *responseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// noteResponseError puts message in the request log line for w.
+func noteResponseError(w http.ResponseWriter, message string) {
+	if recorder, ok := w.(*responseRecorder); ok {
+		recorder.errorMessage = message
+	}
+}
+
+// validRequestID accepts IDs from a proxy in front of us as long as they
+// can't be used to forge log lines.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > requestIDMaxLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// middlewareObserveRequest gives each request an ID, echoed in X-Request-ID,
+// and a trace span, and logs and counts it once it has been handled. It must
+// wrap the ServeMux directly, so that the matched route pattern is set on the
+// request it passes on.
+func (cfg *apiConfig) middlewareObserveRequest(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+
+		id := req.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = uuid.NewString()
+		}
+		w.Header().Set(requestIDHeader, id)
+
+		ctx, span := tracing.StartRequest(req)
+		info := &logging.Request{ID: id}
+		req = req.WithContext(logging.NewContext(ctx, info))
+		recorder := &responseRecorder{ResponseWriter: w}
+
+		next.ServeHTTP(recorder, req)
+
+		status := recorder.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		latency := time.Since(start)
+		cfg.metrics.ObserveRequest(req.Pattern, status, latency)
+		tracing.EndRequest(span, req.Pattern, status)
+
+		attrs := []any{
+			"method", req.Method,
+			"route", req.Pattern,
+			"status", status,
+			"latency", latency,
+		}
+		if recorder.errorMessage != "" {
+			attrs = append(attrs, "error", recorder.errorMessage)
+		}
+
+		level := slog.LevelInfo
+		if status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		slog.Log(req.Context(), level, "request", attrs...)
+	})
+}
+
+// setRequestUserID adds the authenticated user to the request's log records.
+func setRequestUserID(req *http.Request, userID uuid.UUID) {
+	if info := logging.FromContext(req.Context()); info != nil {
+		info.SetUserID(userID.String())
+	}
+}
+
+type logSettings struct {
+	Level  string `json:"level"`
+	Format string `json:"format"`
+}
+
+func (cfg *apiConfig) getLoggingHandler(w http.ResponseWriter, req *http.Request) {
+	respondWithJson(w, http.StatusOK, logSettings{
+		Level:  cfg.logSettings.Level(),
+		Format: cfg.logSettings.Format(),
+	})
+}
+
+// updateLoggingHandler changes the log level and format without a restart.
+// Fields left empty are not changed.
+func (cfg *apiConfig) updateLoggingHandler(w http.ResponseWriter, req *http.Request) {
+	var decoded logSettings
+	if err := json.NewDecoder(req.Body).Decode(&decoded); err != nil {
+		respondWithError(w, http.StatusBadRequest, "error unmarshalling request body")
+		return
+	}
+
+	// Validate both before changing either.
+	if _, err := logging.NewSettings(decoded.Level, decoded.Format); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if decoded.Level != "" {
+		cfg.logSettings.SetLevel(decoded.Level)
+	}
+	if decoded.Format != "" {
+		cfg.logSettings.SetFormat(decoded.Format)
+	}
+	slog.InfoContext(req.Context(), "log settings updated", "level", cfg.logSettings.Level(), "format", cfg.logSettings.Format())
+
+	cfg.getLoggingHandler(w, req)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/drewheasman/chirpy/internal/logging"
+	"github.com/drewheasman/chirpy/internal/metrics"
+	"github.com/google/uuid"
+)
+
+func TestMiddlewareObserveRequest(t *testing.T) {
+	settings, err := logging.NewSettings("", "")
+	if err != nil {
+		t.Fatalf("NewSettings() resulted in error: %v", err)
+	}
+	var buf bytes.Buffer
+	defaultLogger := slog.Default()
+	slog.SetDefault(logging.New(&buf, settings))
+	t.Cleanup(func() { slog.SetDefault(defaultLogger) })
+
+	userID := uuid.New()
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/chirps/{id}", func(w http.ResponseWriter, req *http.Request) {
+		setRequestUserID(req, userID)
+		respondWithError(w, http.StatusNotFound, "chirp not found")
+	})
+	cfg := &apiConfig{metrics: metrics.New()}
+	handler := cfg.middlewareObserveRequest(mux)
+
+	tests := []struct {
+		name      string
+		requestID string
+		wantID    string
+	}{
+		{name: "propagates a valid id", requestID: "abc-123", wantID: "abc-123"},
+		{name: "replaces an invalid id", requestID: "bad\nid"},
+		{name: "generates a missing id"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf.Reset()
+			req := httptest.NewRequest(http.MethodGet, "/api/chirps/"+uuid.NewString(), nil)
+			req.Header.Set("Authorization", "Bearer secret")
+			if tt.requestID != "" {
+				req.Header.Set(requestIDHeader, tt.requestID)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			requestID := w.Header().Get(requestIDHeader)
+			if tt.wantID != "" && requestID != tt.wantID {
+				t.Errorf("%s = %q, want %q", requestIDHeader, requestID, tt.wantID)
+			}
+			if tt.wantID == "" && uuid.Validate(requestID) != nil {
+				t.Errorf("%s = %q, want a generated uuid", requestIDHeader, requestID)
+			}
+
+			var record map[string]any
+			if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+				t.Fatalf("json.Unmarshal() resulted in error: %v", err)
+			}
+			want := map[string]any{
+				"msg":        "request",
+				"method":     "GET",
+				"route":      "GET /api/chirps/{id}",
+				"status":     float64(http.StatusNotFound),
+				"error":      "chirp not found",
+				"request_id": requestID,
+				"user_id":    userID.String(),
+			}
+			for key, value := range want {
+				if record[key] != value {
+					t.Errorf("%s = %v, want %v", key, record[key], value)
+				}
+			}
+			if _, ok := record["latency"]; !ok {
+				t.Error("latency missing from request log")
+			}
+			if bytes.Contains(buf.Bytes(), []byte("secret")) {
+				t.Errorf("request log contains the bearer token: %s", buf.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/drewheasman/chirpy/internal/store"
+	"github.com/drewheasman/chirpy/internal/throttle"
+)
+
+var accountThrottlePolicy = throttle.Policy{
+	MaxFailures: 5,
+	BaseDelay:   time.Second,
+	MaxDelay:    30 * time.Second,
+	Lockout:     15 * time.Minute,
+	Window:      15 * time.Minute,
+}
+
+var ipThrottlePolicy = throttle.Policy{
+	MaxFailures: 50,
+	BaseDelay:   250 * time.Millisecond,
+	MaxDelay:    10 * time.Second,
+	Lockout:     15 * time.Minute,
+	Window:      15 * time.Minute,
+}
+
+// newLoginThrottleStore returns the store named by LOGIN_THROTTLE_STORE.
+// "postgres" shares attempts between instances, anything else keeps them in
+// memory.
+func newLoginThrottleStore(name string, attempts store.LoginAttempts) throttle.Store {
+	if name == "postgres" {
+		return throttle.NewPostgresStore(attempts)
+	}
+	return throttle.NewMemoryStore()
+}
+
+func accountThrottleKey(email string) string {
+	return "email:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipThrottleKey(ip string) string {
+	return "ip:" + ip
+}
+
+// clientIP uses the connection's remote address rather than X-Forwarded-For,
+// which any client can set.
+func clientIP(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
+
+// loginAttempt is a login attempt reserved with both the account and the IP
+// limiter. It counts as a failure until it ends, so that parallel attempts
+// can't all check the password before any of them has failed.
+type loginAttempt struct {
+	cfg     *apiConfig
+	email   string
+	account *throttle.Reservation
+	ip      *throttle.Reservation
+}
+
+// reserveLoginAttempt reserves an attempt to log in to email from ip. When
+// either limiter makes it wait, the attempt is nil. An attempt has to end in
+// fail or succeed; release, which can be deferred, ends it otherwise.
+func (cfg *apiConfig) reserveLoginAttempt(ctx context.Context, email, ip string) (*loginAttempt, time.Duration, error) {
+	account, wait, err := cfg.accountLimiter.Reserve(ctx, accountThrottleKey(email))
+	if err != nil || account == nil {
+		return nil, wait, err
+	}
+	ipReservation, wait, err := cfg.ipLimiter.Reserve(ctx, ipThrottleKey(ip))
+	if err != nil || ipReservation == nil {
+		if err := account.Release(ctx); err != nil {
+			slog.ErrorContext(ctx, "error releasing login attempt", "error", err)
+		}
+		return nil, wait, err
+	}
+
+	return &loginAttempt{cfg: cfg, email: email, account: account, ip: ipReservation}, 0, nil
+}
+
+func (a *loginAttempt) fail(ctx context.Context) {
+	if a.account == nil {
+		return
+	}
+	if _, err := a.account.Fail(ctx); err != nil {
+		slog.ErrorContext(ctx, "error recording login attempt", "error", err)
+	}
+	if _, err := a.ip.Fail(ctx); err != nil {
+		slog.ErrorContext(ctx, "error recording login attempt", "error", err)
+	}
+	a.account, a.ip = nil, nil
+}
+
+// succeed clears the account. The IP's history is left to expire so that
+// one valid account can't reset an attacker's counter.
+func (a *loginAttempt) succeed(ctx context.Context) {
+	if a.account == nil {
+		return
+	}
+	if err := a.cfg.accountLimiter.Succeed(ctx, accountThrottleKey(a.email)); err != nil {
+		slog.ErrorContext(ctx, "error recording login attempt", "error", err)
+	}
+	if err := a.ip.Release(ctx); err != nil {
+		slog.ErrorContext(ctx, "error recording login attempt", "error", err)
+	}
+	a.account, a.ip = nil, nil
+}
+
+// release ends an attempt that neither failed nor succeeded, such as one
+// that needs a second factor next. It does nothing once the attempt ended.
+func (a *loginAttempt) release(ctx context.Context) {
+	if a.account == nil {
+		return
+	}
+	if err := a.account.Release(ctx); err != nil {
+		slog.ErrorContext(ctx, "error releasing login attempt", "error", err)
+	}
+	if err := a.ip.Release(ctx); err != nil {
+		slog.ErrorContext(ctx, "error releasing login attempt", "error", err)
+	}
+	a.account, a.ip = nil, nil
+}
+
+func respondTooManyAttempts(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	respondWithError(w, http.StatusTooManyRequests, "too many login attempts, try again later")
+}
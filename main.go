@@ -1,13 +1,29 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"flag"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
-	"sync/atomic"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
-	"github.com/drewheasman/chirpy/internal/database"
+	"github.com/drewheasman/chirpy/internal/audit"
+	"github.com/drewheasman/chirpy/internal/auth"
+	"github.com/drewheasman/chirpy/internal/blob"
+	"github.com/drewheasman/chirpy/internal/config"
+	"github.com/drewheasman/chirpy/internal/logging"
+	"github.com/drewheasman/chirpy/internal/metrics"
+	"github.com/drewheasman/chirpy/internal/migrate"
+	"github.com/drewheasman/chirpy/internal/store"
+	"github.com/drewheasman/chirpy/internal/throttle"
+	"github.com/drewheasman/chirpy/internal/tracing"
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
 )
@@ -15,56 +31,307 @@ import (
 func main() {
 	godotenv.Load()
 
-	dbURL := os.Getenv("DB_URL")
-	db, err := sql.Open("postgres", dbURL)
+	// Flags on their own are for serve, which is also what runs without a
+	// command.
+	if len(os.Args) < 2 || strings.HasPrefix(os.Args[1], "-") {
+		os.Exit(runServeCommand(os.Args[1:]))
+	}
+	os.Exit(runCommand(os.Args[1], os.Args[2:]))
+}
+
+// runServeCommand runs the API until SIGINT or SIGTERM.
+func runServeCommand(args []string) int {
+	conf, err := config.Load(args, os.Getenv)
+	if errors.Is(err, flag.ErrHelp) {
+		fmt.Println(commandUsage)
+		fmt.Println("\nflags:")
+		config.Usage(os.Stdout)
+		return 0
+	}
+	if err == nil {
+		err = conf.ValidateServe()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, configError(err))
+		return 2
+	}
+
+	logSettings, err := newLogger(conf.Log)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	db, err := openDB(conf.Database)
 	if err != nil {
-		fmt.Println("error starting server")
+		slog.Error("error opening database", "error", err)
+		return 1
+	}
+	if err := prepareSchema(context.Background(), db, conf.Database.Driver, conf.Database.AutoMigrate); err != nil {
+		if errors.Is(err, migrate.ErrBehind) {
+			slog.Error("refusing to start, run chirpy migrate up or turn on database.auto_migrate", "error", err)
+		} else {
+			slog.Error("error migrating database", "error", err)
+		}
+		return 1
+	}
+
+	jwtKeys, err := newKeyring(conf.JWT)
+	if err != nil {
+		slog.Error("error loading JWT keys", "error", err)
+		return 1
+	}
+	var workers []backgroundWorker
+	if conf.JWT.RotateEvery > 0 {
+		workers = append(workers, func(ctx context.Context) error {
+			return jwtKeys.RunRotation(ctx, conf.JWT.RotateEvery)
+		})
+	}
+
+	shutdownTracing, err := tracing.Setup(context.Background(), conf.Tracing.Exporter, "chirpy")
+	if err != nil {
+		slog.Error("error setting up tracing", "error", err)
+		return 1
+	}
+
+	dataStore := newStore(conf.Database.Driver, db)
+
+	appMetrics := metrics.New()
+	if err := appMetrics.RegisterDB(db); err != nil {
+		slog.Error("error registering database metrics", "error", err)
+		return 1
+	}
+	loginThrottleStore := newLoginThrottleStore(conf.Accounts.LoginThrottleStore, dataStore)
+
+	if email := conf.Accounts.AdminEmail; email != "" {
+		if err := bootstrapAdmin(context.Background(), dataStore, email, conf.Accounts.AdminPassword); err != nil {
+			slog.Error("error bootstrapping admin", "error", err)
+			return 1
+		}
+	}
+
+	blobStore, exportSigner, err := newExportStorage(conf.Exports)
+	if err != nil {
+		slog.Error("error opening export storage", "error", err)
+		return 1
+	}
+
+	auditLog, err := newAuditLog(dataStore, conf.Audit)
+	if err != nil {
+		slog.Error("error creating audit log", "error", err)
+		return 1
 	}
 
 	config := &apiConfig{
-		dbQueries:    database.New(db),
-		serverSecret: os.Getenv("SERVER_SECRET"),
-		polkaKey:     os.Getenv("POLKA_KEY"),
+		platform:       conf.Platform,
+		features:       conf.Features,
+		logSettings:    logSettings,
+		metrics:        appMetrics,
+		db:             db,
+		dbDriver:       conf.Database.Driver,
+		store:          dataStore,
+		auditLog:       auditLog,
+		jwtKeys:        jwtKeys,
+		polkaKey:       conf.Polka.Key,
+		metricsToken:   conf.Metrics.Token,
+		accountLimiter: throttle.NewLimiter(loginThrottleStore, accountThrottlePolicy),
+		ipLimiter:      throttle.NewLimiter(loginThrottleStore, ipThrottlePolicy),
+
+		staticDir:       conf.Server.StaticDir,
+		accessTokenTTL:  conf.JWT.AccessTokenTTL,
+		refreshTokenTTL: conf.JWT.RefreshTokenTTL,
+
+		accountDeletionGrace: conf.Accounts.DeletionGrace,
+
+		blobStore:        blobStore,
+		exportSigner:     exportSigner,
+		dataExportQueued: make(chan struct{}, 1),
+
+		workers: newWorkerHealth(),
+		now:     time.Now,
 	}
 
-	serveMux := http.NewServeMux()
-	server := &http.Server{
-		Handler: serveMux,
-		Addr:    ":8080",
+	workers = append(workers, config.RunAccountDeletion)
+	if conf.Features.DataExports {
+		workers = append(workers, config.RunDataExports)
 	}
 
-	fileHandler := http.StripPrefix("/app/", http.FileServer(http.Dir(".")))
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		// Once shutdown starts, a second signal kills the process rather
+		// than waiting for it.
+		<-ctx.Done()
+		stop()
+	}()
+	serveErr := config.serve(ctx, conf.Server, workers)
+	if serveErr != nil {
+		slog.Error("error serving", "error", serveErr)
+	}
 
-	serveMux.Handle("/app/", config.middlewareMetricsIncrement(fileHandler))
+	flushCtx, cancel := context.WithTimeout(context.Background(), conf.Server.ShutdownTimeout)
+	defer cancel()
+	if err := shutdownTracing(flushCtx); err != nil {
+		slog.Error("error flushing traces", "error", err)
+	}
+	if err := db.Close(); err != nil {
+		slog.Error("error closing database", "error", err)
+	}
+	slog.Info("server stopped")
 
-	serveMux.HandleFunc("GET /admin/metrics", config.metricsHandler)
-	serveMux.HandleFunc("POST /admin/reset", config.resetHandler)
+	if serveErr != nil {
+		return 1
+	}
+	return 0
+}
 
-	serveMux.HandleFunc("GET /api/healthz", getHealthzHandler)
-	serveMux.HandleFunc("GET /api/chirps", config.getChirpsHandler)
-	serveMux.HandleFunc("GET /api/chirps/{id}", config.getChirpHandler)
-	serveMux.HandleFunc("DELETE /api/chirps/{id}", config.deleteChirpHandler)
-	serveMux.HandleFunc("POST /api/chirps", config.createChirpHandler)
-	serveMux.HandleFunc("POST /api/users", config.createUsersHandler)
-	serveMux.HandleFunc("PUT /api/users", config.updateUserHandler)
-	serveMux.HandleFunc("POST /api/login", config.loginHandler)
-	serveMux.HandleFunc("POST /api/refresh", config.refreshHandler)
-	serveMux.HandleFunc("POST /api/revoke", config.revokeHandler)
-	serveMux.HandleFunc("POST /api/polka/webhooks", config.polkaWebhooksHandler)
-
-	server.ListenAndServe()
+// configError lists every problem config.Load found, one per line.
+func configError(err error) error {
+	return fmt.Errorf("invalid configuration:\n  %s", strings.ReplaceAll(err.Error(), "\n", "\n  "))
+}
+
+// openDB opens the database with the configured driver and connection pool
+// limits.
+func openDB(c config.Database) (*sql.DB, error) {
+	var db *sql.DB
+	var err error
+	if c.Driver == "sqlite" {
+		db, err = store.OpenSQLite(c.URL)
+	} else {
+		db, err = sql.Open("postgres", c.URL)
+	}
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(c.MaxOpenConns)
+	db.SetMaxIdleConns(c.MaxIdleConns)
+	db.SetConnMaxLifetime(c.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(c.ConnMaxIdleTime)
+	return db, nil
+}
+
+// newStore returns the store for the configured driver.
+func newStore(driver string, db *sql.DB) store.Store {
+	if driver == "sqlite" {
+		return store.NewSQLite(db)
+	}
+	return store.NewPostgres(db)
 }
 
 type apiConfig struct {
-	dbQueries      *database.Queries
-	fileserverHits atomic.Int32
-	serverSecret   string
+	platform       string
+	features       config.Features
+	logSettings    *logging.Settings
+	db             *sql.DB
+	dbDriver       string
+	store          store.Store
+	auditLog       *audit.Log
+	metrics        *metrics.Metrics
+	jwtKeys        *auth.Keyring
 	polkaKey       string
+	metricsToken   string
+	accountLimiter *throttle.Limiter
+	ipLimiter      *throttle.Limiter
+
+	staticDir       string
+	accessTokenTTL  time.Duration
+	refreshTokenTTL time.Duration
+
+	accountDeletionGrace time.Duration
+
+	blobStore        blob.Store
+	exportSigner     *blob.Signer
+	dataExportQueued chan struct{}
+
+	workers *workerHealth
+
+	// now is the clock TOTP codes and two-factor challenges are checked
+	// against, fixed in tests.
+	now func() time.Time
+}
+
+func (cfg *apiConfig) routes() http.Handler {
+	serveMux := http.NewServeMux()
+
+	fileHandler := http.StripPrefix("/app/", http.FileServer(http.Dir(cfg.staticDir)))
+
+	serveMux.Handle("/app/", cfg.middlewareMetricsIncrement(fileHandler))
+
+	serveMux.Handle("GET /admin/metrics", cfg.RequireRole(auth.RoleModerator, cfg.metricsHandler))
+	serveMux.Handle("POST /admin/reset", cfg.requireDevPlatform(cfg.RequireRole(auth.RoleAdmin, cfg.resetHandler)))
+	serveMux.Handle("POST /admin/unlock", cfg.RequireRole(auth.RoleModerator, cfg.unlockHandler))
+	serveMux.Handle("GET /admin/users", cfg.RequireRole(auth.RoleModerator, cfg.listUsersHandler))
+	serveMux.Handle("GET /admin/users/{id}", cfg.RequireRole(auth.RoleModerator, cfg.getAdminUserHandler))
+	serveMux.Handle("POST /admin/users/{id}/suspend", cfg.RequireRole(auth.RoleModerator, cfg.suspendUserHandler))
+	serveMux.Handle("POST /admin/users/{id}/unsuspend", cfg.RequireRole(auth.RoleModerator, cfg.unsuspendUserHandler))
+	serveMux.Handle("PUT /admin/users/{id}/shadow-ban", cfg.RequireRole(auth.RoleModerator, cfg.setShadowBanHandler))
+	serveMux.Handle("POST /admin/users/{id}/revoke-sessions", cfg.RequireRole(auth.RoleModerator, cfg.revokeUserSessionsHandler))
+	serveMux.Handle("POST /admin/users/{id}/password-reset", cfg.RequireRole(auth.RoleAdmin, cfg.forcePasswordResetHandler))
+	serveMux.Handle("PUT /admin/users/{id}/chirpy-red", cfg.RequireRole(auth.RoleAdmin, cfg.setChirpyRedHandler))
+	serveMux.Handle("PUT /admin/users/{id}/role", cfg.RequireRole(auth.RoleAdmin, cfg.setUserRoleHandler))
+
+	serveMux.Handle("GET /admin/logging", cfg.RequireRole(auth.RoleAdmin, cfg.getLoggingHandler))
+	serveMux.Handle("PUT /admin/logging", cfg.RequireRole(auth.RoleAdmin, cfg.updateLoggingHandler))
+	serveMux.Handle("GET /admin/audit", cfg.RequireRole(auth.RoleAdmin, cfg.listAuditLogHandler))
+	serveMux.Handle("POST /admin/import", cfg.RequireRole(auth.RoleAdmin, cfg.importHandler))
+	serveMux.Handle("GET /admin/export", cfg.RequireRole(auth.RoleAdmin, cfg.exportHandler))
+
+	// Metrics name routes and count users, so scrapers need the metrics
+	// token. Without one configured the route isn't served.
+	if cfg.metricsToken != "" {
+		serveMux.Handle("GET /metrics", cfg.requireMetricsToken(cfg.metrics.Handler()))
+	}
+	serveMux.HandleFunc("GET /.well-known/jwks.json", cfg.jwksHandler)
+
+	serveMux.HandleFunc("GET /livez", livezHandler)
+	serveMux.HandleFunc("GET /readyz", cfg.readyzHandler)
+	serveMux.HandleFunc("GET /api/healthz", getHealthzHandler)
+	serveMux.Handle("GET /api/chirps", cfg.OptionalAuth(cfg.getChirpsHandler, auth.ScopeChirpsRead))
+	serveMux.Handle("GET /api/chirps/{id}", cfg.OptionalAuth(cfg.getChirpHandler, auth.ScopeChirpsRead))
+	serveMux.Handle("DELETE /api/chirps/{id}", cfg.RequireAuth(cfg.deleteChirpHandler, auth.ScopeChirpsWrite))
+	serveMux.Handle("POST /api/chirps", cfg.RequireAuth(cfg.createChirpHandler, auth.ScopeChirpsWrite))
+	serveMux.HandleFunc("POST /api/users", cfg.createUsersHandler)
+	serveMux.Handle("PUT /api/users", cfg.RequireAuth(cfg.updateUserHandler, auth.ScopeProfileWrite))
+	serveMux.Handle("DELETE /api/users/me", cfg.RequireFirstParty(cfg.deleteMeHandler))
+	serveMux.Handle("POST /api/users/me/2fa/setup", cfg.RequireFirstParty(cfg.setupTwoFactorHandler))
+	serveMux.Handle("POST /api/users/me/2fa/verify", cfg.RequireFirstParty(cfg.verifyTwoFactorHandler))
+	serveMux.Handle("POST /api/users/me/2fa/disable", cfg.RequireFirstParty(cfg.disableTwoFactorHandler))
+	serveMux.HandleFunc("POST /api/login", cfg.loginHandler)
+	serveMux.HandleFunc("POST /api/login/2fa", cfg.loginTwoFactorHandler)
+	serveMux.HandleFunc("POST /api/password/reset", cfg.resetPasswordHandler)
+	serveMux.HandleFunc("POST /api/refresh", cfg.refreshHandler)
+	serveMux.HandleFunc("POST /api/revoke", cfg.revokeHandler)
+	serveMux.Handle("POST /api/tokens", cfg.RequireFirstParty(cfg.createTokenHandler))
+	serveMux.Handle("GET /api/tokens", cfg.RequireFirstParty(cfg.getTokensHandler))
+	serveMux.Handle("DELETE /api/tokens/{id}", cfg.RequireFirstParty(cfg.deleteTokenHandler))
+	serveMux.Handle("GET /api/sessions", cfg.RequireFirstParty(cfg.getSessionsHandler))
+	serveMux.Handle("DELETE /api/sessions/{id}", cfg.RequireFirstParty(cfg.deleteSessionHandler))
+	serveMux.Handle("POST /api/sessions/revoke-all", cfg.RequireFirstParty(cfg.revokeAllSessionsHandler))
+
+	// Turning a feature off removes its routes, so they 404 like any other
+	// path that isn't served.
+	if cfg.features.DataExports {
+		serveMux.Handle("POST /api/users/me/export", cfg.RequireFirstParty(cfg.createDataExportHandler))
+		serveMux.Handle("GET /api/users/me/export/{id}", cfg.RequireFirstParty(cfg.getDataExportHandler))
+		serveMux.HandleFunc("GET /api/exports/{id}/download", cfg.downloadDataExportHandler)
+	}
+	if cfg.features.PolkaWebhooks {
+		serveMux.HandleFunc("POST /api/polka/webhooks", cfg.polkaWebhooksHandler)
+	}
+	if cfg.features.OAuth {
+		serveMux.Handle("POST /oauth/clients", cfg.RequireFirstParty(cfg.createOAuthClientHandler))
+		serveMux.HandleFunc("GET /oauth/authorize", cfg.getAuthorizeHandler)
+		serveMux.HandleFunc("POST /oauth/authorize", cfg.postAuthorizeHandler)
+		serveMux.HandleFunc("POST /oauth/token", cfg.tokenHandler)
+		serveMux.HandleFunc("POST /oauth/revoke", cfg.oauthRevokeHandler)
+		serveMux.HandleFunc("POST /oauth/introspect", cfg.introspectHandler)
+	}
+
+	return middlewareAuditRequest(cfg.middlewareObserveRequest(serveMux))
 }
 
 func (cfg *apiConfig) middlewareMetricsIncrement(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		cfg.fileserverHits.Add(1)
+		cfg.metrics.FileserverHit()
 		next.ServeHTTP(w, r)
 	})
 }
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/drewheasman/chirpy/internal/migrate"
+)
+
+const migrateUsage = "usage: chirpy migrate up|down|status|to VERSION"
+
+//go:embed sql/schema/*.sql sql/sqlite/schema/*.sql
+var schemaFS embed.FS
+
+// migrationsDir is where the migrations for driver are in schemaFS.
+func migrationsDir(driver string) string {
+	if driver == "sqlite" {
+		return "sql/sqlite/schema"
+	}
+	return "sql/schema"
+}
+
+// newMigrator returns a Migrator for the migrations built into the binary.
+func newMigrator(db *sql.DB, driver string) (*migrate.Migrator, error) {
+	migrations, err := fs.Sub(schemaFS, migrationsDir(driver))
+	if err != nil {
+		return nil, err
+	}
+	if driver == "sqlite" {
+		return migrate.NewSQLite(db, migrations)
+	}
+	return migrate.New(db, migrations)
+}
+
+// prepareSchema makes sure the database has every migration applied before
+// the server starts. With autoMigrate it applies them itself, otherwise it
+// refuses to run against a schema it wasn't built for.
+func prepareSchema(ctx context.Context, db *sql.DB, driver string, autoMigrate bool) error {
+	migrator, err := newMigrator(db, driver)
+	if err != nil {
+		return err
+	}
+	if !autoMigrate {
+		return migrator.Check(ctx)
+	}
+
+	results, err := migrator.Up(ctx)
+	for _, result := range results {
+		slog.InfoContext(ctx, "applied migration", "migration", path.Base(result.Source.Path), "duration", result.Duration)
+	}
+	return err
+}
+
+func runMigrateCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	var version int64
+	switch args[0] {
+	case "up", "down", "status":
+		if len(args) != 1 {
+			fmt.Fprintln(os.Stderr, migrateUsage)
+			return 2
+		}
+	case "to":
+		if len(args) != 2 {
+			fmt.Fprintln(os.Stderr, migrateUsage)
+			return 2
+		}
+		var err error
+		version, err = strconv.ParseInt(args[1], 10, 64)
+		if err != nil || version < 0 {
+			fmt.Fprintln(os.Stderr, "invalid version:", args[1])
+			return 2
+		}
+	default:
+		fmt.Fprintln(os.Stderr, "unknown migrate command:", args[0])
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	cfg, err := newCommandConfig()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer cfg.db.Close()
+
+	migrator, err := newMigrator(cfg.db, cfg.dbDriver)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	ctx := context.Background()
+	var results []*migrate.Result
+	switch args[0] {
+	case "up":
+		results, err = migrator.Up(ctx)
+	case "down":
+		var result *migrate.Result
+		result, err = migrator.Down(ctx)
+		if errors.Is(err, migrate.ErrNothingApplied) {
+			fmt.Println("no migrations to roll back")
+			return 0
+		}
+		if result != nil {
+			results = append(results, result)
+		}
+	case "to":
+		results, err = migrator.To(ctx, version)
+	case "status":
+		return printMigrationStatus(ctx, migrator)
+	}
+
+	for _, result := range results {
+		fmt.Println(result)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "migration failed:", err)
+		return 1
+	}
+	if len(results) == 0 {
+		fmt.Println("no migrations to apply")
+	}
+	return 0
+}
+
+func printMigrationStatus(ctx context.Context, migrator *migrate.Migrator) int {
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "MIGRATION\tSTATE\tAPPLIED AT")
+	for _, status := range statuses {
+		appliedAt := "-"
+		if !status.AppliedAt.IsZero() {
+			appliedAt = status.AppliedAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", path.Base(status.Source.Path), status.State, appliedAt)
+	}
+	if err := w.Flush(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,685 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/drewheasman/chirpy/internal/audit"
+	"github.com/drewheasman/chirpy/internal/auth"
+	"github.com/drewheasman/chirpy/internal/database"
+	"github.com/drewheasman/chirpy/internal/store"
+	"github.com/google/uuid"
+)
+
+const (
+	oauthCodeTTL        = 5 * time.Minute
+	oauthAccessTokenTTL = time.Hour
+	oauthClientIDPrefix = "chirpy_client_"
+)
+
+var errInvalidClient = errors.New("client authentication failed")
+
+var errInvalidScope = errors.New("scope exceeds the original grant")
+
+// oauthError is the error body defined by RFC 6749 section 5.2.
+type oauthError struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+func respondWithOAuthError(w http.ResponseWriter, statusCode int, code, description string) {
+	noteResponseError(w, code+": "+description)
+	w.Header().Set("Cache-Control", "no-store")
+	respondWithJson(w, statusCode, oauthError{Error: code, ErrorDescription: description})
+}
+
+type OAuthClient struct {
+	ClientID     string    `json:"client_id"`
+	ClientSecret string    `json:"client_secret,omitempty"`
+	Name         string    `json:"name"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	Scopes       []string  `json:"scopes"`
+	Confidential bool      `json:"confidential"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// validRedirectURI allows https URIs, and plain http only for loopback
+// addresses used by native apps. Fragments aren't allowed by RFC 6749.
+func validRedirectURI(raw string) bool {
+	parsed, err := url.Parse(raw)
+	if err != nil || !parsed.IsAbs() || parsed.Fragment != "" || parsed.Host == "" {
+		return false
+	}
+
+	switch parsed.Scheme {
+	case "https":
+		return true
+	case "http":
+		host := parsed.Hostname()
+		return host == "localhost" || host == "127.0.0.1" || host == "::1"
+	default:
+		return false
+	}
+}
+
+// parseScopes splits a space separated scope parameter. Every scope has to
+// be one the client registered for; an empty parameter asks for all of them.
+func parseScopes(raw string, allowed []string) ([]string, bool) {
+	requested := strings.Fields(raw)
+	if len(requested) == 0 {
+		return allowed, true
+	}
+
+	scopes := []string{}
+	for _, scope := range requested {
+		if !slices.Contains(allowed, scope) {
+			return nil, false
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes, true
+}
+
+func (cfg *apiConfig) createOAuthClientHandler(w http.ResponseWriter, req *http.Request) {
+	type createClientRequest struct {
+		Name         string   `json:"name"`
+		RedirectURIs []string `json:"redirect_uris"`
+		Scopes       []string `json:"scopes"`
+		Confidential bool     `json:"confidential"`
+	}
+
+	userId := requestPrincipal(req).UserID
+
+	decoder := json.NewDecoder(req.Body)
+	var decoded createClientRequest
+	if err := decoder.Decode(&decoded); err != nil || decoded.Name == "" || len(decoded.RedirectURIs) == 0 || len(decoded.Scopes) == 0 {
+		respondWithError(w, http.StatusBadRequest, "error unmarshalling request body")
+		return
+	}
+	for _, redirectURI := range decoded.RedirectURIs {
+		if !validRedirectURI(redirectURI) {
+			respondWithError(w, http.StatusBadRequest, "invalid redirect uri "+redirectURI)
+			return
+		}
+	}
+	for _, scope := range decoded.Scopes {
+		if !auth.ValidScope(scope) {
+			respondWithError(w, http.StatusBadRequest, "unknown scope "+scope)
+			return
+		}
+	}
+
+	randData := make([]byte, 16)
+	if _, err := rand.Read(randData); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "failed to make client id")
+		return
+	}
+	clientID := oauthClientIDPrefix + hex.EncodeToString(randData)
+
+	var clientSecret string
+	var secretHash sql.NullString
+	if decoded.Confidential {
+		var err error
+		clientSecret, err = auth.MakeRefreshToken()
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "failed to make client secret")
+			return
+		}
+		secretHash = sql.NullString{String: auth.HashToken(clientSecret), Valid: true}
+	}
+
+	clientRecord, err := cfg.store.CreateOAuthClient(req.Context(), database.CreateOAuthClientParams{
+		ID:           clientID,
+		OwnerID:      userId,
+		Name:         decoded.Name,
+		SecretHash:   secretHash,
+		RedirectUris: decoded.RedirectURIs,
+		Scopes:       decoded.Scopes,
+	})
+	if err != nil {
+		slog.ErrorContext(req.Context(), "failed to create client", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "failed to create client")
+		return
+	}
+
+	slog.InfoContext(req.Context(), "oauth client registered")
+
+	respondWithJson(w, http.StatusCreated, OAuthClient{
+		ClientID:     clientRecord.ID,
+		ClientSecret: clientSecret,
+		Name:         clientRecord.Name,
+		RedirectURIs: clientRecord.RedirectUris,
+		Scopes:       clientRecord.Scopes,
+		Confidential: clientRecord.SecretHash.Valid,
+		CreatedAt:    clientRecord.CreatedAt,
+	})
+}
+
+// authorizeRequest is a validated /oauth/authorize request.
+type authorizeRequest struct {
+	Client        database.OauthClient
+	RedirectURI   string
+	Scopes        []string
+	State         string
+	CodeChallenge string
+}
+
+// authorizeError is an error with an authorization request. Errors found
+// before the client and redirect URI are trusted are shown to the user;
+// anything later is sent back to the client's redirect URI.
+type authorizeError struct {
+	code        string
+	description string
+	redirect    bool
+}
+
+func (cfg *apiConfig) parseAuthorizeRequest(ctx context.Context, params url.Values) (authorizeRequest, *authorizeError) {
+	clientRecord, err := cfg.store.GetOAuthClient(ctx, params.Get("client_id"))
+	if err != nil {
+		return authorizeRequest{}, &authorizeError{code: "invalid_client", description: "unknown client"}
+	}
+
+	redirectURI := params.Get("redirect_uri")
+	if !slices.Contains(clientRecord.RedirectUris, redirectURI) {
+		return authorizeRequest{}, &authorizeError{code: "invalid_request", description: "redirect_uri is not registered for this client"}
+	}
+
+	authReq := authorizeRequest{
+		Client:        clientRecord,
+		RedirectURI:   redirectURI,
+		State:         params.Get("state"),
+		CodeChallenge: params.Get("code_challenge"),
+	}
+
+	if params.Get("response_type") != "code" {
+		return authReq, &authorizeError{code: "unsupported_response_type", description: "response_type must be code", redirect: true}
+	}
+	if authReq.CodeChallenge == "" || params.Get("code_challenge_method") != "S256" {
+		return authReq, &authorizeError{code: "invalid_request", description: "PKCE with code_challenge_method S256 is required", redirect: true}
+	}
+
+	scopes, ok := parseScopes(params.Get("scope"), clientRecord.Scopes)
+	if !ok {
+		return authReq, &authorizeError{code: "invalid_scope", description: "scope is not allowed for this client", redirect: true}
+	}
+	authReq.Scopes = scopes
+
+	return authReq, nil
+}
+
+func redirectToClient(w http.ResponseWriter, req *http.Request, redirectURI string, params url.Values) {
+	target, err := url.Parse(redirectURI)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "invalid redirect uri")
+		return
+	}
+
+	query := target.Query()
+	for key, values := range params {
+		for _, value := range values {
+			query.Add(key, value)
+		}
+	}
+	target.RawQuery = query.Encode()
+
+	http.Redirect(w, req, target.String(), http.StatusFound)
+}
+
+func respondWithAuthorizeError(w http.ResponseWriter, req *http.Request, authReq authorizeRequest, authErr *authorizeError) {
+	if !authErr.redirect {
+		respondWithOAuthError(w, http.StatusBadRequest, authErr.code, authErr.description)
+		return
+	}
+
+	params := url.Values{}
+	params.Set("error", authErr.code)
+	params.Set("error_description", authErr.description)
+	if authReq.State != "" {
+		params.Set("state", authReq.State)
+	}
+	redirectToClient(w, req, authReq.RedirectURI, params)
+}
+
+var consentTemplate = template.Must(template.New("consent").Parse(`
+<html>
+    <body>
+        <h1>Authorize {{.ClientName}}</h1>
+        <p>{{.ClientName}} would like to:</p>
+        <ul>
+            {{range .Scopes}}<li>{{.}}</li>{{end}}
+        </ul>
+        {{if .Error}}<p><strong>{{.Error}}</strong></p>{{end}}
+        <form method="post" action="/oauth/authorize">
+            {{range $key, $values := .Params}}{{range $values}}<input type="hidden" name="{{$key}}" value="{{.}}">
+            {{end}}{{end}}
+            <label>Email <input type="email" name="email" value="{{.Email}}"></label>
+            <label>Password <input type="password" name="password"></label>
+            <label>Two-factor code (if enabled) <input type="text" name="code" autocomplete="one-time-code"></label>
+            <button type="submit" name="action" value="approve">Allow</button>
+            <button type="submit" name="action" value="deny">Deny</button>
+        </form>
+    </body>
+</html>`))
+
+// authorizeParams are the request parameters carried through the consent
+// form.
+var authorizeParams = []string{"response_type", "client_id", "redirect_uri", "scope", "state", "code_challenge", "code_challenge_method"}
+
+func renderConsentPage(w http.ResponseWriter, statusCode int, authReq authorizeRequest, params url.Values, email, message string) {
+	hidden := url.Values{}
+	for _, key := range authorizeParams {
+		if value := params.Get(key); value != "" {
+			hidden.Set(key, value)
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "frame-ancestors 'none'")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(statusCode)
+
+	err := consentTemplate.Execute(w, struct {
+		ClientName string
+		Scopes     []string
+		Params     url.Values
+		Email      string
+		Error      string
+	}{
+		ClientName: authReq.Client.Name,
+		Scopes:     authReq.Scopes,
+		Params:     hidden,
+		Email:      email,
+		Error:      message,
+	})
+	if err != nil {
+		slog.Error("error rendering consent page", "error", err)
+	}
+}
+
+func (cfg *apiConfig) getAuthorizeHandler(w http.ResponseWriter, req *http.Request) {
+	params := req.URL.Query()
+	authReq, authErr := cfg.parseAuthorizeRequest(req.Context(), params)
+	if authErr != nil {
+		respondWithAuthorizeError(w, req, authReq, authErr)
+		return
+	}
+
+	renderConsentPage(w, http.StatusOK, authReq, params, "", "")
+}
+
+// postAuthorizeHandler handles the consent form. The user signs in on the
+// form itself, so the client never sees their password.
+func (cfg *apiConfig) postAuthorizeHandler(w http.ResponseWriter, req *http.Request) {
+	if err := req.ParseForm(); err != nil {
+		respondWithOAuthError(w, http.StatusBadRequest, "invalid_request", "malformed form body")
+		return
+	}
+	params := req.PostForm
+
+	authReq, authErr := cfg.parseAuthorizeRequest(req.Context(), params)
+	if authErr != nil {
+		respondWithAuthorizeError(w, req, authReq, authErr)
+		return
+	}
+
+	if params.Get("action") != "approve" {
+		respondWithAuthorizeError(w, req, authReq, &authorizeError{code: "access_denied", description: "the user denied the request", redirect: true})
+		return
+	}
+
+	email := params.Get("email")
+	attempt, _, err := cfg.reserveLoginAttempt(req.Context(), email, clientIP(req))
+	if err != nil {
+		slog.ErrorContext(req.Context(), "error checking login throttle", "error", err)
+		renderConsentPage(w, http.StatusInternalServerError, authReq, params, email, "Something went wrong, please try again.")
+		return
+	}
+	if attempt == nil {
+		renderConsentPage(w, http.StatusTooManyRequests, authReq, params, email, "Too many attempts, please try again later.")
+		return
+	}
+	defer attempt.release(context.WithoutCancel(req.Context()))
+
+	userRecord, err := cfg.store.GetUserByEmail(req.Context(), email)
+	if err == nil {
+		err = checkPasswordHash(req.Context(), params.Get("password"), userRecord.HashedPassword)
+	}
+	if err == nil && userRecord.TotpEnabled {
+		var valid bool
+		valid, err = cfg.useTOTPCode(req.Context(), userRecord, params.Get("code"))
+		if err == nil && !valid {
+			err = errors.New("invalid two-factor code")
+		}
+	}
+	if err != nil {
+		attempt.fail(req.Context())
+		cfg.recordFailedLogin(req.Context(), email, uuid.NullUUID{UUID: userRecord.ID, Valid: userRecord.ID != uuid.Nil}, loginMethodOAuth)
+		renderConsentPage(w, http.StatusUnauthorized, authReq, params, email, "Incorrect email, password or two-factor code.")
+		return
+	}
+	attempt.succeed(req.Context())
+	cfg.recordLogin(req.Context(), userRecord.ID, loginMethodOAuth)
+	if userRecord.SuspendedAt.Valid {
+		renderConsentPage(w, http.StatusForbidden, authReq, params, email, "Your Chirpy account is suspended.")
+		return
+	}
+	cfg.cancelAccountDeletion(req.Context(), userRecord)
+	if userRecord.PasswordResetRequired {
+		renderConsentPage(w, http.StatusForbidden, authReq, params, email, "You need to reset your password in Chirpy before signing in to other apps.")
+		return
+	}
+
+	code, err := auth.MakeRefreshToken()
+	if err != nil {
+		renderConsentPage(w, http.StatusInternalServerError, authReq, params, email, "Something went wrong, please try again.")
+		return
+	}
+	err = cfg.store.CreateOAuthAuthorizationCode(req.Context(), database.CreateOAuthAuthorizationCodeParams{
+		CodeHash:      auth.HashToken(code),
+		ClientID:      authReq.Client.ID,
+		UserID:        userRecord.ID,
+		RedirectUri:   authReq.RedirectURI,
+		Scopes:        authReq.Scopes,
+		CodeChallenge: authReq.CodeChallenge,
+		ExpiresAt:     time.Now().Add(oauthCodeTTL),
+	})
+	if err != nil {
+		slog.ErrorContext(req.Context(), "error creating authorization code", "error", err)
+		renderConsentPage(w, http.StatusInternalServerError, authReq, params, email, "Something went wrong, please try again.")
+		return
+	}
+
+	slog.InfoContext(req.Context(), "oauth authorization granted")
+
+	redirectParams := url.Values{}
+	redirectParams.Set("code", code)
+	if authReq.State != "" {
+		redirectParams.Set("state", authReq.State)
+	}
+	redirectToClient(w, req, authReq.RedirectURI, redirectParams)
+}
+
+// authenticateOAuthClient identifies the client from HTTP Basic credentials
+// or the client_id and client_secret form fields. Public clients have no
+// secret and rely on PKCE instead.
+func (cfg *apiConfig) authenticateOAuthClient(req *http.Request) (database.OauthClient, error) {
+	clientID, clientSecret, basic := req.BasicAuth()
+	if basic {
+		clientID, _ = url.QueryUnescape(clientID)
+		clientSecret, _ = url.QueryUnescape(clientSecret)
+	} else {
+		clientID = req.PostForm.Get("client_id")
+		clientSecret = req.PostForm.Get("client_secret")
+	}
+
+	clientRecord, err := cfg.store.GetOAuthClient(req.Context(), clientID)
+	if err != nil {
+		return database.OauthClient{}, errInvalidClient
+	}
+
+	if clientRecord.SecretHash.Valid {
+		secretHash := auth.HashToken(clientSecret)
+		if subtle.ConstantTimeCompare([]byte(secretHash), []byte(clientRecord.SecretHash.String)) != 1 {
+			return database.OauthClient{}, errInvalidClient
+		}
+	}
+
+	return clientRecord, nil
+}
+
+type oauthTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Scope        string `json:"scope"`
+}
+
+func (cfg *apiConfig) tokenHandler(w http.ResponseWriter, req *http.Request) {
+	if err := req.ParseForm(); err != nil {
+		respondWithOAuthError(w, http.StatusBadRequest, "invalid_request", "malformed form body")
+		return
+	}
+
+	clientRecord, err := cfg.authenticateOAuthClient(req)
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", `Basic realm="chirpy"`)
+		respondWithOAuthError(w, http.StatusUnauthorized, "invalid_client", err.Error())
+		return
+	}
+
+	var userId, sessionID uuid.UUID
+	var grantScopes, accessScopes []string
+	var deviceName, refreshToken string
+	issueRefreshToken := func(s store.Store) error {
+		metadata := sessionMetadataFromRequest(req, deviceName)
+		metadata.ClientID = clientRecord.ID
+		metadata.Scopes = grantScopes
+		var err error
+		refreshToken, err = cfg.createRefreshToken(req.Context(), s, userId, sessionID, metadata)
+		return err
+	}
+
+	switch req.PostForm.Get("grant_type") {
+	case "authorization_code":
+		codeRecord, err := cfg.store.ConsumeOAuthAuthorizationCode(req.Context(), auth.HashToken(req.PostForm.Get("code")))
+		if err != nil {
+			respondWithOAuthError(w, http.StatusBadRequest, "invalid_grant", "authorization code is invalid or expired")
+			return
+		}
+		if codeRecord.ClientID != clientRecord.ID || codeRecord.RedirectUri != req.PostForm.Get("redirect_uri") {
+			respondWithOAuthError(w, http.StatusBadRequest, "invalid_grant", "authorization code was issued to a different client or redirect_uri")
+			return
+		}
+		if !auth.VerifyPKCE(req.PostForm.Get("code_verifier"), codeRecord.CodeChallenge) {
+			respondWithOAuthError(w, http.StatusBadRequest, "invalid_grant", "code_verifier does not match the code_challenge")
+			return
+		}
+
+		userId = codeRecord.UserID
+		sessionID = uuid.New()
+		grantScopes = codeRecord.Scopes
+		accessScopes = codeRecord.Scopes
+		deviceName = clientRecord.Name
+		if err := issueRefreshToken(cfg.store); err != nil {
+			slog.ErrorContext(req.Context(), "error making refresh token", "error", err)
+			respondWithOAuthError(w, http.StatusInternalServerError, "server_error", "failed to make refresh token")
+			return
+		}
+
+	case "refresh_token":
+		_, err := cfg.rotateRefreshToken(req.Context(), req.PostForm.Get("refresh_token"), clientRecord.ID, func(tx store.Store, rotated database.RotateRefreshTokenRow) error {
+			// A client may ask for fewer scopes on a refresh, but never
+			// more than the user originally granted.
+			scopes, ok := parseScopes(req.PostForm.Get("scope"), rotated.Scopes)
+			if !ok {
+				return errInvalidScope
+			}
+
+			userId = rotated.UserID
+			sessionID = rotated.FamilyID
+			grantScopes = rotated.Scopes
+			accessScopes = scopes
+			deviceName = rotated.DeviceName
+			return issueRefreshToken(tx)
+		})
+		if errors.Is(err, errInvalidRefreshToken) {
+			respondWithOAuthError(w, http.StatusBadRequest, "invalid_grant", "refresh token is invalid, expired or revoked")
+			return
+		}
+		if errors.Is(err, errInvalidScope) {
+			respondWithOAuthError(w, http.StatusBadRequest, "invalid_scope", err.Error())
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(req.Context(), "error making refresh token", "error", err)
+			respondWithOAuthError(w, http.StatusInternalServerError, "server_error", "failed to make refresh token")
+			return
+		}
+
+	default:
+		respondWithOAuthError(w, http.StatusBadRequest, "unsupported_grant_type", "grant_type must be authorization_code or refresh_token")
+		return
+	}
+
+	status, err := cfg.store.GetUserStatus(req.Context(), userId)
+	if err != nil || status.SuspendedAt.Valid {
+		if sessionID != uuid.Nil {
+			if err := cfg.store.RevokeRefreshTokenFamily(req.Context(), sessionID); err != nil {
+				slog.ErrorContext(req.Context(), "error revoking refresh token family", "error", err)
+			}
+		}
+		respondWithOAuthError(w, http.StatusBadRequest, "invalid_grant", "the user's account is suspended or deleted")
+		return
+	}
+
+	accessToken, err := auth.MakeClientJWT(userId, sessionID, clientRecord.ID, accessScopes, cfg.jwtKeys, oauthAccessTokenTTL)
+	if err != nil {
+		slog.ErrorContext(req.Context(), "error making client JWT", "error", err)
+		respondWithOAuthError(w, http.StatusInternalServerError, "server_error", "failed to make access token")
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	respondWithJson(w, http.StatusOK, oauthTokenResponse{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(oauthAccessTokenTTL.Seconds()),
+		RefreshToken: refreshToken,
+		Scope:        strings.Join(accessScopes, " "),
+	})
+}
+
+// oauthRevokeHandler implements RFC 7009. Revoking either kind of token ends
+// the whole grant, and unknown tokens are not an error.
+func (cfg *apiConfig) oauthRevokeHandler(w http.ResponseWriter, req *http.Request) {
+	if err := req.ParseForm(); err != nil {
+		respondWithOAuthError(w, http.StatusBadRequest, "invalid_request", "malformed form body")
+		return
+	}
+
+	clientRecord, err := cfg.authenticateOAuthClient(req)
+	if err != nil {
+		respondWithOAuthError(w, http.StatusUnauthorized, "invalid_client", err.Error())
+		return
+	}
+
+	token := req.PostForm.Get("token")
+	var familyID, userID uuid.UUID
+	if refreshToken, err := cfg.store.GetRefreshToken(req.Context(), auth.HashToken(token)); err == nil {
+		if refreshToken.ClientID.String == clientRecord.ID {
+			familyID = refreshToken.FamilyID
+			userID = refreshToken.UserID
+		}
+	} else if claims, err := auth.ParseJWT(token, cfg.jwtKeys); err == nil && claims.ClientID == clientRecord.ID {
+		familyID, _ = claims.SessionUUID()
+		userID, _ = uuid.Parse(claims.Subject)
+	}
+
+	if familyID != uuid.Nil {
+		if err := cfg.store.RevokeRefreshTokenFamily(req.Context(), familyID); err != nil {
+			slog.ErrorContext(req.Context(), "error revoking refresh token family", "error", err)
+			respondWithOAuthError(w, http.StatusServiceUnavailable, "server_error", "failed to revoke token")
+			return
+		}
+		cfg.recordAudit(req.Context(), audit.Entry{
+			Action:       audit.ActionTokenRevoked,
+			TargetUserID: uuid.NullUUID{UUID: userID, Valid: userID != uuid.Nil},
+			TargetType:   audit.TargetSession,
+			TargetID:     familyID.String(),
+			Details:      map[string]any{"client_id": clientRecord.ID},
+		})
+		slog.InfoContext(req.Context(), "oauth grant revoked")
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+type introspectionResponse struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+	Issuer    string `json:"iss,omitempty"`
+	Audience  string `json:"aud,omitempty"`
+}
+
+// introspectHandler implements RFC 7662. Clients can only introspect tokens
+// that were issued to them.
+func (cfg *apiConfig) introspectHandler(w http.ResponseWriter, req *http.Request) {
+	if err := req.ParseForm(); err != nil {
+		respondWithOAuthError(w, http.StatusBadRequest, "invalid_request", "malformed form body")
+		return
+	}
+
+	clientRecord, err := cfg.authenticateOAuthClient(req)
+	if err != nil {
+		respondWithOAuthError(w, http.StatusUnauthorized, "invalid_client", err.Error())
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	token := req.PostForm.Get("token")
+
+	if claims, err := cfg.parseAccessToken(req.Context(), token); err == nil {
+		if claims.ClientID != clientRecord.ID {
+			respondWithJson(w, http.StatusOK, introspectionResponse{Active: false})
+			return
+		}
+		response := introspectionResponse{
+			Active:    true,
+			Scope:     claims.Scope,
+			ClientID:  claims.ClientID,
+			Subject:   claims.Subject,
+			TokenType: "access_token",
+			Issuer:    claims.Issuer,
+			Audience:  cfg.jwtKeys.Audience(),
+		}
+		if claims.ExpiresAt != nil {
+			response.ExpiresAt = claims.ExpiresAt.Unix()
+		}
+		if claims.IssuedAt != nil {
+			response.IssuedAt = claims.IssuedAt.Unix()
+		}
+		respondWithJson(w, http.StatusOK, response)
+		return
+	}
+
+	refreshToken, err := cfg.store.GetRefreshToken(req.Context(), auth.HashToken(token))
+	if err != nil ||
+		refreshToken.ClientID.String != clientRecord.ID ||
+		refreshToken.RevokedAt.Valid ||
+		refreshToken.RotatedAt.Valid ||
+		refreshToken.ExpiresAt.Before(time.Now()) {
+		respondWithJson(w, http.StatusOK, introspectionResponse{Active: false})
+		return
+	}
+
+	respondWithJson(w, http.StatusOK, introspectionResponse{
+		Active:    true,
+		Scope:     strings.Join(refreshToken.Scopes, " "),
+		ClientID:  clientRecord.ID,
+		Subject:   refreshToken.UserID.String(),
+		TokenType: "refresh_token",
+		ExpiresAt: refreshToken.ExpiresAt.Unix(),
+		IssuedAt:  refreshToken.CreatedAt.Unix(),
+	})
+}
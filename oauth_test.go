@@ -0,0 +1,357 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/drewheasman/chirpy/internal/audit"
+	"github.com/drewheasman/chirpy/internal/auth"
+	"github.com/drewheasman/chirpy/internal/blob"
+	"github.com/drewheasman/chirpy/internal/config"
+	"github.com/drewheasman/chirpy/internal/logging"
+	"github.com/drewheasman/chirpy/internal/metrics"
+	"github.com/drewheasman/chirpy/internal/store"
+	"github.com/drewheasman/chirpy/internal/throttle"
+	"github.com/google/uuid"
+	_ "github.com/lib/pq"
+)
+
+// newTestServer starts the API against the migrated database named by
+// CHIRPY_TEST_DB_URL, skipping the test when it isn't set.
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	dbURL := os.Getenv("CHIRPY_TEST_DB_URL")
+	if dbURL == "" {
+		t.Skip("CHIRPY_TEST_DB_URL is not set")
+	}
+	db, err := sql.Open("postgres", dbURL)
+	if err != nil {
+		t.Fatalf("sql.Open() resulted in error: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	cfg := newTestConfig(t, store.NewPostgres(db))
+	cfg.db = db
+
+	server := httptest.NewServer(cfg.routes())
+	t.Cleanup(server.Close)
+	return server
+}
+
+// newSQLiteTestServer starts the API against a freshly migrated SQLite
+// database file, so it runs everywhere too.
+func newSQLiteTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	db, err := openDB(config.Database{Driver: "sqlite", URL: filepath.Join(t.TempDir(), "chirpy.db")})
+	if err != nil {
+		t.Fatalf("openDB() resulted in error: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := prepareSchema(context.Background(), db, "sqlite", true); err != nil {
+		t.Fatalf("prepareSchema() resulted in error: %v", err)
+	}
+
+	cfg := newTestConfig(t, newStore("sqlite", db))
+	cfg.db = db
+	cfg.dbDriver = "sqlite"
+
+	server := httptest.NewServer(cfg.routes())
+	t.Cleanup(server.Close)
+	return server
+}
+
+// newMemoryTestServer starts the API against an empty in-memory store, so it
+// runs everywhere. The config is returned for tests that need to reach past
+// the API, such as to make an admin.
+func newMemoryTestServer(t *testing.T) (*httptest.Server, *apiConfig) {
+	t.Helper()
+
+	cfg := newTestConfig(t, store.NewMemory())
+	server := httptest.NewServer(cfg.routes())
+	t.Cleanup(server.Close)
+	return server, cfg
+}
+
+func newTestConfig(t *testing.T, dataStore store.Store) *apiConfig {
+	t.Helper()
+
+	jwtKeys := newTestKeyring(t, auth.KeyringConfig{
+		Algorithm: auth.AlgorithmEdDSA,
+		Audience:  defaultJWTAudience,
+	})
+	logSettings, err := logging.NewSettings("info", "text")
+	if err != nil {
+		t.Fatalf("NewSettings() resulted in error: %v", err)
+	}
+	blobStore, err := blob.NewFSStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFSStore() resulted in error: %v", err)
+	}
+
+	conf := config.Default()
+	throttleStore := throttle.NewMemoryStore()
+	return &apiConfig{
+		platform:       platformDev,
+		logSettings:    logSettings,
+		store:          dataStore,
+		auditLog:       audit.New(dataStore, []byte("test-audit-key")),
+		jwtKeys:        jwtKeys,
+		polkaKey:       "test-polka-key",
+		metricsToken:   "test-metrics-token",
+		accountLimiter: throttle.NewLimiter(throttleStore, accountThrottlePolicy),
+		ipLimiter:      throttle.NewLimiter(throttleStore, ipThrottlePolicy),
+		metrics:        metrics.New(),
+		workers:        newWorkerHealth(),
+		now:            time.Now,
+
+		features:        conf.Features,
+		staticDir:       t.TempDir(),
+		accessTokenTTL:  conf.JWT.AccessTokenTTL,
+		refreshTokenTTL: conf.JWT.RefreshTokenTTL,
+
+		accountDeletionGrace: conf.Accounts.DeletionGrace,
+
+		blobStore:        blobStore,
+		exportSigner:     blob.NewSigner([]byte("test")),
+		dataExportQueued: make(chan struct{}, 1),
+	}
+}
+
+func doJSON(t *testing.T, method, url, token string, body any, out any) *http.Response {
+	t.Helper()
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("json.Marshal() resulted in error: %v", err)
+	}
+	req, err := http.NewRequest(method, url, bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("http.NewRequest() resulted in error: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s resulted in error: %v", method, url, err)
+	}
+	defer resp.Body.Close()
+	if out != nil {
+		json.NewDecoder(resp.Body).Decode(out)
+	}
+	return resp
+}
+
+func postForm(t *testing.T, client *http.Client, url string, form url.Values, out any) *http.Response {
+	t.Helper()
+
+	resp, err := client.PostForm(url, form)
+	if err != nil {
+		t.Fatalf("POST %s resulted in error: %v", url, err)
+	}
+	defer resp.Body.Close()
+	if out != nil {
+		json.NewDecoder(resp.Body).Decode(out)
+	}
+	return resp
+}
+
+func TestOAuthAuthorizationCodeFlow(t *testing.T) {
+	t.Run("postgres", func(t *testing.T) {
+		testOAuthAuthorizationCodeFlow(t, newTestServer(t))
+	})
+	t.Run("sqlite", func(t *testing.T) {
+		testOAuthAuthorizationCodeFlow(t, newSQLiteTestServer(t))
+	})
+	t.Run("memory", func(t *testing.T) {
+		server, _ := newMemoryTestServer(t)
+		testOAuthAuthorizationCodeFlow(t, server)
+	})
+}
+
+// testOAuthAuthorizationCodeFlow walks a confidential client through every
+// /oauth route: registration, consent, the code and refresh grants,
+// introspection and revocation.
+func testOAuthAuthorizationCodeFlow(t *testing.T, server *httptest.Server) {
+	noRedirects := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+
+	email := "oauth-" + uuid.NewString() + "@example.com"
+	password := "correct horse battery staple"
+	doJSON(t, "POST", server.URL+"/api/users", "", map[string]string{"email": email, "password": password}, nil)
+
+	var login struct {
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	if resp := doJSON(t, "POST", server.URL+"/api/login", "", map[string]string{"email": email, "password": password}, &login); resp.StatusCode != http.StatusOK {
+		t.Fatalf("login: expected 200 got %d", resp.StatusCode)
+	}
+
+	redirectURI := "http://127.0.0.1:9999/callback"
+	var client OAuthClient
+	resp := doJSON(t, "POST", server.URL+"/oauth/clients", login.Token, map[string]any{
+		"name":          "Test client",
+		"redirect_uris": []string{redirectURI},
+		"scopes":        []string{auth.ScopeChirpsRead, auth.ScopeChirpsWrite},
+		"confidential":  true,
+	}, &client)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("register client: expected 201 got %d", resp.StatusCode)
+	}
+
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	authorizeParams := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {client.ClientID},
+		"redirect_uri":          {redirectURI},
+		"scope":                 {auth.ScopeChirpsWrite},
+		"state":                 {"xyz"},
+		"code_challenge":        {auth.PKCEChallengeS256(verifier)},
+		"code_challenge_method": {"S256"},
+	}
+
+	consent, err := http.Get(server.URL + "/oauth/authorize?" + authorizeParams.Encode())
+	if err != nil {
+		t.Fatalf("GET /oauth/authorize resulted in error: %v", err)
+	}
+	consent.Body.Close()
+	if consent.StatusCode != http.StatusOK {
+		t.Fatalf("consent page: expected 200 got %d", consent.StatusCode)
+	}
+
+	form := url.Values{}
+	for key, values := range authorizeParams {
+		form[key] = values
+	}
+	form.Set("email", email)
+	form.Set("password", password)
+	form.Set("action", "approve")
+	resp = postForm(t, noRedirects, server.URL+"/oauth/authorize", form, nil)
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("approve: expected 302 got %d", resp.StatusCode)
+	}
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatalf("url.Parse() resulted in error: %v", err)
+	}
+	if location.Query().Get("state") != "xyz" {
+		t.Fatalf("expected state to round trip, got %q", location.Query().Get("state"))
+	}
+	code := location.Query().Get("code")
+
+	tokenForm := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirectURI},
+		"code_verifier": {"wrong-verifier"},
+		"client_id":     {client.ClientID},
+		"client_secret": {client.ClientSecret},
+	}
+	var oauthErr oauthError
+	if resp := postForm(t, http.DefaultClient, server.URL+"/oauth/token", tokenForm, &oauthErr); resp.StatusCode != http.StatusBadRequest || oauthErr.Error != "invalid_grant" {
+		t.Fatalf("wrong verifier: expected invalid_grant got %d %q", resp.StatusCode, oauthErr.Error)
+	}
+
+	// The failed attempt consumed the code, so start over.
+	resp = postForm(t, noRedirects, server.URL+"/oauth/authorize", form, nil)
+	location, _ = url.Parse(resp.Header.Get("Location"))
+	tokenForm.Set("code", location.Query().Get("code"))
+	tokenForm.Set("code_verifier", verifier)
+
+	var tokens oauthTokenResponse
+	if resp := postForm(t, http.DefaultClient, server.URL+"/oauth/token", tokenForm, &tokens); resp.StatusCode != http.StatusOK {
+		t.Fatalf("code exchange: expected 200 got %d", resp.StatusCode)
+	}
+	if tokens.Scope != auth.ScopeChirpsWrite || tokens.TokenType != "Bearer" {
+		t.Fatalf("unexpected token response %+v", tokens)
+	}
+
+	if resp := doJSON(t, "POST", server.URL+"/api/chirps", tokens.AccessToken, map[string]string{"body": "posted through oauth"}, nil); resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create chirp: expected 201 got %d", resp.StatusCode)
+	}
+	if resp := doJSON(t, "PUT", server.URL+"/api/users", tokens.AccessToken, map[string]string{"email": email, "password": password}, nil); resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("update user without profile:write: expected 403 got %d", resp.StatusCode)
+	}
+	if resp := doJSON(t, "GET", server.URL+"/api/sessions", tokens.AccessToken, nil, nil); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("sessions with oauth token: expected 401 got %d", resp.StatusCode)
+	}
+
+	refreshForm := url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {tokens.RefreshToken},
+		"client_id":     {client.ClientID},
+		"client_secret": {client.ClientSecret},
+	}
+	var refreshed oauthTokenResponse
+	if resp := postForm(t, http.DefaultClient, server.URL+"/oauth/token", refreshForm, &refreshed); resp.StatusCode != http.StatusOK {
+		t.Fatalf("refresh: expected 200 got %d", resp.StatusCode)
+	}
+
+	// A rotated first-party token presented by the client is rejected
+	// without ending the first-party session.
+	var session User
+	if resp := doJSON(t, "POST", server.URL+"/api/refresh", login.RefreshToken, nil, &session); resp.StatusCode != http.StatusOK {
+		t.Fatalf("first-party refresh: expected 200 got %d", resp.StatusCode)
+	}
+	reuseForm := url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {login.RefreshToken},
+		"client_id":     {client.ClientID},
+		"client_secret": {client.ClientSecret},
+	}
+	if resp := postForm(t, http.DefaultClient, server.URL+"/oauth/token", reuseForm, &oauthErr); resp.StatusCode != http.StatusBadRequest || oauthErr.Error != "invalid_grant" {
+		t.Fatalf("first-party token through a client: expected invalid_grant got %d %q", resp.StatusCode, oauthErr.Error)
+	}
+	if resp := doJSON(t, "POST", server.URL+"/api/refresh", session.RefreshToken, nil, nil); resp.StatusCode != http.StatusOK {
+		t.Fatalf("first-party refresh after a client presented its old token: expected 200 got %d", resp.StatusCode)
+	}
+
+	var introspection introspectionResponse
+	introspectForm := url.Values{
+		"token":         {refreshed.AccessToken},
+		"client_id":     {client.ClientID},
+		"client_secret": {client.ClientSecret},
+	}
+	postForm(t, http.DefaultClient, server.URL+"/oauth/introspect", introspectForm, &introspection)
+	if !introspection.Active || introspection.ClientID != client.ClientID {
+		t.Fatalf("expected active token for %s, got %+v", client.ClientID, introspection)
+	}
+
+	// Presenting the rotated refresh token again revokes the grant.
+	if resp := postForm(t, http.DefaultClient, server.URL+"/oauth/token", refreshForm, &oauthErr); resp.StatusCode != http.StatusBadRequest || oauthErr.Error != "invalid_grant" {
+		t.Fatalf("refresh token reuse: expected invalid_grant got %d %q", resp.StatusCode, oauthErr.Error)
+	}
+	introspection = introspectionResponse{}
+	postForm(t, http.DefaultClient, server.URL+"/oauth/introspect", introspectForm, &introspection)
+	if introspection.Active {
+		t.Fatalf("expected access token to be inactive after reuse, got %+v", introspection)
+	}
+
+	revokeForm := url.Values{
+		"token":         {refreshed.RefreshToken},
+		"client_id":     {client.ClientID},
+		"client_secret": {client.ClientSecret},
+	}
+	if resp := postForm(t, http.DefaultClient, server.URL+"/oauth/revoke", revokeForm, nil); resp.StatusCode != http.StatusOK {
+		t.Fatalf("revoke: expected 200 got %d", resp.StatusCode)
+	}
+	if !strings.HasPrefix(client.ClientID, oauthClientIDPrefix) {
+		t.Fatalf("unexpected client id %q", client.ClientID)
+	}
+}
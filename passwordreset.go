@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/drewheasman/chirpy/internal/audit"
+	"github.com/drewheasman/chirpy/internal/auth"
+	"github.com/drewheasman/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const passwordResetTTL = 15 * time.Minute
+
+type passwordResetRequiredResponse struct {
+	Error                 string `json:"error"`
+	PasswordResetRequired bool   `json:"password_reset_required"`
+	ResetToken            string `json:"reset_token"`
+}
+
+// respondPasswordResetRequired stands in for the tokens at the end of a login
+// when an admin has forced a password reset. The user has already proven who
+// they are, so they get a short-lived token to set a new password with.
+func (cfg *apiConfig) respondPasswordResetRequired(w http.ResponseWriter, ctx context.Context, userID uuid.UUID) {
+	resetToken, err := auth.MakeRefreshToken()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to create password reset token")
+		return
+	}
+
+	err = cfg.store.CreatePasswordResetToken(ctx, database.CreatePasswordResetTokenParams{
+		TokenHash: auth.HashToken(resetToken),
+		UserID:    userID,
+		ExpiresAt: time.Now().Add(passwordResetTTL),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to create password reset token", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to create password reset token")
+		return
+	}
+
+	respondWithJson(w, http.StatusForbidden, passwordResetRequiredResponse{
+		Error:                 "password reset required",
+		PasswordResetRequired: true,
+		ResetToken:            resetToken,
+	})
+}
+
+func (cfg *apiConfig) resetPasswordHandler(w http.ResponseWriter, req *http.Request) {
+	type resetPasswordRequest struct {
+		ResetToken  string `json:"reset_token"`
+		NewPassword string `json:"new_password"`
+	}
+
+	decoder := json.NewDecoder(req.Body)
+	var decoded resetPasswordRequest
+	if err := decoder.Decode(&decoded); err != nil || decoded.ResetToken == "" || decoded.NewPassword == "" {
+		respondWithError(w, http.StatusBadRequest, "error unmarshalling request body")
+		return
+	}
+
+	userId, err := cfg.store.ConsumePasswordResetToken(req.Context(), database.ConsumePasswordResetTokenParams{
+		TokenHash: auth.HashToken(decoded.ResetToken),
+		ExpiresAt: time.Now(),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "invalid or expired reset token")
+		return
+	}
+
+	userRecord, err := cfg.store.GetUser(req.Context(), userId)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "invalid or expired reset token")
+		return
+	}
+	if checkPasswordHash(req.Context(), decoded.NewPassword, userRecord.HashedPassword) == nil {
+		respondWithError(w, http.StatusBadRequest, "new password must be different from the old one")
+		return
+	}
+
+	hashedPassword, err := hashPassword(req.Context(), decoded.NewPassword)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "failed to hash password")
+		return
+	}
+
+	err = cfg.store.ResetPassword(req.Context(), database.ResetPasswordParams{
+		ID:             userId,
+		HashedPassword: hashedPassword,
+	})
+	if err != nil {
+		slog.ErrorContext(req.Context(), "failed to reset password", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "failed to reset password")
+		return
+	}
+
+	cfg.recordAudit(req.Context(), audit.Entry{
+		Action:       audit.ActionPasswordChanged,
+		ActorID:      uuid.NullUUID{UUID: userId, Valid: true},
+		TargetUserID: uuid.NullUUID{UUID: userId, Valid: true},
+		Diff: audit.Compare(
+			map[string]any{"password_reset_required": userRecord.PasswordResetRequired},
+			map[string]any{"password_reset_required": false},
+		),
+		Details: map[string]any{"method": "reset_token"},
+	})
+	slog.InfoContext(req.Context(), "password reset")
+
+	respondNoContent(w, http.StatusNoContent)
+}
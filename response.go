@@ -2,12 +2,12 @@ package main
 
 import (
 	"encoding/json"
-	"fmt"
+	"log/slog"
 	"net/http"
 )
 
 func respondWithError(w http.ResponseWriter, statusCode int, message string) {
-	fmt.Println(message)
+	noteResponseError(w, message)
 
 	type error struct {
 		Error string `json:"error"`
@@ -15,7 +15,7 @@ func respondWithError(w http.ResponseWriter, statusCode int, message string) {
 
 	errorJsonString, err := json.Marshal(error{Error: message})
 	if err != nil {
-		fmt.Println("error marshalling error json")
+		slog.Error("error marshalling error json", "error", err)
 	}
 
 	w.WriteHeader(statusCode)
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/drewheasman/chirpy/internal/audit"
+	"github.com/drewheasman/chirpy/internal/auth"
+	"github.com/drewheasman/chirpy/internal/database"
+	"github.com/drewheasman/chirpy/internal/store"
+	"github.com/google/uuid"
+)
+
+const platformDev = "dev"
+
+// bootstrapAdmin makes sure there is an admin to log in with on a fresh
+// install. It does nothing once any admin exists, so ADMIN_EMAIL can stay
+// set without re-promoting the account after someone demotes it. The user is
+// created with password if it doesn't exist yet.
+func bootstrapAdmin(ctx context.Context, users store.Users, email, password string) error {
+	exists, err := users.AdminExists(ctx)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+
+	var userID uuid.UUID
+	userRecord, err := users.GetUserByEmail(ctx, email)
+	switch {
+	case err == nil:
+		userID = userRecord.ID
+	case errors.Is(err, sql.ErrNoRows):
+		if password == "" {
+			return fmt.Errorf("user %s does not exist and ADMIN_PASSWORD is not set", email)
+		}
+		hashedPassword, err := hashPassword(ctx, password)
+		if err != nil {
+			return err
+		}
+		created, err := users.CreateUser(ctx, database.CreateUserParams{
+			Email:          email,
+			HashedPassword: hashedPassword,
+		})
+		if err != nil {
+			return err
+		}
+		userID = created.ID
+	default:
+		return err
+	}
+
+	_, err = users.SetUserRole(ctx, database.SetUserRoleParams{
+		ID:   userID,
+		Role: auth.RoleAdmin,
+	})
+	if err != nil {
+		return err
+	}
+
+	slog.InfoContext(ctx, "bootstrapped admin", "user_id", userID)
+	return nil
+}
+
+// requireDevPlatform refuses destructive endpoints outside of a development
+// server, whoever is calling.
+func (cfg *apiConfig) requireDevPlatform(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if cfg.platform != platformDev {
+			respondWithError(w, http.StatusForbidden, "only allowed when PLATFORM=dev")
+			return
+		}
+
+		next.ServeHTTP(w, req)
+	})
+}
+
+func (cfg *apiConfig) setUserRoleHandler(w http.ResponseWriter, req *http.Request) {
+	type setRoleRequest struct {
+		Role string `json:"role"`
+	}
+
+	userId, err := uuid.Parse(req.PathValue("id"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "error parsing uuid from given id path param")
+		return
+	}
+
+	decoder := json.NewDecoder(req.Body)
+	var decoded setRoleRequest
+	if err := decoder.Decode(&decoded); err != nil || !auth.ValidRole(decoded.Role) {
+		respondWithError(w, http.StatusBadRequest, "role must be one of user, moderator or admin")
+		return
+	}
+
+	// Admins can't demote themselves, so there is always at least one left.
+	if userId == requestPrincipal(req).UserID && decoded.Role != auth.RoleAdmin {
+		respondWithError(w, http.StatusConflict, "admins can't remove their own admin role")
+		return
+	}
+
+	userRecord, err := cfg.store.GetUser(req.Context(), userId)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "user not found")
+		return
+	}
+
+	updated, err := cfg.store.SetUserRole(req.Context(), database.SetUserRoleParams{
+		ID:   userId,
+		Role: decoded.Role,
+	})
+	if err != nil {
+		slog.ErrorContext(req.Context(), "error updating role", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "error updating role")
+		return
+	}
+	if updated == 0 {
+		respondWithError(w, http.StatusNotFound, "user not found")
+		return
+	}
+
+	cfg.recordAdminAction(req, audit.ActionUserRoleChanged, userId, audit.Changed("role", userRecord.Role, decoded.Role), nil)
+	slog.InfoContext(req.Context(), "user role updated")
+
+	respondNoContent(w, http.StatusNoContent)
+}
@@ -0,0 +1,803 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/drewheasman/chirpy/internal/audit"
+	"github.com/drewheasman/chirpy/internal/auth"
+	"github.com/drewheasman/chirpy/internal/database"
+	"github.com/drewheasman/chirpy/internal/store"
+	"github.com/google/uuid"
+)
+
+// The tests in this file run every route against the in-memory store. The
+// /oauth routes are covered by TestOAuthAuthorizationCodeFlow.
+
+const testPassword = "correct horse battery staple"
+
+type testUser struct {
+	ID           uuid.UUID
+	Email        string
+	Token        string
+	RefreshToken string
+}
+
+// signUp creates a user through the API, gives it role and logs it in.
+func signUp(t *testing.T, serverURL string, cfg *apiConfig, role string) testUser {
+	t.Helper()
+
+	email := role + "-" + uuid.NewString() + "@example.com"
+	var created User
+	if resp := doJSON(t, "POST", serverURL+"/api/users", "", map[string]string{"email": email, "password": testPassword}, &created); resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create user: expected 201 got %d", resp.StatusCode)
+	}
+	if role != auth.RoleUser {
+		_, err := cfg.store.SetUserRole(context.Background(), database.SetUserRoleParams{ID: created.Id, Role: role})
+		if err != nil {
+			t.Fatalf("SetUserRole() resulted in error: %v", err)
+		}
+	}
+
+	var login User
+	if resp := doJSON(t, "POST", serverURL+"/api/login", "", map[string]string{"email": email, "password": testPassword}, &login); resp.StatusCode != http.StatusOK {
+		t.Fatalf("login: expected 200 got %d", resp.StatusCode)
+	}
+	return testUser{ID: created.Id, Email: email, Token: login.Token, RefreshToken: login.RefreshToken}
+}
+
+func decodeJSON(t *testing.T, data []byte, out any) {
+	t.Helper()
+
+	if err := json.Unmarshal(data, out); err != nil {
+		t.Fatalf("json.Unmarshal() resulted in error: %v: %s", err, data)
+	}
+}
+
+// doRaw sends a request with an arbitrary body and Authorization header and
+// returns the response body unparsed.
+func doRaw(t *testing.T, method, url, authorization string, body string) (*http.Response, []byte) {
+	t.Helper()
+
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("http.NewRequest() resulted in error: %v", err)
+	}
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s resulted in error: %v", method, url, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("reading %s %s resulted in error: %v", method, url, err)
+	}
+	return resp, data
+}
+
+func TestUserRoutes(t *testing.T) {
+	server, cfg := newMemoryTestServer(t)
+	user := signUp(t, server.URL, cfg, auth.RoleUser)
+	other := signUp(t, server.URL, cfg, auth.RoleUser)
+
+	t.Run("POST /api/users rejects a taken email", func(t *testing.T) {
+		resp := doJSON(t, "POST", server.URL+"/api/users", "", map[string]string{"email": user.Email, "password": testPassword}, nil)
+		if resp.StatusCode != http.StatusConflict {
+			t.Fatalf("expected 409 got %d", resp.StatusCode)
+		}
+	})
+
+	t.Run("POST /api/login rejects a wrong password", func(t *testing.T) {
+		resp := doJSON(t, "POST", server.URL+"/api/login", "", map[string]string{"email": user.Email, "password": "wrong"}, nil)
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Fatalf("expected 401 got %d", resp.StatusCode)
+		}
+	})
+
+	t.Run("PUT /api/users", func(t *testing.T) {
+		newEmail := "renamed-" + user.Email
+		var updated User
+		resp := doJSON(t, "PUT", server.URL+"/api/users", user.Token, map[string]string{"email": newEmail, "password": testPassword}, &updated)
+		if resp.StatusCode != http.StatusOK || updated.Email != newEmail {
+			t.Fatalf("expected 200 with %s got %d %+v", newEmail, resp.StatusCode, updated)
+		}
+
+		resp = doJSON(t, "PUT", server.URL+"/api/users", user.Token, map[string]string{"email": other.Email, "password": testPassword}, nil)
+		if resp.StatusCode != http.StatusConflict {
+			t.Fatalf("taking another user's email: expected 409 got %d", resp.StatusCode)
+		}
+	})
+
+	t.Run("POST /api/refresh", func(t *testing.T) {
+		var refreshed User
+		if resp := doJSON(t, "POST", server.URL+"/api/refresh", user.RefreshToken, nil, &refreshed); resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected 200 got %d", resp.StatusCode)
+		}
+		if refreshed.Token == "" || refreshed.RefreshToken == "" || refreshed.RefreshToken == user.RefreshToken {
+			t.Fatalf("expected new tokens, got %+v", refreshed)
+		}
+
+		// Reusing the rotated token ends the session it belonged to.
+		if resp := doJSON(t, "POST", server.URL+"/api/refresh", user.RefreshToken, nil, nil); resp.StatusCode != http.StatusUnauthorized {
+			t.Fatalf("reused refresh token: expected 401 got %d", resp.StatusCode)
+		}
+		if resp := doJSON(t, "POST", server.URL+"/api/refresh", refreshed.RefreshToken, nil, nil); resp.StatusCode != http.StatusUnauthorized {
+			t.Fatalf("refresh token from a revoked family: expected 401 got %d", resp.StatusCode)
+		}
+	})
+
+	t.Run("POST /api/revoke", func(t *testing.T) {
+		if resp := doJSON(t, "POST", server.URL+"/api/revoke", other.RefreshToken, nil, nil); resp.StatusCode != http.StatusNoContent {
+			t.Fatalf("expected 204 got %d", resp.StatusCode)
+		}
+		if resp := doJSON(t, "POST", server.URL+"/api/chirps", other.Token, map[string]string{"body": "after revoke"}, nil); resp.StatusCode != http.StatusUnauthorized {
+			t.Fatalf("access token of a revoked session: expected 401 got %d", resp.StatusCode)
+		}
+	})
+}
+
+// failingRefreshStore fails CreateRefreshToken while fail is set, the way a
+// dropped database connection would.
+type failingRefreshStore struct {
+	store.Store
+	fail *bool
+}
+
+func (s failingRefreshStore) InTx(ctx context.Context, fn func(store.Store) error) error {
+	return s.Store.InTx(ctx, func(tx store.Store) error {
+		return fn(failingRefreshStore{Store: tx, fail: s.fail})
+	})
+}
+
+func (s failingRefreshStore) CreateRefreshToken(ctx context.Context, arg database.CreateRefreshTokenParams) error {
+	if *s.fail {
+		return errors.New("connection reset")
+	}
+	return s.Store.CreateRefreshToken(ctx, arg)
+}
+
+func TestRefreshRetryAfterFailedInsert(t *testing.T) {
+	server, cfg := newMemoryTestServer(t)
+	user := signUp(t, server.URL, cfg, auth.RoleUser)
+
+	fail := true
+	cfg.store = failingRefreshStore{Store: cfg.store, fail: &fail}
+	if resp := doJSON(t, "POST", server.URL+"/api/refresh", user.RefreshToken, nil, nil); resp.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("refresh with a failing insert: expected 500 got %d", resp.StatusCode)
+	}
+
+	// The token was never rotated, so retrying it isn't taken for reuse.
+	fail = false
+	var refreshed User
+	if resp := doJSON(t, "POST", server.URL+"/api/refresh", user.RefreshToken, nil, &refreshed); resp.StatusCode != http.StatusOK {
+		t.Fatalf("retried refresh: expected 200 got %d", resp.StatusCode)
+	}
+	if resp := doJSON(t, "POST", server.URL+"/api/refresh", refreshed.RefreshToken, nil, nil); resp.StatusCode != http.StatusOK {
+		t.Fatalf("refresh with the retried token: expected 200 got %d", resp.StatusCode)
+	}
+}
+
+func TestLoginThrottleParallel(t *testing.T) {
+	server, cfg := newMemoryTestServer(t)
+	user := signUp(t, server.URL, cfg, auth.RoleUser)
+	// Without a backoff only the failure limit holds parallel attempts back.
+	cfg.accountLimiter.Policy.BaseDelay = 0
+	cfg.ipLimiter.Policy.BaseDelay = 0
+
+	attempts := 4 * accountThrottlePolicy.MaxFailures
+	statuses := make(chan int, attempts)
+	var wg sync.WaitGroup
+	for range attempts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, _ := doRaw(t, "POST", server.URL+"/api/login", "", `{"email":"`+user.Email+`","password":"wrong"}`)
+			statuses <- resp.StatusCode
+		}()
+	}
+	wg.Wait()
+	close(statuses)
+
+	counts := map[int]int{}
+	for status := range statuses {
+		counts[status]++
+	}
+	if counts[http.StatusUnauthorized] != accountThrottlePolicy.MaxFailures || counts[http.StatusTooManyRequests] != attempts-accountThrottlePolicy.MaxFailures {
+		t.Fatalf("expected %d wrong passwords to be checked and the rest refused, got %v", accountThrottlePolicy.MaxFailures, counts)
+	}
+	if resp := doJSON(t, "POST", server.URL+"/api/login", "", map[string]string{"email": user.Email, "password": testPassword}, nil); resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("right password once locked out: expected 429 got %d", resp.StatusCode)
+	}
+}
+
+func TestChirpRoutes(t *testing.T) {
+	server, cfg := newMemoryTestServer(t)
+	author := signUp(t, server.URL, cfg, auth.RoleUser)
+	other := signUp(t, server.URL, cfg, auth.RoleUser)
+
+	var chirp Chirp
+	resp := doJSON(t, "POST", server.URL+"/api/chirps", author.Token, map[string]string{"body": "what a kerfuffle"}, &chirp)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("POST /api/chirps: expected 201 got %d", resp.StatusCode)
+	}
+	if chirp.Body != "what a ****" || chirp.UserID != author.ID {
+		t.Fatalf("unexpected chirp %+v", chirp)
+	}
+	doJSON(t, "POST", server.URL+"/api/chirps", other.Token, map[string]string{"body": "someone else"}, nil)
+
+	var chirps []Chirp
+	if resp := doJSON(t, "GET", server.URL+"/api/chirps?author_id="+author.ID.String(), "", nil, &chirps); resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /api/chirps: expected 200 got %d", resp.StatusCode)
+	}
+	if len(chirps) != 1 || chirps[0].ID != chirp.ID {
+		t.Fatalf("expected only %s, got %+v", chirp.ID, chirps)
+	}
+	chirps = nil
+	doJSON(t, "GET", server.URL+"/api/chirps?sort=desc", "", nil, &chirps)
+	if len(chirps) != 2 {
+		t.Fatalf("expected 2 chirps, got %d", len(chirps))
+	}
+
+	var fetched Chirp
+	if resp := doJSON(t, "GET", server.URL+"/api/chirps/"+chirp.ID.String(), "", nil, &fetched); resp.StatusCode != http.StatusOK || fetched.ID != chirp.ID {
+		t.Fatalf("GET /api/chirps/{id}: expected 200 with %s got %d %+v", chirp.ID, resp.StatusCode, fetched)
+	}
+
+	if resp := doJSON(t, "DELETE", server.URL+"/api/chirps/"+chirp.ID.String(), other.Token, nil, nil); resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("DELETE another user's chirp: expected 403 got %d", resp.StatusCode)
+	}
+	if resp := doJSON(t, "DELETE", server.URL+"/api/chirps/"+chirp.ID.String(), author.Token, nil, nil); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("DELETE /api/chirps/{id}: expected 204 got %d", resp.StatusCode)
+	}
+	if resp := doJSON(t, "GET", server.URL+"/api/chirps/"+chirp.ID.String(), "", nil, nil); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("GET a deleted chirp: expected 404 got %d", resp.StatusCode)
+	}
+}
+
+func TestTwoFactorRoutes(t *testing.T) {
+	server, cfg := newMemoryTestServer(t)
+	user := signUp(t, server.URL, cfg, auth.RoleUser)
+
+	// The login throttle shares the clock, so moving it on also lets the
+	// next attempt through after a failure.
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	cfg.now, cfg.accountLimiter.Now, cfg.ipLimiter.Now = clock, clock, clock
+
+	var setup struct {
+		Secret string `json:"secret"`
+	}
+	if resp := doJSON(t, "POST", server.URL+"/api/users/me/2fa/setup", user.Token, nil, &setup); resp.StatusCode != http.StatusOK {
+		t.Fatalf("setup: expected 200 got %d", resp.StatusCode)
+	}
+	code, err := auth.TOTPCode(setup.Secret, now)
+	if err != nil {
+		t.Fatalf("TOTPCode() resulted in error: %v", err)
+	}
+	var verified struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	if resp := doJSON(t, "POST", server.URL+"/api/users/me/2fa/verify", user.Token, map[string]string{"code": code}, &verified); resp.StatusCode != http.StatusOK {
+		t.Fatalf("verify: expected 200 got %d", resp.StatusCode)
+	}
+	if len(verified.RecoveryCodes) == 0 {
+		t.Fatal("verify: expected recovery codes")
+	}
+
+	var challenge twoFactorChallengeResponse
+	doJSON(t, "POST", server.URL+"/api/login", "", map[string]string{"email": user.Email, "password": testPassword}, &challenge)
+	if !challenge.TwoFactorRequired || challenge.ChallengeToken == "" {
+		t.Fatalf("login: expected a two-factor challenge, got %+v", challenge)
+	}
+	replay := map[string]string{"challenge_token": challenge.ChallengeToken, "code": code}
+	if resp := doJSON(t, "POST", server.URL+"/api/login/2fa", "", replay, nil); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("login/2fa with the code used to verify: expected 401 got %d", resp.StatusCode)
+	}
+
+	now = now.Add(30 * time.Second)
+	next, err := auth.TOTPCode(setup.Secret, now)
+	if err != nil {
+		t.Fatalf("TOTPCode() resulted in error: %v", err)
+	}
+	if resp := doJSON(t, "POST", server.URL+"/api/login/2fa", "", map[string]string{"challenge_token": challenge.ChallengeToken, "code": next}, nil); resp.StatusCode != http.StatusOK {
+		t.Fatalf("login/2fa with the next code: expected 200 got %d", resp.StatusCode)
+	}
+
+	doJSON(t, "POST", server.URL+"/api/login", "", map[string]string{"email": user.Email, "password": testPassword}, &challenge)
+	now = now.Add(twoFactorChallengeTTL + time.Second)
+	late, err := auth.TOTPCode(setup.Secret, now)
+	if err != nil {
+		t.Fatalf("TOTPCode() resulted in error: %v", err)
+	}
+	if resp := doJSON(t, "POST", server.URL+"/api/login/2fa", "", map[string]string{"challenge_token": challenge.ChallengeToken, "code": late}, nil); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("login/2fa with an expired challenge: expected 401 got %d", resp.StatusCode)
+	}
+
+	now = now.Add(30 * time.Second)
+	doJSON(t, "POST", server.URL+"/api/login", "", map[string]string{"email": user.Email, "password": testPassword}, &challenge)
+	var login User
+	resp := doJSON(t, "POST", server.URL+"/api/login/2fa", "", map[string]string{
+		"challenge_token": challenge.ChallengeToken,
+		"recovery_code":   verified.RecoveryCodes[0],
+	}, &login)
+	if resp.StatusCode != http.StatusOK || login.Token == "" {
+		t.Fatalf("login/2fa: expected 200 with a token got %d", resp.StatusCode)
+	}
+
+	if resp := doJSON(t, "POST", server.URL+"/api/users/me/2fa/disable", login.Token, map[string]string{"password": testPassword}, nil); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("disable: expected 204 got %d", resp.StatusCode)
+	}
+	var plain User
+	if resp := doJSON(t, "POST", server.URL+"/api/login", "", map[string]string{"email": user.Email, "password": testPassword}, &plain); resp.StatusCode != http.StatusOK || plain.Token == "" {
+		t.Fatalf("login after disabling: expected 200 with a token got %d", resp.StatusCode)
+	}
+}
+
+func TestTokenAndSessionRoutes(t *testing.T) {
+	server, cfg := newMemoryTestServer(t)
+	user := signUp(t, server.URL, cfg, auth.RoleUser)
+
+	var token PersonalAccessToken
+	resp := doJSON(t, "POST", server.URL+"/api/tokens", user.Token, map[string]any{
+		"name":   "ci",
+		"scopes": []string{auth.ScopeChirpsWrite},
+	}, &token)
+	if resp.StatusCode != http.StatusCreated || token.Token == "" {
+		t.Fatalf("POST /api/tokens: expected 201 with a token got %d", resp.StatusCode)
+	}
+	if resp := doJSON(t, "POST", server.URL+"/api/chirps", token.Token, map[string]string{"body": "from ci"}, nil); resp.StatusCode != http.StatusCreated {
+		t.Fatalf("chirp with a personal access token: expected 201 got %d", resp.StatusCode)
+	}
+	if resp := doJSON(t, "GET", server.URL+"/api/chirps", token.Token, nil, nil); resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("GET /api/chirps with a token missing chirps:read: expected 403 got %d", resp.StatusCode)
+	}
+	if resp := doJSON(t, "GET", server.URL+"/api/chirps", "", nil, nil); resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /api/chirps without a token: expected 200 got %d", resp.StatusCode)
+	}
+
+	var tokens []PersonalAccessToken
+	if resp := doJSON(t, "GET", server.URL+"/api/tokens", user.Token, nil, &tokens); resp.StatusCode != http.StatusOK || len(tokens) != 1 || tokens[0].ID != token.ID {
+		t.Fatalf("GET /api/tokens: expected 200 with %s got %d %+v", token.ID, resp.StatusCode, tokens)
+	}
+	if resp := doJSON(t, "DELETE", server.URL+"/api/tokens/"+token.ID.String(), user.Token, nil, nil); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("DELETE /api/tokens/{id}: expected 204 got %d", resp.StatusCode)
+	}
+	if resp := doJSON(t, "POST", server.URL+"/api/chirps", token.Token, map[string]string{"body": "from ci"}, nil); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("chirp with a deleted token: expected 401 got %d", resp.StatusCode)
+	}
+
+	second := logIn(t, server.URL, user.Email)
+	var sessions []Session
+	if resp := doJSON(t, "GET", server.URL+"/api/sessions", user.Token, nil, &sessions); resp.StatusCode != http.StatusOK || len(sessions) != 2 {
+		t.Fatalf("GET /api/sessions: expected 200 with 2 sessions got %d %+v", resp.StatusCode, sessions)
+	}
+	for _, s := range sessions {
+		if s.Current {
+			continue
+		}
+		if resp := doJSON(t, "DELETE", server.URL+"/api/sessions/"+s.ID.String(), user.Token, nil, nil); resp.StatusCode != http.StatusNoContent {
+			t.Fatalf("DELETE /api/sessions/{id}: expected 204 got %d", resp.StatusCode)
+		}
+	}
+	if resp := doJSON(t, "GET", server.URL+"/api/sessions", second.Token, nil, nil); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("access token of a deleted session: expected 401 got %d", resp.StatusCode)
+	}
+
+	if resp := doJSON(t, "POST", server.URL+"/api/sessions/revoke-all", user.Token, nil, nil); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("POST /api/sessions/revoke-all: expected 204 got %d", resp.StatusCode)
+	}
+	if resp := doJSON(t, "GET", server.URL+"/api/sessions", user.Token, nil, nil); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("access token after revoke-all: expected 401 got %d", resp.StatusCode)
+	}
+}
+
+// logIn starts another session for an existing user.
+func logIn(t *testing.T, serverURL, email string) User {
+	t.Helper()
+
+	var login User
+	if resp := doJSON(t, "POST", serverURL+"/api/login", "", map[string]string{"email": email, "password": testPassword}, &login); resp.StatusCode != http.StatusOK {
+		t.Fatalf("login: expected 200 got %d", resp.StatusCode)
+	}
+	return login
+}
+
+func TestPasswordResetRoute(t *testing.T) {
+	server, cfg := newMemoryTestServer(t)
+	admin := signUp(t, server.URL, cfg, auth.RoleAdmin)
+	user := signUp(t, server.URL, cfg, auth.RoleUser)
+
+	if resp := doJSON(t, "POST", server.URL+"/admin/users/"+user.ID.String()+"/password-reset", admin.Token, nil, nil); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("force reset: expected 204 got %d", resp.StatusCode)
+	}
+
+	var required passwordResetRequiredResponse
+	if resp := doJSON(t, "POST", server.URL+"/api/login", "", map[string]string{"email": user.Email, "password": testPassword}, &required); resp.StatusCode != http.StatusForbidden || required.ResetToken == "" {
+		t.Fatalf("login: expected 403 with a reset token got %d %+v", resp.StatusCode, required)
+	}
+
+	newPassword := "a much better password"
+	resp := doJSON(t, "POST", server.URL+"/api/password/reset", "", map[string]string{"reset_token": required.ResetToken, "new_password": newPassword}, nil)
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("POST /api/password/reset: expected 204 got %d", resp.StatusCode)
+	}
+	if resp := doJSON(t, "POST", server.URL+"/api/password/reset", "", map[string]string{"reset_token": required.ResetToken, "new_password": newPassword}, nil); resp.StatusCode == http.StatusNoContent {
+		t.Fatal("reusing a reset token: expected an error")
+	}
+	if resp := doJSON(t, "POST", server.URL+"/api/login", "", map[string]string{"email": user.Email, "password": newPassword}, nil); resp.StatusCode != http.StatusOK {
+		t.Fatalf("login with the new password: expected 200 got %d", resp.StatusCode)
+	}
+}
+
+func TestDeleteMeRoute(t *testing.T) {
+	server, cfg := newMemoryTestServer(t)
+	user := signUp(t, server.URL, cfg, auth.RoleUser)
+
+	if resp := doJSON(t, "DELETE", server.URL+"/api/users/me", user.Token, map[string]string{"password": "wrong"}, nil); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("wrong password: expected 401 got %d", resp.StatusCode)
+	}
+	if resp := doJSON(t, "DELETE", server.URL+"/api/users/me", user.Token, map[string]string{"password": testPassword}, nil); resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("DELETE /api/users/me: expected 202 got %d", resp.StatusCode)
+	}
+	if resp := doJSON(t, "POST", server.URL+"/api/refresh", user.RefreshToken, nil, nil); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("refresh after scheduling deletion: expected 401 got %d", resp.StatusCode)
+	}
+
+	// Logging back in during the grace period cancels the deletion.
+	logIn(t, server.URL, user.Email)
+	userRecord, err := cfg.store.GetUser(context.Background(), user.ID)
+	if err != nil {
+		t.Fatalf("GetUser() resulted in error: %v", err)
+	}
+	if userRecord.DeletionScheduledAt.Valid {
+		t.Fatal("expected logging in to cancel the deletion")
+	}
+}
+
+func TestDataExportRoutes(t *testing.T) {
+	server, cfg := newMemoryTestServer(t)
+	user := signUp(t, server.URL, cfg, auth.RoleUser)
+	doJSON(t, "POST", server.URL+"/api/chirps", user.Token, map[string]string{"body": "to be exported"}, nil)
+
+	var export DataExport
+	if resp := doJSON(t, "POST", server.URL+"/api/users/me/export", user.Token, nil, &export); resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("POST /api/users/me/export: expected 202 got %d", resp.StatusCode)
+	}
+	if resp := doJSON(t, "POST", server.URL+"/api/users/me/export", user.Token, nil, nil); resp.StatusCode != http.StatusConflict {
+		t.Fatalf("second export: expected 409 got %d", resp.StatusCode)
+	}
+
+	if err := cfg.processDataExports(context.Background()); err != nil {
+		t.Fatalf("processDataExports() resulted in error: %v", err)
+	}
+
+	if resp := doJSON(t, "GET", server.URL+"/api/users/me/export/"+export.ID.String(), user.Token, nil, &export); resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /api/users/me/export/{id}: expected 200 got %d", resp.StatusCode)
+	}
+	if export.Status != dataExportComplete || export.DownloadURL == "" {
+		t.Fatalf("expected a complete export with a download link, got %+v", export)
+	}
+
+	resp, data := doRaw(t, "GET", server.URL+export.DownloadURL, "", "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("download: expected 200 got %d", resp.StatusCode)
+	}
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("zip.NewReader() resulted in error: %v", err)
+	}
+	if len(archive.File) == 0 {
+		t.Fatal("expected the archive to contain files")
+	}
+}
+
+func TestPolkaWebhooksRoute(t *testing.T) {
+	server, cfg := newMemoryTestServer(t)
+	user := signUp(t, server.URL, cfg, auth.RoleUser)
+	body := `{"event":"user.upgraded","data":{"user_id":"` + user.ID.String() + `"}}`
+
+	if resp, _ := doRaw(t, "POST", server.URL+"/api/polka/webhooks", "ApiKey wrong", body); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("wrong key: expected 401 got %d", resp.StatusCode)
+	}
+
+	key := cfg.polkaKey
+	cfg.polkaKey = ""
+	if resp, _ := doRaw(t, "POST", server.URL+"/api/polka/webhooks", "ApiKey ", body); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("empty key with no key configured: expected 401 got %d", resp.StatusCode)
+	}
+	cfg.polkaKey = key
+	if resp, _ := doRaw(t, "POST", server.URL+"/api/polka/webhooks", "ApiKey "+cfg.polkaKey, body); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("POST /api/polka/webhooks: expected 204 got %d", resp.StatusCode)
+	}
+
+	var login User
+	doJSON(t, "POST", server.URL+"/api/login", "", map[string]string{"email": user.Email, "password": testPassword}, &login)
+	if !login.IsChirpyRed {
+		t.Fatal("expected the user to be upgraded")
+	}
+}
+
+func TestAdminUserRoutes(t *testing.T) {
+	server, cfg := newMemoryTestServer(t)
+	admin := signUp(t, server.URL, cfg, auth.RoleAdmin)
+	user := signUp(t, server.URL, cfg, auth.RoleUser)
+	userURL := server.URL + "/admin/users/" + user.ID.String()
+
+	if resp := doJSON(t, "GET", server.URL+"/admin/users", user.Token, nil, nil); resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("GET /admin/users as a user: expected 403 got %d", resp.StatusCode)
+	}
+
+	var list adminUserList
+	if resp := doJSON(t, "GET", server.URL+"/admin/users?limit=1", admin.Token, nil, &list); resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /admin/users: expected 200 got %d", resp.StatusCode)
+	}
+	if list.Total != 2 || len(list.Users) != 1 {
+		t.Fatalf("expected 1 of 2 users, got %+v", list)
+	}
+
+	var adminUser AdminUser
+	if resp := doJSON(t, "GET", userURL, admin.Token, nil, &adminUser); resp.StatusCode != http.StatusOK || adminUser.Email != user.Email {
+		t.Fatalf("GET /admin/users/{id}: expected 200 with %s got %d %+v", user.Email, resp.StatusCode, adminUser)
+	}
+	if resp := doJSON(t, "GET", server.URL+"/admin/users/"+uuid.NewString(), admin.Token, nil, nil); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("GET an unknown user: expected 404 got %d", resp.StatusCode)
+	}
+
+	t.Run("suspend and unsuspend", func(t *testing.T) {
+		if resp := doJSON(t, "POST", userURL+"/suspend", admin.Token, map[string]string{"reason": "spam"}, nil); resp.StatusCode != http.StatusNoContent {
+			t.Fatalf("suspend: expected 204 got %d", resp.StatusCode)
+		}
+		var suspended accountErrorResponse
+		if resp := doJSON(t, "POST", server.URL+"/api/login", "", map[string]string{"email": user.Email, "password": testPassword}, &suspended); resp.StatusCode != http.StatusForbidden || suspended.Reason != "spam" {
+			t.Fatalf("login while suspended: expected 403 with the reason got %d %+v", resp.StatusCode, suspended)
+		}
+		if resp := doJSON(t, "POST", userURL+"/unsuspend", admin.Token, nil, nil); resp.StatusCode != http.StatusNoContent {
+			t.Fatalf("unsuspend: expected 204 got %d", resp.StatusCode)
+		}
+		user = logInAgain(t, server.URL, user)
+	})
+
+	t.Run("shadow-ban", func(t *testing.T) {
+		var chirp Chirp
+		doJSON(t, "POST", server.URL+"/api/chirps", user.Token, map[string]string{"body": "hidden"}, &chirp)
+		if resp := doJSON(t, "PUT", userURL+"/shadow-ban", admin.Token, map[string]bool{"shadow_banned": true}, nil); resp.StatusCode != http.StatusNoContent {
+			t.Fatalf("shadow-ban: expected 204 got %d", resp.StatusCode)
+		}
+		if resp := doJSON(t, "GET", server.URL+"/api/chirps/"+chirp.ID.String(), "", nil, nil); resp.StatusCode != http.StatusNotFound {
+			t.Fatalf("shadow-banned chirp to others: expected 404 got %d", resp.StatusCode)
+		}
+		if resp := doJSON(t, "GET", server.URL+"/api/chirps/"+chirp.ID.String(), user.Token, nil, nil); resp.StatusCode != http.StatusOK {
+			t.Fatalf("shadow-banned chirp to its author: expected 200 got %d", resp.StatusCode)
+		}
+	})
+
+	t.Run("chirpy-red", func(t *testing.T) {
+		if resp := doJSON(t, "PUT", userURL+"/chirpy-red", admin.Token, map[string]bool{"is_chirpy_red": true}, nil); resp.StatusCode != http.StatusNoContent {
+			t.Fatalf("chirpy-red: expected 204 got %d", resp.StatusCode)
+		}
+		var red adminUserList
+		doJSON(t, "GET", server.URL+"/admin/users?plan=red", admin.Token, nil, &red)
+		if len(red.Users) != 1 || red.Users[0].ID != user.ID {
+			t.Fatalf("expected only %s on the red plan, got %+v", user.ID, red.Users)
+		}
+	})
+
+	t.Run("role", func(t *testing.T) {
+		if resp := doJSON(t, "PUT", userURL+"/role", admin.Token, map[string]string{"role": "superuser"}, nil); resp.StatusCode != http.StatusBadRequest {
+			t.Fatalf("unknown role: expected 400 got %d", resp.StatusCode)
+		}
+		if resp := doJSON(t, "PUT", userURL+"/role", admin.Token, map[string]string{"role": auth.RoleModerator}, nil); resp.StatusCode != http.StatusNoContent {
+			t.Fatalf("role: expected 204 got %d", resp.StatusCode)
+		}
+		user = logInAgain(t, server.URL, user)
+		if resp := doJSON(t, "GET", server.URL+"/admin/users", user.Token, nil, nil); resp.StatusCode != http.StatusOK {
+			t.Fatalf("GET /admin/users as a moderator: expected 200 got %d", resp.StatusCode)
+		}
+	})
+
+	t.Run("revoke-sessions", func(t *testing.T) {
+		if resp := doJSON(t, "POST", userURL+"/revoke-sessions", admin.Token, nil, nil); resp.StatusCode != http.StatusNoContent {
+			t.Fatalf("revoke-sessions: expected 204 got %d", resp.StatusCode)
+		}
+		if resp := doJSON(t, "POST", server.URL+"/api/refresh", user.RefreshToken, nil, nil); resp.StatusCode != http.StatusUnauthorized {
+			t.Fatalf("refresh after revoke-sessions: expected 401 got %d", resp.StatusCode)
+		}
+	})
+
+	t.Run("audit", func(t *testing.T) {
+		var entries auditLogList
+		if resp := doJSON(t, "GET", server.URL+"/admin/audit?target_user_id="+user.ID.String(), admin.Token, nil, &entries); resp.StatusCode != http.StatusOK {
+			t.Fatalf("GET /admin/audit: expected 200 got %d", resp.StatusCode)
+		}
+		if entries.Total == 0 || len(entries.Entries) == 0 {
+			t.Fatalf("expected the admin actions to be audited, got %+v", entries)
+		}
+	})
+}
+
+// logInAgain replaces a test user's tokens, for after something ended their
+// session.
+func logInAgain(t *testing.T, serverURL string, user testUser) testUser {
+	t.Helper()
+
+	login := logIn(t, serverURL, user.Email)
+	user.Token = login.Token
+	user.RefreshToken = login.RefreshToken
+	return user
+}
+
+func TestAuditLogKeepsNoEmails(t *testing.T) {
+	server, cfg := newMemoryTestServer(t)
+	admin := signUp(t, server.URL, cfg, auth.RoleAdmin)
+	user := signUp(t, server.URL, cfg, auth.RoleUser)
+
+	if resp := doJSON(t, "POST", server.URL+"/api/login", "", map[string]string{"email": user.Email, "password": "wrong"}, nil); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("login with a wrong password: expected 401 got %d", resp.StatusCode)
+	}
+	newEmail := "changed-" + uuid.NewString() + "@example.com"
+	if resp := doJSON(t, "PUT", server.URL+"/api/users", user.Token, map[string]string{"email": newEmail, "password": testPassword}, nil); resp.StatusCode != http.StatusOK {
+		t.Fatalf("PUT /api/users: expected 200 got %d", resp.StatusCode)
+	}
+
+	resp, body := doRaw(t, "GET", server.URL+"/admin/audit?target_user_id="+user.ID.String(), "Bearer "+admin.Token, "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /admin/audit: expected 200 got %d", resp.StatusCode)
+	}
+	for _, email := range []string{user.Email, newEmail} {
+		if bytes.Contains(body, []byte(email)) {
+			t.Errorf("expected the audit log not to contain %s, got %s", email, body)
+		}
+	}
+
+	var entries auditLogList
+	decodeJSON(t, body, &entries)
+	actions := map[string]bool{}
+	for _, e := range entries.Entries {
+		actions[e.Action] = true
+	}
+	if !actions[audit.ActionLoginFailed] || !actions[audit.ActionEmailChanged] {
+		t.Errorf("expected a failed login and an email change to be audited, got %s", body)
+	}
+	if !bytes.Contains(body, []byte(cfg.auditLog.HashEmail(user.Email))) {
+		t.Errorf("expected the failed login to record the email's hash, got %s", body)
+	}
+}
+
+func TestAdminRoutes(t *testing.T) {
+	server, cfg := newMemoryTestServer(t)
+	admin := signUp(t, server.URL, cfg, auth.RoleAdmin)
+
+	t.Run("GET /admin/metrics", func(t *testing.T) {
+		resp, body := doRaw(t, "GET", server.URL+"/admin/metrics", "Bearer "+admin.Token, "")
+		if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), "Chirpy has been visited") {
+			t.Fatalf("expected 200 with the metrics page got %d %s", resp.StatusCode, body)
+		}
+	})
+
+	t.Run("GET /metrics", func(t *testing.T) {
+		resp, body := doRaw(t, "GET", server.URL+"/metrics", "Bearer "+cfg.metricsToken, "")
+		if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), "chirpy_") {
+			t.Fatalf("scrape with the metrics token: expected 200 with metrics got %d %s", resp.StatusCode, body)
+		}
+		for name, authorization := range map[string]string{"an admin token": "Bearer " + admin.Token, "a wrong token": "Bearer wrong", "no token": ""} {
+			if resp, _ := doRaw(t, "GET", server.URL+"/metrics", authorization, ""); resp.StatusCode != http.StatusUnauthorized {
+				t.Fatalf("with %s: expected 401 got %d", name, resp.StatusCode)
+			}
+		}
+
+		unset := newTestConfig(t, store.NewMemory())
+		unset.metricsToken = ""
+		w := httptest.NewRecorder()
+		unset.routes().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+		if w.Code != http.StatusNotFound {
+			t.Fatalf("without a metrics token configured: expected 404 got %d", w.Code)
+		}
+	})
+
+	t.Run("POST /admin/unlock", func(t *testing.T) {
+		if resp := doJSON(t, "POST", server.URL+"/admin/unlock", admin.Token, map[string]string{}, nil); resp.StatusCode != http.StatusBadRequest {
+			t.Fatalf("nothing to unlock: expected 400 got %d", resp.StatusCode)
+		}
+		if resp := doJSON(t, "POST", server.URL+"/admin/unlock", admin.Token, map[string]string{"email": admin.Email, "ip": "127.0.0.1"}, nil); resp.StatusCode != http.StatusNoContent {
+			t.Fatalf("expected 204 got %d", resp.StatusCode)
+		}
+	})
+
+	t.Run("logging", func(t *testing.T) {
+		var settings logSettings
+		if resp := doJSON(t, "PUT", server.URL+"/admin/logging", admin.Token, logSettings{Level: "debug"}, &settings); resp.StatusCode != http.StatusOK || settings.Level != "debug" {
+			t.Fatalf("PUT /admin/logging: expected 200 with level debug got %d %+v", resp.StatusCode, settings)
+		}
+		settings = logSettings{}
+		if resp := doJSON(t, "GET", server.URL+"/admin/logging", admin.Token, nil, &settings); resp.StatusCode != http.StatusOK || settings.Level != "debug" {
+			t.Fatalf("GET /admin/logging: expected 200 with level debug got %d %+v", resp.StatusCode, settings)
+		}
+	})
+
+	t.Run("import and export", func(t *testing.T) {
+		lines := strings.Join([]string{
+			`{"type":"user","external_id":"u1","email":"imported-` + uuid.NewString() + `@example.com"}`,
+			`{"type":"chirp","external_id":"c1","author_id":"u1","body":"imported chirp"}`,
+			`{"type":"chirp","external_id":"c2","author_id":"u2","body":"no such author"}`,
+		}, "\n")
+
+		var report importReport
+		resp, body := doRaw(t, "POST", server.URL+"/admin/import?source=test&dry_run=true", "Bearer "+admin.Token, lines)
+		decodeJSON(t, body, &report)
+		if resp.StatusCode != http.StatusOK || report.UsersImported != 1 || report.ChirpsImported != 1 || len(report.Errors) != 1 {
+			t.Fatalf("dry run: unexpected report %d %+v", resp.StatusCode, report)
+		}
+		var chirps []Chirp
+		doJSON(t, "GET", server.URL+"/api/chirps", "", nil, &chirps)
+		if len(chirps) != 0 {
+			t.Fatalf("dry run: expected nothing imported, got %d chirps", len(chirps))
+		}
+
+		resp, body = doRaw(t, "POST", server.URL+"/admin/import?source=test", "Bearer "+admin.Token, lines)
+		report = importReport{}
+		decodeJSON(t, body, &report)
+		if resp.StatusCode != http.StatusOK || report.UsersImported != 1 || report.ChirpsImported != 1 {
+			t.Fatalf("import: unexpected report %d %+v", resp.StatusCode, report)
+		}
+
+		resp, body = doRaw(t, "GET", server.URL+"/admin/export", "Bearer "+admin.Token, "")
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("GET /admin/export: expected 200 got %d", resp.StatusCode)
+		}
+		// Both users and the imported chirp.
+		if lines := strings.Count(string(body), "\n"); lines != 3 {
+			t.Fatalf("expected 3 exported lines, got %d: %s", lines, body)
+		}
+	})
+
+	t.Run("POST /admin/reset", func(t *testing.T) {
+		if resp := doJSON(t, "POST", server.URL+"/admin/reset", admin.Token, nil, nil); resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected 200 got %d", resp.StatusCode)
+		}
+		if _, err := cfg.store.GetUser(context.Background(), admin.ID); err == nil {
+			t.Fatal("expected every user to be deleted")
+		}
+	})
+}
+
+func TestPublicRoutes(t *testing.T) {
+	server, cfg := newMemoryTestServer(t)
+	if err := os.WriteFile(filepath.Join(cfg.staticDir, "index.html"), []byte("<h1>Chirpy</h1>"), 0o644); err != nil {
+		t.Fatalf("os.WriteFile() resulted in error: %v", err)
+	}
+
+	routes := []struct {
+		path     string
+		contains string
+	}{
+		{"/app/", "Chirpy"},
+		{"/api/healthz", "OK"},
+		{"/livez", healthOK},
+		{"/readyz", healthOK},
+		{"/.well-known/jwks.json", `"keys"`},
+	}
+
+	for _, route := range routes {
+		t.Run("GET "+route.path, func(t *testing.T) {
+			resp, body := doRaw(t, "GET", server.URL+route.path, "", "")
+			if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), route.contains) {
+				t.Fatalf("expected 200 containing %q got %d %s", route.contains, resp.StatusCode, body)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+
+	"github.com/drewheasman/chirpy/internal/config"
+)
+
+// backgroundWorker runs until ctx is cancelled.
+type backgroundWorker func(ctx context.Context) error
+
+// serve runs the API and workers until ctx is cancelled, normally by
+// SIGTERM or SIGINT. It then stops accepting connections, waits for
+// in-flight requests, and only then stops the workers, so a request never
+// sees them gone. Everything has to finish within the shutdown timeout.
+func (cfg *apiConfig) serve(ctx context.Context, settings config.Server, workers []backgroundWorker) error {
+	server := &http.Server{
+		Addr:              settings.Addr,
+		Handler:           cfg.routes(),
+		ReadHeaderTimeout: settings.ReadHeaderTimeout,
+		ReadTimeout:       settings.ReadTimeout,
+		WriteTimeout:      settings.WriteTimeout,
+		IdleTimeout:       settings.IdleTimeout,
+		MaxHeaderBytes:    settings.MaxHeaderBytes,
+	}
+
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+	var wg sync.WaitGroup
+	for _, worker := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := worker(workerCtx); err != nil && !errors.Is(err, context.Canceled) {
+				slog.Error("background worker stopped", "error", err)
+			}
+		}()
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		slog.Info("server listening", "addr", settings.Addr)
+		serveErr <- server.ListenAndServe()
+	}()
+
+	var err error
+	select {
+	case err = <-serveErr:
+		// The server never started, most likely because the port is taken.
+	case <-ctx.Done():
+		slog.Info("shutting down", "timeout", settings.ShutdownTimeout)
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), settings.ShutdownTimeout)
+	defer cancel()
+
+	if shutdownErr := server.Shutdown(shutdownCtx); shutdownErr != nil {
+		slog.Error("requests still running at the shutdown deadline, closing their connections", "error", shutdownErr)
+		server.Close()
+	}
+
+	stopWorkers()
+	stopped := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-shutdownCtx.Done():
+		slog.Error("background workers still running at the shutdown deadline")
+	}
+
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
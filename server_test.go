@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/drewheasman/chirpy/internal/config"
+	"github.com/drewheasman/chirpy/internal/metrics"
+)
+
+func TestRoutesRespectFeatures(t *testing.T) {
+	routes := []struct {
+		method       string
+		path         string
+		whenDisabled int
+	}{
+		{"POST", "/api/users", http.StatusForbidden},
+		{"POST", "/api/users/me/export", http.StatusNotFound},
+		{"POST", "/api/polka/webhooks", http.StatusNotFound},
+		{"POST", "/oauth/clients", http.StatusNotFound},
+	}
+
+	enabled := &apiConfig{metrics: metrics.New(), features: config.Default().Features}
+	disabled := &apiConfig{metrics: metrics.New()}
+
+	for _, route := range routes {
+		t.Run(route.method+" "+route.path, func(t *testing.T) {
+			req := httptest.NewRequest(route.method, route.path, strings.NewReader(`{}`))
+			rec := httptest.NewRecorder()
+			disabled.routes().ServeHTTP(rec, req)
+			if rec.Code != route.whenDisabled {
+				t.Errorf("disabled: expected %d got %d", route.whenDisabled, rec.Code)
+			}
+
+			req = httptest.NewRequest(route.method, route.path, strings.NewReader(`{}`))
+			rec = httptest.NewRecorder()
+			enabled.routes().ServeHTTP(rec, req)
+			if rec.Code == route.whenDisabled {
+				t.Errorf("enabled: expected the route to be served, got %d", rec.Code)
+			}
+		})
+	}
+}
+
+func TestServeStopsWorkersOnShutdown(t *testing.T) {
+	cfg := &apiConfig{metrics: metrics.New()}
+	settings := config.Default().Server
+	settings.Addr = "127.0.0.1:0"
+	settings.ShutdownTimeout = time.Second
+
+	started := make(chan struct{})
+	stopped := make(chan struct{})
+	worker := func(ctx context.Context) error {
+		close(started)
+		<-ctx.Done()
+		close(stopped)
+		return ctx.Err()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- cfg.serve(ctx, settings, []backgroundWorker{worker}) }()
+
+	<-started
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("serve() resulted in error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("serve() didn't return after its context was cancelled")
+	}
+	select {
+	case <-stopped:
+	default:
+		t.Error("serve() returned before the worker stopped")
+	}
+}
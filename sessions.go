@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/drewheasman/chirpy/internal/audit"
+	"github.com/drewheasman/chirpy/internal/auth"
+	"github.com/drewheasman/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+var (
+	errSessionRevoked = errors.New("session has been revoked")
+	errFirstPartyOnly = errors.New("only a session token can use this endpoint")
+)
+
+// sessionMetadata describes the device a session was started from and, for
+// sessions granted to an OAuth client, the client and its scopes.
+type sessionMetadata struct {
+	DeviceName string
+	UserAgent  string
+	IP         string
+	ClientID   string
+	Scopes     []string
+}
+
+func sessionMetadataFromRequest(req *http.Request, deviceName string) sessionMetadata {
+	return sessionMetadata{
+		DeviceName: deviceName,
+		UserAgent:  req.UserAgent(),
+		IP:         clientIP(req),
+	}
+}
+
+// parseAccessToken validates an access JWT and checks that the session it
+// was issued for hasn't been revoked since.
+func (cfg *apiConfig) parseAccessToken(ctx context.Context, token string) (*auth.Claims, error) {
+	claims, err := auth.ParseJWT(token, cfg.jwtKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	sessionID, err := claims.SessionUUID()
+	if err != nil {
+		return nil, err
+	}
+	if sessionID != uuid.Nil {
+		active, err := cfg.store.IsSessionActive(ctx, sessionID)
+		if err != nil {
+			return nil, err
+		}
+		if !active {
+			return nil, errSessionRevoked
+		}
+	}
+
+	return claims, nil
+}
+
+type Session struct {
+	ID         uuid.UUID `json:"id"`
+	DeviceName string    `json:"device_name"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"`
+}
+
+func (cfg *apiConfig) getSessionsHandler(w http.ResponseWriter, req *http.Request) {
+	caller := requestPrincipal(req)
+	userId := caller.UserID
+
+	sessionRecords, err := cfg.store.GetActiveSessionsForUser(req.Context(), userId)
+	if err != nil {
+		slog.ErrorContext(req.Context(), "error getting sessions", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "error getting sessions")
+		return
+	}
+
+	sessionsResponse := []Session{}
+	for _, s := range sessionRecords {
+		sessionsResponse = append(sessionsResponse, Session{
+			ID:         s.FamilyID,
+			DeviceName: s.DeviceName,
+			UserAgent:  s.UserAgent,
+			IP:         s.Ip,
+			CreatedAt:  s.StartedAt,
+			LastUsedAt: s.LastUsedAt,
+			ExpiresAt:  s.ExpiresAt,
+			Current:    s.FamilyID == caller.SessionID,
+		})
+	}
+
+	respondWithJson(w, http.StatusOK, sessionsResponse)
+}
+
+func (cfg *apiConfig) deleteSessionHandler(w http.ResponseWriter, req *http.Request) {
+	sessionID, err := uuid.Parse(req.PathValue("id"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "error parsing uuid from given id path param")
+		return
+	}
+
+	userId := requestPrincipal(req).UserID
+
+	revoked, err := cfg.store.RevokeSessionForUser(req.Context(), database.RevokeSessionForUserParams{
+		FamilyID: sessionID,
+		UserID:   userId,
+	})
+	if err != nil {
+		slog.ErrorContext(req.Context(), "error revoking session", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Error revoking session")
+		return
+	}
+	if revoked == 0 {
+		respondWithError(w, http.StatusNotFound, "Session not found")
+		return
+	}
+
+	cfg.recordTokenRevoked(req.Context(), userId, audit.TargetSession, sessionID.String())
+	slog.InfoContext(req.Context(), "session revoked")
+
+	respondNoContent(w, http.StatusNoContent)
+}
+
+func (cfg *apiConfig) revokeAllSessionsHandler(w http.ResponseWriter, req *http.Request) {
+	userId := requestPrincipal(req).UserID
+
+	if err := cfg.store.RevokeAllSessionsForUser(req.Context(), userId); err != nil {
+		slog.ErrorContext(req.Context(), "error revoking sessions", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Error revoking sessions")
+		return
+	}
+
+	cfg.recordAudit(req.Context(), audit.Entry{
+		Action:       audit.ActionUserSessionsRevoked,
+		ActorID:      uuid.NullUUID{UUID: userId, Valid: true},
+		TargetUserID: uuid.NullUUID{UUID: userId, Valid: true},
+	})
+	slog.InfoContext(req.Context(), "all sessions revoked")
+
+	respondNoContent(w, http.StatusNoContent)
+}
@@ -0,0 +1,81 @@
+-- name: CreateDataExport :one
+INSERT INTO data_exports (id, created_at, updated_at, user_id, status)
+VALUES (gen_random_uuid(), NOW(), NOW(), $1, 'pending')
+RETURNING *;
+
+-- name: GetDataExport :one
+SELECT *
+FROM data_exports
+WHERE id = $1;
+
+-- name: GetDataExportForUser :one
+SELECT *
+FROM data_exports
+WHERE
+    id = $1 AND
+    user_id = $2;
+
+-- name: CountActiveDataExportsForUser :one
+SELECT COUNT(*)
+FROM data_exports
+WHERE
+    user_id = $1 AND
+    status IN ('pending', 'running');
+
+-- Jobs left running by a server that died are picked up again once they are
+-- older than stale_before.
+
+-- name: ClaimDataExport :one
+UPDATE data_exports
+SET
+    status = 'running',
+    updated_at = NOW()
+WHERE id = (
+    SELECT id
+    FROM data_exports
+    WHERE
+        status = 'pending' OR
+        (status = 'running' AND updated_at < sqlc.arg('stale_before'))
+    ORDER BY created_at
+    LIMIT 1
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+
+-- name: CompleteDataExport :exec
+UPDATE data_exports
+SET
+    status = 'complete',
+    blob_key = $2,
+    completed_at = NOW(),
+    expires_at = $3,
+    updated_at = NOW()
+WHERE id = $1;
+
+-- name: FailDataExport :exec
+UPDATE data_exports
+SET
+    status = 'failed',
+    error = $2,
+    completed_at = NOW(),
+    expires_at = $3,
+    updated_at = NOW()
+WHERE id = $1;
+
+-- name: DeleteExpiredDataExports :many
+DELETE
+FROM data_exports
+WHERE expires_at <= $1
+RETURNING blob_key;
+
+-- Runs just before DeleteDueUsers, which would otherwise cascade the rows
+-- away and leave their blobs behind.
+
+-- name: DeleteDataExportsForDueUsers :many
+DELETE
+FROM data_exports
+USING users
+WHERE
+    users.id = data_exports.user_id AND
+    users.deletion_scheduled_at <= $1
+RETURNING data_exports.blob_key;
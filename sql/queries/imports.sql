@@ -0,0 +1,73 @@
+-- name: GetExternalUserIDs :many
+SELECT external_id, user_id
+FROM external_user_ids
+WHERE
+    source = sqlc.arg('source') AND
+    external_id = ANY(sqlc.arg('external_ids')::text[]);
+
+-- name: CreateExternalUserIDs :exec
+INSERT INTO external_user_ids (source, external_id, user_id)
+SELECT sqlc.arg('source')::text, e.external_id, e.user_id
+FROM UNNEST(
+    sqlc.arg('external_ids')::text[],
+    sqlc.arg('user_ids')::uuid[]
+) AS e (external_id, user_id);
+
+-- name: GetExternalChirpIDs :many
+SELECT external_id
+FROM external_chirp_ids
+WHERE
+    source = sqlc.arg('source') AND
+    external_id = ANY(sqlc.arg('external_ids')::text[]);
+
+-- name: CreateExternalChirpIDs :exec
+INSERT INTO external_chirp_ids (source, external_id, chirp_id)
+SELECT sqlc.arg('source')::text, e.external_id, e.chirp_id
+FROM UNNEST(
+    sqlc.arg('external_ids')::text[],
+    sqlc.arg('chirp_ids')::uuid[]
+) AS e (external_id, chirp_id);
+
+-- Emails must be lower case; the match ignores the case of stored emails.
+
+-- name: GetUsersByEmails :many
+SELECT email
+FROM users
+WHERE lower(email) = ANY(sqlc.arg('emails')::text[]);
+
+-- name: ImportUsers :exec
+INSERT INTO users (id, created_at, updated_at, email, hashed_password, is_chirpy_red)
+SELECT u.id, u.created_at, u.created_at, u.email, u.hashed_password, u.is_chirpy_red
+FROM UNNEST(
+    sqlc.arg('ids')::uuid[],
+    sqlc.arg('created_at')::timestamp[],
+    sqlc.arg('emails')::text[],
+    sqlc.arg('hashed_passwords')::text[],
+    sqlc.arg('is_chirpy_red')::boolean[]
+) AS u (id, created_at, email, hashed_password, is_chirpy_red);
+
+-- name: ImportChirps :execrows
+INSERT INTO chirps (id, created_at, updated_at, body, user_id)
+SELECT c.id, c.created_at, c.created_at, c.body, c.user_id
+FROM UNNEST(
+    sqlc.arg('ids')::uuid[],
+    sqlc.arg('created_at')::timestamp[],
+    sqlc.arg('bodies')::text[],
+    sqlc.arg('user_ids')::uuid[]
+) AS c (id, created_at, body, user_id);
+
+-- Exports page through by ID so they never hold every row in memory.
+
+-- name: ListUsersForExport :many
+SELECT id, created_at, email, is_chirpy_red
+FROM users
+WHERE id > sqlc.arg('after_id')
+ORDER BY id
+LIMIT sqlc.arg('max_results');
+
+-- name: ListChirpsForExport :many
+SELECT id, created_at, body, user_id
+FROM chirps
+WHERE id > sqlc.arg('after_id')
+ORDER BY id
+LIMIT sqlc.arg('max_results');
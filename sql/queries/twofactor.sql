@@ -0,0 +1,32 @@
+-- name: CreateRecoveryCodes :exec
+INSERT INTO recovery_codes (id, created_at, user_id, code_hash)
+SELECT gen_random_uuid(), NOW(), @user_id::uuid, unnest(@code_hashes::text[]);
+
+-- name: UseRecoveryCode :execrows
+UPDATE recovery_codes
+SET used_at = NOW()
+WHERE
+    user_id = $1 AND
+    code_hash = $2 AND
+    used_at IS NULL;
+
+-- name: DeleteRecoveryCodes :exec
+DELETE
+FROM recovery_codes
+WHERE user_id = $1;
+
+-- name: CreateTwoFactorChallenge :exec
+INSERT INTO two_factor_challenges (token_hash, created_at, user_id, expires_at)
+VALUES ($1, NOW(), $2, $3);
+
+-- name: GetUserFromTwoFactorChallenge :one
+SELECT user_id
+FROM two_factor_challenges
+WHERE
+    token_hash = $1 AND
+    expires_at > $2;
+
+-- name: DeleteTwoFactorChallenge :exec
+DELETE
+FROM two_factor_challenges
+WHERE token_hash = $1;
@@ -30,3 +30,153 @@ RETURNING id, created_at, updated_at, email, is_chirpy_red;
 UPDATE users
 SET is_chirpy_red = TRUE
 WHERE id = $1;
+
+-- name: SetTOTPSecret :exec
+UPDATE users
+SET
+    totp_secret = $2,
+    totp_enabled = FALSE,
+    updated_at = NOW()
+WHERE id = $1;
+
+-- A TOTP code stays valid for a whole time step either side of now, so the
+-- step of every accepted code is kept and older steps are refused.
+
+-- name: UseTOTPCounter :execrows
+UPDATE users
+SET totp_last_counter = $2
+WHERE
+    id = $1 AND
+    totp_last_counter < $2;
+
+-- name: EnableTOTP :exec
+UPDATE users
+SET
+    totp_enabled = TRUE,
+    updated_at = NOW()
+WHERE id = $1;
+
+-- name: DisableTOTP :exec
+UPDATE users
+SET
+    totp_secret = NULL,
+    totp_enabled = FALSE,
+    updated_at = NOW()
+WHERE id = $1;
+
+-- name: SetUserRole :execrows
+UPDATE users
+SET
+    role = $2,
+    updated_at = NOW()
+WHERE id = $1;
+
+-- name: AdminExists :one
+SELECT EXISTS (
+    SELECT 1
+    FROM users
+    WHERE role = 'admin'
+);
+
+-- name: ListUsers :many
+SELECT id, created_at, updated_at, email, is_chirpy_red, role, suspended_at
+FROM users
+WHERE
+    (sqlc.narg('email')::text IS NULL OR email ILIKE '%' || sqlc.narg('email') || '%') AND
+    (sqlc.narg('is_chirpy_red')::boolean IS NULL OR is_chirpy_red = sqlc.narg('is_chirpy_red')) AND
+    (sqlc.narg('created_after')::timestamp IS NULL OR created_at >= sqlc.narg('created_after')) AND
+    (sqlc.narg('created_before')::timestamp IS NULL OR created_at < sqlc.narg('created_before'))
+ORDER BY created_at DESC, id DESC
+LIMIT @max_results
+OFFSET @skip_results;
+
+-- name: CountUsers :one
+SELECT COUNT(*)
+FROM users
+WHERE
+    (sqlc.narg('email')::text IS NULL OR email ILIKE '%' || sqlc.narg('email') || '%') AND
+    (sqlc.narg('is_chirpy_red')::boolean IS NULL OR is_chirpy_red = sqlc.narg('is_chirpy_red')) AND
+    (sqlc.narg('created_after')::timestamp IS NULL OR created_at >= sqlc.narg('created_after')) AND
+    (sqlc.narg('created_before')::timestamp IS NULL OR created_at < sqlc.narg('created_before'));
+
+-- name: GetUserActivityCounts :one
+SELECT
+    (
+        SELECT COUNT(*)
+        FROM chirps
+        WHERE chirps.user_id = @user_id
+    ) AS chirp_count,
+    (
+        SELECT COUNT(DISTINCT family_id)
+        FROM refresh_tokens
+        WHERE
+            refresh_tokens.user_id = @user_id AND
+            revoked_at IS NULL AND
+            rotated_at IS NULL AND
+            expires_at > NOW()
+    ) AS session_count;
+
+-- name: SuspendUser :execrows
+UPDATE users
+SET
+    suspended_at = NOW(),
+    suspension_reason = $2,
+    updated_at = NOW()
+WHERE id = $1;
+
+-- name: UnsuspendUser :execrows
+UPDATE users
+SET
+    suspended_at = NULL,
+    suspension_reason = NULL,
+    updated_at = NOW()
+WHERE id = $1;
+
+-- name: RequirePasswordReset :execrows
+UPDATE users
+SET
+    password_reset_required = TRUE,
+    updated_at = NOW()
+WHERE id = $1;
+
+-- name: UpdateChirpyRed :execrows
+UPDATE users
+SET
+    is_chirpy_red = $2,
+    updated_at = NOW()
+WHERE id = $1;
+
+-- name: GetUserStatus :one
+SELECT suspended_at, suspension_reason, shadow_banned, deletion_scheduled_at
+FROM users
+WHERE id = $1;
+
+-- name: SetShadowBanned :execrows
+UPDATE users
+SET
+    shadow_banned = $2,
+    updated_at = NOW()
+WHERE id = $1;
+
+-- name: ScheduleUserDeletion :one
+UPDATE users
+SET
+    deletion_scheduled_at = $2,
+    updated_at = NOW()
+WHERE id = $1
+RETURNING deletion_scheduled_at;
+
+-- name: CancelUserDeletion :execrows
+UPDATE users
+SET
+    deletion_scheduled_at = NULL,
+    updated_at = NOW()
+WHERE
+    id = $1 AND
+    deletion_scheduled_at IS NOT NULL;
+
+-- name: DeleteDueUsers :many
+DELETE
+FROM users
+WHERE deletion_scheduled_at <= $1
+RETURNING id, email;
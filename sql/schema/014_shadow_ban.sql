@@ -0,0 +1,11 @@
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN suspended_at TIMESTAMP,
+ADD COLUMN suspension_reason TEXT,
+ADD COLUMN shadow_banned BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- +goose Down
+ALTER TABLE users
+DROP COLUMN shadow_banned,
+DROP COLUMN suspension_reason,
+DROP COLUMN suspended_at;
@@ -0,0 +1,14 @@
+-- +goose Up
+-- Maps user IDs from systems communities are imported from to Chirpy users,
+-- so later imports from the same source can refer to them.
+CREATE TABLE external_user_ids (
+    source TEXT NOT NULL,
+    external_id TEXT NOT NULL,
+    user_id UUID NOT NULL
+        REFERENCES users(id)
+        ON DELETE CASCADE,
+    PRIMARY KEY (source, external_id)
+);
+
+-- +goose Down
+DROP TABLE external_user_ids;
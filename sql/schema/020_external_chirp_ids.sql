@@ -0,0 +1,14 @@
+-- +goose Up
+-- Maps chirp IDs from the systems communities are imported from to Chirpy
+-- chirps, so running an import again skips the chirps it already brought in.
+CREATE TABLE external_chirp_ids (
+    source TEXT NOT NULL,
+    external_id TEXT NOT NULL,
+    chirp_id UUID NOT NULL
+        REFERENCES chirps(id)
+        ON DELETE CASCADE,
+    PRIMARY KEY (source, external_id)
+);
+
+-- +goose Down
+DROP TABLE external_chirp_ids;
@@ -0,0 +1,36 @@
+-- name: CreateAuditLogEntry :exec
+INSERT INTO audit_log (id, created_at, actor_id, action, target_user_id, target_type, target_id, ip, user_agent, details, diff)
+VALUES (gen_random_uuid(), NOW(), ?1, ?2, ?3, ?4, ?5, ?6, ?7, ?8, ?9);
+
+-- name: GetAuditLogForTarget :many
+SELECT created_at, action, details
+FROM audit_log
+WHERE
+    target_user_id = sqlc.arg('target_user_id') AND
+    action IN (sqlc.slice('actions'))
+ORDER BY created_at;
+
+-- name: ListAuditLog :many
+SELECT *
+FROM audit_log
+WHERE
+    (sqlc.narg('actor_id') IS NULL OR actor_id = sqlc.narg('actor_id')) AND
+    (sqlc.narg('target_user_id') IS NULL OR target_user_id = sqlc.narg('target_user_id')) AND
+    (sqlc.narg('action') IS NULL OR action = sqlc.narg('action')) AND
+    (sqlc.narg('target_type') IS NULL OR target_type = sqlc.narg('target_type')) AND
+    (sqlc.narg('created_after') IS NULL OR created_at >= sqlc.narg('created_after')) AND
+    (sqlc.narg('created_before') IS NULL OR created_at < sqlc.narg('created_before'))
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg('max_results')
+OFFSET sqlc.arg('skip_results');
+
+-- name: CountAuditLog :one
+SELECT COUNT(*)
+FROM audit_log
+WHERE
+    (sqlc.narg('actor_id') IS NULL OR actor_id = sqlc.narg('actor_id')) AND
+    (sqlc.narg('target_user_id') IS NULL OR target_user_id = sqlc.narg('target_user_id')) AND
+    (sqlc.narg('action') IS NULL OR action = sqlc.narg('action')) AND
+    (sqlc.narg('target_type') IS NULL OR target_type = sqlc.narg('target_type')) AND
+    (sqlc.narg('created_after') IS NULL OR created_at >= sqlc.narg('created_after')) AND
+    (sqlc.narg('created_before') IS NULL OR created_at < sqlc.narg('created_before'));
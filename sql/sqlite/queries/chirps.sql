@@ -0,0 +1,54 @@
+-- name: CreateChirp :one
+INSERT INTO chirps (id, created_at, updated_at, body, user_id)
+VALUES (gen_random_uuid(), NOW(), NOW(), ?1, ?2)
+RETURNING *;
+
+-- name: GetChirps :many
+SELECT *
+FROM chirps;
+
+-- name: GetChirpsByUser :many
+SELECT *
+FROM chirps
+WHERE user_id = ?1;
+
+-- name: GetChirp :one
+SELECT *
+FROM chirps
+WHERE id = ?1;
+
+-- name: DeleteChirp :exec
+DELETE
+FROM chirps
+WHERE id = ?1;
+
+-- Chirps by shadow-banned users are only visible to their author.
+
+-- name: GetVisibleChirps :many
+SELECT chirps.*
+FROM chirps
+JOIN users ON users.id = chirps.user_id
+WHERE
+    NOT users.shadow_banned OR
+    chirps.user_id = sqlc.narg('viewer_id');
+
+-- name: GetVisibleChirpsByUser :many
+SELECT chirps.*
+FROM chirps
+JOIN users ON users.id = chirps.user_id
+WHERE
+    chirps.user_id = sqlc.arg('user_id') AND
+    (NOT users.shadow_banned OR chirps.user_id = sqlc.narg('viewer_id'));
+
+-- name: GetVisibleChirp :one
+SELECT chirps.*
+FROM chirps
+JOIN users ON users.id = chirps.user_id
+WHERE
+    chirps.id = sqlc.arg('id') AND
+    (NOT users.shadow_banned OR chirps.user_id = sqlc.narg('viewer_id'));
+
+-- name: DeleteChirpsBefore :execrows
+DELETE
+FROM chirps
+WHERE created_at < ?1;
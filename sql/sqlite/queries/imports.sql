@@ -0,0 +1,55 @@
+-- name: GetExternalUserIDs :many
+SELECT external_id, user_id
+FROM external_user_ids
+WHERE
+    source = sqlc.arg('source') AND
+    external_id IN (sqlc.slice('external_ids'));
+
+-- name: GetExternalChirpIDs :many
+SELECT external_id
+FROM external_chirp_ids
+WHERE
+    source = sqlc.arg('source') AND
+    external_id IN (sqlc.slice('external_ids'));
+
+-- SQLite has no arrays to UNNEST, so imports insert one row at a time, in
+-- the transaction the store runs the whole batch in.
+
+-- name: CreateExternalUserID :exec
+INSERT INTO external_user_ids (source, external_id, user_id)
+VALUES (?1, ?2, ?3);
+
+-- name: CreateExternalChirpID :exec
+INSERT INTO external_chirp_ids (source, external_id, chirp_id)
+VALUES (?1, ?2, ?3);
+
+-- Emails must be lower case; the match ignores the case of stored emails.
+
+-- name: GetUsersByEmails :many
+SELECT email
+FROM users
+WHERE lower(email) IN (sqlc.slice('emails'));
+
+-- name: ImportUser :exec
+INSERT INTO users (id, created_at, updated_at, email, hashed_password, is_chirpy_red)
+VALUES (sqlc.arg('id'), sqlc.arg('created_at'), sqlc.arg('created_at'), sqlc.arg('email'), sqlc.arg('hashed_password'), sqlc.arg('is_chirpy_red'));
+
+-- name: ImportChirp :exec
+INSERT INTO chirps (id, created_at, updated_at, body, user_id)
+VALUES (sqlc.arg('id'), sqlc.arg('created_at'), sqlc.arg('created_at'), sqlc.arg('body'), sqlc.arg('user_id'));
+
+-- Exports page through by ID so they never hold every row in memory.
+
+-- name: ListUsersForExport :many
+SELECT id, created_at, email, is_chirpy_red
+FROM users
+WHERE id > sqlc.arg('after_id')
+ORDER BY id
+LIMIT sqlc.arg('max_results');
+
+-- name: ListChirpsForExport :many
+SELECT id, created_at, body, user_id
+FROM chirps
+WHERE id > sqlc.arg('after_id')
+ORDER BY id
+LIMIT sqlc.arg('max_results');
@@ -0,0 +1,42 @@
+-- name: GetLoginAttempt :one
+SELECT *
+FROM login_attempts
+WHERE key = ?1;
+
+-- name: RecordLoginFailure :one
+INSERT INTO login_attempts (key, failures, last_failure_at)
+VALUES (sqlc.arg('key'), 1, sqlc.arg('failed_at'))
+ON CONFLICT (key) DO UPDATE
+SET
+    failures = CASE
+        WHEN login_attempts.last_failure_at < sqlc.arg('window_start') THEN 1
+        ELSE login_attempts.failures + 1
+    END,
+    last_failure_at = sqlc.arg('failed_at')
+RETURNING *;
+
+-- ReleaseLoginAttempt takes back a failure that was counted before an
+-- attempt was made, once the attempt didn't fail. The last failure goes back
+-- to what it was unless another failure has been counted since.
+
+-- name: ReleaseLoginAttempt :exec
+UPDATE login_attempts
+SET
+    failures = failures - 1,
+    last_failure_at = CASE
+        WHEN last_failure_at = sqlc.arg('reserved_at') THEN sqlc.arg('previous_failure_at')
+        ELSE last_failure_at
+    END
+WHERE
+    key = sqlc.arg('key') AND
+    failures > 0;
+
+-- name: LockLoginAttempts :exec
+UPDATE login_attempts
+SET locked_until = ?2
+WHERE key = ?1;
+
+-- name: ResetLoginAttempts :exec
+DELETE
+FROM login_attempts
+WHERE key = ?1;
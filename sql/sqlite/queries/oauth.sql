@@ -0,0 +1,21 @@
+-- name: CreateOAuthClient :one
+INSERT INTO oauth_clients (id, created_at, owner_id, name, secret_hash, redirect_uris, scopes)
+VALUES (?1, NOW(), ?2, ?3, ?4, ?5, ?6)
+RETURNING *;
+
+-- name: GetOAuthClient :one
+SELECT *
+FROM oauth_clients
+WHERE id = ?1;
+
+-- name: CreateOAuthAuthorizationCode :exec
+INSERT INTO oauth_authorization_codes (code_hash, created_at, client_id, user_id, redirect_uri, scopes, code_challenge, expires_at)
+VALUES (?1, NOW(), ?2, ?3, ?4, ?5, ?6, ?7);
+
+-- name: ConsumeOAuthAuthorizationCode :one
+DELETE
+FROM oauth_authorization_codes
+WHERE
+    code_hash = ?1 AND
+    expires_at > NOW()
+RETURNING *;
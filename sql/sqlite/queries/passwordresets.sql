@@ -0,0 +1,19 @@
+-- name: CreatePasswordResetToken :exec
+INSERT INTO password_reset_tokens (token_hash, created_at, user_id, expires_at)
+VALUES (?1, NOW(), ?2, ?3);
+
+-- name: ConsumePasswordResetToken :one
+DELETE
+FROM password_reset_tokens
+WHERE
+    token_hash = ?1 AND
+    expires_at > ?2
+RETURNING user_id;
+
+-- name: ResetPassword :exec
+UPDATE users
+SET
+    hashed_password = ?2,
+    password_reset_required = FALSE,
+    updated_at = NOW()
+WHERE id = ?1;
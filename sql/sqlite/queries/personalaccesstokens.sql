@@ -0,0 +1,30 @@
+-- name: CreatePersonalAccessToken :one
+INSERT INTO personal_access_tokens (id, created_at, user_id, name, token_hash, scopes, expires_at)
+VALUES (gen_random_uuid(), NOW(), ?1, ?2, ?3, ?4, ?5)
+RETURNING id, created_at, name, scopes, expires_at, last_used_at;
+
+-- name: GetPersonalAccessTokensForUser :many
+SELECT id, created_at, name, scopes, expires_at, last_used_at
+FROM personal_access_tokens
+WHERE user_id = ?1
+ORDER BY created_at DESC;
+
+-- name: UsePersonalAccessToken :one
+UPDATE personal_access_tokens
+SET last_used_at = NOW()
+WHERE
+    token_hash = ?1 AND
+    (expires_at IS NULL OR expires_at > NOW())
+RETURNING id, user_id, scopes;
+
+-- name: DeletePersonalAccessToken :execrows
+DELETE
+FROM personal_access_tokens
+WHERE
+    id = ?1 AND
+    user_id = ?2;
+
+-- name: DeletePersonalAccessTokensForUser :execrows
+DELETE
+FROM personal_access_tokens
+WHERE user_id = ?1;
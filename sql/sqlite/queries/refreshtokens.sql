@@ -0,0 +1,101 @@
+-- name: CreateRefreshToken :exec
+INSERT INTO refresh_tokens (token_hash, created_at, updated_at, user_id, expires_at, family_id, device_name, user_agent, ip, last_used_at, client_id, scopes)
+VALUES (?1, NOW(), NOW(), ?2, ?3, ?4, ?5, ?6, ?7, NOW(), ?8, ?9);
+
+-- name: GetRefreshToken :one
+SELECT *
+FROM refresh_tokens
+WHERE token_hash = ?1;
+
+-- name: RotateRefreshToken :one
+UPDATE refresh_tokens
+SET
+    rotated_at = NOW(),
+    updated_at = NOW()
+WHERE
+    token_hash = ?1 AND
+    expires_at > NOW() AND
+    revoked_at IS NULL AND
+    rotated_at IS NULL AND
+    client_id IS ?2
+RETURNING user_id, family_id, device_name, scopes;
+
+-- name: RevokeRefreshTokenFamily :exec
+UPDATE refresh_tokens
+SET
+    revoked_at = NOW(),
+    updated_at = NOW()
+WHERE
+    family_id = ?1 AND
+    revoked_at IS NULL;
+
+-- name: IsSessionActive :one
+SELECT EXISTS (
+    SELECT 1
+    FROM refresh_tokens
+    WHERE
+        family_id = ?1 AND
+        revoked_at IS NULL AND
+        expires_at > NOW()
+);
+
+-- started_at is joined from the family's first token rather than taken with
+-- MIN(), which SQLite would return as text instead of a timestamp.
+
+-- name: GetActiveSessionsForUser :many
+SELECT
+    refresh_tokens.family_id,
+    refresh_tokens.device_name,
+    refresh_tokens.user_agent,
+    refresh_tokens.ip,
+    first.created_at AS started_at,
+    refresh_tokens.last_used_at,
+    refresh_tokens.expires_at
+FROM refresh_tokens
+JOIN refresh_tokens AS first ON first.token_hash = (
+    SELECT f.token_hash
+    FROM refresh_tokens f
+    WHERE f.family_id = refresh_tokens.family_id
+    ORDER BY f.created_at, f.token_hash
+    LIMIT 1
+)
+WHERE
+    refresh_tokens.user_id = ?1 AND
+    refresh_tokens.expires_at > NOW() AND
+    refresh_tokens.revoked_at IS NULL AND
+    refresh_tokens.rotated_at IS NULL
+ORDER BY refresh_tokens.last_used_at DESC;
+
+-- name: RevokeSessionForUser :execrows
+UPDATE refresh_tokens
+SET
+    revoked_at = NOW(),
+    updated_at = NOW()
+WHERE
+    family_id = ?1 AND
+    user_id = ?2 AND
+    revoked_at IS NULL;
+
+-- name: RevokeAllSessionsForUser :exec
+UPDATE refresh_tokens
+SET
+    revoked_at = NOW(),
+    updated_at = NOW()
+WHERE
+    user_id = ?1 AND
+    revoked_at IS NULL;
+
+-- name: GetSessionHistoryForUser :many
+SELECT
+    family_id,
+    created_at,
+    last_used_at,
+    expires_at,
+    revoked_at,
+    device_name,
+    user_agent,
+    ip,
+    client_id
+FROM refresh_tokens
+WHERE user_id = ?1
+ORDER BY created_at;
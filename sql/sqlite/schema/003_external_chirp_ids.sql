@@ -0,0 +1,12 @@
+-- +goose Up
+CREATE TABLE external_chirp_ids (
+    source TEXT NOT NULL,
+    external_id TEXT NOT NULL,
+    chirp_id UUID NOT NULL
+        REFERENCES chirps(id)
+        ON DELETE CASCADE,
+    PRIMARY KEY (source, external_id)
+);
+
+-- +goose Down
+DROP TABLE external_chirp_ids;
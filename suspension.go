@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/drewheasman/chirpy/internal/audit"
+	"github.com/drewheasman/chirpy/internal/auth"
+	"github.com/drewheasman/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const errorCodeAccountSuspended = "account_suspended"
+
+// accountErrorResponse is an error about the state of the account rather
+// than the request, with a code clients can switch on.
+type accountErrorResponse struct {
+	Error  string `json:"error"`
+	Code   string `json:"code"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// respondAccountSuspended tells a suspended user why they can't log in.
+// Clients should show the reason rather than asking for the password again.
+func respondAccountSuspended(w http.ResponseWriter, reason string) {
+	noteResponseError(w, "account suspended")
+	respondWithJson(w, http.StatusForbidden, accountErrorResponse{
+		Error:  "account suspended",
+		Code:   errorCodeAccountSuspended,
+		Reason: reason,
+	})
+}
+
+// setShadowBanHandler hides or shows a user's chirps to everyone else. The
+// user isn't told, and can keep chirping as normal.
+func (cfg *apiConfig) setShadowBanHandler(w http.ResponseWriter, req *http.Request) {
+	type shadowBanRequest struct {
+		ShadowBanned *bool `json:"shadow_banned"`
+	}
+
+	decoder := json.NewDecoder(req.Body)
+	var decoded shadowBanRequest
+	if err := decoder.Decode(&decoded); err != nil || decoded.ShadowBanned == nil {
+		respondWithError(w, http.StatusBadRequest, "shadow_banned is required")
+		return
+	}
+
+	target, ok := cfg.manageableUser(w, req)
+	if !ok {
+		return
+	}
+
+	_, err := cfg.store.SetShadowBanned(req.Context(), database.SetShadowBannedParams{
+		ID:           target.ID,
+		ShadowBanned: *decoded.ShadowBanned,
+	})
+	if err != nil {
+		slog.ErrorContext(req.Context(), "error updating shadow ban", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "error updating shadow ban")
+		return
+	}
+
+	action := audit.ActionUserShadowBanLifted
+	if *decoded.ShadowBanned {
+		action = audit.ActionUserShadowBanned
+	}
+	cfg.recordAdminAction(req, action, target.ID, audit.Changed("shadow_banned", target.ShadowBanned, *decoded.ShadowBanned), nil)
+	slog.InfoContext(req.Context(), "shadow ban updated")
+
+	respondNoContent(w, http.StatusNoContent)
+}
+
+// viewerID is the user making an OptionalAuth request, if any, for showing
+// them their own shadow-banned chirps.
+func viewerID(req *http.Request) uuid.NullUUID {
+	caller, ok := auth.FromContext(req.Context())
+	if !ok {
+		return uuid.NullUUID{}
+	}
+	return uuid.NullUUID{UUID: caller.UserID, Valid: true}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/drewheasman/chirpy/internal/audit"
+	"github.com/drewheasman/chirpy/internal/auth"
+	"github.com/drewheasman/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+type PersonalAccessToken struct {
+	ID         uuid.UUID  `json:"id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	Token      string     `json:"token,omitempty"`
+}
+
+func nullTimePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+func (cfg *apiConfig) createTokenHandler(w http.ResponseWriter, req *http.Request) {
+	type createTokenRequest struct {
+		Name          string   `json:"name"`
+		Scopes        []string `json:"scopes"`
+		ExpiresInDays int      `json:"expires_in_days"`
+	}
+
+	userId := requestPrincipal(req).UserID
+
+	decoder := json.NewDecoder(req.Body)
+	var decoded createTokenRequest
+	if err := decoder.Decode(&decoded); err != nil || decoded.Name == "" || len(decoded.Scopes) == 0 || decoded.ExpiresInDays < 0 {
+		respondWithError(w, http.StatusBadRequest, "error unmarshalling request body")
+		return
+	}
+	for _, scope := range decoded.Scopes {
+		if !auth.ValidScope(scope) {
+			respondWithError(w, http.StatusBadRequest, "unknown scope "+scope)
+			return
+		}
+	}
+
+	var expiresAt sql.NullTime
+	if decoded.ExpiresInDays > 0 {
+		expiresAt = sql.NullTime{Time: time.Now().AddDate(0, 0, decoded.ExpiresInDays), Valid: true}
+	}
+
+	pat, err := auth.MakePersonalAccessToken()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "failed to make token")
+		return
+	}
+
+	tokenRecord, err := cfg.store.CreatePersonalAccessToken(req.Context(), database.CreatePersonalAccessTokenParams{
+		UserID:    userId,
+		Name:      decoded.Name,
+		TokenHash: auth.HashToken(pat),
+		Scopes:    decoded.Scopes,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		slog.ErrorContext(req.Context(), "failed to save token", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "failed to save token")
+		return
+	}
+
+	slog.InfoContext(req.Context(), "personal access token created")
+
+	respondWithJson(w, http.StatusCreated, PersonalAccessToken{
+		ID:         tokenRecord.ID,
+		Name:       tokenRecord.Name,
+		Scopes:     tokenRecord.Scopes,
+		CreatedAt:  tokenRecord.CreatedAt,
+		ExpiresAt:  nullTimePtr(tokenRecord.ExpiresAt),
+		LastUsedAt: nullTimePtr(tokenRecord.LastUsedAt),
+		Token:      pat,
+	})
+}
+
+func (cfg *apiConfig) getTokensHandler(w http.ResponseWriter, req *http.Request) {
+	userId := requestPrincipal(req).UserID
+
+	tokenRecords, err := cfg.store.GetPersonalAccessTokensForUser(req.Context(), userId)
+	if err != nil {
+		slog.ErrorContext(req.Context(), "error getting tokens", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "error getting tokens")
+		return
+	}
+
+	tokensResponse := []PersonalAccessToken{}
+	for _, t := range tokenRecords {
+		tokensResponse = append(tokensResponse, PersonalAccessToken{
+			ID:         t.ID,
+			Name:       t.Name,
+			Scopes:     t.Scopes,
+			CreatedAt:  t.CreatedAt,
+			ExpiresAt:  nullTimePtr(t.ExpiresAt),
+			LastUsedAt: nullTimePtr(t.LastUsedAt),
+		})
+	}
+
+	respondWithJson(w, http.StatusOK, tokensResponse)
+}
+
+func (cfg *apiConfig) deleteTokenHandler(w http.ResponseWriter, req *http.Request) {
+	id, err := uuid.Parse(req.PathValue("id"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "error parsing uuid from given id path param")
+		return
+	}
+
+	userId := requestPrincipal(req).UserID
+
+	deleted, err := cfg.store.DeletePersonalAccessToken(req.Context(), database.DeletePersonalAccessTokenParams{
+		ID:     id,
+		UserID: userId,
+	})
+	if err != nil {
+		slog.ErrorContext(req.Context(), "error deleting token", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Error deleting token")
+		return
+	}
+	if deleted == 0 {
+		respondWithError(w, http.StatusNotFound, "Token not found")
+		return
+	}
+
+	cfg.recordTokenRevoked(req.Context(), userId, audit.TargetPersonalAccessToken, id.String())
+	slog.InfoContext(req.Context(), "personal access token deleted")
+
+	respondNoContent(w, http.StatusNoContent)
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"context"
+
+	"github.com/drewheasman/chirpy/internal/auth"
+	"github.com/drewheasman/chirpy/internal/tracing"
+)
+
+// hashPassword is auth.HashPassword in a span of its own, since bcrypt is
+// deliberately one of the slowest things a request does.
+func hashPassword(ctx context.Context, password string) (string, error) {
+	_, span := tracing.Tracer().Start(ctx, "auth.HashPassword")
+	defer span.End()
+	return auth.HashPassword(password)
+}
+
+// checkPasswordHash is auth.CheckPasswordHash in a span of its own. A
+// mismatch is the expected outcome of a wrong password, so it isn't recorded
+// as a span error.
+func checkPasswordHash(ctx context.Context, password, hash string) error {
+	_, span := tracing.Tracer().Start(ctx, "auth.CheckPasswordHash")
+	defer span.End()
+	return auth.CheckPasswordHash(password, hash)
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/drewheasman/chirpy/internal/auth"
+	"github.com/drewheasman/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	totpIssuer            = "Chirpy"
+	recoveryCodeCount     = 10
+	twoFactorChallengeTTL = 5 * time.Minute
+)
+
+type twoFactorChallengeResponse struct {
+	TwoFactorRequired bool   `json:"two_factor_required"`
+	ChallengeToken    string `json:"challenge_token"`
+}
+
+// createTwoFactorChallenge stores a short-lived token that stands in for the
+// password until the second factor is supplied to /api/login/2fa.
+func (cfg *apiConfig) createTwoFactorChallenge(ctx context.Context, userID uuid.UUID) (string, error) {
+	challengeToken, err := auth.MakeRefreshToken()
+	if err != nil {
+		return "", err
+	}
+
+	err = cfg.store.CreateTwoFactorChallenge(ctx, database.CreateTwoFactorChallengeParams{
+		TokenHash: auth.HashToken(challengeToken),
+		UserID:    userID,
+		ExpiresAt: cfg.now().Add(twoFactorChallengeTTL),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return challengeToken, nil
+}
+
+// useTOTPCode reports whether code is the user's TOTP code for now and no code
+// from the same period or a later one has been accepted already. Accepting it
+// uses up its period, so an intercepted code can't be replayed while it is
+// still within the clock drift allowance.
+func (cfg *apiConfig) useTOTPCode(ctx context.Context, userRecord database.User, code string) (bool, error) {
+	if !userRecord.TotpSecret.Valid {
+		return false, nil
+	}
+	counter, ok := auth.ValidateTOTP(code, userRecord.TotpSecret.String, cfg.now())
+	if !ok {
+		return false, nil
+	}
+	used, err := cfg.store.UseTOTPCounter(ctx, database.UseTOTPCounterParams{
+		ID:              userRecord.ID,
+		TotpLastCounter: counter,
+	})
+	if err != nil {
+		return false, err
+	}
+	return used == 1, nil
+}
+
+func (cfg *apiConfig) setupTwoFactorHandler(w http.ResponseWriter, req *http.Request) {
+	id := requestPrincipal(req).UserID
+
+	userRecord, err := cfg.store.GetUser(req.Context(), id)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "user not found")
+		return
+	}
+	if userRecord.TotpEnabled {
+		respondWithError(w, http.StatusConflict, "two-factor authentication is already enabled")
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "failed to generate secret")
+		return
+	}
+
+	err = cfg.store.SetTOTPSecret(req.Context(), database.SetTOTPSecretParams{
+		ID:         id,
+		TotpSecret: sql.NullString{String: secret, Valid: true},
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "failed to save secret")
+		return
+	}
+
+	type setupResponse struct {
+		Secret     string `json:"secret"`
+		OtpauthURI string `json:"otpauth_uri"`
+	}
+
+	respondWithJson(w, http.StatusOK, setupResponse{
+		Secret:     secret,
+		OtpauthURI: auth.TOTPURI(secret, userRecord.Email, totpIssuer),
+	})
+}
+
+func (cfg *apiConfig) verifyTwoFactorHandler(w http.ResponseWriter, req *http.Request) {
+	type verifyRequest struct {
+		Code string `json:"code"`
+	}
+
+	id := requestPrincipal(req).UserID
+
+	decoder := json.NewDecoder(req.Body)
+	var decoded verifyRequest
+	if err := decoder.Decode(&decoded); err != nil || decoded.Code == "" {
+		respondWithError(w, http.StatusBadRequest, "error unmarshalling request body")
+		return
+	}
+
+	userRecord, err := cfg.store.GetUser(req.Context(), id)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "user not found")
+		return
+	}
+	if userRecord.TotpEnabled {
+		respondWithError(w, http.StatusConflict, "two-factor authentication is already enabled")
+		return
+	}
+	if !userRecord.TotpSecret.Valid {
+		respondWithError(w, http.StatusBadRequest, "two-factor setup has not been started")
+		return
+	}
+
+	valid, err := cfg.useTOTPCode(req.Context(), userRecord, decoded.Code)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "error checking code")
+		return
+	}
+	if !valid {
+		respondWithError(w, http.StatusUnauthorized, "invalid code")
+		return
+	}
+
+	recoveryCodes, err := auth.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "failed to generate recovery codes")
+		return
+	}
+	codeHashes := make([]string, 0, len(recoveryCodes))
+	for _, code := range recoveryCodes {
+		codeHashes = append(codeHashes, auth.HashToken(code))
+	}
+
+	if err := cfg.store.DeleteRecoveryCodes(req.Context(), id); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "failed to save recovery codes")
+		return
+	}
+	err = cfg.store.CreateRecoveryCodes(req.Context(), database.CreateRecoveryCodesParams{
+		UserID:     id,
+		CodeHashes: codeHashes,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "failed to save recovery codes")
+		return
+	}
+
+	if err := cfg.store.EnableTOTP(req.Context(), id); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "failed to enable two-factor authentication")
+		return
+	}
+
+	slog.InfoContext(req.Context(), "two-factor authentication enabled")
+
+	type verifyResponse struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+
+	respondWithJson(w, http.StatusOK, verifyResponse{RecoveryCodes: recoveryCodes})
+}
+
+func (cfg *apiConfig) disableTwoFactorHandler(w http.ResponseWriter, req *http.Request) {
+	type disableRequest struct {
+		Password string `json:"password"`
+	}
+
+	id := requestPrincipal(req).UserID
+
+	decoder := json.NewDecoder(req.Body)
+	var decoded disableRequest
+	if err := decoder.Decode(&decoded); err != nil || decoded.Password == "" {
+		respondWithError(w, http.StatusBadRequest, "error unmarshalling request body")
+		return
+	}
+
+	userRecord, err := cfg.store.GetUser(req.Context(), id)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "user not found")
+		return
+	}
+
+	if err := checkPasswordHash(req.Context(), decoded.Password, userRecord.HashedPassword); err != nil {
+		respondWithError(w, http.StatusUnauthorized, "incorrect password")
+		return
+	}
+
+	if err := cfg.store.DisableTOTP(req.Context(), id); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "failed to disable two-factor authentication")
+		return
+	}
+	if err := cfg.store.DeleteRecoveryCodes(req.Context(), id); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "failed to delete recovery codes")
+		return
+	}
+
+	slog.InfoContext(req.Context(), "two-factor authentication disabled")
+
+	respondNoContent(w, http.StatusNoContent)
+}
+
+func (cfg *apiConfig) loginTwoFactorHandler(w http.ResponseWriter, req *http.Request) {
+	type loginTwoFactorRequest struct {
+		ChallengeToken string `json:"challenge_token"`
+		Code           string `json:"code"`
+		RecoveryCode   string `json:"recovery_code"`
+		DeviceName     string `json:"device_name"`
+	}
+
+	decoder := json.NewDecoder(req.Body)
+	var decoded loginTwoFactorRequest
+	if err := decoder.Decode(&decoded); err != nil || decoded.ChallengeToken == "" || (decoded.Code == "" && decoded.RecoveryCode == "") {
+		respondWithError(w, http.StatusBadRequest, "error unmarshalling request body")
+		return
+	}
+
+	challengeHash := auth.HashToken(decoded.ChallengeToken)
+	userId, err := cfg.store.GetUserFromTwoFactorChallenge(req.Context(), database.GetUserFromTwoFactorChallengeParams{
+		TokenHash: challengeHash,
+		ExpiresAt: cfg.now(),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "invalid or expired challenge token")
+		return
+	}
+
+	userRecord, err := cfg.store.GetUser(req.Context(), userId)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "invalid or expired challenge token")
+		return
+	}
+
+	attempt, wait, err := cfg.reserveLoginAttempt(req.Context(), userRecord.Email, clientIP(req))
+	if err != nil {
+		slog.ErrorContext(req.Context(), "error checking login attempts", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "error checking login attempts")
+		return
+	}
+	if attempt == nil {
+		respondTooManyAttempts(w, wait)
+		return
+	}
+	defer attempt.release(context.WithoutCancel(req.Context()))
+
+	valid := false
+	if decoded.Code != "" {
+		valid, err = cfg.useTOTPCode(req.Context(), userRecord, decoded.Code)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "error checking code")
+			return
+		}
+	} else {
+		used, err := cfg.store.UseRecoveryCode(req.Context(), database.UseRecoveryCodeParams{
+			UserID:   userId,
+			CodeHash: auth.HashToken(auth.NormalizeRecoveryCode(decoded.RecoveryCode)),
+		})
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "error checking recovery code")
+			return
+		}
+		valid = used == 1
+	}
+
+	if !valid {
+		attempt.fail(req.Context())
+		cfg.recordFailedLogin(req.Context(), userRecord.Email, uuid.NullUUID{UUID: userRecord.ID, Valid: true}, loginMethodTwoFactor)
+		respondWithError(w, http.StatusUnauthorized, "invalid code")
+		return
+	}
+
+	if err := cfg.store.DeleteTwoFactorChallenge(req.Context(), challengeHash); err != nil {
+		slog.ErrorContext(req.Context(), "error deleting two-factor challenge", "error", err)
+	}
+	if userRecord.SuspendedAt.Valid {
+		respondAccountSuspended(w, userRecord.SuspensionReason.String)
+		return
+	}
+	attempt.succeed(req.Context())
+	cfg.recordLogin(req.Context(), userRecord.ID, loginMethodTwoFactor)
+
+	cfg.cancelAccountDeletion(req.Context(), userRecord)
+
+	if userRecord.PasswordResetRequired {
+		cfg.respondPasswordResetRequired(w, req.Context(), userRecord.ID)
+		return
+	}
+
+	usersResponse, err := cfg.issueLoginTokens(req.Context(), userRecord, sessionMetadataFromRequest(req, decoded.DeviceName))
+	if err != nil {
+		slog.ErrorContext(req.Context(), "failed to issue tokens", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to issue tokens")
+		return
+	}
+
+	slog.InfoContext(req.Context(), "user logged in with two-factor authentication")
+
+	respondWithJson(w, http.StatusOK, usersResponse)
+}